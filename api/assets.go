@@ -0,0 +1,34 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// Asset limits, uploads above `AssetMaxSize` are rejected & a step's attachments (plus inline images) stay within `StepAssetsMaxSize`
+const (
+	AssetMaxSize      = 5 << 20
+	StepAssetsMaxSize = 10 << 20
+)
+
+// AssetTypes accepted for upload, sniffed from the content (the request's `Content-Type` isn't trusted)
+var AssetTypes = []string{"application/pdf", "image/gif", "image/jpeg", "image/png"}
+
+// AssetImageTypes may be inlined into an email's content
+var AssetImageTypes = []string{"image/gif", "image/jpeg", "image/png"}
+
+// Asset is an uploaded file, attached to email steps (`SequenceStep.Attachments`) or inlined into their content
+// with `<img src="cid:asset-<ID>">`. The content is kept in the asset store, under `Key`
+type Asset struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `valid:"required,maxstringlength(100)"` // file name of the attachment
+	ContentType string
+	Size        int64
+	Key         string `json:"-"`
+	CreatedAt   time.Time
+}
+
+// ContentID of the asset's MIME part, `cid:<ContentID>` references it from the HTML content
+func (a *Asset) ContentID() string {
+	return fmt.Sprintf("asset-%d", a.ID)
+}
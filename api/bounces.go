@@ -0,0 +1,45 @@
+package api
+
+import "time"
+
+// Bounce event types & bounce classifications
+const (
+	BounceTypeBounce    = "bounce"
+	BounceTypeComplaint = "complaint"
+
+	BounceHard = "hard" // permanent failure (5.x.x), the address gets suppressed
+	BounceSoft = "soft" // temporary failure (4.x.x), e.g. full mailbox
+)
+
+// InboundBounce is the normalized form of a bounce or complaint, parsed from DSN (RFC 3464) & ARF (RFC 5965)
+// reports or posted as is. `Classification` is derived from the DSN `Status` when omitted
+type InboundBounce struct {
+	Type           string `valid:"in(bounce|complaint),required"`
+	Email          string `valid:"email,required"`
+	MessageID      string // of the bounced email, angle brackets are optional
+	Classification string `valid:"in(hard|soft)"`
+	Status         string // DSN status code, e.g. 5.1.1
+	Diagnostic     string
+}
+
+type InboundBouncesRequest struct {
+	Events []InboundBounce
+}
+
+// BounceEvent is a processed bounce or complaint, matched to the email it was about when possible
+// (`EnrollmentID`, `SequenceID` & `StepID` are 0 otherwise)
+type BounceEvent struct {
+	ID             uint   `gorm:"primaryKey"`
+	Workspace      string `gorm:"index" json:"-"`
+	Type           string `gorm:"index"`
+	Classification string `json:",omitempty"`
+	Email          string
+	MessageID      string `json:",omitempty"`
+	Status         string `json:",omitempty"`
+	Diagnostic     string `json:",omitempty"`
+	ContactID      uint
+	EnrollmentID   uint
+	SequenceID     uint `gorm:"index"`
+	StepID         uint
+	CreatedAt      time.Time
+}
@@ -0,0 +1,86 @@
+package api
+
+import "time"
+
+// DefaultWorkspace is used for API keys created without a workspace & for anonymous requests
+const DefaultWorkspace = "default"
+
+// Contact statuses, set by bounce & complaint processing
+const (
+	ContactActive     = "active"
+	ContactBounced    = "bounced" // hard bounce, the address doesn't exist (anymore)
+	ContactComplained = "complained"
+)
+
+// AttributePrefix names a custom attribute of contacts (in segment rules & import mappings), e.g. `attributes.company`
+const AttributePrefix = "attributes."
+
+// Contact `Email` is unique per workspace
+type Contact struct {
+	ID         uint   `gorm:"primaryKey"`
+	Workspace  string `gorm:"uniqueIndex:idx_contacts_workspace_email" json:"-"`
+	Email      string `valid:"email,required" gorm:"uniqueIndex:idx_contacts_workspace_email"`
+	FirstName  string
+	LastName   string
+	TimeZone   string            // IANA name, e.g. America/New_York (the sequence's schedule time zone when empty)
+	Tags       []string          `gorm:"serializer:json"`                   // stored lowercase, segments filter on them
+	Attributes map[string]string `gorm:"serializer:json" json:",omitempty"` // custom ones, names are stored lowercase
+	Status     string            `gorm:"not null;default:active"`
+	CreatedAt  time.Time
+}
+
+// Enrollment statuses, only `active` enrollments get emails
+const (
+	EnrollmentActive       = "active"
+	EnrollmentCompleted    = "completed"    // all steps were sent
+	EnrollmentUnsubscribed = "unsubscribed" // through the unsubscribe link of one of its emails
+	EnrollmentSuppressed   = "suppressed"   // contact is on the suppression list of its workspace
+	EnrollmentBounced      = "bounced"      // hard bounce of one of its emails
+	EnrollmentComplained   = "complained"   // spam complaint about one of its emails
+	EnrollmentReplied      = "replied"      // the contact answered one of its emails
+	EnrollmentPaused       = "paused"       // held via `POST /sequences/:id/enrollments/:enrollmentID/pause` until resumed
+	EnrollmentStopped      = "stopped"      // via `POST /sequences/:id/enrollments/:enrollmentID/stop`
+)
+
+// Enrollment is a contact going through a sequence, one step after another
+// `NextStep` is the index (in sending order) of the step to be sent at `NextSendAt`,
+// for sequences with edges it's the number of sent steps & `NextSendAt` is when the edges of `CurrentStepID` are due
+// `NextSendAt` is nil while an active enrollment waits for its manual task
+type Enrollment struct {
+	ID            uint   `gorm:"primaryKey"`
+	SequenceID    uint   `gorm:"uniqueIndex:idx_enrollments_sequence_contact"`
+	ContactID     uint   `gorm:"uniqueIndex:idx_enrollments_sequence_contact"`
+	Status        string `gorm:"index"`
+	NextStep      uint
+	NextSendAt    *time.Time `gorm:"index"`
+	MailboxID     uint       `json:",omitempty"` // picked for the first step, every follow-up comes from the same mailbox
+	CurrentStepID uint       `json:",omitempty"` // last sent (or done) step, sequences with edges continue from it
+	CurrentStepAt *time.Time `json:",omitempty"` // when `CurrentStepID` was sent (or done)
+	LastError     string     `json:",omitempty"` // of the last failed send attempt
+	PausedAt      *time.Time `json:",omitempty"` // while paused
+	ThreadID      string     `json:",omitempty"` // `Message-ID` of the first email, follow-ups reply to it
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type EnrollmentRequest struct {
+	ContactID uint `valid:"required"`
+}
+
+// EmailSend is recorded for every email handed over to the sender
+type EmailSend struct {
+	ID           uint `gorm:"primaryKey"`
+	EnrollmentID uint `gorm:"index"`
+	SequenceID   uint `gorm:"index"`
+	StepID       uint
+	ContactID    uint
+	MailboxID    uint   `json:",omitempty"`
+	VariantID    uint   `json:",omitempty" gorm:"index"` // A/B variant of the step, if any
+	MessageID    string `gorm:"uniqueIndex"`             // `Message-ID` header, without angle brackets
+	TrackingID   string `gorm:"index" json:"-"`          // identifies the email in open & click tracking URLs
+	ToEmail      string
+	Subject      string
+	SentAt       time.Time
+	OpenedAt     *time.Time `json:",omitempty"` // first open (tracking pixel loaded)
+	ClickedAt    *time.Time `json:",omitempty"` // first click on a tracked link
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// AssetController manages the files email steps attach or inline
+type AssetController struct {
+	service      service.AssetService
+	auditService service.AuditService
+}
+
+func NewAssetController(db *gorm.DB) *AssetController {
+	return &AssetController{
+		service:      service.AssetService{Db: db, Store: service.LocalAssetStore{}},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+func (ac *AssetController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, ac.service.List())
+}
+
+// Upload stores the raw body as asset named `?name=`, its type is sniffed from the content
+func (ac *AssetController) Upload(ctx *gin.Context) {
+	asset := api.Asset{Name: ctx.Query("name")}
+	if _, err := govalidator.ValidateStruct(&asset); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	// known to be too large without reading it
+	if ctx.Request.ContentLength > api.AssetMaxSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, api.ErrorResponse{Error: fmt.Sprintf("Asset exceeds %d bytes.", api.AssetMaxSize)})
+		return
+	}
+
+	err := ac.auditService.Transaction(func(tx *gorm.DB) error {
+		assetService := ac.service
+		assetService.Db = tx
+		if err := assetService.Create(&asset, ctx.Request.Body); err != nil {
+			return err
+		}
+		return ac.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntityAsset, asset.ID, nil, &asset))
+	})
+	switch {
+	case errors.Is(err, service.ErrAssetTooLarge):
+		ctx.JSON(http.StatusRequestEntityTooLarge, api.ErrorResponse{Error: fmt.Sprintf("Asset exceeds %d bytes.", api.AssetMaxSize)})
+		return
+	case errors.Is(err, service.ErrAssetType):
+		ctx.JSON(http.StatusUnsupportedMediaType, api.ErrorResponse{Error: fmt.Sprintf("Asset is %s, must be one of %s.", asset.ContentType, strings.Join(api.AssetTypes, ", "))})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusCreated, &asset)
+}
+
+func (ac *AssetController) View(ctx *gin.Context) {
+	if foundAsset := ac.findAsset(ctx); foundAsset != nil {
+		ctx.JSON(http.StatusOK, foundAsset)
+	}
+}
+
+// Content responds with the file as uploaded
+func (ac *AssetController) Content(ctx *gin.Context) {
+	foundAsset := ac.findAsset(ctx)
+	if foundAsset == nil {
+		return
+	}
+	content, err := ac.service.Read(foundAsset)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": foundAsset.Name}))
+	ctx.Data(http.StatusOK, foundAsset.ContentType, content)
+}
+
+// Delete assets still attached or inlined by a step are kept
+func (ac *AssetController) Delete(ctx *gin.Context) {
+	foundAsset := ac.findAsset(ctx)
+	if foundAsset == nil {
+		return
+	}
+	if ac.service.InUse(foundAsset) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Asset is used by a step."})
+		return
+	}
+
+	// recorded first, the content is gone once deleted
+	audited(ctx, &ac.auditService, func(tx *gorm.DB) error {
+		if err := ac.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionDelete, api.AuditEntityAsset, foundAsset.ID, foundAsset, nil)); err != nil {
+			return err
+		}
+		assetService := ac.service
+		assetService.Db = tx
+		return assetService.Delete(foundAsset)
+	})
+}
+
+// findAsset responds with an error (& returns nil) when the `id` param is invalid or unknown
+func (ac *AssetController) findAsset(ctx *gin.Context) *api.Asset {
+	assetID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundAsset := ac.service.GetByID(uint(assetID))
+	if foundAsset.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Asset not found."})
+		return nil
+	}
+	return foundAsset
+}
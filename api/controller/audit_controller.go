@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+type AuditController struct {
+	service service.AuditService
+}
+
+func NewAuditController(db *gorm.DB) *AuditController {
+	return &AuditController{
+		service: service.AuditService{Db: db},
+	}
+}
+
+// List supports `entity`, `entity_id`, `from` & `to` (RFC 3339) query params
+func (ac *AuditController) List(ctx *gin.Context) {
+	var filter service.AuditFilter
+	filter.Entity = ctx.Query("entity")
+
+	if entityIDStr := ctx.Query("entity_id"); entityIDStr != "" {
+		entityID, err := api.StrToUint(entityIDStr)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+		filter.EntityID = uint(entityID)
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(ctx, "from"); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if filter.To, err = parseTimeQuery(ctx, "to"); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ac.service.List(filter))
+}
+
+func parseTimeQuery(ctx *gin.Context, key string) (time.Time, error) {
+	value := ctx.Query(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// newAuditRecord pass `nil` for missing before/after state (e.g. `before` on create)
+func newAuditRecord(ctx *gin.Context, action string, entity string, entityID uint, before any, after any) *api.AuditRecord {
+	return &api.AuditRecord{
+		Actor:     middleware.GetActor(ctx),
+		Entity:    entity,
+		EntityID:  entityID,
+		Action:    action,
+		Before:    api.ToJSON(before),
+		After:     api.ToJSON(after),
+		RequestID: middleware.GetRequestID(ctx),
+	}
+}
+
+// newCaller identifies the caller of `service.Operations` (recorded in audit log)
+func newCaller(ctx *gin.Context) service.Caller {
+	return service.Caller{Actor: middleware.GetActor(ctx), Workspace: middleware.GetWorkspace(ctx), RequestID: middleware.GetRequestID(ctx)}
+}
+
+// respondWithOperationError responds with the status of `service.OperationError`s, 500 for other errors
+func respondWithOperationError(ctx *gin.Context, err error) {
+	var operationErr *service.OperationError
+	if errors.As(err, &operationErr) {
+		ctx.JSON(operationErr.Code, api.ErrorResponse{Error: operationErr.Message})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+}
+
+// audited runs `mutate`, which records its audit records within `tx`, in a single transaction
+// Responds with 500 (& returns false) when the transaction fails, nothing was changed then
+func audited(ctx *gin.Context, auditService *service.AuditService, mutate func(tx *gorm.DB) error) bool {
+	if err := auditService.Transaction(mutate); err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	return true
+}
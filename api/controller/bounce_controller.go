@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type BounceController struct {
+	service service.BounceService
+}
+
+func NewBounceController(db *gorm.DB) *BounceController {
+	return &BounceController{
+		service: service.BounceService{Db: db},
+	}
+}
+
+// List bounces & complaints of the workspace (newest first), filterable by `type`
+func (bc *BounceController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, bc.service.List(middleware.GetWorkspace(ctx), ctx.Query("type")))
+}
+
+// Receive accepts normalized JSON events (`InboundBouncesRequest`) or a raw DSN/ARF message (any other content type),
+// e.g. piped from the bounce mailbox. Nothing is recorded when any of the events is invalid
+func (bc *BounceController) Receive(ctx *gin.Context) {
+	var bounces []api.InboundBounce
+	if ctx.ContentType() == "application/json" {
+		var request api.InboundBouncesRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+		bounces = request.Events
+	} else {
+		var err error
+		if bounces, err = service.ParseBounceMessage(ctx.Request.Body); err != nil {
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if len(bounces) == 0 {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "No bounces or complaints provided."})
+		return
+	}
+	for i := range bounces {
+		if err := service.ValidateBounce(&bounces[i]); err != nil {
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	workspace := middleware.GetWorkspace(ctx)
+	events := make([]api.BounceEvent, len(bounces))
+	for i, bounce := range bounces {
+		event, err := bc.service.Process(workspace, bounce)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+		events[i] = *event
+	}
+	ctx.JSON(http.StatusCreated, events)
+}
@@ -0,0 +1,367 @@
+package controller
+
+import (
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+// ContactController contacts belong to the workspace of the caller's API key
+type ContactController struct {
+	service           service.ContactService
+	sequenceService   service.SequenceService
+	enrollmentService service.EnrollmentService
+	autoEnrollService service.AutoEnrollService
+	importService     service.ContactImportService
+	auditService      service.AuditService
+}
+
+func NewContactController(db *gorm.DB) *ContactController {
+	return &ContactController{
+		service:           service.ContactService{Db: db},
+		sequenceService:   service.SequenceService{Db: db},
+		enrollmentService: service.EnrollmentService{Db: db},
+		autoEnrollService: service.AutoEnrollService{Db: db},
+		importService:     service.ContactImportService{Db: db},
+		auditService:      service.AuditService{Db: db},
+	}
+}
+
+func (cc *ContactController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, cc.service.List(middleware.GetWorkspace(ctx)))
+}
+
+func (cc *ContactController) Create(ctx *gin.Context) {
+	var contact api.Contact
+	if err := ctx.BindJSON(&contact); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !cc.validateContact(ctx, &contact, 0) {
+		return
+	}
+
+	contact.ID = 0
+	if !audited(ctx, &cc.auditService, func(tx *gorm.DB) error {
+		(&service.ContactService{Db: tx}).Create(middleware.GetWorkspace(ctx), &contact)
+		return cc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntityContact, contact.ID, nil, &contact))
+	}) {
+		return
+	}
+	cc.autoEnrollService.ContactChanged(&contact, time.Now().UTC())
+	ctx.JSON(http.StatusCreated, &contact)
+}
+
+// Update contacts entering a segment get enrolled in the sequences auto-enrolling from it
+func (cc *ContactController) Update(ctx *gin.Context) {
+	foundContact := cc.findContact(ctx, ctx.Param("id"))
+	if foundContact == nil {
+		return
+	}
+
+	var contact api.Contact
+	if err := ctx.BindJSON(&contact); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !cc.validateContact(ctx, &contact, foundContact.ID) {
+		return
+	}
+
+	before := *foundContact
+	if !audited(ctx, &cc.auditService, func(tx *gorm.DB) error {
+		(&service.ContactService{Db: tx}).Update(foundContact, contact)
+		return cc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntityContact, foundContact.ID, &before, foundContact))
+	}) {
+		return
+	}
+	cc.autoEnrollService.ContactChanged(foundContact, time.Now().UTC())
+	ctx.JSON(http.StatusOK, foundContact)
+}
+
+// validateContact responds with an error (& returns false) when the contact is invalid, `id` is the contact being updated (0 on create)
+func (cc *ContactController) validateContact(ctx *gin.Context, contact *api.Contact, id uint) bool {
+	if _, err := govalidator.ValidateStruct(contact); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if _, err := time.LoadLocation(contact.TimeZone); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "TimeZone: " + err.Error()})
+		return false
+	}
+	if !cc.service.EmailAvailable(middleware.GetWorkspace(ctx), contact.Email, id) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Email already taken."})
+		return false
+	}
+	return true
+}
+
+func (cc *ContactController) View(ctx *gin.Context) {
+	foundContact := cc.findContact(ctx, ctx.Param("id"))
+	if foundContact == nil {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundContact)
+}
+
+// Delete removes the contact along with its enrollments
+func (cc *ContactController) Delete(ctx *gin.Context) {
+	foundContact := cc.findContact(ctx, ctx.Param("id"))
+	if foundContact == nil {
+		return
+	}
+
+	audited(ctx, &cc.auditService, func(tx *gorm.DB) error {
+		if err := (&service.ContactService{Db: tx}).Delete(foundContact); err != nil {
+			return err
+		}
+		return cc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionDelete, api.AuditEntityContact, foundContact.ID, foundContact, nil))
+	})
+}
+
+// Enrollments lists the enrollments of a sequence
+func (cc *ContactController) Enrollments(ctx *gin.Context) {
+	foundSequence := cc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+	ctx.JSON(http.StatusOK, cc.enrollmentService.ListBySequenceID(foundSequence.ID))
+}
+
+// Enroll starts sending the steps of a sequence to a contact of the caller's workspace
+func (cc *ContactController) Enroll(ctx *gin.Context) {
+	foundSequence := cc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+	if foundSequence.Status == api.SequenceArchived {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Sequence is archived."})
+		return
+	}
+
+	var enrollmentRequest api.EnrollmentRequest
+	if err := ctx.BindJSON(&enrollmentRequest); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if _, err := govalidator.ValidateStruct(&enrollmentRequest); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	foundContact := cc.service.GetByID(middleware.GetWorkspace(ctx), enrollmentRequest.ContactID)
+	if foundContact.ID == 0 {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Contact not found."})
+		return
+	}
+	// completed enrollments may start over, depending on the sequence's re-enrollment policy
+	if foundEnrollment := cc.enrollmentService.GetByContact(foundSequence.ID, foundContact.ID); foundEnrollment.ID != 0 {
+		if !service.Reenrollable(foundSequence, foundEnrollment, time.Now().UTC()) {
+			ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Contact already enrolled."})
+			return
+		}
+		before := *foundEnrollment
+		if !audited(ctx, &cc.auditService, func(tx *gorm.DB) error {
+			(&service.EnrollmentService{Db: tx}).Restart(foundEnrollment)
+			return cc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntityEnrollment, foundEnrollment.ID, &before, foundEnrollment))
+		}) {
+			return
+		}
+		ctx.JSON(http.StatusCreated, foundEnrollment)
+		return
+	}
+
+	enrollment := api.Enrollment{SequenceID: foundSequence.ID, ContactID: foundContact.ID}
+	if !audited(ctx, &cc.auditService, func(tx *gorm.DB) error {
+		(&service.EnrollmentService{Db: tx}).Create(&enrollment)
+		return cc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntityEnrollment, enrollment.ID, nil, &enrollment))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusCreated, &enrollment)
+}
+
+// BulkEnroll queues a `bulk_enroll` job enrolling contacts of the caller's workspace, the job is polled for the result
+func (cc *ContactController) BulkEnroll(ctx *gin.Context) {
+	foundSequence := cc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+	if foundSequence.Status == api.SequenceArchived {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Sequence is archived."})
+		return
+	}
+
+	var bulkEnrollment api.BulkEnrollmentRequest
+	if err := ctx.BindJSON(&bulkEnrollment); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if _, err := govalidator.ValidateStruct(&bulkEnrollment); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	payload := api.BulkEnrollJob{SequenceID: foundSequence.ID, ContactIDs: bulkEnrollment.ContactIDs}
+	var job *api.Job
+	if !audited(ctx, &cc.auditService, func(tx *gorm.DB) error {
+		var err error
+		if job, err = (&service.JobService{Db: tx}).Enqueue(middleware.GetWorkspace(ctx), api.JobTypeBulkEnroll, payload); err != nil {
+			return err
+		}
+		return cc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntityJob, job.ID, nil, job))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+// PauseEnrollment holds the steps of an active enrollment until it's resumed
+func (cc *ContactController) PauseEnrollment(ctx *gin.Context) {
+	cc.changeEnrollment(ctx, (*service.EnrollmentService).Pause, "Enrollment is not active.")
+}
+
+// ResumeEnrollment continues a paused enrollment, its next step is due as much later as it was paused
+func (cc *ContactController) ResumeEnrollment(ctx *gin.Context) {
+	cc.changeEnrollment(ctx, (*service.EnrollmentService).Resume, "Enrollment is not paused.")
+}
+
+// StopEnrollment ends an active (or paused) enrollment for good, its open tasks are skipped
+func (cc *ContactController) StopEnrollment(ctx *gin.Context) {
+	cc.changeEnrollment(ctx, func(enrollments *service.EnrollmentService, enrollment *api.Enrollment, _ time.Time) bool {
+		return enrollments.Stop(enrollment, api.EnrollmentStopped)
+	}, "Enrollment already finished.")
+}
+
+// changeEnrollment applies `change` to `:enrollmentID`, responds with 409 & `msg` when it doesn't apply to its status
+func (cc *ContactController) changeEnrollment(ctx *gin.Context, change func(*service.EnrollmentService, *api.Enrollment, time.Time) bool, msg string) {
+	foundEnrollment := cc.findEnrollment(ctx)
+	if foundEnrollment == nil {
+		return
+	}
+
+	before := *foundEnrollment
+	changed := false
+	if !audited(ctx, &cc.auditService, func(tx *gorm.DB) error {
+		if changed = change(&service.EnrollmentService{Db: tx}, foundEnrollment, time.Now().UTC()); !changed {
+			return nil
+		}
+		return cc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntityEnrollment, foundEnrollment.ID, &before, foundEnrollment))
+	}) {
+		return
+	}
+	if !changed {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: msg})
+		return
+	}
+	ctx.JSON(http.StatusOK, foundEnrollment)
+}
+
+// Import spools a CSV body (with header line) to be imported by a background job, the import is polled for its progress
+// Query: `map[<column>]=<field>` (repeated), `existing=skip|update`, `sequence_id` to enroll the imported contacts
+func (cc *ContactController) Import(ctx *gin.Context) {
+	contactImport := api.ContactImport{Mapping: ctx.QueryMap("map"), Existing: ctx.Query("existing")}
+	if err := service.ValidateImport(&contactImport); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if sequenceIDStr := ctx.Query("sequence_id"); sequenceIDStr != "" {
+		sequenceID, err := api.StrToUint(sequenceIDStr)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+			return
+		}
+		if cc.sequenceService.GetByID(uint(sequenceID)).ID == 0 {
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Sequence not found."})
+			return
+		}
+		if cc.sequenceService.GetByID(uint(sequenceID)).Status == api.SequenceArchived {
+			ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Sequence is archived."})
+			return
+		}
+		contactImport.SequenceID = uint(sequenceID)
+	}
+
+	if !audited(ctx, &cc.auditService, func(tx *gorm.DB) error {
+		if err := (&service.ContactImportService{Db: tx}).Create(middleware.GetWorkspace(ctx), &contactImport, ctx.Request.Body); err != nil {
+			return err
+		}
+		return cc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntityContactImport, contactImport.ID, nil, &contactImport))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusAccepted, &contactImport)
+}
+
+func (cc *ContactController) ViewImport(ctx *gin.Context) {
+	importID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	foundImport := cc.importService.GetByID(middleware.GetWorkspace(ctx), uint(importID))
+	if foundImport.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Import not found."})
+		return
+	}
+	ctx.JSON(http.StatusOK, foundImport)
+}
+
+// findContact responds with an error (& returns nil) when `idStr` is invalid or unknown (within the workspace)
+func (cc *ContactController) findContact(ctx *gin.Context, idStr string) *api.Contact {
+	contactID, err := api.StrToUint(idStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundContact := cc.service.GetByID(middleware.GetWorkspace(ctx), uint(contactID))
+	if foundContact.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Contact not found."})
+		return nil
+	}
+	return foundContact
+}
+
+// findEnrollment responds with an error (& returns nil) when `:enrollmentID` is invalid or unknown
+// (within the sequence `:id` & the workspace)
+func (cc *ContactController) findEnrollment(ctx *gin.Context) *api.Enrollment {
+	foundSequence := cc.findSequence(ctx)
+	if foundSequence == nil {
+		return nil
+	}
+	enrollmentID, err := api.StrToUint(ctx.Param("enrollmentID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundEnrollment := cc.enrollmentService.GetByID(uint(enrollmentID))
+	if foundEnrollment.ID == 0 || foundEnrollment.SequenceID != foundSequence.ID ||
+		cc.service.GetByID(middleware.GetWorkspace(ctx), foundEnrollment.ContactID).ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Enrollment not found."})
+		return nil
+	}
+	return foundEnrollment
+}
+
+func (cc *ContactController) findSequence(ctx *gin.Context) *api.Sequence {
+	sequenceID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundSequence := cc.sequenceService.GetByID(uint(sequenceID))
+	if foundSequence.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Sequence not found."})
+		return nil
+	}
+	return foundSequence
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/graphqlapi"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type GraphQLController struct {
+	schema *graphqlapi.Schema
+}
+
+func NewGraphQLController(db *gorm.DB) *GraphQLController {
+	return &GraphQLController{
+		schema: graphqlapi.NewSchema(db),
+	}
+}
+
+// Execute query & resolver errors are reported in `errors` of a 200 response (as per GraphQL over HTTP)
+func (gc *GraphQLController) Execute(ctx *gin.Context) {
+	var request api.GraphQLRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if _, err := govalidator.ValidateStruct(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gc.schema.Execute(ctx.Request.Context(), newCaller(ctx), request))
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type HolidayCalendarController struct {
+	service      service.ScheduleService
+	auditService service.AuditService
+}
+
+func NewHolidayCalendarController(db *gorm.DB) *HolidayCalendarController {
+	return &HolidayCalendarController{
+		service:      service.ScheduleService{Db: db},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+func (hcc *HolidayCalendarController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, hcc.service.ListCalendars())
+}
+
+func (hcc *HolidayCalendarController) Create(ctx *gin.Context) {
+	var calendar api.HolidayCalendar
+	if !hcc.bindCalendar(ctx, &calendar, 0) {
+		return
+	}
+
+	calendar.ID = 0
+	if !audited(ctx, &hcc.auditService, func(tx *gorm.DB) error {
+		(&service.ScheduleService{Db: tx}).CreateCalendar(&calendar)
+		return hcc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntityHolidayCalendar, calendar.ID, nil, &calendar))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusCreated, &calendar)
+}
+
+func (hcc *HolidayCalendarController) View(ctx *gin.Context) {
+	foundCalendar := hcc.findCalendar(ctx)
+	if foundCalendar == nil {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundCalendar)
+}
+
+// Update replaces name & dates, sequences using the calendar pick up the new dates right away
+// (rejected when they would leave a schedule without any send day)
+func (hcc *HolidayCalendarController) Update(ctx *gin.Context) {
+	foundCalendar := hcc.findCalendar(ctx)
+	if foundCalendar == nil {
+		return
+	}
+
+	var calendar api.HolidayCalendar
+	if !hcc.bindCalendar(ctx, &calendar, foundCalendar.ID) {
+		return
+	}
+	if err := hcc.service.ValidateCalendarUpdate(foundCalendar.ID, calendar); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	before := *foundCalendar
+	if !audited(ctx, &hcc.auditService, func(tx *gorm.DB) error {
+		(&service.ScheduleService{Db: tx}).UpdateCalendar(foundCalendar, calendar)
+		return hcc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntityHolidayCalendar, foundCalendar.ID, &before, foundCalendar))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundCalendar)
+}
+
+func (hcc *HolidayCalendarController) Delete(ctx *gin.Context) {
+	foundCalendar := hcc.findCalendar(ctx)
+	if foundCalendar == nil {
+		return
+	}
+	if hcc.service.CalendarInUse(foundCalendar.ID) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Calendar is used by a sequence schedule."})
+		return
+	}
+
+	audited(ctx, &hcc.auditService, func(tx *gorm.DB) error {
+		(&service.ScheduleService{Db: tx}).DeleteCalendar(foundCalendar)
+		return hcc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionDelete, api.AuditEntityHolidayCalendar, foundCalendar.ID, foundCalendar, nil))
+	})
+}
+
+// bindCalendar responds with an error (& returns false) for invalid bodies & names taken by other calendars
+func (hcc *HolidayCalendarController) bindCalendar(ctx *gin.Context, calendar *api.HolidayCalendar, id uint) bool {
+	if err := ctx.BindJSON(calendar); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if err := service.ValidateCalendar(calendar); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if !hcc.service.CalendarNameAvailable(calendar.Name, id) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Name already taken."})
+		return false
+	}
+	return true
+}
+
+// findCalendar responds with an error (& returns nil) when `:id` is invalid or unknown
+func (hcc *HolidayCalendarController) findCalendar(ctx *gin.Context) *api.HolidayCalendar {
+	calendarID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundCalendar := hcc.service.GetCalendarByID(uint(calendarID))
+	if foundCalendar.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Calendar not found."})
+		return nil
+	}
+	return foundCalendar
+}
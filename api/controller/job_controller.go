@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// JobController background jobs of the workspace of the caller's API key, queued by other endpoints (e.g. imports)
+type JobController struct {
+	service      service.JobService
+	auditService service.AuditService
+}
+
+func NewJobController(db *gorm.DB) *JobController {
+	return &JobController{
+		service:      service.JobService{Db: db},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+// List jobs, latest first, optionally with `status` (e.g. `dead` ones)
+func (jc *JobController) List(ctx *gin.Context) {
+	status := ctx.Query("status")
+	if status != "" && !slices.Contains(api.JobStatuses, status) {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: fmt.Sprintf("status: must be one of %s", strings.Join(api.JobStatuses, ", "))})
+		return
+	}
+	ctx.JSON(http.StatusOK, jc.service.List(middleware.GetWorkspace(ctx), status))
+}
+
+func (jc *JobController) View(ctx *gin.Context) {
+	if foundJob := jc.findJob(ctx); foundJob != nil {
+		ctx.JSON(http.StatusOK, foundJob)
+	}
+}
+
+// Cancel a pending or running job, a running job stops once its worker notices
+func (jc *JobController) Cancel(ctx *gin.Context) {
+	foundJob := jc.findJob(ctx)
+	if foundJob == nil {
+		return
+	}
+
+	before := *foundJob
+	changed := false
+	if !audited(ctx, &jc.auditService, func(tx *gorm.DB) error {
+		if changed = (&service.JobService{Db: tx}).Cancel(foundJob); !changed {
+			return nil
+		}
+		return jc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntityJob, foundJob.ID, &before, foundJob))
+	}) {
+		return
+	}
+	if !changed {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Job already finished."})
+		return
+	}
+	ctx.JSON(http.StatusOK, foundJob)
+}
+
+// Retry queues a dead or canceled job again
+func (jc *JobController) Retry(ctx *gin.Context) {
+	foundJob := jc.findJob(ctx)
+	if foundJob == nil {
+		return
+	}
+
+	before := *foundJob
+	changed := false
+	if !audited(ctx, &jc.auditService, func(tx *gorm.DB) error {
+		if changed = (&service.JobService{Db: tx}).Retry(foundJob); !changed {
+			return nil
+		}
+		return jc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntityJob, foundJob.ID, &before, foundJob))
+	}) {
+		return
+	}
+	if !changed {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Job is neither dead nor canceled."})
+		return
+	}
+	ctx.JSON(http.StatusOK, foundJob)
+}
+
+// findJob responds with an error (& returns nil) when `:id` is invalid or unknown in the workspace
+func (jc *JobController) findJob(ctx *gin.Context) *api.Job {
+	jobID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundJob := jc.service.GetByID(middleware.GetWorkspace(ctx), uint(jobID))
+	if foundJob.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found."})
+		return nil
+	}
+	return foundJob
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// MailboxController manages the identities emails are sent from, SMTP passwords are never returned
+type MailboxController struct {
+	service      service.MailboxService
+	auditService service.AuditService
+}
+
+func NewMailboxController(db *gorm.DB) *MailboxController {
+	return &MailboxController{
+		service:      service.MailboxService{Db: db},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+func (mc *MailboxController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, mc.service.List())
+}
+
+func (mc *MailboxController) Create(ctx *gin.Context) {
+	var mailbox api.Mailbox
+	if !mc.bindMailbox(ctx, &mailbox, 0) {
+		return
+	}
+
+	mailbox.ID = 0
+	if !audited(ctx, &mc.auditService, func(tx *gorm.DB) error {
+		if err := (&service.MailboxService{Db: tx}).Create(&mailbox); err != nil {
+			return err
+		}
+		return mc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntityMailbox, mailbox.ID, nil, &mailbox))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusCreated, &mailbox)
+}
+
+func (mc *MailboxController) View(ctx *gin.Context) {
+	foundMailbox := mc.findMailbox(ctx)
+	if foundMailbox == nil {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundMailbox)
+}
+
+// Update replaces all fields, the SMTP password is kept when omitted
+func (mc *MailboxController) Update(ctx *gin.Context) {
+	foundMailbox := mc.findMailbox(ctx)
+	if foundMailbox == nil {
+		return
+	}
+
+	var mailbox api.Mailbox
+	if !mc.bindMailbox(ctx, &mailbox, foundMailbox.ID) {
+		return
+	}
+
+	before := *foundMailbox
+	if !audited(ctx, &mc.auditService, func(tx *gorm.DB) error {
+		if err := (&service.MailboxService{Db: tx}).Update(foundMailbox, mailbox); err != nil {
+			return err
+		}
+		return mc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntityMailbox, foundMailbox.ID, &before, foundMailbox))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundMailbox)
+}
+
+func (mc *MailboxController) Delete(ctx *gin.Context) {
+	foundMailbox := mc.findMailbox(ctx)
+	if foundMailbox == nil {
+		return
+	}
+	if mc.service.InUse(foundMailbox.ID) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Mailbox is used by a sequence or active enrollment."})
+		return
+	}
+
+	audited(ctx, &mc.auditService, func(tx *gorm.DB) error {
+		(&service.MailboxService{Db: tx}).Delete(foundMailbox)
+		return mc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionDelete, api.AuditEntityMailbox, foundMailbox.ID, foundMailbox, nil))
+	})
+}
+
+// bindMailbox responds with an error (& returns false) for invalid bodies & addresses taken by other mailboxes
+func (mc *MailboxController) bindMailbox(ctx *gin.Context, mailbox *api.Mailbox, id uint) bool {
+	if err := ctx.BindJSON(mailbox); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if err := service.ValidateMailbox(mailbox); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if !mc.service.AddressAvailable(mailbox.Address, id) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Address already taken."})
+		return false
+	}
+	return true
+}
+
+// findMailbox responds with an error (& returns nil) when `:id` is invalid or unknown
+func (mc *MailboxController) findMailbox(ctx *gin.Context) *api.Mailbox {
+	mailboxID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundMailbox := mc.service.GetByID(uint(mailboxID))
+	if foundMailbox.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Mailbox not found."})
+		return nil
+	}
+	return foundMailbox
+}
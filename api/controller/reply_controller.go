@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type ReplyController struct {
+	service service.ReplyService
+}
+
+func NewReplyController(db *gorm.DB) *ReplyController {
+	return &ReplyController{
+		service: service.ReplyService{Db: db},
+	}
+}
+
+// List replies of the workspace (newest first)
+func (rc *ReplyController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, rc.service.List(middleware.GetWorkspace(ctx)))
+}
+
+// Receive takes a raw MIME message (e.g. from an inbound email provider), unmatched messages aren't an error,
+// so providers don't retry them
+func (rc *ReplyController) Receive(ctx *gin.Context) {
+	result, err := rc.service.Process(middleware.GetWorkspace(ctx), ctx.Request.Body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
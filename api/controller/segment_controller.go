@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// SegmentController segments belong to the workspace of the caller's API key
+type SegmentController struct {
+	service      service.SegmentService
+	auditService service.AuditService
+}
+
+func NewSegmentController(db *gorm.DB) *SegmentController {
+	return &SegmentController{
+		service:      service.SegmentService{Db: db},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+func (sc *SegmentController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, sc.service.List(middleware.GetWorkspace(ctx)))
+}
+
+func (sc *SegmentController) Create(ctx *gin.Context) {
+	var segment api.Segment
+	if !sc.bindSegment(ctx, &segment, 0) {
+		return
+	}
+
+	segment.ID = 0
+	if !audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		(&service.SegmentService{Db: tx}).Create(middleware.GetWorkspace(ctx), &segment)
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntitySegment, segment.ID, nil, &segment))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusCreated, &segment)
+}
+
+func (sc *SegmentController) View(ctx *gin.Context) {
+	if foundSegment := sc.findSegment(ctx); foundSegment != nil {
+		ctx.JSON(http.StatusOK, foundSegment)
+	}
+}
+
+// Update contacts entering the segment this way are enrolled by the next auto-enrollment sync
+func (sc *SegmentController) Update(ctx *gin.Context) {
+	foundSegment := sc.findSegment(ctx)
+	if foundSegment == nil {
+		return
+	}
+
+	var segment api.Segment
+	if !sc.bindSegment(ctx, &segment, foundSegment.ID) {
+		return
+	}
+
+	before := *foundSegment
+	if !audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		(&service.SegmentService{Db: tx}).Update(foundSegment, segment)
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntitySegment, foundSegment.ID, &before, foundSegment))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundSegment)
+}
+
+func (sc *SegmentController) Delete(ctx *gin.Context) {
+	foundSegment := sc.findSegment(ctx)
+	if foundSegment == nil {
+		return
+	}
+	if sc.service.InUse(foundSegment.ID) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Segment is used by a sequence."})
+		return
+	}
+
+	audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		(&service.SegmentService{Db: tx}).Delete(foundSegment)
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionDelete, api.AuditEntitySegment, foundSegment.ID, foundSegment, nil))
+	})
+}
+
+// Contacts lists the current members of the segment
+func (sc *SegmentController) Contacts(ctx *gin.Context) {
+	if foundSegment := sc.findSegment(ctx); foundSegment != nil {
+		ctx.JSON(http.StatusOK, sc.service.Members(foundSegment))
+	}
+}
+
+// bindSegment responds with an error (& returns false) when the body is invalid, `id` is the segment being updated (0 on create)
+func (sc *SegmentController) bindSegment(ctx *gin.Context, segment *api.Segment, id uint) bool {
+	if err := ctx.BindJSON(segment); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if err := service.ValidateSegment(segment); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if !sc.service.NameAvailable(middleware.GetWorkspace(ctx), segment.Name, id) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Name already taken."})
+		return false
+	}
+	return true
+}
+
+// findSegment responds with an error (& returns nil) when `:id` is invalid or unknown in the workspace
+func (sc *SegmentController) findSegment(ctx *gin.Context) *api.Segment {
+	segmentID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundSegment := sc.service.GetByID(middleware.GetWorkspace(ctx), uint(segmentID))
+	if foundSegment.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Segment not found."})
+		return nil
+	}
+	return foundSegment
+}
@@ -1,22 +1,40 @@
 package controller
 
 import (
-	"fmt"
-	"github.com/asaskevich/govalidator"
 	"github.com/gin-gonic/gin"
 	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
 	"github.com/sitetester/sequence-api/api/service"
 	"gorm.io/gorm"
 	"net/http"
+	"time"
 )
 
 type SequenceController struct {
-	service service.SequenceService
+	operations      *service.Operations
+	service         service.SequenceService
+	auditService    service.AuditService
+	scheduleService service.ScheduleService
+	contactService  service.ContactService
+	mailboxService  service.MailboxService
+	graphService    service.GraphService
+	segmentService  service.SegmentService
+	autoEnroll      service.AutoEnrollService
+	enrollments     service.EnrollmentService
 }
 
 func NewSequenceController(db *gorm.DB) *SequenceController {
 	return &SequenceController{
-		service: service.SequenceService{Db: db},
+		operations:      service.NewOperations(db),
+		service:         service.SequenceService{Db: db},
+		auditService:    service.AuditService{Db: db},
+		scheduleService: service.ScheduleService{Db: db},
+		contactService:  service.ContactService{Db: db},
+		mailboxService:  service.MailboxService{Db: db},
+		graphService:    service.GraphService{Db: db},
+		segmentService:  service.SegmentService{Db: db},
+		autoEnroll:      service.AutoEnrollService{Db: db},
+		enrollments:     service.EnrollmentService{Db: db},
 	}
 }
 
@@ -27,26 +45,36 @@ func (sc *SequenceController) Create(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
-	_, err := govalidator.ValidateStruct(&sequence)
+
+	createdSequence, err := sc.operations.CreateSequence(newCaller(ctx), sequence)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		respondWithOperationError(ctx, err)
 		return
 	}
+	ctx.JSON(http.StatusCreated, createdSequence)
+}
 
-	var foundSequence *api.Sequence
-	foundSequence = sc.service.GetByName(sequence.Name)
-	if foundSequence.ID > 0 {
-		msg := fmt.Sprintf("Name already assigned to sequence: %d", foundSequence.ID)
-		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: msg})
+func (sc *SequenceController) Update(ctx *gin.Context) {
+	sequenceIDStr := ctx.Param("id")
+	sequenceID, err := api.StrToUint(sequenceIDStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	sc.service.Create(&sequence)
+	var sequence api.Sequence
+	if err := ctx.BindJSON(&sequence); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
 
-	ctx.JSON(http.StatusCreated, &sequence)
+	if _, err := sc.operations.UpdateSequence(newCaller(ctx), uint(sequenceID), sequence); err != nil {
+		respondWithOperationError(ctx, err)
+	}
+	// auto returns 200 status
 }
 
-func (sc *SequenceController) Update(ctx *gin.Context) {
+func (sc *SequenceController) ViewWithSteps(ctx *gin.Context) {
 	sequenceIDStr := ctx.Param("id")
 	sequenceID, err := api.StrToUint(sequenceIDStr)
 	if err != nil {
@@ -55,57 +83,342 @@ func (sc *SequenceController) Update(ctx *gin.Context) {
 	}
 
 	var foundSequence *api.Sequence
-	foundSequence = sc.service.GetByID(uint(sequenceID))
+	foundSequence = sc.service.GetWithSteps(sequenceID)
 	if foundSequence.ID == 0 {
 		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Sequence not found."})
 		return
 	}
 
-	var sequence api.Sequence
-	if err := ctx.BindJSON(&sequence); err != nil {
+	sequenceWithSteps := api.SequenceWithSteps{
+		Sequence: foundSequence,
+		Steps:    &foundSequence.SequenceSteps,
+	}
+	ctx.JSON(http.StatusOK, sequenceWithSteps)
+}
+
+// UpdateSchedule replaces the sending window, time zone & holiday calendar of the sequence
+func (sc *SequenceController) UpdateSchedule(ctx *gin.Context) {
+	foundSequence := sc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+
+	var schedule api.SendSchedule
+	if err := ctx.BindJSON(&schedule); err != nil {
 		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
-	_, err = govalidator.ValidateStruct(&sequence)
-	if err != nil {
+	if err := sc.scheduleService.Validate(&schedule); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	before := *foundSequence
+	if !audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		(&service.ScheduleService{Db: tx}).UpdateSchedule(foundSequence, schedule)
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntitySequence, foundSequence.ID, &before, foundSequence))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundSequence)
+}
+
+func (sc *SequenceController) Mailboxes(ctx *gin.Context) {
+	foundSequence := sc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+	ctx.JSON(http.StatusOK, api.SequenceMailboxes{Rotation: foundSequence.MailboxRotation, Mailboxes: sc.mailboxService.Assigned(foundSequence.ID)})
+}
+
+// UpdateMailboxes replaces the mailboxes emails of the sequence are sent from & their rotation
+func (sc *SequenceController) UpdateMailboxes(ctx *gin.Context) {
+	foundSequence := sc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+
+	var assignment api.SequenceMailboxes
+	if err := ctx.BindJSON(&assignment); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := sc.mailboxService.ValidateAssignment(&assignment); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	before := *foundSequence
+	if !audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		if err := (&service.MailboxService{Db: tx}).Assign(foundSequence, assignment); err != nil {
+			return err
+		}
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntitySequence, foundSequence.ID, &before, foundSequence))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, api.SequenceMailboxes{Rotation: foundSequence.MailboxRotation, Mailboxes: sc.mailboxService.Assigned(foundSequence.ID)})
+}
+
+// UpdateAutoEnrollment sets the segment the sequence enrolls from, exclusions & re-enrollment policy
+// Current members of the segment are enrolled right away
+func (sc *SequenceController) UpdateAutoEnrollment(ctx *gin.Context) {
+	foundSequence := sc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+
+	var settings api.AutoEnrollment
+	if err := ctx.BindJSON(&settings); err != nil {
 		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
+	if err := sc.segmentService.ValidateAutoEnrollment(middleware.GetWorkspace(ctx), &settings); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	before := *foundSequence
+	if !audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		(&service.SequenceService{Db: tx}).UpdateAutoEnrollment(foundSequence, settings)
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntitySequence, foundSequence.ID, &before, foundSequence))
+	}) {
+		return
+	}
+	sc.autoEnroll.Sync(foundSequence, time.Now().UTC())
+	ctx.JSON(http.StatusOK, foundSequence)
+}
+
+// Activate starts sending the steps of a draft
+func (sc *SequenceController) Activate(ctx *gin.Context) {
+	sc.transition(ctx, []string{api.SequenceDraft}, api.SequenceActive, "Sequence is not a draft.")
+}
+
+// Pause holds every step of the sequence (scheduled or due) until it's resumed
+func (sc *SequenceController) Pause(ctx *gin.Context) {
+	sc.transition(ctx, []string{api.SequenceActive}, api.SequencePaused, "Sequence is not active.")
+}
+
+// Resume sends the steps of a paused sequence again, their due times are shifted by the pause
+func (sc *SequenceController) Resume(ctx *gin.Context) {
+	sc.transition(ctx, []string{api.SequencePaused}, api.SequenceActive, "Sequence is not paused.")
+}
+
+// Archive retires the sequence for good, its enrollments are held & contacts can't be enrolled anymore
+func (sc *SequenceController) Archive(ctx *gin.Context) {
+	sc.transition(ctx, []string{api.SequenceDraft, api.SequenceActive, api.SequencePaused}, api.SequenceArchived, "Sequence already archived.")
+}
+
+// transition moves the sequence from one of the `from` statuses to `to`, responds with 409 & `msg` from any other
+func (sc *SequenceController) transition(ctx *gin.Context, from []string, to string, msg string) {
+	foundSequence := sc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
 
-	// Check other sequence with same name
-	var otherSequence *api.Sequence
-	otherSequence = sc.service.GetOtherSequenceWithSameName(sequence.Name, uint(sequenceID))
-	if otherSequence.ID > 0 {
-		msg := fmt.Sprintf("Name already assigned to sequence: %d", otherSequence.ID)
+	before := *foundSequence
+	now := time.Now().UTC()
+	transitioned := false
+	if !audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		if transitioned = (&service.SequenceService{Db: tx}).Transition(foundSequence, from, to, now); !transitioned {
+			return nil
+		}
+		if before.Status == api.SequencePaused && to == api.SequenceActive && before.PausedAt != nil {
+			(&service.EnrollmentService{Db: tx}).ResumeSequence(foundSequence.ID, now.Sub(*before.PausedAt), now)
+		}
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntitySequence, foundSequence.ID, &before, foundSequence))
+	}) {
+		return
+	}
+	if !transitioned {
 		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: msg})
 		return
 	}
+	ctx.JSON(http.StatusOK, foundSequence)
+}
 
-	// finally update
-	sc.service.Update(foundSequence, sequence)
-	// auto returns 200 status
+func (sc *SequenceController) Edges(ctx *gin.Context) {
+	foundSequence := sc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+	ctx.JSON(http.StatusOK, api.SequenceGraph{Edges: sc.graphService.Edges(foundSequence.ID)})
 }
 
-func (sc *SequenceController) ViewWithSteps(ctx *gin.Context) {
-	sequenceIDStr := ctx.Param("id")
-	sequenceID, err := api.StrToUint(sequenceIDStr)
+// UpdateEdges replaces the edges between the steps of the sequence, an empty list makes it linear again
+func (sc *SequenceController) UpdateEdges(ctx *gin.Context) {
+	foundSequence := sc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+
+	var graph api.SequenceGraph
+	if err := ctx.BindJSON(&graph); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := sc.graphService.Validate(foundSequence.ID, &graph); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	before := api.SequenceGraph{Edges: sc.graphService.Edges(foundSequence.ID)}
+	var after api.SequenceGraph
+	if !audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		graphService := service.GraphService{Db: tx}
+		if err := graphService.Replace(foundSequence.ID, graph); err != nil {
+			return err
+		}
+		after = api.SequenceGraph{Edges: graphService.Edges(foundSequence.ID)}
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntitySequenceGraph, foundSequence.ID, &before, &after))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, after)
+}
+
+// Preview projects the send times of the steps for `contact_id`, as if enrolled at `start` (RFC 3339, default now)
+func (sc *SequenceController) Preview(ctx *gin.Context) {
+	foundSequence := sc.findSequence(ctx)
+	if foundSequence == nil {
+		return
+	}
+
+	contactID, err := api.StrToUint(ctx.Query("contact_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "contact_id: " + err.Error()})
+		return
+	}
+	foundContact := sc.contactService.GetByID(middleware.GetWorkspace(ctx), uint(contactID))
+	if foundContact.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Contact not found."})
+		return
+	}
+
+	start, err := parseTimeQuery(ctx, "start")
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
+	if start.IsZero() {
+		start = time.Now().UTC()
+	}
 
-	var foundSequence *api.Sequence
-	foundSequence = sc.service.GetWithSteps(sequenceID)
+	ctx.JSON(http.StatusOK, sc.scheduleService.Preview(foundSequence, foundContact, start))
+}
+
+// findSequence responds with an error (& returns nil) when `:id` is invalid or unknown
+func (sc *SequenceController) findSequence(ctx *gin.Context) *api.Sequence {
+	sequenceID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundSequence := sc.service.GetByID(uint(sequenceID))
 	if foundSequence.ID == 0 {
 		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Sequence not found."})
+		return nil
+	}
+	return foundSequence
+}
+
+// Stats aggregates the steps of a sequence along with the bounces & complaints of its emails
+func (sc *SequenceController) Stats(ctx *gin.Context) {
+	foundSequence := sc.findSequence(ctx)
+	if foundSequence == nil {
 		return
 	}
 
-	sequenceWithSteps := api.SequenceWithSteps{
-		Sequence: foundSequence,
-		Steps:    &foundSequence.SequenceSteps,
+	ctx.JSON(http.StatusOK, sc.service.GetStats([]uint{foundSequence.ID})[foundSequence.ID])
+}
+
+func (sc *SequenceController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, sc.service.List())
+}
+
+// Delete removes the sequence along with its steps
+func (sc *SequenceController) Delete(ctx *gin.Context) {
+	sequenceIDStr := ctx.Param("id")
+	sequenceID, err := api.StrToUint(sequenceIDStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := sc.operations.DeleteSequence(newCaller(ctx), uint(sequenceID)); err != nil {
+		respondWithOperationError(ctx, err)
+	}
+}
+
+// Export renders the sequence with its ordered steps as `api.SequenceDocument`
+// JSON by default, YAML with `?format=yaml`
+func (sc *SequenceController) Export(ctx *gin.Context) {
+	sequenceIDStr := ctx.Param("id")
+	sequenceID, err := api.StrToUint(sequenceIDStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	document, err := sc.operations.Export(uint(sequenceID))
+	if err != nil {
+		respondWithOperationError(ctx, err)
+		return
+	}
+
+	switch ctx.DefaultQuery("format", "json") {
+	case "json":
+		ctx.JSON(http.StatusOK, document)
+	case "yaml":
+		ctx.YAML(http.StatusOK, document)
+	default:
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Unsupported format, use json or yaml."})
 	}
-	ctx.JSON(http.StatusOK, sequenceWithSteps)
 }
 
-// TODO: Implement "delete" endpoint (when needed)
+// QueueExport queues a `sequence_export` job, its result is the document (JSON)
+func (sc *SequenceController) QueueExport(ctx *gin.Context) {
+	sequenceID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	job, err := sc.operations.QueueExport(newCaller(ctx), uint(sequenceID))
+	if err != nil {
+		respondWithOperationError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+// Import creates or updates (matched by name) a sequence from `api.SequenceDocument`
+// Body is parsed as YAML for YAML content types, JSON otherwise. Nothing is written with `?dry_run=true`
+func (sc *SequenceController) Import(ctx *gin.Context) {
+	var document api.SequenceDocument
+	var err error
+	switch ctx.ContentType() {
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		err = ctx.ShouldBindYAML(&document)
+	default:
+		err = ctx.ShouldBindJSON(&document)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	dryRun := ctx.Query("dry_run") == "true"
+	result, err := sc.operations.Import(newCaller(ctx), document, dryRun)
+	if err != nil {
+		respondWithOperationError(ctx, err)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Action == api.ImportActionCreate && !dryRun {
+		status = http.StatusCreated
+	}
+	ctx.JSON(status, result)
+}
@@ -1,23 +1,24 @@
 package controller
 
 import (
-	"github.com/asaskevich/govalidator"
 	"github.com/gin-gonic/gin"
 	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
 	"github.com/sitetester/sequence-api/api/service"
 	"gorm.io/gorm"
 	"net/http"
 )
 
+// SequenceStepsController reads & writes steps through `service.Operations`, like every other API
 type SequenceStepsController struct {
-	SequenceService      service.SequenceService
-	SequenceStepsService service.SequenceStepsService
+	Operations     *service.Operations
+	ContactService service.ContactService
 }
 
 func NewSequenceStepsController(db *gorm.DB) *SequenceStepsController {
 	return &SequenceStepsController{
-		SequenceService:      service.SequenceService{Db: db},
-		SequenceStepsService: service.SequenceStepsService{Db: db},
+		Operations:     service.NewOperations(db),
+		ContactService: service.ContactService{Db: db},
 	}
 }
 
@@ -28,31 +29,47 @@ func (ssc *SequenceStepsController) Create(ctx *gin.Context) {
 		return
 	}
 
-	_, err := govalidator.ValidateStruct(&sequenceStep)
+	createdStep, err := ssc.Operations.CreateStep(newCaller(ctx), sequenceStep)
+	if err != nil {
+		respondWithOperationError(ctx, err)
+		return
+	}
+	createdStep.Lint = service.LintStep(createdStep)
+	ctx.JSON(http.StatusCreated, createdStep)
+}
+
+func (ssc *SequenceStepsController) Update(ctx *gin.Context) {
+	stepIDStr := ctx.Param("id")
+	stepID, err := api.StrToUint(stepIDStr)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	var foundSequence *api.Sequence
-	foundSequence = ssc.SequenceService.GetByID(sequenceStep.SequenceID)
-	if foundSequence.ID == 0 {
-		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Sequence not found."})
+	foundSequenceStep, err := ssc.Operations.GetStep(uint(stepID))
+	if err != nil {
+		respondWithOperationError(ctx, err)
 		return
 	}
 
-	// Assumption: steps have unique subject per sequence
-	subjectAvailablePerSequence := ssc.SequenceStepsService.SubjectAvailablePerSequence(sequenceStep.Subject, sequenceStep.SequenceID)
-	if !subjectAvailablePerSequence {
-		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Subject already taken."})
+	// omitted fields keep their value
+	var update api.SequenceStepUpdate
+	if err := ctx.BindJSON(&update); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	ssc.SequenceStepsService.Create(&sequenceStep)
-	ctx.JSON(http.StatusCreated, &sequenceStep)
+	updatedStep, err := ssc.Operations.UpdateStep(newCaller(ctx), foundSequenceStep.ID, update.Apply(*foundSequenceStep))
+	if err != nil {
+		respondWithOperationError(ctx, err)
+		return
+	}
+	updatedStep.Lint = service.LintStep(updatedStep)
+	ctx.JSON(http.StatusOK, updatedStep)
 }
 
-func (ssc *SequenceStepsController) Update(ctx *gin.Context) {
+// Delete steps of an active sequence are only deleted with `?force=true`
+func (ssc *SequenceStepsController) Delete(ctx *gin.Context) {
 	stepIDStr := ctx.Param("id")
 	stepID, err := api.StrToUint(stepIDStr)
 	if err != nil {
@@ -60,59 +77,90 @@ func (ssc *SequenceStepsController) Update(ctx *gin.Context) {
 		return
 	}
 
-	var foundSequenceStep *api.SequenceStep
-	foundSequenceStep = ssc.SequenceStepsService.GetByID(uint(stepID))
-	if foundSequenceStep.ID == 0 {
-		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Step not found."})
-		return
+	if err := ssc.Operations.DeleteStep(newCaller(ctx), uint(stepID), ctx.Query("force") == "true"); err != nil {
+		respondWithOperationError(ctx, err)
 	}
+}
 
-	var sequenceStep api.SequenceStep
-	if err := ctx.BindJSON(&sequenceStep); err != nil {
+func (ssc *SequenceStepsController) View(ctx *gin.Context) {
+	stepIDStr := ctx.Param("id")
+	stepID, err := api.StrToUint(stepIDStr)
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
-	_, err = govalidator.ValidateStruct(&sequenceStep)
+
+	foundSequenceStep, err := ssc.Operations.GetStep(uint(stepID))
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		respondWithOperationError(ctx, err)
 		return
 	}
 
-	ssc.SequenceStepsService.Update(foundSequenceStep, sequenceStep)
+	ctx.JSON(http.StatusOK, foundSequenceStep)
 }
 
-func (ssc *SequenceStepsController) Delete(ctx *gin.Context) {
-	stepIDStr := ctx.Param("id")
-	stepID, err := api.StrToUint(stepIDStr)
+// Preview renders an email step for `contact_id` along with its lint report
+func (ssc *SequenceStepsController) Preview(ctx *gin.Context) {
+	stepID, err := api.StrToUint(ctx.Param("id"))
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
+	foundSequenceStep, err := ssc.Operations.GetStep(uint(stepID))
+	if err != nil {
+		respondWithOperationError(ctx, err)
+		return
+	}
+	if foundSequenceStep.Type != api.StepTypeEmail {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Only email steps are previewed."})
+		return
+	}
 
-	var foundSequenceStep *api.SequenceStep
-	foundSequenceStep = ssc.SequenceStepsService.GetByID(uint(stepID))
-	if foundSequenceStep.ID == 0 {
-		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Step not found."})
+	contactID, err := api.StrToUint(ctx.Query("contact_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "contact_id: " + err.Error()})
+		return
+	}
+	foundContact := ssc.ContactService.GetByID(middleware.GetWorkspace(ctx), uint(contactID))
+	if foundContact.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Contact not found."})
 		return
 	}
 
-	ssc.SequenceStepsService.Delete(foundSequenceStep)
+	ctx.JSON(http.StatusOK, service.PreviewStep(foundSequenceStep, foundContact))
 }
 
-func (ssc *SequenceStepsController) View(ctx *gin.Context) {
-	stepIDStr := ctx.Param("id")
-	stepID, err := api.StrToUint(stepIDStr)
+// Batch handles `POST /sequences/:id/steps:batch`
+// All operations are validated up front, if any of them fails nothing is applied
+func (ssc *SequenceStepsController) Batch(ctx *gin.Context) {
+	// gin has no notion of custom methods, `:batch` is captured as `action` param
+	if ctx.Param("action") != ":batch" {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Action not found."})
+		return
+	}
+
+	sequenceIDStr := ctx.Param("id")
+	sequenceID, err := api.StrToUint(sequenceIDStr)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	var foundSequenceStep *api.SequenceStep
-	foundSequenceStep = ssc.SequenceStepsService.GetByID(uint(stepID))
-	if foundSequenceStep.ID == 0 {
-		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Step not found."})
+	var batchRequest api.BatchStepsRequest
+	if err := ctx.BindJSON(&batchRequest); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, &foundSequenceStep)
+	batchResponse, err := ssc.Operations.ApplyBatch(newCaller(ctx), uint(sequenceID), batchRequest)
+	if err != nil {
+		// rejected batches report the result of every operation
+		if batchResponse != nil {
+			ctx.JSON(http.StatusBadRequest, batchResponse)
+			return
+		}
+		respondWithOperationError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, batchResponse)
 }
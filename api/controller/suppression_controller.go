@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// SuppressionController manages the suppression list of the caller's workspace
+type SuppressionController struct {
+	service      service.SuppressionService
+	auditService service.AuditService
+}
+
+func NewSuppressionController(db *gorm.DB) *SuppressionController {
+	return &SuppressionController{
+		service:      service.SuppressionService{Db: db},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+// List can be filtered by `reason`
+func (sc *SuppressionController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, sc.service.List(middleware.GetWorkspace(ctx), ctx.Query("reason")))
+}
+
+func (sc *SuppressionController) Create(ctx *gin.Context) {
+	var suppression api.Suppression
+	if err := ctx.BindJSON(&suppression); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := service.ValidateSuppression(&suppression); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	suppression.ID = 0
+	added := false
+	if !audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		if added = (&service.SuppressionService{Db: tx}).Add(middleware.GetWorkspace(ctx), &suppression); !added {
+			return nil
+		}
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntitySuppression, suppression.ID, nil, &suppression))
+	}) {
+		return
+	}
+	if !added {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Email already suppressed."})
+		return
+	}
+	ctx.JSON(http.StatusCreated, &suppression)
+}
+
+// Delete lets emails of the address be sent again (e.g. after an unsubscribe by mistake)
+func (sc *SuppressionController) Delete(ctx *gin.Context) {
+	suppressionID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	foundSuppression := sc.service.GetByID(middleware.GetWorkspace(ctx), uint(suppressionID))
+	if foundSuppression.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Suppression not found."})
+		return
+	}
+
+	audited(ctx, &sc.auditService, func(tx *gorm.DB) error {
+		(&service.SuppressionService{Db: tx}).Delete(foundSuppression)
+		return sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionDelete, api.AuditEntitySuppression, foundSuppression.ID, foundSuppression, nil))
+	})
+}
+
+// Import reads a CSV body (`email[,reason]` lines), already suppressed emails are skipped
+// A malformed body adds nothing
+func (sc *SuppressionController) Import(ctx *gin.Context) {
+	var result *api.SuppressionImportResult
+	var readErr error
+	err := sc.auditService.Transaction(func(tx *gorm.DB) error {
+		var added []api.Suppression
+		if result, added, readErr = (&service.SuppressionService{Db: tx}).ImportCSV(middleware.GetWorkspace(ctx), ctx.Request.Body); readErr != nil {
+			return readErr
+		}
+		for _, suppression := range added {
+			if err := sc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntitySuppression, suppression.ID, nil, &suppression)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	switch {
+	case readErr != nil:
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: readErr.Error()})
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+	default:
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func (sc *SuppressionController) Export(ctx *gin.Context) {
+	var buffer bytes.Buffer
+	if err := sc.service.ExportCSV(middleware.GetWorkspace(ctx), &buffer); err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Header("Content-Disposition", `attachment; filename="suppressions.csv"`)
+	ctx.Data(http.StatusOK, "text/csv; charset=utf-8", buffer.Bytes())
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TaskController is the inbox of the tasks opened by `manual_task` steps
+type TaskController struct {
+	service      service.TaskService
+	auditService service.AuditService
+}
+
+func NewTaskController(db *gorm.DB) *TaskController {
+	return &TaskController{
+		service:      service.TaskService{Db: db},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+// List tasks with `status` (open by default)
+func (tc *TaskController) List(ctx *gin.Context) {
+	status := ctx.DefaultQuery("status", api.TaskOpen)
+	if !govalidator.IsIn(status, api.TaskStatuses...) {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: fmt.Sprintf("status: must be one of %s", strings.Join(api.TaskStatuses, ", "))})
+		return
+	}
+	ctx.JSON(http.StatusOK, tc.service.List(middleware.GetWorkspace(ctx), status))
+}
+
+func (tc *TaskController) View(ctx *gin.Context) {
+	if foundTask := tc.findTask(ctx); foundTask != nil {
+		ctx.JSON(http.StatusOK, foundTask)
+	}
+}
+
+// Complete resolves the task, the enrollment continues with its next step
+func (tc *TaskController) Complete(ctx *gin.Context) {
+	tc.resolve(ctx, api.TaskCompleted)
+}
+
+// Skip resolves the task without doing it, the enrollment continues with its next step
+func (tc *TaskController) Skip(ctx *gin.Context) {
+	tc.resolve(ctx, api.TaskSkipped)
+}
+
+func (tc *TaskController) resolve(ctx *gin.Context, status string) {
+	foundTask := tc.findTask(ctx)
+	if foundTask == nil {
+		return
+	}
+	if foundTask.Status != api.TaskOpen {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Task is not open."})
+		return
+	}
+
+	before := *foundTask
+	if !audited(ctx, &tc.auditService, func(tx *gorm.DB) error {
+		(&service.TaskService{Db: tx}).Resolve(foundTask, status, time.Now().UTC())
+		return tc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntityTask, foundTask.ID, &before, foundTask))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundTask)
+}
+
+// findTask responds with an error (& returns nil) when `:id` is invalid or unknown in the workspace
+func (tc *TaskController) findTask(ctx *gin.Context) *api.Task {
+	taskID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundTask := tc.service.GetByID(middleware.GetWorkspace(ctx), uint(taskID))
+	if foundTask.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Task not found."})
+		return nil
+	}
+	return foundTask
+}
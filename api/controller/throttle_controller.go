@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+// ThrottleController manages the send throttles applied by the scheduler
+type ThrottleController struct {
+	service      service.ThrottleService
+	auditService service.AuditService
+}
+
+func NewThrottleController(db *gorm.DB) *ThrottleController {
+	return &ThrottleController{
+		service:      service.ThrottleService{Db: db},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+func (tc *ThrottleController) List(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, tc.service.List())
+}
+
+func (tc *ThrottleController) Create(ctx *gin.Context) {
+	var throttle api.Throttle
+	if err := ctx.BindJSON(&throttle); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := service.ValidateThrottle(&throttle); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	throttle.ID = 0
+	if !audited(ctx, &tc.auditService, func(tx *gorm.DB) error {
+		(&service.ThrottleService{Db: tx}).Create(&throttle)
+		return tc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntityThrottle, throttle.ID, nil, &throttle))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusCreated, &throttle)
+}
+
+func (tc *ThrottleController) Delete(ctx *gin.Context) {
+	throttleID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	foundThrottle := tc.service.GetByID(uint(throttleID))
+	if foundThrottle.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Throttle not found."})
+		return
+	}
+
+	audited(ctx, &tc.auditService, func(tx *gorm.DB) error {
+		(&service.ThrottleService{Db: tx}).Delete(foundThrottle)
+		return tc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionDelete, api.AuditEntityThrottle, foundThrottle.ID, foundThrottle, nil))
+	})
+}
+
+// Usage reports the current quota of every bucket
+func (tc *ThrottleController) Usage(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, tc.service.Usage(time.Now().UTC()))
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+// TrackingController serves the public open (`/o/:token`) & click (`/c/:token`) tracking endpoints
+type TrackingController struct {
+	service service.TrackingService
+}
+
+func NewTrackingController(db *gorm.DB) *TrackingController {
+	return &TrackingController{service: service.TrackingService{Db: db}}
+}
+
+// Open always responds with the pixel, unknown tokens are only not recorded
+func (tc *TrackingController) Open(ctx *gin.Context) {
+	tc.service.Open(ctx.Param("token"), time.Now().UTC())
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, "image/gif", service.TrackingPixel)
+}
+
+// Click redirects to `url` when the token signs it
+func (tc *TrackingController) Click(ctx *gin.Context) {
+	target := ctx.Query("url")
+	if !tc.service.Click(ctx.Param("token"), target, time.Now().UTC()) {
+		ctx.String(http.StatusNotFound, "This link is invalid.")
+		return
+	}
+	ctx.Redirect(http.StatusFound, target)
+}
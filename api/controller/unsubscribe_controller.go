@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"html/template"
+	"net/http"
+)
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+{{if .Invalid}}<p>This unsubscribe link is invalid or has expired.</p>
+{{else if .Done}}<p>You have been unsubscribed, you won't receive any further emails.</p>
+{{else}}<form method="post" action="{{.Action}}">
+<p>Do you want to stop receiving these emails?</p>
+<button type="submit" name="List-Unsubscribe" value="One-Click">Unsubscribe</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+type unsubscribePageData struct {
+	Invalid bool
+	Done    bool
+	Action  string
+}
+
+// UnsubscribeController serves the public `/u/:token` endpoint (no API key needed), linked from every email
+type UnsubscribeController struct {
+	service           service.UnsubscribeService
+	enrollmentService service.EnrollmentService
+}
+
+func NewUnsubscribeController(db *gorm.DB) *UnsubscribeController {
+	return &UnsubscribeController{
+		service:           service.UnsubscribeService{Db: db},
+		enrollmentService: service.EnrollmentService{Db: db},
+	}
+}
+
+// Confirm only shows a confirmation form, link scanners of mail providers follow GET links
+func (uc *UnsubscribeController) Confirm(ctx *gin.Context) {
+	if uc.findEnrollment(ctx) == nil {
+		return
+	}
+	renderUnsubscribePage(ctx, http.StatusOK, unsubscribePageData{Action: ctx.Request.URL.Path})
+}
+
+// Unsubscribe handles both the confirmation form & RFC 8058 one-click requests of mail clients
+func (uc *UnsubscribeController) Unsubscribe(ctx *gin.Context) {
+	foundEnrollment := uc.findEnrollment(ctx)
+	if foundEnrollment == nil {
+		return
+	}
+
+	if err := uc.service.Unsubscribe(foundEnrollment); err != nil {
+		ctx.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	renderUnsubscribePage(ctx, http.StatusOK, unsubscribePageData{Done: true})
+}
+
+// findEnrollment responds with 404 (& returns nil) for invalid tokens or deleted enrollments
+func (uc *UnsubscribeController) findEnrollment(ctx *gin.Context) *api.Enrollment {
+	enrollmentID, ok := uc.service.Verify(ctx.Param("token"))
+	var foundEnrollment *api.Enrollment
+	if ok {
+		foundEnrollment = uc.enrollmentService.GetByID(enrollmentID)
+	}
+	if foundEnrollment == nil || foundEnrollment.ID == 0 {
+		renderUnsubscribePage(ctx, http.StatusNotFound, unsubscribePageData{Invalid: true})
+		return nil
+	}
+	return foundEnrollment
+}
+
+func renderUnsubscribePage(ctx *gin.Context, code int, data unsubscribePageData) {
+	var buffer bytes.Buffer
+	if err := unsubscribePage.Execute(&buffer, data); err != nil {
+		ctx.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Data(code, "text/html; charset=utf-8", buffer.Bytes())
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// VariantController manages the A/B variants of a step (`/sequence-steps/:id/variants`)
+type VariantController struct {
+	service      service.VariantService
+	stepsService service.SequenceStepsService
+	auditService service.AuditService
+}
+
+func NewVariantController(db *gorm.DB) *VariantController {
+	return &VariantController{
+		service:      service.VariantService{Db: db},
+		stepsService: service.SequenceStepsService{Db: db},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+func (vc *VariantController) List(ctx *gin.Context) {
+	foundStep := vc.findStep(ctx)
+	if foundStep == nil {
+		return
+	}
+	ctx.JSON(http.StatusOK, vc.service.List(foundStep.ID))
+}
+
+func (vc *VariantController) Create(ctx *gin.Context) {
+	foundStep := vc.findStep(ctx)
+	if foundStep == nil {
+		return
+	}
+
+	var variant api.StepVariant
+	if !vc.bindVariant(ctx, &variant, foundStep, 0) {
+		return
+	}
+
+	variant.ID = 0
+	variant.StepID = foundStep.ID
+	if !audited(ctx, &vc.auditService, func(tx *gorm.DB) error {
+		(&service.VariantService{Db: tx}).Create(&variant)
+		return vc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionCreate, api.AuditEntityStepVariant, variant.ID, nil, &variant))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusCreated, &variant)
+}
+
+func (vc *VariantController) Update(ctx *gin.Context) {
+	foundStep, foundVariant := vc.findVariant(ctx)
+	if foundVariant == nil {
+		return
+	}
+
+	var variant api.StepVariant
+	if !vc.bindVariant(ctx, &variant, foundStep, foundVariant.ID) {
+		return
+	}
+
+	before := *foundVariant
+	if !audited(ctx, &vc.auditService, func(tx *gorm.DB) error {
+		(&service.VariantService{Db: tx}).Update(foundVariant, variant)
+		return vc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntityStepVariant, foundVariant.ID, &before, foundVariant))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundVariant)
+}
+
+func (vc *VariantController) Delete(ctx *gin.Context) {
+	_, foundVariant := vc.findVariant(ctx)
+	if foundVariant == nil {
+		return
+	}
+
+	audited(ctx, &vc.auditService, func(tx *gorm.DB) error {
+		(&service.VariantService{Db: tx}).Delete(foundVariant)
+		return vc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionDelete, api.AuditEntityStepVariant, foundVariant.ID, foundVariant, nil))
+	})
+}
+
+// UpdatePromotion sets the auto-promotion metric & sample size, or the winner right away
+func (vc *VariantController) UpdatePromotion(ctx *gin.Context) {
+	foundStep := vc.findStep(ctx)
+	if foundStep == nil {
+		return
+	}
+
+	var promotion api.VariantPromotion
+	if err := ctx.BindJSON(&promotion); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := vc.service.ValidatePromotion(foundStep, &promotion); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	before := *foundStep
+	if !audited(ctx, &vc.auditService, func(tx *gorm.DB) error {
+		(&service.VariantService{Db: tx}).UpdatePromotion(foundStep, promotion)
+		return vc.auditService.Record(tx, newAuditRecord(ctx, api.AuditActionUpdate, api.AuditEntitySequenceStep, foundStep.ID, &before, foundStep))
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, foundStep)
+}
+
+func (vc *VariantController) Stats(ctx *gin.Context) {
+	foundStep := vc.findStep(ctx)
+	if foundStep == nil {
+		return
+	}
+	ctx.JSON(http.StatusOK, vc.service.Stats(foundStep))
+}
+
+// bindVariant responds with an error (& returns false) for invalid bodies & names taken by other variants of the step
+func (vc *VariantController) bindVariant(ctx *gin.Context, variant *api.StepVariant, step *api.SequenceStep, id uint) bool {
+	if err := ctx.BindJSON(variant); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if err := service.ValidateVariant(step, variant); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if !vc.service.NameAvailable(step.ID, variant.Name, id) {
+		ctx.JSON(http.StatusConflict, api.ErrorResponse{Error: "Name already taken."})
+		return false
+	}
+	return true
+}
+
+// findStep responds with an error (& returns nil) when `:id` is invalid or unknown
+func (vc *VariantController) findStep(ctx *gin.Context) *api.SequenceStep {
+	stepID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundStep := vc.stepsService.GetByID(uint(stepID))
+	if foundStep.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Step not found."})
+		return nil
+	}
+	return foundStep
+}
+
+// findVariant responds with an error (& returns a nil variant) when the step or `:variantID` is invalid or unknown
+func (vc *VariantController) findVariant(ctx *gin.Context) (*api.SequenceStep, *api.StepVariant) {
+	foundStep := vc.findStep(ctx)
+	if foundStep == nil {
+		return nil, nil
+	}
+	variantID, err := api.StrToUint(ctx.Param("variantID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil, nil
+	}
+
+	foundVariant := vc.service.GetByID(foundStep.ID, uint(variantID))
+	if foundVariant.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Variant not found."})
+		return nil, nil
+	}
+	return foundStep, foundVariant
+}
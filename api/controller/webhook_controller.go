@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type WebhookController struct {
+	service      service.WebhookService
+	auditService service.AuditService
+}
+
+func NewWebhookController(db *gorm.DB) *WebhookController {
+	return &WebhookController{
+		service:      service.WebhookService{Db: db},
+		auditService: service.AuditService{Db: db},
+	}
+}
+
+// List `Secret` is never included (only returned by `Create`)
+func (wc *WebhookController) List(ctx *gin.Context) {
+	subscriptions := wc.service.List(middleware.GetWorkspace(ctx))
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	ctx.JSON(http.StatusOK, subscriptions)
+}
+
+func (wc *WebhookController) Create(ctx *gin.Context) {
+	var subscription api.WebhookSubscription
+	if err := ctx.BindJSON(&subscription); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := validateSubscription(&subscription); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	subscription.ID = 0
+	if !audited(ctx, &wc.auditService, func(tx *gorm.DB) error {
+		(&service.WebhookService{Db: tx}).Create(middleware.GetWorkspace(ctx), &subscription)
+		return wc.audit(ctx, tx, api.AuditActionCreate, subscription.ID, nil, &subscription)
+	}) {
+		return
+	}
+	ctx.JSON(http.StatusCreated, &subscription)
+}
+
+func (wc *WebhookController) View(ctx *gin.Context) {
+	foundSubscription := wc.findSubscription(ctx)
+	if foundSubscription == nil {
+		return
+	}
+
+	foundSubscription.Secret = ""
+	ctx.JSON(http.StatusOK, foundSubscription)
+}
+
+// Update replaces URL, event types & disabled flag, the secret is only changed when given
+func (wc *WebhookController) Update(ctx *gin.Context) {
+	foundSubscription := wc.findSubscription(ctx)
+	if foundSubscription == nil {
+		return
+	}
+
+	var subscription api.WebhookSubscription
+	if err := ctx.BindJSON(&subscription); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := validateSubscription(&subscription); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	before := *foundSubscription
+	if !audited(ctx, &wc.auditService, func(tx *gorm.DB) error {
+		(&service.WebhookService{Db: tx}).Update(foundSubscription, subscription)
+		return wc.audit(ctx, tx, api.AuditActionUpdate, foundSubscription.ID, &before, foundSubscription)
+	}) {
+		return
+	}
+	foundSubscription.Secret = ""
+	ctx.JSON(http.StatusOK, foundSubscription)
+}
+
+// Delete removes the subscription along with its delivery log
+func (wc *WebhookController) Delete(ctx *gin.Context) {
+	foundSubscription := wc.findSubscription(ctx)
+	if foundSubscription == nil {
+		return
+	}
+
+	audited(ctx, &wc.auditService, func(tx *gorm.DB) error {
+		if err := (&service.WebhookService{Db: tx}).Delete(foundSubscription); err != nil {
+			return err
+		}
+		return wc.audit(ctx, tx, api.AuditActionDelete, foundSubscription.ID, foundSubscription, nil)
+	})
+}
+
+// Deliveries is the delivery log of a subscription (newest first), filterable by `status`
+func (wc *WebhookController) Deliveries(ctx *gin.Context) {
+	foundSubscription := wc.findSubscription(ctx)
+	if foundSubscription == nil {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, wc.service.ListDeliveries(foundSubscription.ID, ctx.Query("status")))
+}
+
+// Redeliver queues a delivery again, e.g. after the receiver was fixed
+func (wc *WebhookController) Redeliver(ctx *gin.Context) {
+	foundSubscription := wc.findSubscription(ctx)
+	if foundSubscription == nil {
+		return
+	}
+
+	deliveryID, err := api.StrToUint(ctx.Param("deliveryID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	foundDelivery := wc.service.GetDelivery(foundSubscription.ID, uint(deliveryID))
+	if foundDelivery.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Delivery not found."})
+		return
+	}
+
+	if err := wc.service.Redeliver(middleware.GetWorkspace(ctx), foundDelivery); err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, foundDelivery)
+}
+
+// findSubscription responds with an error (& returns nil) when `:id` is invalid or unknown
+func (wc *WebhookController) findSubscription(ctx *gin.Context) *api.WebhookSubscription {
+	subscriptionID, err := api.StrToUint(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		return nil
+	}
+
+	foundSubscription := wc.service.GetByID(middleware.GetWorkspace(ctx), uint(subscriptionID))
+	if foundSubscription.ID == 0 {
+		ctx.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Webhook not found."})
+		return nil
+	}
+	return foundSubscription
+}
+
+// audit secrets are left out of the audit log, recorded within `tx`
+func (wc *WebhookController) audit(ctx *gin.Context, tx *gorm.DB, action string, id uint, before *api.WebhookSubscription, after *api.WebhookSubscription) error {
+	var beforeValue, afterValue any
+	if before != nil {
+		withoutSecret := *before
+		withoutSecret.Secret = ""
+		beforeValue = &withoutSecret
+	}
+	if after != nil {
+		withoutSecret := *after
+		withoutSecret.Secret = ""
+		afterValue = &withoutSecret
+	}
+	return wc.auditService.Record(tx, newAuditRecord(ctx, action, api.AuditEntityWebhookSubscription, id, beforeValue, afterValue))
+}
+
+func validateSubscription(subscription *api.WebhookSubscription) error {
+	if _, err := govalidator.ValidateStruct(subscription); err != nil {
+		return err
+	}
+	return service.ValidateEventTypes(subscription.EventTypes)
+}
@@ -0,0 +1,34 @@
+package api
+
+// Edge conditions, evaluated once the edge is due (its target's wait days after the send of its source step)
+const (
+	EdgeAlways     = "always"
+	EdgeOpened     = "opened"      // the email of the source step was opened
+	EdgeClicked    = "clicked"     // a link of the email of the source step was clicked
+	EdgeNotOpened  = "not_opened"  // not opened within `WithinDays` of its send
+	EdgeNotClicked = "not_clicked" // not clicked within `WithinDays` of its send
+	EdgeAttribute  = "attribute"   // the contact's `Attribute` matches the `Value` pattern (case-insensitive, `*` & `?` wildcards)
+)
+
+// Contact attributes edges can match, along with `status` & custom `attributes.<name>`
+var EdgeAttributes = []string{"email", "first_name", "last_name", "time_zone"}
+
+// StepEdge leads from a step to the next one when its condition holds
+// The edges of a step are evaluated in `Priority` order: the first one holding wins, a not yet due one is waited for
+type StepEdge struct {
+	ID         uint   `gorm:"primaryKey"`
+	SequenceID uint   `gorm:"index" json:"-"`
+	FromStepID uint   `valid:"required"`
+	ToStepID   uint   `valid:"required"`
+	Condition  string `valid:"in(always|opened|clicked|not_opened|not_clicked|attribute),required"`
+	WithinDays uint   `json:",omitempty"` // not_opened & not_clicked
+	Attribute  string `json:",omitempty"` // attribute
+	Value      string `json:",omitempty"` // attribute
+	Priority   uint
+}
+
+// SequenceGraph is the body of `PUT /sequences/:id/edges`, sequences without edges send their steps in `Position` order
+// With edges, the first step (by position) is the entry, steps without outgoing edges end the sequence
+type SequenceGraph struct {
+	Edges []StepEdge
+}
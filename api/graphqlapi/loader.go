@@ -0,0 +1,69 @@
+package graphqlapi
+
+import "sync"
+
+// loader batches lookups by ID (dataloader style): list resolvers `prime` the IDs of their items,
+// so the first `load` of a field fetches it for all of them with a single query
+type loader[T any] struct {
+	mu      sync.Mutex
+	fetch   func(ids []uint) map[uint]T
+	pending map[uint]bool
+	loaded  map[uint]T
+	missing map[uint]bool
+}
+
+func newLoader[T any](fetch func(ids []uint) map[uint]T) *loader[T] {
+	return &loader[T]{fetch: fetch, pending: map[uint]bool{}, loaded: map[uint]T{}, missing: map[uint]bool{}}
+}
+
+// prime registers IDs to be fetched with the next batch
+func (l *loader[T]) prime(ids ...uint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, id := range ids {
+		if _, ok := l.loaded[id]; !ok && !l.missing[id] {
+			l.pending[id] = true
+		}
+	}
+}
+
+// load `ok` is false when fetch didn't return the ID (e.g. unknown or deleted meanwhile)
+func (l *loader[T]) load(id uint) (T, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if value, ok := l.loaded[id]; ok || l.missing[id] {
+		return value, ok
+	}
+
+	l.pending[id] = true
+	ids := make([]uint, 0, len(l.pending))
+	for pendingID := range l.pending {
+		ids = append(ids, pendingID)
+	}
+	l.pending = map[uint]bool{}
+
+	fetched := l.fetch(ids)
+	for _, fetchedID := range ids {
+		if value, ok := fetched[fetchedID]; ok {
+			l.loaded[fetchedID] = value
+		} else {
+			l.missing[fetchedID] = true
+		}
+	}
+
+	value, ok := l.loaded[id]
+	return value, ok
+}
+
+// forget drops cached values after mutations, so later loads see the changes
+func (l *loader[T]) forget(ids ...uint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, id := range ids {
+		delete(l.loaded, id)
+		delete(l.missing, id)
+	}
+}
@@ -0,0 +1,433 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"net/http"
+	"strconv"
+)
+
+// loaders are created per request, so cached values never outlive it
+type loaders struct {
+	sequences *loader[api.Sequence]
+	steps     *loader[[]api.SequenceStep]
+	stats     *loader[api.SequenceStats]
+}
+
+type requestKey struct{}
+
+type requestState struct {
+	caller  service.Caller
+	loaders *loaders
+}
+
+func getState(ctx context.Context) requestState {
+	return ctx.Value(requestKey{}).(requestState)
+}
+
+// resolver is the root of both `Query` & `Mutation` types
+type resolver struct {
+	operations           *service.Operations
+	sequenceService      service.SequenceService
+	sequenceStepsService service.SequenceStepsService
+}
+
+func (r *resolver) newLoaders() *loaders {
+	return &loaders{
+		sequences: newLoader(r.sequenceService.GetByIDs),
+		steps:     newLoader(r.sequenceStepsService.GetBySequenceIDs),
+		stats:     newLoader(r.sequenceService.GetStats),
+	}
+}
+
+func (r *resolver) Sequences(ctx context.Context) []*sequenceResolver {
+	sequences := r.operations.ListSequences()
+
+	ids := make([]uint, len(sequences))
+	for i, sequence := range sequences {
+		ids[i] = sequence.ID
+	}
+	l := getState(ctx).loaders
+	l.steps.prime(ids...)
+	l.stats.prime(ids...)
+
+	resolvers := make([]*sequenceResolver, len(sequences))
+	for i := range sequences {
+		resolvers[i] = &sequenceResolver{sequence: sequences[i]}
+	}
+	return resolvers
+}
+
+func (r *resolver) Sequence(ctx context.Context, args struct{ ID graphql.ID }) (*sequenceResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sequence, ok := getState(ctx).loaders.sequences.load(id)
+	if !ok {
+		return nil, nil
+	}
+	return &sequenceResolver{sequence: sequence}, nil
+}
+
+func (r *resolver) Step(ctx context.Context, args struct{ ID graphql.ID }) (*stepResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	step, err := r.operations.GetStep(id)
+	if err != nil {
+		return nil, nil
+	}
+	return &stepResolver{step: *step}, nil
+}
+
+type sequenceInput struct {
+	Name                 string
+	OpenTrackingEnabled  *bool
+	ClickTrackingEnabled *bool
+}
+
+// apply omitted (optional) fields keep their current value
+func (si sequenceInput) apply(sequence api.Sequence) api.Sequence {
+	sequence.Name = si.Name
+	if si.OpenTrackingEnabled != nil {
+		sequence.OpenTrackingEnabled = *si.OpenTrackingEnabled
+	}
+	if si.ClickTrackingEnabled != nil {
+		sequence.ClickTrackingEnabled = *si.ClickTrackingEnabled
+	}
+	return sequence
+}
+
+func (r *resolver) CreateSequence(ctx context.Context, args struct{ Input sequenceInput }) (*sequenceResolver, error) {
+	created, err := r.operations.CreateSequence(getState(ctx).caller, args.Input.apply(api.Sequence{}))
+	if err != nil {
+		return nil, toError(err)
+	}
+	return &sequenceResolver{sequence: *created}, nil
+}
+
+func (r *resolver) UpdateSequence(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input sequenceInput
+}) (*sequenceResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	foundSequence, err := r.operations.GetSequence(id)
+	if err != nil {
+		return nil, toError(err)
+	}
+
+	state := getState(ctx)
+	updated, err := r.operations.UpdateSequence(state.caller, id, args.Input.apply(*foundSequence))
+	if err != nil {
+		return nil, toError(err)
+	}
+	state.loaders.sequences.forget(id)
+	return &sequenceResolver{sequence: *updated}, nil
+}
+
+func (r *resolver) DeleteSequence(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return false, err
+	}
+
+	state := getState(ctx)
+	if err := r.operations.DeleteSequence(state.caller, id); err != nil {
+		return false, toError(err)
+	}
+	state.loaders.sequences.forget(id)
+	state.loaders.steps.forget(id)
+	state.loaders.stats.forget(id)
+	return true, nil
+}
+
+type stepInput struct {
+	SequenceID graphql.ID
+	Subject    string
+	stepFields
+}
+
+type stepUpdateInput struct {
+	Subject *string
+	stepFields
+}
+
+// stepFields optional in both inputs
+type stepFields struct {
+	Type      *string
+	Content   *string
+	WaitUntil *graphql.Time
+	URL       *string
+	Method    *string
+	Position  *int32
+	WaitDays  *int32
+}
+
+// apply omitted (optional) fields keep their current value (see `api.SequenceStepUpdate`),
+// negative delays are rejected (`Int` is signed)
+func (sui stepUpdateInput) apply(step api.SequenceStep) (api.SequenceStep, error) {
+	update := api.SequenceStepUpdate{
+		Type:    sui.Type,
+		Subject: sui.Subject,
+		Content: sui.Content,
+		URL:     sui.URL,
+		Method:  sui.Method,
+	}
+	if sui.WaitUntil != nil {
+		update.WaitUntil = &sui.WaitUntil.Time
+	}
+	if sui.Position != nil {
+		if *sui.Position < 0 {
+			return step, resolverError{&service.OperationError{Code: http.StatusBadRequest, Message: "position: must not be negative"}}
+		}
+		position := uint(*sui.Position)
+		update.Position = &position
+	}
+	if sui.WaitDays != nil {
+		if *sui.WaitDays < 0 {
+			return step, resolverError{&service.OperationError{Code: http.StatusBadRequest, Message: "waitDays: must not be negative"}}
+		}
+		waitDays := uint(*sui.WaitDays)
+		update.WaitDays = &waitDays
+	}
+	return update.Apply(step), nil
+}
+
+func (r *resolver) CreateStep(ctx context.Context, args struct{ Input stepInput }) (*stepResolver, error) {
+	sequenceID, err := parseID(args.Input.SequenceID)
+	if err != nil {
+		return nil, err
+	}
+	update := stepUpdateInput{Subject: &args.Input.Subject, stepFields: args.Input.stepFields}
+	step, err := update.apply(api.SequenceStep{SequenceID: sequenceID, Type: api.StepTypeEmail})
+	if err != nil {
+		return nil, err
+	}
+
+	state := getState(ctx)
+	created, err := r.operations.CreateStep(state.caller, step)
+	if err != nil {
+		return nil, toError(err)
+	}
+	state.loaders.steps.forget(sequenceID)
+	state.loaders.stats.forget(sequenceID)
+	return &stepResolver{step: *created}, nil
+}
+
+func (r *resolver) UpdateStep(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input stepUpdateInput
+}) (*stepResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	foundSequenceStep, err := r.operations.GetStep(id)
+	if err != nil {
+		return nil, toError(err)
+	}
+
+	step, err := args.Input.apply(*foundSequenceStep)
+	if err != nil {
+		return nil, err
+	}
+
+	state := getState(ctx)
+	updated, err := r.operations.UpdateStep(state.caller, id, step)
+	if err != nil {
+		return nil, toError(err)
+	}
+	state.loaders.steps.forget(updated.SequenceID)
+	state.loaders.stats.forget(updated.SequenceID)
+	return &stepResolver{step: *updated}, nil
+}
+
+func (r *resolver) DeleteStep(ctx context.Context, args struct {
+	ID    graphql.ID
+	Force *bool
+}) (bool, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return false, err
+	}
+	foundSequenceStep, err := r.operations.GetStep(id)
+	if err != nil {
+		return false, toError(err)
+	}
+
+	state := getState(ctx)
+	if err := r.operations.DeleteStep(state.caller, id, args.Force != nil && *args.Force); err != nil {
+		return false, toError(err)
+	}
+	state.loaders.steps.forget(foundSequenceStep.SequenceID)
+	state.loaders.stats.forget(foundSequenceStep.SequenceID)
+	return true, nil
+}
+
+type sequenceResolver struct {
+	sequence api.Sequence
+}
+
+func (sr *sequenceResolver) ID() graphql.ID {
+	return toID(sr.sequence.ID)
+}
+
+func (sr *sequenceResolver) Name() string {
+	return sr.sequence.Name
+}
+
+func (sr *sequenceResolver) OpenTrackingEnabled() bool {
+	return sr.sequence.OpenTrackingEnabled
+}
+
+func (sr *sequenceResolver) ClickTrackingEnabled() bool {
+	return sr.sequence.ClickTrackingEnabled
+}
+
+func (sr *sequenceResolver) Status() string {
+	return sr.sequence.Status
+}
+
+func (sr *sequenceResolver) Steps(ctx context.Context) []*stepResolver {
+	steps, _ := getState(ctx).loaders.steps.load(sr.sequence.ID)
+
+	resolvers := make([]*stepResolver, len(steps))
+	for i := range steps {
+		resolvers[i] = &stepResolver{step: steps[i], sequence: sr}
+	}
+	return resolvers
+}
+
+func (sr *sequenceResolver) Stats(ctx context.Context) *statsResolver {
+	stats, _ := getState(ctx).loaders.stats.load(sr.sequence.ID)
+	return &statsResolver{stats: stats}
+}
+
+type stepResolver struct {
+	step     api.SequenceStep
+	sequence *sequenceResolver // set when resolved through its sequence
+}
+
+func (sr *stepResolver) ID() graphql.ID {
+	return toID(sr.step.ID)
+}
+
+func (sr *stepResolver) SequenceID() graphql.ID {
+	return toID(sr.step.SequenceID)
+}
+
+func (sr *stepResolver) Sequence(ctx context.Context) (*sequenceResolver, error) {
+	if sr.sequence != nil {
+		return sr.sequence, nil
+	}
+
+	sequence, ok := getState(ctx).loaders.sequences.load(sr.step.SequenceID)
+	if !ok {
+		return nil, toError(&service.OperationError{Code: http.StatusNotFound, Message: "Sequence not found."})
+	}
+	return &sequenceResolver{sequence: sequence}, nil
+}
+
+func (sr *stepResolver) Type() string {
+	return sr.step.Type
+}
+
+func (sr *stepResolver) Subject() string {
+	return sr.step.Subject
+}
+
+func (sr *stepResolver) Content() string {
+	return sr.step.Content
+}
+
+func (sr *stepResolver) WaitUntil() *graphql.Time {
+	if sr.step.WaitUntil == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *sr.step.WaitUntil}
+}
+
+func (sr *stepResolver) URL() *string {
+	if sr.step.URL == "" {
+		return nil
+	}
+	return &sr.step.URL
+}
+
+func (sr *stepResolver) Method() *string {
+	if sr.step.Method == "" {
+		return nil
+	}
+	return &sr.step.Method
+}
+
+func (sr *stepResolver) Position() int32 {
+	return int32(sr.step.Position)
+}
+
+func (sr *stepResolver) WaitDays() int32 {
+	return int32(sr.step.WaitDays)
+}
+
+type statsResolver struct {
+	stats api.SequenceStats
+}
+
+func (sr *statsResolver) StepCount() int32 {
+	return int32(sr.stats.StepCount)
+}
+
+func (sr *statsResolver) TotalWaitDays() int32 {
+	return int32(sr.stats.TotalWaitDays)
+}
+
+func (sr *statsResolver) HardBounces() int32 {
+	return int32(sr.stats.HardBounces)
+}
+
+func (sr *statsResolver) SoftBounces() int32 {
+	return int32(sr.stats.SoftBounces)
+}
+
+func (sr *statsResolver) Complaints() int32 {
+	return int32(sr.stats.Complaints)
+}
+
+// resolverError exposes the HTTP status of service errors as `extensions.status`
+type resolverError struct {
+	*service.OperationError
+}
+
+func (re resolverError) Extensions() map[string]any {
+	return map[string]any{"status": re.Code}
+}
+
+func toError(err error) error {
+	var operationErr *service.OperationError
+	if errors.As(err, &operationErr) {
+		return resolverError{operationErr}
+	}
+	return err
+}
+
+func parseID(id graphql.ID) (uint, error) {
+	parsed, err := api.StrToUint(string(id))
+	if err != nil {
+		return 0, resolverError{&service.OperationError{Code: http.StatusBadRequest, Message: err.Error()}}
+	}
+	return uint(parsed), nil
+}
+
+func toID(id uint) graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(id), 10))
+}
@@ -0,0 +1,38 @@
+// Package graphqlapi serves sequences, steps & their stats over GraphQL (see `schema.graphql`),
+// through the same service layer & validation rules as the REST API
+package graphqlapi
+
+import (
+	"context"
+	_ "embed"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+type Schema struct {
+	schema   *graphql.Schema
+	resolver *resolver
+}
+
+func NewSchema(db *gorm.DB) *Schema {
+	r := &resolver{
+		operations:           service.NewOperations(db),
+		sequenceService:      service.SequenceService{Db: db},
+		sequenceStepsService: service.SequenceStepsService{Db: db},
+	}
+	return &Schema{
+		schema:   graphql.MustParseSchema(schemaSDL, r),
+		resolver: r,
+	}
+}
+
+// Execute `caller` is recorded in audit log for mutations
+func (s *Schema) Execute(ctx context.Context, caller service.Caller, request api.GraphQLRequest) *graphql.Response {
+	ctx = context.WithValue(ctx, requestKey{}, requestState{caller: caller, loaders: s.resolver.newLoaders()})
+	return s.schema.Exec(ctx, request.Query, request.OperationName, request.Variables)
+}
@@ -0,0 +1,528 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: sequences.proto
+
+// gRPC counterpart of the REST API (`/v1`), backed by the same service layer
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	SequenceService_ListSequences_FullMethodName  = "/sequences.v1.SequenceService/ListSequences"
+	SequenceService_GetSequence_FullMethodName    = "/sequences.v1.SequenceService/GetSequence"
+	SequenceService_CreateSequence_FullMethodName = "/sequences.v1.SequenceService/CreateSequence"
+	SequenceService_UpdateSequence_FullMethodName = "/sequences.v1.SequenceService/UpdateSequence"
+	SequenceService_DeleteSequence_FullMethodName = "/sequences.v1.SequenceService/DeleteSequence"
+)
+
+// SequenceServiceClient is the client API for SequenceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SequenceServiceClient interface {
+	ListSequences(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ListSequencesResponse, error)
+	GetSequence(ctx context.Context, in *IDRequest, opts ...grpc.CallOption) (*SequenceWithSteps, error)
+	CreateSequence(ctx context.Context, in *Sequence, opts ...grpc.CallOption) (*Sequence, error)
+	UpdateSequence(ctx context.Context, in *UpdateSequenceRequest, opts ...grpc.CallOption) (*Sequence, error)
+	DeleteSequence(ctx context.Context, in *IDRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type sequenceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSequenceServiceClient(cc grpc.ClientConnInterface) SequenceServiceClient {
+	return &sequenceServiceClient{cc}
+}
+
+func (c *sequenceServiceClient) ListSequences(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ListSequencesResponse, error) {
+	out := new(ListSequencesResponse)
+	err := c.cc.Invoke(ctx, SequenceService_ListSequences_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sequenceServiceClient) GetSequence(ctx context.Context, in *IDRequest, opts ...grpc.CallOption) (*SequenceWithSteps, error) {
+	out := new(SequenceWithSteps)
+	err := c.cc.Invoke(ctx, SequenceService_GetSequence_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sequenceServiceClient) CreateSequence(ctx context.Context, in *Sequence, opts ...grpc.CallOption) (*Sequence, error) {
+	out := new(Sequence)
+	err := c.cc.Invoke(ctx, SequenceService_CreateSequence_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sequenceServiceClient) UpdateSequence(ctx context.Context, in *UpdateSequenceRequest, opts ...grpc.CallOption) (*Sequence, error) {
+	out := new(Sequence)
+	err := c.cc.Invoke(ctx, SequenceService_UpdateSequence_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sequenceServiceClient) DeleteSequence(ctx context.Context, in *IDRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, SequenceService_DeleteSequence_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SequenceServiceServer is the server API for SequenceService service.
+// All implementations must embed UnimplementedSequenceServiceServer
+// for forward compatibility
+type SequenceServiceServer interface {
+	ListSequences(context.Context, *emptypb.Empty) (*ListSequencesResponse, error)
+	GetSequence(context.Context, *IDRequest) (*SequenceWithSteps, error)
+	CreateSequence(context.Context, *Sequence) (*Sequence, error)
+	UpdateSequence(context.Context, *UpdateSequenceRequest) (*Sequence, error)
+	DeleteSequence(context.Context, *IDRequest) (*emptypb.Empty, error)
+	mustEmbedUnimplementedSequenceServiceServer()
+}
+
+// UnimplementedSequenceServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedSequenceServiceServer struct {
+}
+
+func (UnimplementedSequenceServiceServer) ListSequences(context.Context, *emptypb.Empty) (*ListSequencesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSequences not implemented")
+}
+func (UnimplementedSequenceServiceServer) GetSequence(context.Context, *IDRequest) (*SequenceWithSteps, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSequence not implemented")
+}
+func (UnimplementedSequenceServiceServer) CreateSequence(context.Context, *Sequence) (*Sequence, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSequence not implemented")
+}
+func (UnimplementedSequenceServiceServer) UpdateSequence(context.Context, *UpdateSequenceRequest) (*Sequence, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateSequence not implemented")
+}
+func (UnimplementedSequenceServiceServer) DeleteSequence(context.Context, *IDRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSequence not implemented")
+}
+func (UnimplementedSequenceServiceServer) mustEmbedUnimplementedSequenceServiceServer() {}
+
+// UnsafeSequenceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SequenceServiceServer will
+// result in compilation errors.
+type UnsafeSequenceServiceServer interface {
+	mustEmbedUnimplementedSequenceServiceServer()
+}
+
+func RegisterSequenceServiceServer(s grpc.ServiceRegistrar, srv SequenceServiceServer) {
+	s.RegisterService(&SequenceService_ServiceDesc, srv)
+}
+
+func _SequenceService_ListSequences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SequenceServiceServer).ListSequences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SequenceService_ListSequences_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SequenceServiceServer).ListSequences(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SequenceService_GetSequence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SequenceServiceServer).GetSequence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SequenceService_GetSequence_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SequenceServiceServer).GetSequence(ctx, req.(*IDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SequenceService_CreateSequence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Sequence)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SequenceServiceServer).CreateSequence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SequenceService_CreateSequence_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SequenceServiceServer).CreateSequence(ctx, req.(*Sequence))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SequenceService_UpdateSequence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateSequenceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SequenceServiceServer).UpdateSequence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SequenceService_UpdateSequence_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SequenceServiceServer).UpdateSequence(ctx, req.(*UpdateSequenceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SequenceService_DeleteSequence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SequenceServiceServer).DeleteSequence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SequenceService_DeleteSequence_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SequenceServiceServer).DeleteSequence(ctx, req.(*IDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SequenceService_ServiceDesc is the grpc.ServiceDesc for SequenceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SequenceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sequences.v1.SequenceService",
+	HandlerType: (*SequenceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListSequences",
+			Handler:    _SequenceService_ListSequences_Handler,
+		},
+		{
+			MethodName: "GetSequence",
+			Handler:    _SequenceService_GetSequence_Handler,
+		},
+		{
+			MethodName: "CreateSequence",
+			Handler:    _SequenceService_CreateSequence_Handler,
+		},
+		{
+			MethodName: "UpdateSequence",
+			Handler:    _SequenceService_UpdateSequence_Handler,
+		},
+		{
+			MethodName: "DeleteSequence",
+			Handler:    _SequenceService_DeleteSequence_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "sequences.proto",
+}
+
+const (
+	SequenceStepsService_GetStep_FullMethodName    = "/sequences.v1.SequenceStepsService/GetStep"
+	SequenceStepsService_ListSteps_FullMethodName  = "/sequences.v1.SequenceStepsService/ListSteps"
+	SequenceStepsService_CreateStep_FullMethodName = "/sequences.v1.SequenceStepsService/CreateStep"
+	SequenceStepsService_UpdateStep_FullMethodName = "/sequences.v1.SequenceStepsService/UpdateStep"
+	SequenceStepsService_DeleteStep_FullMethodName = "/sequences.v1.SequenceStepsService/DeleteStep"
+)
+
+// SequenceStepsServiceClient is the client API for SequenceStepsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SequenceStepsServiceClient interface {
+	GetStep(ctx context.Context, in *IDRequest, opts ...grpc.CallOption) (*SequenceStep, error)
+	// ListSteps streams the steps of a sequence in sending order
+	ListSteps(ctx context.Context, in *ListStepsRequest, opts ...grpc.CallOption) (SequenceStepsService_ListStepsClient, error)
+	CreateStep(ctx context.Context, in *SequenceStep, opts ...grpc.CallOption) (*SequenceStep, error)
+	UpdateStep(ctx context.Context, in *UpdateStepRequest, opts ...grpc.CallOption) (*SequenceStep, error)
+	DeleteStep(ctx context.Context, in *DeleteStepRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type sequenceStepsServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSequenceStepsServiceClient(cc grpc.ClientConnInterface) SequenceStepsServiceClient {
+	return &sequenceStepsServiceClient{cc}
+}
+
+func (c *sequenceStepsServiceClient) GetStep(ctx context.Context, in *IDRequest, opts ...grpc.CallOption) (*SequenceStep, error) {
+	out := new(SequenceStep)
+	err := c.cc.Invoke(ctx, SequenceStepsService_GetStep_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sequenceStepsServiceClient) ListSteps(ctx context.Context, in *ListStepsRequest, opts ...grpc.CallOption) (SequenceStepsService_ListStepsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &SequenceStepsService_ServiceDesc.Streams[0], SequenceStepsService_ListSteps_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sequenceStepsServiceListStepsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SequenceStepsService_ListStepsClient interface {
+	Recv() (*SequenceStep, error)
+	grpc.ClientStream
+}
+
+type sequenceStepsServiceListStepsClient struct {
+	grpc.ClientStream
+}
+
+func (x *sequenceStepsServiceListStepsClient) Recv() (*SequenceStep, error) {
+	m := new(SequenceStep)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *sequenceStepsServiceClient) CreateStep(ctx context.Context, in *SequenceStep, opts ...grpc.CallOption) (*SequenceStep, error) {
+	out := new(SequenceStep)
+	err := c.cc.Invoke(ctx, SequenceStepsService_CreateStep_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sequenceStepsServiceClient) UpdateStep(ctx context.Context, in *UpdateStepRequest, opts ...grpc.CallOption) (*SequenceStep, error) {
+	out := new(SequenceStep)
+	err := c.cc.Invoke(ctx, SequenceStepsService_UpdateStep_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sequenceStepsServiceClient) DeleteStep(ctx context.Context, in *DeleteStepRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, SequenceStepsService_DeleteStep_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SequenceStepsServiceServer is the server API for SequenceStepsService service.
+// All implementations must embed UnimplementedSequenceStepsServiceServer
+// for forward compatibility
+type SequenceStepsServiceServer interface {
+	GetStep(context.Context, *IDRequest) (*SequenceStep, error)
+	// ListSteps streams the steps of a sequence in sending order
+	ListSteps(*ListStepsRequest, SequenceStepsService_ListStepsServer) error
+	CreateStep(context.Context, *SequenceStep) (*SequenceStep, error)
+	UpdateStep(context.Context, *UpdateStepRequest) (*SequenceStep, error)
+	DeleteStep(context.Context, *DeleteStepRequest) (*emptypb.Empty, error)
+	mustEmbedUnimplementedSequenceStepsServiceServer()
+}
+
+// UnimplementedSequenceStepsServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedSequenceStepsServiceServer struct {
+}
+
+func (UnimplementedSequenceStepsServiceServer) GetStep(context.Context, *IDRequest) (*SequenceStep, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStep not implemented")
+}
+func (UnimplementedSequenceStepsServiceServer) ListSteps(*ListStepsRequest, SequenceStepsService_ListStepsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListSteps not implemented")
+}
+func (UnimplementedSequenceStepsServiceServer) CreateStep(context.Context, *SequenceStep) (*SequenceStep, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateStep not implemented")
+}
+func (UnimplementedSequenceStepsServiceServer) UpdateStep(context.Context, *UpdateStepRequest) (*SequenceStep, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateStep not implemented")
+}
+func (UnimplementedSequenceStepsServiceServer) DeleteStep(context.Context, *DeleteStepRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteStep not implemented")
+}
+func (UnimplementedSequenceStepsServiceServer) mustEmbedUnimplementedSequenceStepsServiceServer() {}
+
+// UnsafeSequenceStepsServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SequenceStepsServiceServer will
+// result in compilation errors.
+type UnsafeSequenceStepsServiceServer interface {
+	mustEmbedUnimplementedSequenceStepsServiceServer()
+}
+
+func RegisterSequenceStepsServiceServer(s grpc.ServiceRegistrar, srv SequenceStepsServiceServer) {
+	s.RegisterService(&SequenceStepsService_ServiceDesc, srv)
+}
+
+func _SequenceStepsService_GetStep_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SequenceStepsServiceServer).GetStep(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SequenceStepsService_GetStep_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SequenceStepsServiceServer).GetStep(ctx, req.(*IDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SequenceStepsService_ListSteps_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListStepsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SequenceStepsServiceServer).ListSteps(m, &sequenceStepsServiceListStepsServer{stream})
+}
+
+type SequenceStepsService_ListStepsServer interface {
+	Send(*SequenceStep) error
+	grpc.ServerStream
+}
+
+type sequenceStepsServiceListStepsServer struct {
+	grpc.ServerStream
+}
+
+func (x *sequenceStepsServiceListStepsServer) Send(m *SequenceStep) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _SequenceStepsService_CreateStep_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SequenceStep)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SequenceStepsServiceServer).CreateStep(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SequenceStepsService_CreateStep_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SequenceStepsServiceServer).CreateStep(ctx, req.(*SequenceStep))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SequenceStepsService_UpdateStep_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateStepRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SequenceStepsServiceServer).UpdateStep(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SequenceStepsService_UpdateStep_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SequenceStepsServiceServer).UpdateStep(ctx, req.(*UpdateStepRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SequenceStepsService_DeleteStep_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteStepRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SequenceStepsServiceServer).DeleteStep(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SequenceStepsService_DeleteStep_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SequenceStepsServiceServer).DeleteStep(ctx, req.(*DeleteStepRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SequenceStepsService_ServiceDesc is the grpc.ServiceDesc for SequenceStepsService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SequenceStepsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sequences.v1.SequenceStepsService",
+	HandlerType: (*SequenceStepsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStep",
+			Handler:    _SequenceStepsService_GetStep_Handler,
+		},
+		{
+			MethodName: "CreateStep",
+			Handler:    _SequenceStepsService_CreateStep_Handler,
+		},
+		{
+			MethodName: "UpdateStep",
+			Handler:    _SequenceStepsService_UpdateStep_Handler,
+		},
+		{
+			MethodName: "DeleteStep",
+			Handler:    _SequenceStepsService_DeleteStep_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListSteps",
+			Handler:       _SequenceStepsService_ListSteps_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sequences.proto",
+}
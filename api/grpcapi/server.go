@@ -0,0 +1,341 @@
+// Package grpcapi serves the sequences API over gRPC (see `proto/sequences.proto`),
+// using the same service layer, validation rules & API keys as the REST API
+package grpcapi
+
+//go:generate buf generate ../.. --template ../../buf.gen.yaml -o ../..
+
+import (
+	"context"
+	"errors"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/grpcapi/pb"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+// NewServer registers both services, every call passes through the auth interceptors first
+func NewServer(db *gorm.DB) *grpc.Server {
+	auth := authenticator{apiKeyService: service.ApiKeyService{Db: db}}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(auth.unary),
+		grpc.StreamInterceptor(auth.stream),
+	)
+
+	operations := service.NewOperations(db)
+	pb.RegisterSequenceServiceServer(server, &sequenceServer{operations: operations})
+	pb.RegisterSequenceStepsServiceServer(server, &sequenceStepsServer{operations: operations})
+	return server
+}
+
+type sequenceServer struct {
+	pb.UnimplementedSequenceServiceServer
+	operations *service.Operations
+}
+
+func (ss *sequenceServer) ListSequences(ctx context.Context, _ *emptypb.Empty) (*pb.ListSequencesResponse, error) {
+	response := &pb.ListSequencesResponse{}
+	for _, sequence := range ss.operations.ListSequences() {
+		response.Sequences = append(response.Sequences, toPbSequence(&sequence))
+	}
+	return response, nil
+}
+
+func (ss *sequenceServer) GetSequence(ctx context.Context, request *pb.IDRequest) (*pb.SequenceWithSteps, error) {
+	foundSequence, err := ss.operations.GetSequence(uint(request.Id))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	response := &pb.SequenceWithSteps{Sequence: toPbSequence(foundSequence)}
+	for _, step := range foundSequence.SequenceSteps {
+		response.Steps = append(response.Steps, toPbStep(&step))
+	}
+	return response, nil
+}
+
+func (ss *sequenceServer) CreateSequence(ctx context.Context, request *pb.Sequence) (*pb.Sequence, error) {
+	created, err := ss.operations.CreateSequence(getCaller(ctx), fromPbSequence(request))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return toPbSequence(created), nil
+}
+
+func (ss *sequenceServer) UpdateSequence(ctx context.Context, request *pb.UpdateSequenceRequest) (*pb.Sequence, error) {
+	updated, err := ss.operations.UpdateSequence(getCaller(ctx), uint(request.Id), fromPbSequence(request.Sequence))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return toPbSequence(updated), nil
+}
+
+func (ss *sequenceServer) DeleteSequence(ctx context.Context, request *pb.IDRequest) (*emptypb.Empty, error) {
+	if err := ss.operations.DeleteSequence(getCaller(ctx), uint(request.Id)); err != nil {
+		return nil, toStatusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+type sequenceStepsServer struct {
+	pb.UnimplementedSequenceStepsServiceServer
+	operations *service.Operations
+}
+
+func (sss *sequenceStepsServer) GetStep(ctx context.Context, request *pb.IDRequest) (*pb.SequenceStep, error) {
+	foundSequenceStep, err := sss.operations.GetStep(uint(request.Id))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return toPbStep(foundSequenceStep), nil
+}
+
+func (sss *sequenceStepsServer) ListSteps(request *pb.ListStepsRequest, stream pb.SequenceStepsService_ListStepsServer) error {
+	steps, err := sss.operations.ListSteps(uint(request.SequenceId))
+	if err != nil {
+		return toStatusError(err)
+	}
+
+	for _, step := range steps {
+		if err := stream.Send(toPbStep(&step)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sss *sequenceStepsServer) CreateStep(ctx context.Context, request *pb.SequenceStep) (*pb.SequenceStep, error) {
+	created, err := sss.operations.CreateStep(getCaller(ctx), fromPbStep(request))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return toPbStep(created), nil
+}
+
+// UpdateStep fields which aren't updated keep their value (see `UpdateStepRequest`)
+func (sss *sequenceStepsServer) UpdateStep(ctx context.Context, request *pb.UpdateStepRequest) (*pb.SequenceStep, error) {
+	update, err := toStepUpdate(request)
+	if err != nil {
+		return nil, err
+	}
+	foundSequenceStep, err := sss.operations.GetStep(uint(request.Id))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	updated, err := sss.operations.UpdateStep(getCaller(ctx), foundSequenceStep.ID, update.Apply(*foundSequenceStep))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return toPbStep(updated), nil
+}
+
+// DeleteStep steps of an active sequence are only deleted with `force`
+func (sss *sequenceStepsServer) DeleteStep(ctx context.Context, request *pb.DeleteStepRequest) (*emptypb.Empty, error) {
+	if err := sss.operations.DeleteStep(getCaller(ctx), uint(request.Id), request.Force); err != nil {
+		return nil, toStatusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// toStatusError maps the HTTP status of service errors to the closest gRPC code
+func toStatusError(err error) error {
+	var operationErr *service.OperationError
+	if !errors.As(err, &operationErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	code := codes.Unknown
+	switch operationErr.Code {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		// e.g. deleting a step of an active sequence without force
+		code = codes.FailedPrecondition
+		if operationErr.Exists {
+			code = codes.AlreadyExists
+		}
+	}
+	return status.Error(code, operationErr.Message)
+}
+
+func toPbSequence(sequence *api.Sequence) *pb.Sequence {
+	return &pb.Sequence{
+		Id:                   uint64(sequence.ID),
+		Name:                 sequence.Name,
+		OpenTrackingEnabled:  sequence.OpenTrackingEnabled,
+		ClickTrackingEnabled: sequence.ClickTrackingEnabled,
+		Status:               sequence.Status,
+	}
+}
+
+// fromPbSequence `ID` & `Status` are ignored, it's taken from the request (if any)
+func fromPbSequence(sequence *pb.Sequence) api.Sequence {
+	return api.Sequence{
+		Name:                 sequence.GetName(),
+		OpenTrackingEnabled:  sequence.GetOpenTrackingEnabled(),
+		ClickTrackingEnabled: sequence.GetClickTrackingEnabled(),
+	}
+}
+
+func toPbStep(step *api.SequenceStep) *pb.SequenceStep {
+	pbStep := &pb.SequenceStep{
+		Id:         uint64(step.ID),
+		SequenceId: uint64(step.SequenceID),
+		Subject:    step.Subject,
+		Content:    step.Content,
+		Position:   uint32(step.Position),
+		WaitDays:   uint32(step.WaitDays),
+		Type:       step.Type,
+		Url:        step.URL,
+		Method:     step.Method,
+	}
+	if step.WaitUntil != nil {
+		pbStep.WaitUntil = timestamppb.New(*step.WaitUntil)
+	}
+	for _, assetID := range step.Attachments {
+		pbStep.Attachments = append(pbStep.Attachments, uint64(assetID))
+	}
+	return pbStep
+}
+
+func fromPbStep(step *pb.SequenceStep) api.SequenceStep {
+	sequenceStep := api.SequenceStep{
+		SequenceID: uint(step.GetSequenceId()),
+		Subject:    step.GetSubject(),
+		Content:    step.GetContent(),
+		Position:   uint(step.GetPosition()),
+		WaitDays:   uint(step.GetWaitDays()),
+		Type:       step.GetType(),
+		URL:        step.GetUrl(),
+		Method:     step.GetMethod(),
+	}
+	if step.GetWaitUntil() != nil {
+		waitUntil := step.GetWaitUntil().AsTime()
+		sequenceStep.WaitUntil = &waitUntil
+	}
+	for _, assetID := range step.GetAttachments() {
+		sequenceStep.Attachments = append(sequenceStep.Attachments, uint(assetID))
+	}
+	return sequenceStep
+}
+
+// toStepUpdate the fields of `update_mask`, the populated fields of the step without mask (as per AIP-134)
+func toStepUpdate(request *pb.UpdateStepRequest) (api.SequenceStepUpdate, error) {
+	step := fromPbStep(request.GetStep())
+	paths := request.GetUpdateMask().GetPaths()
+	if request.GetUpdateMask() == nil && request.GetStep() != nil {
+		request.GetStep().ProtoReflect().Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			paths = append(paths, string(field.Name()))
+			return true
+		})
+	}
+
+	var update api.SequenceStepUpdate
+	for _, path := range paths {
+		switch path {
+		case "subject":
+			update.Subject = &step.Subject
+		case "content":
+			update.Content = &step.Content
+		case "position":
+			update.Position = &step.Position
+		case "wait_days":
+			update.WaitDays = &step.WaitDays
+		case "type":
+			update.Type = &step.Type
+		case "wait_until":
+			update.WaitUntil = step.WaitUntil
+		case "url":
+			update.URL = &step.URL
+		case "method":
+			update.Method = &step.Method
+		case "attachments":
+			update.Attachments = &step.Attachments
+		case "id", "sequence_id":
+			// identify the step, they aren't updated
+			if request.GetUpdateMask() != nil {
+				return update, status.Errorf(codes.InvalidArgument, "update_mask: %s can't be updated", path)
+			}
+		default:
+			return update, status.Errorf(codes.InvalidArgument, "update_mask: unknown field %q", path)
+		}
+	}
+	return update, nil
+}
+
+type callerKey struct{}
+
+func getCaller(ctx context.Context) service.Caller {
+	caller, _ := ctx.Value(callerKey{}).(service.Caller)
+	return caller
+}
+
+// authenticator is the gRPC counterpart of `middleware.RequestID` & `middleware.Actor`,
+// reading `x-request-id` & `x-api-key` from the incoming metadata
+type authenticator struct {
+	apiKeyService service.ApiKeyService
+}
+
+func (a authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	identity, ok := middleware.ResolveIdentity(a.apiKeyService, firstValue(md, middleware.ApiKeyHeader))
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, middleware.InvalidApiKeyMessage)
+	}
+
+	requestID := firstValue(md, middleware.RequestIDHeader)
+	if requestID == "" {
+		requestID = middleware.NewRequestID()
+	}
+	// echoed back like the REST response header
+	_ = grpc.SetHeader(ctx, metadata.Pairs(middleware.RequestIDHeader, requestID))
+
+	return context.WithValue(ctx, callerKey{}, service.Caller{Actor: identity.Actor, Workspace: identity.Workspace, RequestID: requestID}), nil
+}
+
+func (a authenticator) unary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a authenticator) stream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (as *authenticatedStream) Context() context.Context {
+	return as.ctx
+}
+
+// firstValue metadata keys are lowercase
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(strings.ToLower(key)); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
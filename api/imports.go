@@ -0,0 +1,47 @@
+package api
+
+import "time"
+
+// Contact import statuses, `failed` imports couldn't read their file (see `Error`) & `canceled` ones were interrupted
+// Both start over when their job is retried
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+	ImportCanceled  = "canceled"
+)
+
+// What an import does with rows whose email belongs to a contact already
+const (
+	ImportExistingSkip   = "skip"
+	ImportExistingUpdate = "update" // non-empty columns overwrite the contact's fields, tags & attributes are added
+)
+
+// ImportFields contact fields CSV columns map to, besides custom attributes (`attributes.<name>`)
+var ImportFields = []string{"email", "first_name", "last_name", "time_zone", "tags"}
+
+// ContactImport is a CSV upload, processed in the background & polled for its progress
+// `Mapping` maps CSV columns (by header) to `ImportFields` or custom attributes, without it columns named like a field
+// map to it & the others to attributes
+type ContactImport struct {
+	ID         uint              `gorm:"primaryKey"`
+	Workspace  string            `gorm:"index" json:"-"`
+	Status     string            `gorm:"index"`
+	Mapping    map[string]string `gorm:"serializer:json" json:",omitempty"`
+	Existing   string            `valid:"in(skip|update)"`
+	SequenceID uint              `json:",omitempty"` // imported contacts get enrolled in it
+	JobID      uint              // the `contact_import` job processing it
+	File       string            `json:"-"` // the spooled upload, removed once processed
+	Rows       int               // processed so far
+	Created    int
+	Updated    int
+	Skipped    int // existing contacts (unless updated)
+	Failed     int
+	Enrolled   int
+	Errors     []string `gorm:"serializer:json" json:",omitempty"` // per (1-based) CSV line, the first 100 only
+	Error      string   `json:",omitempty"`
+	CreatedAt  time.Time
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
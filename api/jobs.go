@@ -0,0 +1,70 @@
+package api
+
+import "time"
+
+// Job statuses, `dead` jobs exhausted their attempts or failed permanently (kept until retried manually)
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+	JobCanceled  = "canceled"
+)
+
+var JobStatuses = []string{JobPending, JobRunning, JobSucceeded, JobDead, JobCanceled}
+
+// Job types, each has its own payload
+const (
+	JobTypeContactImport   = "contact_import"   // ContactImportJob
+	JobTypeBulkEnroll      = "bulk_enroll"      // BulkEnrollJob
+	JobTypeWebhookDelivery = "webhook_delivery" // WebhookDeliveryJob
+	JobTypeSequenceExport  = "sequence_export"  // SequenceExportJob, the result is the `SequenceDocument`
+)
+
+// Job is a unit of background work, queued in the DB & picked up by a worker
+// A running job is leased by its worker until `LeaseExpiresAt`, the lease is renewed while it runs:
+// jobs of a worker that went away are picked up again once their lease expired
+type Job struct {
+	ID             uint   `gorm:"primaryKey"`
+	Workspace      string `gorm:"index" json:"-"`
+	Type           string `gorm:"index"`
+	Payload        string
+	Status         string `gorm:"index"`
+	Attempts       uint   // made so far
+	MaxAttempts    uint
+	RunAt          time.Time  `gorm:"index"` // when the next attempt is due
+	LeasedBy       string     `json:",omitempty"`
+	LeaseExpiresAt *time.Time `json:",omitempty"`
+	LastError      string     `json:",omitempty"`
+	Result         string     `json:",omitempty"` // JSON, depending on the type
+	FinishedAt     *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// ContactImportJob is the payload of `contact_import` jobs
+type ContactImportJob struct {
+	ImportID uint
+}
+
+// BulkEnrollmentRequest enrolls many contacts at once, in the background
+type BulkEnrollmentRequest struct {
+	ContactIDs []uint `valid:"required"`
+}
+
+// BulkEnrollJob is the payload of `bulk_enroll` jobs
+type BulkEnrollJob struct {
+	SequenceID uint
+	ContactIDs []uint
+}
+
+// SequenceExportJob is the payload of `sequence_export` jobs
+type SequenceExportJob struct {
+	SequenceID uint
+}
+
+// BulkEnrollResult is the result of `bulk_enroll` jobs, `Skipped` contacts were unknown or enrolled already
+type BulkEnrollResult struct {
+	Enrolled int
+	Skipped  int
+}
@@ -0,0 +1,54 @@
+package api
+
+// Lint severities, `error` issues block saving the content under the `block` policy
+const (
+	LintWarning = "warning"
+	LintError   = "error"
+)
+
+// Lint policies (see `service.LintPolicyEnv`)
+const (
+	LintPolicyBlock = "block" // content with lint errors isn't saved (default)
+	LintPolicyWarn  = "warn"  // lint errors are reported like warnings
+)
+
+// Lint rules, each issue is reported by one of them
+const (
+	LintRuleHTML        = "html"        // unbalanced tags
+	LintRuleText        = "text"        // plain-text alternative
+	LintRuleVariable    = "variable"    // broken, unknown or (for a contact) empty template variables
+	LintRuleSpam        = "spam"        // trigger words, shouting & the spam score as a whole
+	LintRuleLinks       = "links"       // too many links for the text
+	LintRuleImage       = "image"       // oversized images
+	LintRuleUnsubscribe = "unsubscribe" // no `{{unsubscribe_url}}` placeholder
+)
+
+// LintIssue `Message` starts with the checked field (`Subject: ` or `Content: `)
+type LintIssue struct {
+	Severity string
+	Rule     string
+	Message  string
+}
+
+// LintReport of an email's subject & content, `SpamScore` adds up the weights of the spam signals found
+type LintReport struct {
+	SpamScore float64
+	Issues    []LintIssue
+}
+
+// HasErrors whether any issue is an error
+func (lr *LintReport) HasErrors() bool {
+	for _, issue := range lr.Issues {
+		if issue.Severity == LintError {
+			return true
+		}
+	}
+	return false
+}
+
+// StepPreview is an email step as sent to a contact (with its variables replaced) along with its lint report
+type StepPreview struct {
+	Subject string
+	Content string
+	Lint    LintReport
+}
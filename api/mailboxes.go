@@ -0,0 +1,40 @@
+package api
+
+import "time"
+
+// Mailbox rotations, i.e. which of the mailboxes of a sequence sends the first step to a contact
+const (
+	MailboxRotationRoundRobin = "round_robin" // the least recently picked mailbox
+	MailboxRotationSticky     = "sticky"      // the mailbox which already emailed the contact (in any sequence) or a fixed one per contact
+)
+
+// Mailbox is an identity emails are sent from, optionally through its own SMTP server
+// `SMTPPassword` is write-only, username & password are stored encrypted in `SMTPCredentials`
+type Mailbox struct {
+	ID              uint   `gorm:"primaryKey"`
+	FromName        string `valid:"required"`
+	Address         string `valid:"email,required" gorm:"unique"` // stored lowercase
+	ReplyTo         string `valid:"email"`
+	Signature       string // HTML appended to the content of every email
+	SMTPHost        string `valid:"host"`
+	SMTPPort        uint   // 587 when `SMTPHost` is set
+	SMTPUsername    string `gorm:"-"`
+	SMTPPassword    string `gorm:"-" json:",omitempty"`
+	SMTPCredentials string `json:"-"`
+	CreatedAt       time.Time
+}
+
+// SequenceMailbox assigns a mailbox to a sequence, `LastPickedAt` drives the round-robin rotation
+type SequenceMailbox struct {
+	SequenceID   uint `gorm:"primaryKey"`
+	MailboxID    uint `gorm:"primaryKey;index"`
+	Position     uint
+	LastPickedAt *time.Time
+}
+
+// SequenceMailboxes is the body of `PUT /sequences/:id/mailboxes` & the response of both its methods
+type SequenceMailboxes struct {
+	Rotation   string    `valid:"in(round_robin|sticky)"` // round_robin when empty
+	MailboxIDs []uint    `json:",omitempty"`              // replaces the assigned mailboxes, in order
+	Mailboxes  []Mailbox `json:",omitempty"`              // only in responses
+}
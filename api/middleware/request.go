@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+const (
+	RequestIDHeader = "X-Request-Id"
+	ApiKeyHeader    = "X-Api-Key"
+
+	requestIDKey = "RequestID"
+	actorKey     = "Actor"
+	workspaceKey = "Workspace"
+
+	// AnonymousActor is recorded when no API key was supplied with the request
+	AnonymousActor = "anonymous"
+
+	InvalidApiKeyMessage = "Invalid API key."
+)
+
+// RequestID reuses the caller supplied `X-Request-Id` header or generates a new one,
+// and echoes it back in the response so both sides can correlate logs/audit records
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = NewRequestID()
+		}
+
+		ctx.Set(requestIDKey, requestID)
+		ctx.Header(RequestIDHeader, requestID)
+		ctx.Next()
+	}
+}
+
+// Actor identifies the caller (& its workspace) by the API key supplied in `X-Api-Key` header, unknown keys are rejected.
+// Requests without a key are still accepted (as anonymous, in the default workspace) until authentication is enforced
+func Actor(db *gorm.DB) gin.HandlerFunc {
+	apiKeyService := service.ApiKeyService{Db: db}
+
+	return func(ctx *gin.Context) {
+		identity, ok := ResolveIdentity(apiKeyService, ctx.GetHeader(ApiKeyHeader))
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, api.ErrorResponse{Error: InvalidApiKeyMessage})
+			return
+		}
+
+		ctx.Set(actorKey, identity.Actor)
+		ctx.Set(workspaceKey, identity.Workspace)
+		ctx.Next()
+	}
+}
+
+// Identity `Actor` is recorded in audit log
+type Identity struct {
+	Actor     string
+	Workspace string
+}
+
+// ResolveIdentity maps the raw API key to the caller identity, `ok` is false for unknown keys.
+// Shared with the gRPC API, which reads the key from metadata instead
+func ResolveIdentity(apiKeyService service.ApiKeyService, rawKey string) (identity Identity, ok bool) {
+	if rawKey == "" {
+		return Identity{Actor: AnonymousActor, Workspace: api.DefaultWorkspace}, true
+	}
+	apiKey := apiKeyService.GetByKey(rawKey)
+	if apiKey.ID == 0 {
+		return Identity{}, false
+	}
+	return Identity{Actor: "apikey:" + apiKey.Prefix, Workspace: apiKey.Workspace}, true
+}
+
+func GetRequestID(ctx *gin.Context) string {
+	return ctx.GetString(requestIDKey)
+}
+
+func GetActor(ctx *gin.Context) string {
+	actor := ctx.GetString(actorKey)
+	if actor == "" {
+		return AnonymousActor
+	}
+	return actor
+}
+
+func GetWorkspace(ctx *gin.Context) string {
+	workspace := ctx.GetString(workspaceKey)
+	if workspace == "" {
+		return api.DefaultWorkspace
+	}
+	return workspace
+}
+
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
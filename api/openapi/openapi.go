@@ -0,0 +1,465 @@
+package openapi
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Operation documents a single route, `Route` uses gin syntax relative to the API version group (root for `Public` ones)
+type Operation struct {
+	Method  string
+	Route   string
+	Path    string // OpenAPI path when it can't be derived from `Route` (e.g. custom methods like `steps:batch`)
+	Summary string
+	Tag     string
+	Query   []Parameter
+	Request any // JSON body, `nil` when there is none
+	Status  int // success status
+	Result  any // JSON result, `nil` when there is no body
+	Errors  []int
+
+	RequestType string // media type of a non JSON body (e.g. text/csv)
+	ResultType  string // media type of a non JSON result (e.g. text/csv)
+	Public      bool   // registered outside the API version group, without API key (e.g. unsubscribe links)
+}
+
+type Parameter struct {
+	Name        string
+	Description string
+	Type        string
+}
+
+var (
+	ginParam  = regexp.MustCompile(`:(\w+)`)
+	pathParam = regexp.MustCompile(`\{(\w+)\}`)
+)
+
+// Operations every route registered in `config.SetupRouter` must be listed here (enforced by tests)
+var Operations = []Operation{
+	{Method: http.MethodGet, Route: "/", Summary: "Health check", Tag: "Meta", Status: http.StatusOK},
+	{Method: http.MethodGet, Route: "/openapi.json", Summary: "This document", Tag: "Meta", Status: http.StatusOK},
+
+	{Method: http.MethodGet, Route: "/sequences", Summary: "List sequences", Tag: "Sequences",
+		Status: http.StatusOK, Result: []api.Sequence{}},
+	{Method: http.MethodPost, Route: "/sequences", Summary: "Create a sequence", Tag: "Sequences",
+		Request: api.Sequence{}, Status: http.StatusCreated, Result: api.Sequence{},
+		Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/sequences/import", Summary: "Create (201) or update (200) a sequence by name from a document", Tag: "Sequences",
+		Query:   []Parameter{{Name: "dry_run", Description: "only report what would change", Type: "boolean"}},
+		Request: api.SequenceDocument{}, Status: http.StatusOK, Result: api.SequenceImportResult{},
+		Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodPut, Route: "/sequences/:id", Summary: "Update a sequence (name, open or click tracking)", Tag: "Sequences",
+		Request: api.Sequence{}, Status: http.StatusOK,
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodGet, Route: "/sequences/:id", Summary: "View a sequence with its steps", Tag: "Sequences",
+		Status: http.StatusOK, Result: api.SequenceWithSteps{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodDelete, Route: "/sequences/:id", Summary: "Delete a sequence along with its steps", Tag: "Sequences",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/sequences/:id/export", Summary: "Export a sequence as a document", Tag: "Sequences",
+		Query:  []Parameter{{Name: "format", Description: "json (default) or yaml", Type: "string"}},
+		Status: http.StatusOK, Result: api.SequenceDocument{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/sequences/:id/export", Summary: "Export a sequence in a background job (its result is the document)", Tag: "Sequences",
+		Status: http.StatusAccepted, Result: api.Job{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/sequences/:id/stats", Summary: "Step, bounce & complaint counts of a sequence", Tag: "Sequences",
+		Status: http.StatusOK, Result: api.SequenceStats{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/sequences/:id/schedule", Summary: "Set the sending window, time zone, business days & holiday calendar", Tag: "Sequences",
+		Request: api.SendSchedule{}, Status: http.StatusOK, Result: api.Sequence{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/sequences/:id/preview", Summary: "Projected send (or due) times of the steps on the path of a contact", Tag: "Sequences",
+		Query: []Parameter{
+			{Name: "contact_id", Type: "integer"},
+			{Name: "start", Description: "RFC 3339 enrollment time (default now), ignored for enrolled contacts", Type: "string"},
+		},
+		Status: http.StatusOK, Result: []api.SendPreview{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/sequences/:id/mailboxes", Summary: "Mailboxes the sequence is sent from & their rotation", Tag: "Sequences",
+		Status: http.StatusOK, Result: api.SequenceMailboxes{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/sequences/:id/mailboxes", Summary: "Assign mailboxes (round_robin or sticky rotation)", Tag: "Sequences",
+		Request: api.SequenceMailboxes{}, Status: http.StatusOK, Result: api.SequenceMailboxes{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/sequences/:id/edges", Summary: "Conditional edges between the steps of the sequence", Tag: "Sequences",
+		Status: http.StatusOK, Result: api.SequenceGraph{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/sequences/:id/edges", Summary: "Replace the edges (acyclic, every step reachable from the first one)", Tag: "Sequences",
+		Request: api.SequenceGraph{}, Status: http.StatusOK, Result: api.SequenceGraph{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/sequences/:id/auto-enrollment", Summary: "Auto-enroll the members of a segment (exclusions & re-enrollment policy)", Tag: "Sequences",
+		Request: api.AutoEnrollment{}, Status: http.StatusOK, Result: api.Sequence{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/sequences/:id/activate", Summary: "Activate a draft", Tag: "Sequences",
+		Status: http.StatusOK, Result: api.Sequence{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/sequences/:id/pause", Summary: "Pause an active sequence, no step is sent until resumed", Tag: "Sequences",
+		Status: http.StatusOK, Result: api.Sequence{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/sequences/:id/resume", Summary: "Resume a paused sequence, due times are shifted by the pause", Tag: "Sequences",
+		Status: http.StatusOK, Result: api.Sequence{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/sequences/:id/archive", Summary: "Archive a sequence, its enrollments are held & no contact can be enrolled anymore", Tag: "Sequences",
+		Status: http.StatusOK, Result: api.Sequence{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/sequences/:id/steps:action", Path: "/sequences/{id}/steps:batch",
+		Summary: "Create, update & delete steps atomically", Tag: "Steps",
+		Request: api.BatchStepsRequest{}, Status: http.StatusOK, Result: api.BatchStepsResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+
+	{Method: http.MethodGet, Route: "/sequences/:id/enrollments", Summary: "List the enrollments of a sequence", Tag: "Contacts",
+		Status: http.StatusOK, Result: []api.Enrollment{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/sequences/:id/enrollments", Summary: "Enroll a contact, its first step is sent after its wait days", Tag: "Contacts",
+		Request: api.EnrollmentRequest{}, Status: http.StatusCreated, Result: api.Enrollment{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/sequences/:id/enrollments/bulk", Summary: "Enroll many contacts in a background job (its result counts enrolled & skipped contacts)", Tag: "Contacts",
+		Request: api.BulkEnrollmentRequest{}, Status: http.StatusAccepted, Result: api.Job{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/sequences/:id/enrollments/:enrollmentID/pause", Summary: "Pause an active enrollment", Tag: "Contacts",
+		Status: http.StatusOK, Result: api.Enrollment{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/sequences/:id/enrollments/:enrollmentID/resume", Summary: "Resume a paused enrollment, its next step is shifted by the pause", Tag: "Contacts",
+		Status: http.StatusOK, Result: api.Enrollment{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/sequences/:id/enrollments/:enrollmentID/stop", Summary: "Stop an active or paused enrollment for good", Tag: "Contacts",
+		Status: http.StatusOK, Result: api.Enrollment{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+
+	{Method: http.MethodPost, Route: "/sequence-steps", Summary: "Create a step (email, manual_task, wait_until or http_call)", Tag: "Steps",
+		Request: api.SequenceStep{}, Status: http.StatusCreated, Result: api.SequenceStep{},
+		Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodPut, Route: "/sequence-steps/:id", Summary: "Update the given fields of a step (type, subject, content, delays & the fields of its type)", Tag: "Steps",
+		Request: api.SequenceStepUpdate{}, Status: http.StatusOK, Result: api.SequenceStep{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodDelete, Route: "/sequence-steps/:id", Summary: "Delete a step", Tag: "Steps",
+		Query:  []Parameter{{Name: "force", Description: "true to delete a step of an active sequence", Type: "boolean"}},
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodGet, Route: "/sequence-steps/:id", Summary: "View a step", Tag: "Steps",
+		Status: http.StatusOK, Result: api.SequenceStep{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/sequence-steps/:id/preview", Summary: "Render an email step for a contact, with its lint report", Tag: "Steps",
+		Query:  []Parameter{{Name: "contact_id", Type: "integer"}},
+		Status: http.StatusOK, Result: api.StepPreview{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/sequence-steps/:id/variants", Summary: "List the A/B variants of a step", Tag: "Steps",
+		Status: http.StatusOK, Result: []api.StepVariant{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/sequence-steps/:id/variants", Summary: "Add an A/B variant (subject & content) to an email step", Tag: "Steps",
+		Request: api.StepVariant{}, Status: http.StatusCreated, Result: api.StepVariant{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPut, Route: "/sequence-steps/:id/variants/:variantID", Summary: "Update an A/B variant", Tag: "Steps",
+		Request: api.StepVariant{}, Status: http.StatusOK, Result: api.StepVariant{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodDelete, Route: "/sequence-steps/:id/variants/:variantID", Summary: "Delete an A/B variant", Tag: "Steps",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/sequence-steps/:id/promotion", Summary: "Set the winner or the auto-promotion (metric & sample size) of the variants", Tag: "Steps",
+		Request: api.VariantPromotion{}, Status: http.StatusOK, Result: api.SequenceStep{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/sequence-steps/:id/variant-stats", Summary: "Sent, open, click & reply counts per variant", Tag: "Steps",
+		Status: http.StatusOK, Result: []api.VariantStats{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+
+	{Method: http.MethodGet, Route: "/audit", Summary: "List audit records", Tag: "Audit",
+		Query: []Parameter{
+			{Name: "entity", Description: "e.g. Sequence or SequenceStep", Type: "string"},
+			{Name: "entity_id", Type: "integer"},
+			{Name: "from", Description: "RFC 3339 time", Type: "string"},
+			{Name: "to", Description: "RFC 3339 time", Type: "string"},
+		},
+		Status: http.StatusOK, Result: []api.AuditRecord{}, Errors: []int{http.StatusBadRequest}},
+
+	{Method: http.MethodGet, Route: "/webhooks", Summary: "List webhook subscriptions (without secrets)", Tag: "Webhooks",
+		Status: http.StatusOK, Result: []api.WebhookSubscription{}},
+	{Method: http.MethodPost, Route: "/webhooks", Summary: "Subscribe to events, the (generated) secret is only returned here", Tag: "Webhooks",
+		Request: api.WebhookSubscription{}, Status: http.StatusCreated, Result: api.WebhookSubscription{},
+		Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodGet, Route: "/webhooks/:id", Summary: "View a webhook subscription", Tag: "Webhooks",
+		Status: http.StatusOK, Result: api.WebhookSubscription{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/webhooks/:id", Summary: "Update a webhook subscription (secret is kept when omitted)", Tag: "Webhooks",
+		Request: api.WebhookSubscription{}, Status: http.StatusOK, Result: api.WebhookSubscription{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodDelete, Route: "/webhooks/:id", Summary: "Delete a webhook subscription along with its deliveries", Tag: "Webhooks",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/webhooks/:id/deliveries", Summary: "Delivery log of a webhook subscription (newest first)", Tag: "Webhooks",
+		Query:  []Parameter{{Name: "status", Description: "pending, succeeded or failed", Type: "string"}},
+		Status: http.StatusOK, Result: []api.WebhookDelivery{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/webhooks/:id/deliveries/:deliveryID/redeliver", Summary: "Queue a delivery again", Tag: "Webhooks",
+		Status: http.StatusAccepted, Result: api.WebhookDelivery{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+
+	{Method: http.MethodGet, Route: "/holiday-calendars", Summary: "List holiday calendars", Tag: "Schedules",
+		Status: http.StatusOK, Result: []api.HolidayCalendar{}},
+	{Method: http.MethodPost, Route: "/holiday-calendars", Summary: "Create a holiday calendar (YYYY-MM-DD dates)", Tag: "Schedules",
+		Request: api.HolidayCalendar{}, Status: http.StatusCreated, Result: api.HolidayCalendar{},
+		Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodGet, Route: "/holiday-calendars/:id", Summary: "View a holiday calendar", Tag: "Schedules",
+		Status: http.StatusOK, Result: api.HolidayCalendar{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/holiday-calendars/:id", Summary: "Update a holiday calendar", Tag: "Schedules",
+		Request: api.HolidayCalendar{}, Status: http.StatusOK, Result: api.HolidayCalendar{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodDelete, Route: "/holiday-calendars/:id", Summary: "Delete a holiday calendar (not used by any sequence)", Tag: "Schedules",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+
+	{Method: http.MethodGet, Route: "/mailboxes", Summary: "List mailboxes", Tag: "Mailboxes",
+		Status: http.StatusOK, Result: []api.Mailbox{}},
+	{Method: http.MethodPost, Route: "/mailboxes", Summary: "Create a mailbox (SMTP credentials are stored encrypted)", Tag: "Mailboxes",
+		Request: api.Mailbox{}, Status: http.StatusCreated, Result: api.Mailbox{},
+		Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodGet, Route: "/mailboxes/:id", Summary: "View a mailbox", Tag: "Mailboxes",
+		Status: http.StatusOK, Result: api.Mailbox{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/mailboxes/:id", Summary: "Update a mailbox (the SMTP password is kept when omitted)", Tag: "Mailboxes",
+		Request: api.Mailbox{}, Status: http.StatusOK, Result: api.Mailbox{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodDelete, Route: "/mailboxes/:id", Summary: "Delete a mailbox (not used by any sequence or active enrollment)", Tag: "Mailboxes",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+
+	{Method: http.MethodGet, Route: "/assets", Summary: "List assets (files attached to or inlined into email steps)", Tag: "Assets",
+		Status: http.StatusOK, Result: []api.Asset{}},
+	{Method: http.MethodPost, Route: "/assets", Summary: "Upload a PDF or image (up to 5 MiB), its type is sniffed from the content", Tag: "Assets",
+		Query:       []Parameter{{Name: "name", Description: "file name of the attachment", Type: "string"}},
+		RequestType: "application/octet-stream", Status: http.StatusCreated, Result: api.Asset{},
+		Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType}},
+	{Method: http.MethodGet, Route: "/assets/:id", Summary: "View an asset", Tag: "Assets",
+		Status: http.StatusOK, Result: api.Asset{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/assets/:id/content", Summary: "Download the content of an asset", Tag: "Assets",
+		Status: http.StatusOK, ResultType: "application/octet-stream", Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodDelete, Route: "/assets/:id", Summary: "Delete an asset (not used by any step)", Tag: "Assets",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+
+	{Method: http.MethodGet, Route: "/throttles", Summary: "List send throttles", Tag: "Throttles",
+		Status: http.StatusOK, Result: []api.Throttle{}},
+	{Method: http.MethodPost, Route: "/throttles", Summary: "Limit sends per mailbox, recipient domain or globally", Tag: "Throttles",
+		Request: api.Throttle{}, Status: http.StatusCreated, Result: api.Throttle{},
+		Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodDelete, Route: "/throttles/:id", Summary: "Delete a throttle", Tag: "Throttles",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/throttles/usage", Summary: "Current quota usage of every throttle bucket", Tag: "Throttles",
+		Status: http.StatusOK, Result: []api.ThrottleUsage{}},
+
+	{Method: http.MethodGet, Route: "/contacts", Summary: "List the contacts of the workspace", Tag: "Contacts",
+		Status: http.StatusOK, Result: []api.Contact{}},
+	{Method: http.MethodPost, Route: "/contacts", Summary: "Create a contact", Tag: "Contacts",
+		Request: api.Contact{}, Status: http.StatusCreated, Result: api.Contact{},
+		Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodGet, Route: "/contacts/:id", Summary: "View a contact", Tag: "Contacts",
+		Status: http.StatusOK, Result: api.Contact{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/contacts/:id", Summary: "Update a contact (auto-enrolls it in the sequences of segments it enters)", Tag: "Contacts",
+		Request: api.Contact{}, Status: http.StatusOK, Result: api.Contact{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/contacts/import", Summary: "Import contacts from CSV (with header line) in a background job", Tag: "Contacts",
+		Query: []Parameter{
+			{Name: "map[<column>]", Description: "field of a column: email, first_name, last_name, time_zone, tags or attributes.<name> (repeated)", Type: "string"},
+			{Name: "existing", Description: "skip (default) or update contacts whose email exists", Type: "string"},
+			{Name: "sequence_id", Description: "enroll the imported contacts in this sequence", Type: "integer"},
+		},
+		RequestType: "text/csv", Status: http.StatusAccepted, Result: api.ContactImport{},
+		Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodGet, Route: "/contacts/imports/:id", Summary: "Progress of a contact import (row counts & errors per line)", Tag: "Contacts",
+		Status: http.StatusOK, Result: api.ContactImport{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodDelete, Route: "/contacts/:id", Summary: "Delete a contact along with its enrollments", Tag: "Contacts",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+
+	{Method: http.MethodGet, Route: "/segments", Summary: "List the segments of the workspace", Tag: "Segments",
+		Status: http.StatusOK, Result: []api.Segment{}},
+	{Method: http.MethodPost, Route: "/segments", Summary: "Create a segment (contacts matching every rule)", Tag: "Segments",
+		Request: api.Segment{}, Status: http.StatusCreated, Result: api.Segment{},
+		Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodGet, Route: "/segments/:id", Summary: "View a segment", Tag: "Segments",
+		Status: http.StatusOK, Result: api.Segment{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPut, Route: "/segments/:id", Summary: "Update a segment", Tag: "Segments",
+		Request: api.Segment{}, Status: http.StatusOK, Result: api.Segment{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodDelete, Route: "/segments/:id", Summary: "Delete a segment (not used by any sequence)", Tag: "Segments",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodGet, Route: "/segments/:id/contacts", Summary: "Current members of a segment", Tag: "Segments",
+		Status: http.StatusOK, Result: []api.Contact{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+
+	{Method: http.MethodGet, Route: "/tasks", Summary: "Task inbox of manual steps", Tag: "Tasks",
+		Query:  []Parameter{{Name: "status", Description: "open (default), completed or skipped", Type: "string"}},
+		Status: http.StatusOK, Result: []api.Task{},
+		Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodGet, Route: "/tasks/:id", Summary: "View a task", Tag: "Tasks",
+		Status: http.StatusOK, Result: api.Task{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/tasks/:id/complete", Summary: "Complete a task, its enrollment moves on", Tag: "Tasks",
+		Status: http.StatusOK, Result: api.Task{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/tasks/:id/skip", Summary: "Skip a task, its enrollment moves on", Tag: "Tasks",
+		Status: http.StatusOK, Result: api.Task{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+
+	{Method: http.MethodGet, Route: "/jobs", Summary: "List the background jobs, latest first", Tag: "Jobs",
+		Query:  []Parameter{{Name: "status", Description: "pending, running, succeeded, dead or canceled", Type: "string"}},
+		Status: http.StatusOK, Result: []api.Job{},
+		Errors: []int{http.StatusBadRequest}},
+	{Method: http.MethodGet, Route: "/jobs/:id", Summary: "Status, attempts & result of a background job", Tag: "Jobs",
+		Status: http.StatusOK, Result: api.Job{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/jobs/:id/cancel", Summary: "Cancel a pending or running job", Tag: "Jobs",
+		Status: http.StatusOK, Result: api.Job{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: http.MethodPost, Route: "/jobs/:id/retry", Summary: "Queue a dead or canceled job again, with a fresh set of attempts", Tag: "Jobs",
+		Status: http.StatusOK, Result: api.Job{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+
+	{Method: http.MethodGet, Route: "/suppressions", Summary: "List the suppression list of the workspace", Tag: "Suppressions",
+		Query:  []Parameter{{Name: "reason", Description: "unsubscribed or manual", Type: "string"}},
+		Status: http.StatusOK, Result: []api.Suppression{}},
+	{Method: http.MethodPost, Route: "/suppressions", Summary: "Add an email to the suppression list", Tag: "Suppressions",
+		Request: api.Suppression{}, Status: http.StatusCreated, Result: api.Suppression{},
+		Errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: http.MethodDelete, Route: "/suppressions/:id", Summary: "Remove an email from the suppression list", Tag: "Suppressions",
+		Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: http.MethodGet, Route: "/suppressions/export", Summary: "Export the suppression list as CSV (email, reason, created_at)", Tag: "Suppressions",
+		Status: http.StatusOK, ResultType: "text/csv"},
+	{Method: http.MethodPost, Route: "/suppressions/import", Summary: "Import `email[,reason]` CSV lines, already suppressed emails are skipped", Tag: "Suppressions",
+		RequestType: "text/csv", Status: http.StatusOK, Result: api.SuppressionImportResult{},
+		Errors: []int{http.StatusBadRequest}},
+
+	{Method: http.MethodGet, Route: "/bounces", Summary: "List bounces & complaints of the workspace (newest first)", Tag: "Bounces",
+		Query:  []Parameter{{Name: "type", Description: "bounce or complaint", Type: "string"}},
+		Status: http.StatusOK, Result: []api.BounceEvent{}},
+	{Method: http.MethodPost, Route: "/bounces", Summary: "Process bounces & complaints, posted as JSON events or as a raw DSN/ARF message (message/rfc822)", Tag: "Bounces",
+		Request: api.InboundBouncesRequest{}, Status: http.StatusCreated, Result: []api.BounceEvent{},
+		Errors: []int{http.StatusBadRequest}},
+
+	{Method: http.MethodGet, Route: "/replies", Summary: "List replies of the workspace (newest first)", Tag: "Replies",
+		Status: http.StatusOK, Result: []api.Reply{}},
+	{Method: http.MethodPost, Route: "/replies", Summary: "Process an inbound email, a reply stops the enrollment it answers", Tag: "Replies",
+		RequestType: "message/rfc822", Status: http.StatusOK, Result: api.InboundReplyResult{},
+		Errors: []int{http.StatusBadRequest}},
+
+	{Method: http.MethodGet, Route: "/u/:token", Summary: "Unsubscribe confirmation page (linked from every email)", Tag: "Unsubscribe",
+		Public: true, Status: http.StatusOK, ResultType: "text/html", Errors: []int{http.StatusNotFound}},
+	{Method: http.MethodPost, Route: "/u/:token", Summary: "Unsubscribe, also used for RFC 8058 one-click (List-Unsubscribe-Post)", Tag: "Unsubscribe",
+		Public: true, RequestType: "application/x-www-form-urlencoded", Status: http.StatusOK, ResultType: "text/html",
+		Errors: []int{http.StatusNotFound}},
+
+	{Method: http.MethodGet, Route: "/o/:token", Summary: "Open tracking pixel", Tag: "Tracking",
+		Public: true, Status: http.StatusOK, ResultType: "image/gif"},
+	{Method: http.MethodGet, Route: "/c/:token", Summary: "Tracked link, redirects to the signed target", Tag: "Tracking",
+		Query:  []Parameter{{Name: "url", Type: "string"}},
+		Public: true, Status: http.StatusFound, Errors: []int{http.StatusNotFound}},
+
+	{Method: http.MethodPost, Route: "/graphql", Summary: "Execute a GraphQL query or mutation (schema: api/graphqlapi/schema.graphql)", Tag: "GraphQL",
+		Request: api.GraphQLRequest{}, Status: http.StatusOK, Result: api.GraphQLResponse{},
+		Errors: []int{http.StatusBadRequest}},
+}
+
+// OpenAPIPath converts gin route syntax (`:id`) to OpenAPI path templating (`{id}`)
+func (o Operation) OpenAPIPath() string {
+	if o.Path != "" {
+		return o.Path
+	}
+	return ginParam.ReplaceAllString(o.Route, "{$1}")
+}
+
+// Document builds the OpenAPI 3 document, `basePath` is the API version prefix (e.g. `/v1`)
+func Document(basePath string) map[string]any {
+	components := schemas{}
+	components.ref(reflect.TypeOf(api.ErrorResponse{}))
+
+	paths := map[string]any{}
+	for _, operation := range Operations {
+		path := operation.OpenAPIPath()
+		if !operation.Public {
+			path = basePath + path
+		}
+		pathItem, ok := paths[path].(map[string]any)
+		if !ok {
+			pathItem = map[string]any{}
+			paths[path] = pathItem
+		}
+		pathItem[strings.ToLower(operation.Method)] = operation.document(components)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Sequences API",
+			"version":     strings.TrimPrefix(basePath, "/"),
+			"description": "Email sequences with steps. Send `X-Api-Key` to be identified in the audit log.",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": components},
+	}
+}
+
+func (o Operation) document(components schemas) map[string]any {
+	var parameters []map[string]any
+	pathSchema := map[string]any{"type": "integer", "minimum": 0}
+	if o.Public {
+		pathSchema = map[string]any{"type": "string"}
+	}
+	for _, match := range pathParam.FindAllStringSubmatch(o.OpenAPIPath(), -1) {
+		parameters = append(parameters, map[string]any{
+			"name": match[1], "in": "path", "required": true, "schema": pathSchema,
+		})
+	}
+	for _, query := range o.Query {
+		parameters = append(parameters, map[string]any{
+			"name": query.Name, "in": "query", "description": query.Description,
+			"schema": map[string]any{"type": query.Type},
+		})
+	}
+
+	success := map[string]any{"description": http.StatusText(o.Status)}
+	if o.Result != nil {
+		success["content"] = jsonContent(components.ref(reflect.TypeOf(o.Result)))
+	}
+	if o.ResultType != "" {
+		success["content"] = textContent(o.ResultType)
+	}
+	responses := map[string]any{strconv.Itoa(o.Status): success}
+	errors := o.Errors
+	if !o.Public {
+		errors = append([]int{http.StatusUnauthorized}, errors...)
+	}
+	for _, status := range errors {
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description": http.StatusText(status),
+			"content":     jsonContent(components.ref(reflect.TypeOf(api.ErrorResponse{}))),
+		}
+	}
+
+	document := map[string]any{
+		"summary":   o.Summary,
+		"tags":      []string{o.Tag},
+		"responses": responses,
+	}
+	if len(parameters) > 0 {
+		document["parameters"] = parameters
+	}
+	if o.Request != nil {
+		document["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(components.ref(reflect.TypeOf(o.Request))),
+		}
+	}
+	if o.RequestType != "" {
+		document["requestBody"] = map[string]any{"required": true, "content": textContent(o.RequestType)}
+	}
+	return document
+}
+
+func textContent(mediaType string) map[string]any {
+	return map[string]any{mediaType: map[string]any{"schema": map[string]any{"type": "string"}}}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
@@ -0,0 +1,113 @@
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// validatorArg matches govalidator tag options with an argument, e.g. `minstringlength(3)`
+var validatorArg = regexp.MustCompile(`^(\w+)\((\d+)\)$`)
+
+// schemas collects component schemas of all (nested) structs referenced by the operations
+type schemas map[string]map[string]any
+
+// ref returns an inline schema for scalars & slices, structs are registered as components & referenced
+func (s schemas) ref(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		if _, ok := s[t.Name()]; !ok {
+			s[t.Name()] = nil // placeholder, guards against recursion
+			s[t.Name()] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Slice:
+		return map[string]any{"type": "array", "items": s.ref(t.Elem())}
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		return map[string]any{"type": "integer"}
+	}
+
+	return map[string]any{}
+}
+
+// object follows `encoding/json` naming rules & maps `valid` (govalidator) tags to schema constraints
+func (s schemas) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		// embedded structs are flattened by `encoding/json`
+		if field.Anonymous && field.Tag.Get("json") == "" && field.Type.Kind() == reflect.Struct {
+			embedded := s.object(field.Type)
+			for name, property := range embedded["properties"].(map[string]any) {
+				properties[name] = property
+			}
+			if embeddedRequired, ok := embedded["required"].([]string); ok {
+				required = append(required, embeddedRequired...)
+			}
+			continue
+		}
+
+		name := field.Name
+		if jsonTag := field.Tag.Get("json"); jsonTag != "" {
+			jsonName, _, _ := strings.Cut(jsonTag, ",")
+			if jsonName == "-" {
+				continue
+			}
+			if jsonName != "" {
+				name = jsonName
+			}
+		}
+
+		property := s.ref(field.Type)
+		for _, option := range strings.Split(strings.TrimSpace(field.Tag.Get("valid")), ",") {
+			switch option {
+			case "":
+			case "required":
+				required = append(required, name)
+			case "alphanum":
+				property["pattern"] = "^[a-zA-Z0-9]+$"
+			default:
+				matches := validatorArg.FindStringSubmatch(option)
+				if matches == nil {
+					continue
+				}
+				n, _ := strconv.Atoi(matches[2])
+				switch matches[1] {
+				case "minstringlength":
+					property["minLength"] = n
+				case "maxstringlength":
+					property["maxLength"] = n
+				}
+			}
+		}
+		properties[name] = property
+	}
+
+	object := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
@@ -0,0 +1,32 @@
+package api
+
+import "time"
+
+// Reply matching methods
+const (
+	ReplyMatchedByMessageID   = "message-id"   // `In-Reply-To` / `References` header
+	ReplyMatchedByPlusAddress = "plus-address" // tagged `Reply-To` address of the sent email
+)
+
+// Reply is an inbound email matched to the email it answers, its enrollment is moved to `replied`
+type Reply struct {
+	ID           uint   `gorm:"primaryKey"`
+	Workspace    string `gorm:"index" json:"-"`
+	EnrollmentID uint   `gorm:"index"`
+	EmailSendID  uint
+	ContactID    uint
+	SequenceID   uint   `gorm:"index"`
+	MessageID    string `json:",omitempty"` // of the reply itself
+	FromEmail    string
+	Subject      string
+	MatchedBy    string
+	CreatedAt    time.Time
+}
+
+// InboundReplyResult `Reply` is only set when the message could be matched to a sent email,
+// `Ignored` explains why a message wasn't considered (e.g. auto-replies)
+type InboundReplyResult struct {
+	Matched bool
+	Ignored string `json:",omitempty"`
+	Reply   *Reply `json:",omitempty"`
+}
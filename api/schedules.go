@@ -0,0 +1,37 @@
+package api
+
+import "time"
+
+// Weekdays as used by `SendSchedule.Days`, indexed by `time.Weekday`
+var Weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// SendSchedule restricts when the emails of a sequence go out, in the time zone of the contact
+// (`TimeZone` is used for contacts without one, UTC when empty). The zero value sends any time
+type SendSchedule struct {
+	Days              []string `gorm:"serializer:json"` // e.g. ["mon", "tue", "wed", "thu", "fri"], every day when empty
+	From              string   // local time of day, e.g. 09:00 (start of day when empty)
+	Until             string   // local time of day, e.g. 17:00 (end of day when empty)
+	TimeZone          string   // IANA name, e.g. Europe/Berlin
+	BusinessDaysOnly  bool     // step `WaitDays` count Mon-Fri only, holidays excluded
+	HolidayCalendarID uint     // no emails are sent on its dates
+}
+
+// HolidayCalendar `Dates` are local dates (YYYY-MM-DD)
+type HolidayCalendar struct {
+	ID    uint     `gorm:"primaryKey"`
+	Name  string   `valid:"required" gorm:"unique"`
+	Dates []string `gorm:"serializer:json"`
+}
+
+// SendPreview is the projected send time of a step for a contact, when the step is due for other step types
+// (a wait_until step is done once its `WaitUntil` passed)
+type SendPreview struct {
+	StepID   uint
+	Position uint
+	Type     string
+	Subject  string    `json:",omitempty"` // of email steps
+	SendAt   time.Time // UTC
+	LocalAt  string    // in `TimeZone` (RFC 3339)
+	TimeZone string    // of the contact, the schedule's when it has none (or an unknown one)
+	Branches []uint    `json:",omitempty"` // steps it may lead to, depending on how the contact engages
+}
@@ -0,0 +1,49 @@
+package api
+
+import "time"
+
+// Segment rule operators, `has` & `not_has` are for tags, the others for contact attributes
+// Values are compared case-insensitively, `matches` supports `*` & `?` wildcards
+const (
+	SegmentOpEquals    = "equals"
+	SegmentOpNotEquals = "not_equals"
+	SegmentOpContains  = "contains"
+	SegmentOpMatches   = "matches"
+	SegmentOpHas       = "has"
+	SegmentOpNotHas    = "not_has"
+)
+
+// SegmentAttributeTag filters on the tags of contacts, every other attribute is one of `EdgeAttributes`, `status`
+// or a custom attribute (`attributes.<name>`)
+const SegmentAttributeTag = "tag"
+
+type SegmentRule struct {
+	Attribute string `valid:"required"`
+	Operator  string `valid:"in(equals|not_equals|contains|matches|has|not_has),required"`
+	Value     string `valid:"required"`
+}
+
+// Segment is a saved filter over the contacts of a workspace, contacts matching every rule are its members
+type Segment struct {
+	ID        uint          `gorm:"primaryKey"`
+	Workspace string        `gorm:"uniqueIndex:idx_segments_workspace_name" json:"-"`
+	Name      string        `valid:"required,maxstringlength(50)" gorm:"uniqueIndex:idx_segments_workspace_name"`
+	Rules     []SegmentRule `gorm:"serializer:json"`
+	CreatedAt time.Time
+}
+
+// Re-enrollment policies, they apply to manual & automatic enrollments
+const (
+	ReenrollNever           = "never"
+	ReenrollAfterCompletion = "after_completion" // completed enrollments start over, `ReenrollAfterDays` after their completion
+)
+
+// AutoEnrollment enrolls contacts of `SegmentID` as soon as they are members (existing members once enabled)
+// Set through `PUT /sequences/:id/auto-enrollment`
+type AutoEnrollment struct {
+	SegmentID              uint   `json:",omitempty"` // 0 disables auto-enrollment
+	ExcludeSegmentID       uint   `json:",omitempty"` // its members are never enrolled automatically
+	ExcludeActiveElsewhere bool   // skips contacts with an active enrollment in another sequence
+	Reenrollment           string `valid:"in(never|after_completion)"` // never when empty
+	ReenrollAfterDays      uint
+}
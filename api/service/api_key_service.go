@@ -0,0 +1,45 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+)
+
+const apiKeyPrefixLength = 8
+
+type ApiKeyService struct {
+	Db *gorm.DB
+}
+
+// Create returns the raw key along with its record, the raw key can't be recovered later
+func (aks *ApiKeyService) Create(name string) (string, *api.ApiKey) {
+	return aks.CreateForWorkspace(name, api.DefaultWorkspace)
+}
+
+func (aks *ApiKeyService) CreateForWorkspace(name string, workspace string) (string, *api.ApiKey) {
+	rawKey := "sk_" + randomHex(24)
+
+	apiKey := api.ApiKey{
+		Name:      name,
+		Prefix:    rawKey[:apiKeyPrefixLength],
+		KeyHash:   hashApiKey(rawKey),
+		Workspace: workspace,
+	}
+	aks.Db.Create(&apiKey)
+
+	return rawKey, &apiKey
+}
+
+// GetByKey returns zero value (ID = 0) for unknown keys
+func (aks *ApiKeyService) GetByKey(rawKey string) *api.ApiKey {
+	var foundApiKey api.ApiKey
+	aks.Db.Where("key_hash = ?", hashApiKey(rawKey)).Find(&foundApiKey)
+	return &foundApiKey
+}
+
+func hashApiKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrAssetTooLarge   = fmt.Errorf("asset exceeds %d bytes", api.AssetMaxSize)
+	ErrAssetType       = fmt.Errorf("asset must be one of %s", strings.Join(api.AssetTypes, ", "))
+	inlineAssetPattern = regexp.MustCompile(`(?i)["']cid:asset-(\d+)["']`)
+)
+
+// AssetService keeps asset metadata in the DB & their content in `Store`
+type AssetService struct {
+	Db    *gorm.DB
+	Store AssetStore
+}
+
+func (as *AssetService) GetByID(id uint) *api.Asset {
+	var foundAsset api.Asset
+	as.Db.Where("id = ?", id).First(&foundAsset)
+	return &foundAsset
+}
+
+func (as *AssetService) List() []api.Asset {
+	assets := []api.Asset{}
+	as.Db.Order("id").Find(&assets)
+	return assets
+}
+
+// Create stores `content` (its type is sniffed), returns `ErrAssetTooLarge` or `ErrAssetType` for rejected uploads
+func (as *AssetService) Create(asset *api.Asset, content io.Reader) error {
+	reader := bufio.NewReader(io.LimitReader(content, api.AssetMaxSize+1))
+	head, _ := reader.Peek(512)
+	asset.ContentType, _, _ = strings.Cut(http.DetectContentType(head), ";")
+	if !govalidator.IsIn(asset.ContentType, api.AssetTypes...) {
+		return ErrAssetType
+	}
+
+	asset.Key = randomHex(16)
+	counted := &countingReader{reader: reader}
+	if err := as.Store.Put(asset.Key, counted); err != nil {
+		return err
+	}
+	if asset.Size = counted.count; asset.Size > api.AssetMaxSize {
+		_ = as.Store.Delete(asset.Key)
+		return ErrAssetTooLarge
+	}
+	return as.Db.Create(asset).Error
+}
+
+// Delete removes the content along with the asset, the content last (it can't be restored by a rollback)
+func (as *AssetService) Delete(asset *api.Asset) error {
+	if err := as.Db.Delete(asset).Error; err != nil {
+		return err
+	}
+	return as.Store.Delete(asset.Key)
+}
+
+// Read returns the content of the asset
+func (as *AssetService) Read(asset *api.Asset) ([]byte, error) {
+	content, err := as.Store.Open(asset.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return io.ReadAll(content)
+}
+
+// InUse whether an email step attaches or inlines the asset
+func (as *AssetService) InUse(asset *api.Asset) bool {
+	var steps []api.SequenceStep
+	as.Db.Where("type = ?", api.StepTypeEmail).Find(&steps)
+	for _, step := range steps {
+		for _, id := range append(step.Attachments, InlineAssetIDs(step.Content)...) {
+			if id == asset.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidateStepAssets attachments & inline images must exist (images only inline), within `api.StepAssetsMaxSize` altogether
+func (as *AssetService) ValidateStepAssets(step *api.SequenceStep) error {
+	if step.Type != api.StepTypeEmail && len(step.Attachments) > 0 {
+		return fmt.Errorf("Attachments: only allowed for %s steps", api.StepTypeEmail)
+	}
+
+	var size int64
+	seen := map[uint]bool{}
+	check := func(field string, ids []uint, types []string) error {
+		for _, id := range ids {
+			asset := as.GetByID(id)
+			if asset.ID == 0 {
+				return fmt.Errorf("%s: asset %d not found", field, id)
+			}
+			if !govalidator.IsIn(asset.ContentType, types...) {
+				return fmt.Errorf("%s: asset %d is %s, must be one of %s", field, id, asset.ContentType, strings.Join(types, ", "))
+			}
+			if !seen[id] {
+				seen[id] = true
+				size += asset.Size
+			}
+		}
+		return nil
+	}
+	if err := check("Attachments", step.Attachments, api.AssetTypes); err != nil {
+		return err
+	}
+	if err := check("Content", InlineAssetIDs(step.Content), api.AssetImageTypes); err != nil {
+		return err
+	}
+	if size > api.StepAssetsMaxSize {
+		return fmt.Errorf("Attachments: %d bytes altogether exceed %d", size, api.StepAssetsMaxSize)
+	}
+	return nil
+}
+
+// Parts of the email's MIME message: inline images of `content` & the step's attachments
+// Inline references to unknown (e.g. deleted) assets are left out
+func (as *AssetService) Parts(step *api.SequenceStep, content string) ([]Attachment, error) {
+	var attachments []Attachment
+	for _, id := range InlineAssetIDs(content) {
+		asset := as.GetByID(id)
+		if asset.ID == 0 || !govalidator.IsIn(asset.ContentType, api.AssetImageTypes...) {
+			continue
+		}
+		attachment, err := as.attachment(asset)
+		if err != nil {
+			return nil, err
+		}
+		attachment.ContentID = asset.ContentID()
+		attachments = append(attachments, attachment)
+	}
+	for _, id := range step.Attachments {
+		asset := as.GetByID(id)
+		if asset.ID == 0 {
+			return nil, fmt.Errorf("step %d: asset %d not found", step.ID, id)
+		}
+		attachment, err := as.attachment(asset)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+func (as *AssetService) attachment(asset *api.Asset) (Attachment, error) {
+	content, err := as.Read(asset)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("asset %d: %w", asset.ID, err)
+	}
+	return Attachment{Name: asset.Name, ContentType: asset.ContentType, Content: content}, nil
+}
+
+// InlineAssetIDs referenced by `cid:asset-<id>` in the content, once each
+func InlineAssetIDs(content string) []uint {
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, match := range inlineAssetPattern.FindAllStringSubmatch(content, -1) {
+		id, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || seen[uint(id)] {
+			continue
+		}
+		seen[uint(id)] = true
+		ids = append(ids, uint(id))
+	}
+	return ids
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// AssetDirEnv the local asset store keeps uploads in this directory (`assets` by default)
+const AssetDirEnv = "SEQUENCES_ASSET_DIR"
+
+// AssetStore keeps the content of assets by key (e.g. on the local filesystem or in an object storage)
+type AssetStore interface {
+	Put(key string, content io.Reader) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// LocalAssetStore stores every asset as a file of `Dir`, `$SEQUENCES_ASSET_DIR` when empty
+type LocalAssetStore struct {
+	Dir string
+}
+
+func (ls LocalAssetStore) Put(key string, content io.Reader) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	// written aside first, a failed upload leaves no partial file behind
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (ls LocalAssetStore) Open(key string) (io.ReadCloser, error) {
+	path, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (ls LocalAssetStore) Delete(key string) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path of `key` within the directory, keys never leave it
+func (ls LocalAssetStore) path(key string) (string, error) {
+	dir := ls.Dir
+	if dir == "" {
+		dir = os.Getenv(AssetDirEnv)
+	}
+	if dir == "" {
+		dir = "assets"
+	}
+	if !filepath.IsLocal(key) {
+		return "", errors.New("invalid asset key: " + key)
+	}
+	return filepath.Join(dir, key), nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"time"
+)
+
+type AuditService struct {
+	Db *gorm.DB
+}
+
+// AuditFilter zero values are ignored
+type AuditFilter struct {
+	Entity   string
+	EntityID uint
+	From     time.Time
+	To       time.Time
+}
+
+// Transaction runs `mutate` in a single transaction, which is rolled back when it returns an error
+// Mutations write their audit records within it (see `Record`): no change is kept without its record
+func (as *AuditService) Transaction(mutate func(tx *gorm.DB) error) error {
+	return as.Db.Transaction(mutate)
+}
+
+// Record only ever inserts, there is intentionally no update/delete counterpart
+// `tx` is the transaction of the recorded mutation
+func (as *AuditService) Record(tx *gorm.DB, record *api.AuditRecord) error {
+	return tx.Create(record).Error
+}
+
+func (as *AuditService) List(filter AuditFilter) []api.AuditRecord {
+	query := as.Db.Order("id")
+	if filter.Entity != "" {
+		query = query.Where("entity = ?", filter.Entity)
+	}
+	if filter.EntityID > 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at <= ?", filter.To)
+	}
+
+	records := []api.AuditRecord{}
+	query.Find(&records)
+	return records
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// AutoEnrollService enrolls the members of the segments sequences auto-enroll from
+type AutoEnrollService struct {
+	Db *gorm.DB
+}
+
+// Run syncs every auto-enrolling sequence every `interval` until `ctx` is done, this catches
+// re-enrollments becoming due & contacts entering a segment because it was changed
+func (as *AutoEnrollService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			as.SyncAll(time.Now().UTC())
+		}
+	}
+}
+
+// SyncAll returns the number of enrollments (re)started
+func (as *AutoEnrollService) SyncAll(now time.Time) int {
+	var sequences []api.Sequence
+	as.Db.Where("auto_enroll_segment_id <> 0").Order("id").Find(&sequences)
+
+	started := 0
+	for i := range sequences {
+		started += as.Sync(&sequences[i], now)
+	}
+	return started
+}
+
+// Sync enrolls every member of the sequence's segment who isn't excluded, returns the number of enrollments (re)started
+func (as *AutoEnrollService) Sync(sequence *api.Sequence, now time.Time) int {
+	segment := as.segment(sequence.AutoEnrollment.SegmentID)
+	if segment.ID == 0 {
+		return 0
+	}
+
+	started := 0
+	for _, contact := range (&SegmentService{Db: as.Db}).Members(segment) {
+		if as.enroll(sequence, &contact, now) {
+			started++
+		}
+	}
+	return started
+}
+
+// ContactChanged enrolls a created or updated contact in the sequences auto-enrolling from a segment it's a member of
+func (as *AutoEnrollService) ContactChanged(contact *api.Contact, now time.Time) {
+	var sequences []api.Sequence
+	as.Db.Where("auto_enroll_segment_id IN (?)", as.Db.Model(&api.Segment{}).Select("id").Where("workspace = ?", contact.Workspace)).
+		Order("id").
+		Find(&sequences)
+
+	segmentService := SegmentService{Db: as.Db}
+	for i := range sequences {
+		if segmentService.Matches(as.segment(sequences[i].AutoEnrollment.SegmentID), contact) {
+			as.enroll(&sequences[i], contact, now)
+		}
+	}
+}
+
+// enroll creates the enrollment (or restarts it, per re-enrollment policy) unless the contact is excluded
+func (as *AutoEnrollService) enroll(sequence *api.Sequence, contact *api.Contact, now time.Time) bool {
+	settings := sequence.AutoEnrollment
+	if sequence.Status == api.SequenceArchived {
+		return false
+	}
+	if contact.Status != api.ContactActive || (&SuppressionService{Db: as.Db}).IsSuppressed(contact.Workspace, contact.Email) {
+		return false
+	}
+	if settings.ExcludeSegmentID != 0 && (&SegmentService{Db: as.Db}).Matches(as.segment(settings.ExcludeSegmentID), contact) {
+		return false
+	}
+	if settings.ExcludeActiveElsewhere &&
+		as.Db.Where("contact_id = ? AND sequence_id <> ? AND status = ?", contact.ID, sequence.ID, api.EnrollmentActive).Find(&api.Enrollment{}).RowsAffected > 0 {
+		return false
+	}
+
+	enrollmentService := EnrollmentService{Db: as.Db}
+	enrollment := enrollmentService.GetByContact(sequence.ID, contact.ID)
+	if enrollment.ID == 0 {
+		enrollment = &api.Enrollment{SequenceID: sequence.ID, ContactID: contact.ID}
+		enrollmentService.Create(enrollment)
+	} else if Reenrollable(sequence, enrollment, now) {
+		enrollmentService.Restart(enrollment)
+	} else {
+		return false
+	}
+	log.Printf("sequence %d: contact %d auto-enrolled (enrollment %d)", sequence.ID, contact.ID, enrollment.ID)
+	return true
+}
+
+func (as *AutoEnrollService) segment(id uint) *api.Segment {
+	var foundSegment api.Segment
+	if id != 0 {
+		as.Db.Where("id = ?", id).Find(&foundSegment)
+	}
+	return &foundSegment
+}
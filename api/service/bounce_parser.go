@@ -0,0 +1,192 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+var ErrNoReport = errors.New("no delivery status or feedback report found")
+
+// ParseBounceMessage extracts bounces from a DSN (`multipart/report; report-type=delivery-status`, RFC 3464)
+// or complaints from an ARF report (`report-type=feedback-report`, RFC 5965), as received by the mailbox
+// Recipients which were delivered (or only relayed) are left out
+func ParseBounceMessage(reader io.Reader) ([]api.InboundBounce, error) {
+	message, err := mail.ReadMessage(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("Content-Type: %w", err)
+	}
+	if mediaType != "multipart/report" {
+		return nil, fmt.Errorf("Content-Type: multipart/report expected, got %s", mediaType)
+	}
+
+	var bounces []api.InboundBounce
+	var original *mail.Header
+	var complaintFields textproto.MIMEHeader
+	foundReport := false
+
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status":
+			foundReport = true
+			if bounces, err = parseDeliveryStatus(part); err != nil {
+				return nil, err
+			}
+		case "message/feedback-report":
+			foundReport = true
+			if complaintFields, err = readFields(bufio.NewReader(part)); err != nil {
+				return nil, err
+			}
+		case "message/rfc822", "text/rfc822-headers":
+			if original, err = readOriginalHeader(part); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !foundReport {
+		return nil, ErrNoReport
+	}
+
+	if complaintFields != nil {
+		complaint := api.InboundBounce{
+			Type:       api.BounceTypeComplaint,
+			Email:      trimAddress(complaintFields.Get("Original-Rcpt-To")),
+			Diagnostic: complaintFields.Get("Feedback-Type"),
+		}
+		if complaint.Email == "" && original != nil {
+			if to, err := mail.ParseAddress(original.Get("To")); err == nil {
+				complaint.Email = to.Address
+			}
+		}
+		bounces = append(bounces, complaint)
+	}
+
+	if original != nil {
+		for i := range bounces {
+			bounces[i].MessageID = original.Get("Message-Id")
+		}
+	}
+	return bounces, nil
+}
+
+// parseDeliveryStatus the per-message fields come first, followed by a block of fields per recipient
+func parseDeliveryStatus(reader io.Reader) ([]api.InboundBounce, error) {
+	bufReader := bufio.NewReader(reader)
+	if _, err := readFields(bufReader); err != nil {
+		return nil, err
+	}
+
+	var bounces []api.InboundBounce
+	for {
+		fields, err := readFields(bufReader)
+		if err != nil {
+			return nil, err
+		}
+		if fields == nil {
+			return bounces, nil
+		}
+
+		bounce := api.InboundBounce{
+			Type:       api.BounceTypeBounce,
+			Email:      trimAddress(fields.Get("Final-Recipient")),
+			Status:     fields.Get("Status"),
+			Diagnostic: trimType(fields.Get("Diagnostic-Code")),
+		}
+		if bounce.Email == "" {
+			bounce.Email = trimAddress(fields.Get("Original-Recipient"))
+		}
+
+		switch strings.ToLower(fields.Get("Action")) {
+		case "failed":
+			bounce.Classification = ClassifyBounce(bounce.Status)
+		case "delayed":
+			bounce.Classification = api.BounceSoft
+		default:
+			continue // delivered, relayed or expanded
+		}
+		bounces = append(bounces, bounce)
+	}
+}
+
+// ClassifyBounce permanent failures (5.x.x) are hard bounces, anything else is soft
+func ClassifyBounce(status string) string {
+	if strings.HasPrefix(strings.TrimSpace(status), "5") {
+		return api.BounceHard
+	}
+	return api.BounceSoft
+}
+
+// readFields reads a block of header fields (up to a blank line), `nil` when there are none left
+func readFields(reader *bufio.Reader) (textproto.MIMEHeader, error) {
+	for {
+		// blank lines in between blocks
+		b, err := reader.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		if _, err := reader.ReadByte(); err != nil {
+			return nil, err
+		}
+	}
+
+	fields, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// readOriginalHeader only the header of the original message is needed (`text/rfc822-headers` has nothing else)
+func readOriginalHeader(reader io.Reader) (*mail.Header, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := mail.ReadMessage(io.MultiReader(bytes.NewReader(content), strings.NewReader("\r\n\r\n")))
+	if err != nil {
+		return nil, fmt.Errorf("original message: %w", err)
+	}
+	return &message.Header, nil
+}
+
+// trimType strips the type of address & diagnostic fields (e.g. `rfc822;` or `smtp;`)
+func trimType(value string) string {
+	if _, rest, found := strings.Cut(value, ";"); found {
+		value = rest
+	}
+	return strings.TrimSpace(value)
+}
+
+func trimAddress(value string) string {
+	return strings.Trim(trimType(value), "<>")
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// BounceService hard bounces & complaints stop the contact's enrollments & suppress its address,
+// soft bounces are only recorded
+type BounceService struct {
+	Db *gorm.DB
+}
+
+// List newest first, `bounceType` is ignored when empty
+func (bs *BounceService) List(workspace string, bounceType string) []api.BounceEvent {
+	query := bs.Db.Where("workspace = ?", workspace).Order("id DESC")
+	if bounceType != "" {
+		query = query.Where("type = ?", bounceType)
+	}
+
+	events := []api.BounceEvent{}
+	query.Find(&events)
+	return events
+}
+
+// ValidateBounce derives a missing bounce `Classification` from `Status`
+func ValidateBounce(bounce *api.InboundBounce) error {
+	if bounce.Type == api.BounceTypeBounce && bounce.Classification == "" {
+		bounce.Classification = ClassifyBounce(bounce.Status)
+	}
+	if bounce.Type == api.BounceTypeComplaint {
+		bounce.Classification = ""
+	}
+	_, err := govalidator.ValidateStruct(bounce)
+	return err
+}
+
+// Process records an already validated bounce, matched by `MessageID` to the email it's about,
+// falling back to the latest email sent to `Email` within the workspace
+func (bs *BounceService) Process(workspace string, bounce api.InboundBounce) (*api.BounceEvent, error) {
+	event := api.BounceEvent{
+		Workspace:      workspace,
+		Type:           bounce.Type,
+		Classification: bounce.Classification,
+		Email:          strings.ToLower(bounce.Email),
+		MessageID:      strings.Trim(strings.TrimSpace(bounce.MessageID), "<>"),
+		Status:         bounce.Status,
+		Diagnostic:     bounce.Diagnostic,
+	}
+
+	contactService := ContactService{Db: bs.Db}
+	var contact *api.Contact
+	if emailSend := bs.findEmailSend(workspace, event.MessageID); emailSend != nil {
+		contact = contactService.GetByID(workspace, emailSend.ContactID)
+		event.EnrollmentID = emailSend.EnrollmentID
+		event.SequenceID = emailSend.SequenceID
+		event.StepID = emailSend.StepID
+	} else {
+		contact = contactService.GetByEmail(workspace, event.Email)
+		if emailSend := bs.latestEmailSend(contact.ID); emailSend != nil {
+			event.EnrollmentID = emailSend.EnrollmentID
+			event.SequenceID = emailSend.SequenceID
+			event.StepID = emailSend.StepID
+		}
+	}
+	event.ContactID = contact.ID
+
+	err := bs.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		txService := BounceService{Db: tx}
+		webhookService := WebhookService{Db: tx}
+		switch {
+		case event.Type == api.BounceTypeComplaint:
+			txService.stop(workspace, contact, event.Email, api.ContactComplained, api.EnrollmentComplained, api.SuppressionComplained)
+			return webhookService.Publish(workspace, api.WebhookEventEmailComplained, event)
+		case event.Classification == api.BounceHard:
+			txService.stop(workspace, contact, event.Email, api.ContactBounced, api.EnrollmentBounced, api.SuppressionBounced)
+		}
+		return webhookService.Publish(workspace, api.WebhookEventEmailBounced, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// stop marks the contact (when known) & stops all of its active enrollments, the address gets suppressed anyway
+func (bs *BounceService) stop(workspace string, contact *api.Contact, email string, contactStatus string, enrollmentStatus string, reason string) {
+	(&SuppressionService{Db: bs.Db}).Add(workspace, &api.Suppression{Email: email, Reason: reason})
+	if contact.ID == 0 {
+		return
+	}
+
+	contact.Status = contactStatus
+	bs.Db.Save(&contact)
+
+	var enrollments []api.Enrollment
+	bs.Db.Where("contact_id = ? AND status IN ?", contact.ID, []string{api.EnrollmentActive, api.EnrollmentPaused}).Find(&enrollments)
+	enrollmentService := EnrollmentService{Db: bs.Db}
+	for i := range enrollments {
+		enrollmentService.Stop(&enrollments[i], enrollmentStatus)
+	}
+}
+
+// findEmailSend ignores sends to contacts of other workspaces
+func (bs *BounceService) findEmailSend(workspace string, messageID string) *api.EmailSend {
+	if messageID == "" {
+		return nil
+	}
+
+	var emailSend api.EmailSend
+	bs.Db.Joins("JOIN contacts ON contacts.id = email_sends.contact_id").
+		Where("email_sends.message_id = ? AND contacts.workspace = ?", messageID, workspace).
+		First(&emailSend)
+	if emailSend.ID == 0 {
+		return nil
+	}
+	return &emailSend
+}
+
+func (bs *BounceService) latestEmailSend(contactID uint) *api.EmailSend {
+	if contactID == 0 {
+		return nil
+	}
+
+	var emailSend api.EmailSend
+	bs.Db.Where("contact_id = ?", contactID).Order("id DESC").First(&emailSend)
+	if emailSend.ID == 0 {
+		return nil
+	}
+	return &emailSend
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImportDirEnv uploaded CSV files are spooled into this directory until imported (a temporary directory by default)
+const ImportDirEnv = "SEQUENCES_IMPORT_DIR"
+
+const (
+	maxImportErrors     = 100 // reported per import, the failed rows are counted anyway
+	importProgressEvery = 100 // rows between saves of the progress
+)
+
+// ContactImportService spools CSV uploads & imports them in a background job, reading the file row by row
+type ContactImportService struct {
+	Db *gorm.DB
+}
+
+func (is *ContactImportService) GetByID(workspace string, id uint) *api.ContactImport {
+	var foundImport api.ContactImport
+	is.Db.Where("workspace = ? AND id = ?", workspace, id).First(&foundImport)
+	return &foundImport
+}
+
+// ValidateImport lowercases the mapping, `Existing` defaults to skip
+func ValidateImport(contactImport *api.ContactImport) error {
+	if _, err := govalidator.ValidateStruct(contactImport); err != nil {
+		return err
+	}
+	if contactImport.Existing == "" {
+		contactImport.Existing = api.ImportExistingSkip
+	}
+
+	mapping := map[string]string{}
+	mapped := map[string]string{}
+	for column, field := range contactImport.Mapping {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !govalidator.IsIn(field, api.ImportFields...) && !isCustomAttribute(field) {
+			return fmt.Errorf("Mapping: %q: must be one of %s or %s<name>", column, strings.Join(api.ImportFields, ", "), api.AttributePrefix)
+		}
+		if other, ok := mapped[field]; ok {
+			return fmt.Errorf("Mapping: %q & %q are both mapped to %s", other, column, field)
+		}
+		mapped[field] = column
+		mapping[column] = field
+	}
+	if len(mapping) > 0 && mapped["email"] == "" {
+		return errors.New("Mapping: no column mapped to email")
+	}
+	contactImport.Mapping = mapping
+	return nil
+}
+
+// Create spools `body` into the import directory & queues the job importing it
+func (is *ContactImportService) Create(workspace string, contactImport *api.ContactImport, body io.Reader) error {
+	dir := os.Getenv(ImportDirEnv)
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "sequence-imports")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, "contacts-*.csv")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	contactImport.Workspace = workspace
+	contactImport.Status = api.ImportPending
+	contactImport.File = file.Name()
+	return is.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(contactImport).Error; err != nil {
+			return err
+		}
+		job, err := (&JobService{Db: tx}).Enqueue(workspace, api.JobTypeContactImport, api.ContactImportJob{ImportID: contactImport.ID})
+		if err != nil {
+			return err
+		}
+		contactImport.JobID = job.ID
+		return tx.Model(contactImport).Update("job_id", job.ID).Error
+	})
+}
+
+// RunJob imports the upload of a `contact_import` job, from the start when the job is retried
+func (is *ContactImportService) RunJob(ctx context.Context, job *api.Job) (any, error) {
+	var payload api.ContactImportJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return nil, Permanent(err)
+	}
+	var contactImport api.ContactImport
+	if is.Db.Where("id = ?", payload.ImportID).Find(&contactImport).RowsAffected == 0 {
+		return nil, Permanent(fmt.Errorf("contact import %d not found", payload.ImportID))
+	}
+
+	now := time.Now().UTC()
+	contactImport = api.ContactImport{
+		ID:         contactImport.ID,
+		Workspace:  contactImport.Workspace,
+		Status:     api.ImportRunning,
+		Mapping:    contactImport.Mapping,
+		Existing:   contactImport.Existing,
+		SequenceID: contactImport.SequenceID,
+		JobID:      contactImport.JobID,
+		File:       contactImport.File,
+		CreatedAt:  contactImport.CreatedAt,
+		StartedAt:  &now,
+	}
+	is.Db.Save(&contactImport)
+
+	err := is.read(ctx, &contactImport)
+	var permanent permanentError
+	switch {
+	case ctx.Err() != nil:
+		contactImport.Status = api.ImportCanceled
+	case err != nil:
+		contactImport.Status = api.ImportFailed
+		contactImport.Error = err.Error()
+	default:
+		contactImport.Status = api.ImportCompleted
+	}
+	if ctx.Err() == nil && (err == nil || errors.As(err, &permanent)) {
+		finishedAt := time.Now().UTC()
+		contactImport.FinishedAt = &finishedAt
+		os.Remove(contactImport.File)
+	}
+	is.Db.Save(&contactImport)
+
+	log.Printf("contact import %d %s: %d created, %d updated, %d skipped, %d failed",
+		contactImport.ID, contactImport.Status, contactImport.Created, contactImport.Updated, contactImport.Skipped, contactImport.Failed)
+	return nil, err
+}
+
+// read imports the rows of the spooled file, an error means the file as a whole couldn't be read
+// (`Permanent` when reading it again won't help)
+func (is *ContactImportService) read(ctx context.Context, contactImport *api.ContactImport) error {
+	file, err := os.Open(contactImport.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	csvReader := csv.NewReader(file)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	csvReader.ReuseRecord = true
+
+	header, err := csvReader.Read()
+	if errors.Is(err, io.EOF) {
+		return Permanent(errors.New("the file is empty"))
+	}
+	var parseError *csv.ParseError
+	if errors.As(err, &parseError) {
+		return Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	fields, err := importColumns(header, contactImport.Mapping)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	seen := map[string]int{} // line of each email
+	for line := 2; ; line++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		switch {
+		case errors.As(err, &parseError):
+			is.rowFailed(contactImport, line, err)
+		case err != nil:
+			return err
+		default:
+			if err := is.importRow(contactImport, importContact(record, fields), line, seen); err != nil {
+				is.rowFailed(contactImport, line, err)
+			}
+		}
+
+		contactImport.Rows++
+		if contactImport.Rows%importProgressEvery == 0 {
+			is.Db.Save(contactImport)
+		}
+	}
+}
+
+// importRow creates or updates the contact of a row & enrolls it
+func (is *ContactImportService) importRow(contactImport *api.ContactImport, contact api.Contact, line int, seen map[string]int) error {
+	contact.Email = strings.ToLower(contact.Email)
+	if !govalidator.IsEmail(contact.Email) {
+		return fmt.Errorf("Email: %q is not an email address", contact.Email)
+	}
+	if _, err := time.LoadLocation(contact.TimeZone); err != nil {
+		return fmt.Errorf("TimeZone: %v", err)
+	}
+	if previous, ok := seen[contact.Email]; ok {
+		return fmt.Errorf("Email: duplicate of line %d", previous)
+	}
+	seen[contact.Email] = line
+
+	contactService := ContactService{Db: is.Db}
+	foundContact := contactService.GetByEmail(contactImport.Workspace, contact.Email)
+	switch {
+	case foundContact.ID == 0:
+		contactService.Create(contactImport.Workspace, &contact)
+		foundContact = &contact
+		contactImport.Created++
+	case contactImport.Existing == api.ImportExistingUpdate:
+		contactService.Update(foundContact, mergeContact(*foundContact, contact))
+		contactImport.Updated++
+	default:
+		contactImport.Skipped++
+		return nil
+	}
+
+	now := time.Now().UTC()
+	if contactImport.SequenceID != 0 {
+		enrollmentService := EnrollmentService{Db: is.Db}
+		if enrollmentService.GetByContact(contactImport.SequenceID, foundContact.ID).ID == 0 {
+			enrollmentService.Create(&api.Enrollment{SequenceID: contactImport.SequenceID, ContactID: foundContact.ID})
+			contactImport.Enrolled++
+		}
+	}
+	(&AutoEnrollService{Db: is.Db}).ContactChanged(foundContact, now)
+	return nil
+}
+
+func (is *ContactImportService) rowFailed(contactImport *api.ContactImport, line int, err error) {
+	contactImport.Failed++
+	if len(contactImport.Errors) < maxImportErrors {
+		contactImport.Errors = append(contactImport.Errors, fmt.Sprintf("line %d: %v", line, err))
+	}
+}
+
+// importColumns the field of each column ("" when it's not imported)
+func importColumns(header []string, mapping map[string]string) ([]string, error) {
+	fields := make([]string, len(header))
+	hasEmail := false
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if len(mapping) > 0 {
+			fields[i] = mapping[column]
+		} else {
+			name := strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(column))
+			fields[i] = api.AttributePrefix + name
+			if govalidator.IsIn(name, api.ImportFields...) {
+				fields[i] = name
+			}
+		}
+		hasEmail = hasEmail || fields[i] == "email"
+	}
+	if !hasEmail {
+		return nil, errors.New("no email column")
+	}
+	return fields, nil
+}
+
+// importContact `Tags` are separated by `,` or `;`
+func importContact(record []string, fields []string) api.Contact {
+	contact := api.Contact{Attributes: map[string]string{}}
+	for i, value := range record {
+		if i >= len(fields) {
+			break
+		}
+		value = strings.TrimSpace(value)
+		switch fields[i] {
+		case "":
+		case "email":
+			contact.Email = value
+		case "first_name":
+			contact.FirstName = value
+		case "last_name":
+			contact.LastName = value
+		case "time_zone":
+			contact.TimeZone = value
+		case "tags":
+			contact.Tags = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' })
+		default:
+			if value != "" {
+				contact.Attributes[strings.TrimPrefix(fields[i], api.AttributePrefix)] = value
+			}
+		}
+	}
+	return contact
+}
+
+// mergeContact the non-empty columns of `imported` overwrite `existing`, tags & attributes are added
+func mergeContact(existing api.Contact, imported api.Contact) api.Contact {
+	if imported.FirstName != "" {
+		existing.FirstName = imported.FirstName
+	}
+	if imported.LastName != "" {
+		existing.LastName = imported.LastName
+	}
+	if imported.TimeZone != "" {
+		existing.TimeZone = imported.TimeZone
+	}
+	existing.Tags = append(append([]string{}, existing.Tags...), imported.Tags...)
+
+	attributes := map[string]string{}
+	for name, value := range existing.Attributes {
+		attributes[name] = value
+	}
+	for name, value := range imported.Attributes {
+		attributes[name] = value
+	}
+	existing.Attributes = attributes
+	return existing
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// ContactService contacts are always looked up within a workspace
+type ContactService struct {
+	Db *gorm.DB
+}
+
+func (cs *ContactService) List(workspace string) []api.Contact {
+	contacts := []api.Contact{}
+	cs.Db.Where("workspace = ?", workspace).Order("id").Find(&contacts)
+	return contacts
+}
+
+func (cs *ContactService) GetByEmail(workspace string, email string) *api.Contact {
+	var foundContact api.Contact
+	cs.Db.Where("workspace = ? AND email = ?", workspace, strings.ToLower(email)).First(&foundContact)
+	return &foundContact
+}
+
+func (cs *ContactService) GetByID(workspace string, id uint) *api.Contact {
+	var foundContact api.Contact
+	cs.Db.Where("workspace = ? AND id = ?", workspace, id).First(&foundContact)
+	return &foundContact
+}
+
+// EmailAvailable emails are compared case-insensitively (they are stored lowercase), `id` is the contact being updated (0 on create)
+func (cs *ContactService) EmailAvailable(workspace string, email string, id uint) bool {
+	result := cs.Db.Where("workspace = ? AND email = ? AND id <> ?", workspace, strings.ToLower(email), id).Find(&api.Contact{})
+	return result.RowsAffected == 0
+}
+
+func (cs *ContactService) Create(workspace string, contact *api.Contact) {
+	contact.Workspace = workspace
+	contact.Email = strings.ToLower(contact.Email)
+	contact.Status = api.ContactActive
+	contact.Tags = normalizeTags(contact.Tags)
+	contact.Attributes = normalizeAttributes(contact.Attributes)
+	cs.Db.Create(&contact)
+}
+
+// Update the status is only changed by bounce & complaint processing
+func (cs *ContactService) Update(foundContact *api.Contact, contact api.Contact) {
+	foundContact.Email = strings.ToLower(contact.Email)
+	foundContact.FirstName = contact.FirstName
+	foundContact.LastName = contact.LastName
+	foundContact.TimeZone = contact.TimeZone
+	foundContact.Tags = normalizeTags(contact.Tags)
+	foundContact.Attributes = normalizeAttributes(contact.Attributes)
+	cs.Db.Save(foundContact)
+}
+
+// normalizeAttributes lowercase names, without blank ones
+func normalizeAttributes(attributes map[string]string) map[string]string {
+	normalized := map[string]string{}
+	for name, value := range attributes {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			normalized[name] = value
+		}
+	}
+	return normalized
+}
+
+// Delete removes the contact along with its enrollments & tasks
+func (cs *ContactService) Delete(contact *api.Contact) error {
+	return cs.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("contact_id = ?", contact.ID).Delete(&api.Enrollment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("contact_id = ?", contact.ID).Delete(&api.Task{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&contact).Error
+	})
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"gorm.io/gorm"
+	"os"
+)
+
+// EncryptionKeyEnv secrets stored in the DB (e.g. SMTP credentials) are encrypted with a key derived from this variable,
+// without it a key is generated into the settings table (which doesn't protect a leaked DB file)
+const EncryptionKeyEnv = "SEQUENCES_ENCRYPTION_KEY"
+
+const encryptionKeySetting = "encryption_key"
+
+var errCiphertext = errors.New("malformed ciphertext")
+
+func encryptionKey(db *gorm.DB) []byte {
+	secret := os.Getenv(EncryptionKeyEnv)
+	if secret == "" {
+		secret = (&SettingService{Db: db}).Secret(encryptionKeySetting)
+	}
+	key := sha256.Sum256([]byte(secret))
+	return key[:]
+}
+
+// encrypt with AES-256-GCM, the result is the base64 of nonce & sealed text
+func encrypt(db *gorm.DB, plaintext string) (string, error) {
+	gcm, err := newGCM(db)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+func decrypt(db *gorm.DB, ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errCiphertext
+	}
+	gcm, err := newGCM(db)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errCiphertext
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(db *gorm.DB) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(encryptionKey(db))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
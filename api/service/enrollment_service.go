@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"time"
+)
+
+type EnrollmentService struct {
+	Db *gorm.DB
+}
+
+func (es *EnrollmentService) GetByID(id uint) *api.Enrollment {
+	var foundEnrollment api.Enrollment
+	es.Db.Where("id = ?", id).First(&foundEnrollment)
+	return &foundEnrollment
+}
+
+func (es *EnrollmentService) ListBySequenceID(sequenceID uint) []api.Enrollment {
+	enrollments := []api.Enrollment{}
+	es.Db.Where("sequence_id = ?", sequenceID).Order("id").Find(&enrollments)
+	return enrollments
+}
+
+// GetByContact the enrollment of the contact in the sequence (zero value when not enrolled)
+func (es *EnrollmentService) GetByContact(sequenceID uint, contactID uint) *api.Enrollment {
+	var foundEnrollment api.Enrollment
+	es.Db.Where("sequence_id = ? AND contact_id = ?", sequenceID, contactID).Find(&foundEnrollment)
+	return &foundEnrollment
+}
+
+// Create schedules the first step `WaitDays` after now, within the schedule of the sequence
+// (right away for sequences without steps, they get completed)
+func (es *EnrollmentService) Create(enrollment *api.Enrollment) {
+	es.start(enrollment)
+	es.Db.Create(&enrollment)
+}
+
+// Restart sends the sequence again from its first step
+func (es *EnrollmentService) Restart(enrollment *api.Enrollment) {
+	enrollment.CurrentStepID = 0
+	enrollment.CurrentStepAt = nil
+	enrollment.MailboxID = 0
+	enrollment.ThreadID = ""
+	enrollment.LastError = ""
+	es.start(enrollment)
+	es.Db.Save(enrollment)
+}
+
+// RunBulkJob enrolls the contacts of a `bulk_enroll` job (of its workspace), like one by one enrollments:
+// unknown & enrolled contacts are skipped, unless the re-enrollment policy lets them start over
+func (es *EnrollmentService) RunBulkJob(ctx context.Context, job *api.Job) (any, error) {
+	var payload api.BulkEnrollJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return nil, Permanent(err)
+	}
+	sequence := (&SequenceService{Db: es.Db}).GetByID(payload.SequenceID)
+	if sequence.ID == 0 {
+		return nil, Permanent(fmt.Errorf("sequence %d not found", payload.SequenceID))
+	}
+	if sequence.Status == api.SequenceArchived {
+		return nil, Permanent(fmt.Errorf("sequence %d is archived", payload.SequenceID))
+	}
+
+	result := api.BulkEnrollResult{}
+	contactService := ContactService{Db: es.Db}
+	for _, contactID := range payload.ContactIDs {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		contact := contactService.GetByID(job.Workspace, contactID)
+		enrollment := es.GetByContact(sequence.ID, contactID)
+		switch {
+		case contact.ID == 0:
+			result.Skipped++
+		case enrollment.ID == 0:
+			es.Create(&api.Enrollment{SequenceID: sequence.ID, ContactID: contact.ID})
+			result.Enrolled++
+		case Reenrollable(sequence, enrollment, time.Now().UTC()):
+			es.Restart(enrollment)
+			result.Enrolled++
+		default:
+			result.Skipped++
+		}
+	}
+	return result, nil
+}
+
+func (es *EnrollmentService) start(enrollment *api.Enrollment) {
+	steps := (&SequenceStepsService{Db: es.Db}).GetBySequenceID(enrollment.SequenceID)
+
+	nextSendAt := time.Now().UTC()
+	if len(steps) > 0 {
+		nextSendAt = es.planner(enrollment).SendTime(nextSendAt, steps[0].WaitDays)
+	}
+	enrollment.Status = api.EnrollmentActive
+	enrollment.NextStep = 0
+	enrollment.NextSendAt = &nextSendAt
+}
+
+// Reenrollable the enrollment may start over, per the re-enrollment policy of its sequence
+func Reenrollable(sequence *api.Sequence, enrollment *api.Enrollment, now time.Time) bool {
+	settings := sequence.AutoEnrollment
+	return settings.Reenrollment == api.ReenrollAfterCompletion &&
+		enrollment.Status == api.EnrollmentCompleted &&
+		!now.Before(enrollment.UpdatedAt.AddDate(0, 0, int(settings.ReenrollAfterDays)))
+}
+
+// Stop moves an active (or paused) enrollment to `status`, no further steps get sent
+// Returns false when the enrollment was finished already
+func (es *EnrollmentService) Stop(enrollment *api.Enrollment, status string) bool {
+	if enrollment.Status != api.EnrollmentActive && enrollment.Status != api.EnrollmentPaused {
+		return false
+	}
+	enrollment.Status = status
+	enrollment.NextSendAt = nil
+	enrollment.PausedAt = nil
+	es.Db.Save(&enrollment)
+	(&TaskService{Db: es.Db}).SkipOpen(enrollment.ID, time.Now().UTC())
+	return true
+}
+
+// Pause holds an active enrollment until resumed, returns false when it isn't active
+func (es *EnrollmentService) Pause(enrollment *api.Enrollment, now time.Time) bool {
+	if enrollment.Status != api.EnrollmentActive {
+		return false
+	}
+	enrollment.Status = api.EnrollmentPaused
+	enrollment.PausedAt = &now
+	es.Db.Save(enrollment)
+	return true
+}
+
+// Resume continues a paused enrollment, its next step is due as much later as the enrollment was paused
+// Returns false when it isn't paused
+func (es *EnrollmentService) Resume(enrollment *api.Enrollment, now time.Time) bool {
+	if enrollment.Status != api.EnrollmentPaused {
+		return false
+	}
+	if enrollment.PausedAt != nil {
+		es.reschedule(enrollment, now.Sub(*enrollment.PausedAt), now)
+	}
+	enrollment.Status = api.EnrollmentActive
+	enrollment.PausedAt = nil
+	es.Db.Save(enrollment)
+	return true
+}
+
+// ResumeSequence shifts the due steps of the active enrollments of a resumed sequence by the time it was `paused`,
+// so that the steps which fell due meanwhile are spread as before instead of being sent all at once
+func (es *EnrollmentService) ResumeSequence(sequenceID uint, paused time.Duration, now time.Time) {
+	var enrollments []api.Enrollment
+	es.Db.Where("sequence_id = ? AND status = ? AND next_send_at IS NOT NULL", sequenceID, api.EnrollmentActive).Find(&enrollments)
+	for i := range enrollments {
+		es.reschedule(&enrollments[i], paused, now)
+		es.Db.Save(&enrollments[i])
+	}
+}
+
+// reschedule moves the due time on by `paused` (not before `now`), within the schedule of the sequence
+// Enrollments waiting for a manual task have no due time
+func (es *EnrollmentService) reschedule(enrollment *api.Enrollment, paused time.Duration, now time.Time) {
+	if enrollment.NextSendAt == nil {
+		return
+	}
+	nextSendAt := enrollment.NextSendAt.Add(paused)
+	if nextSendAt.Before(now) {
+		nextSendAt = now
+	}
+	nextSendAt = es.planner(enrollment).NextEligible(nextSendAt)
+	enrollment.NextSendAt = &nextSendAt
+}
+
+// Advance moves the enrollment past step `stepID`, sent (or done) at `at`: the next step is scheduled its wait days later
+// (edges are evaluated for sequences with edges), the enrollment completes after the last step
+func (es *EnrollmentService) Advance(enrollment *api.Enrollment, stepID uint, at time.Time) {
+	steps := (&SequenceStepsService{Db: es.Db}).GetBySequenceID(enrollment.SequenceID)
+	graphService := GraphService{Db: es.Db}
+	edges := graphService.Edges(enrollment.SequenceID)
+	planner := es.planner(enrollment)
+
+	enrollment.NextStep++
+	enrollment.CurrentStepID = stepID
+	enrollment.CurrentStepAt = &at
+	enrollment.LastError = ""
+	var nextSendAt *time.Time
+	if len(edges) > 0 {
+		nextSendAt = graphService.FirstDue(stepID, steps, edges, at, planner)
+	} else if int(enrollment.NextStep) < len(steps) {
+		sendTime := planner.SendTime(at, steps[enrollment.NextStep].WaitDays)
+		nextSendAt = &sendTime
+	}
+	enrollment.NextSendAt = nextSendAt
+	if nextSendAt == nil {
+		enrollment.Status = api.EnrollmentCompleted
+	}
+	es.Db.Save(enrollment)
+}
+
+func (es *EnrollmentService) planner(enrollment *api.Enrollment) *Planner {
+	sequence := (&SequenceService{Db: es.Db}).GetByID(enrollment.SequenceID)
+	var contact api.Contact
+	es.Db.Where("id = ?", enrollment.ContactID).First(&contact)
+	return (&ScheduleService{Db: es.Db}).Planner(sequence, &contact)
+}
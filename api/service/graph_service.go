@@ -0,0 +1,301 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"path"
+	"strings"
+	"time"
+)
+
+// GraphService manages the edges between the steps of a sequence & decides where an enrollment goes next
+type GraphService struct {
+	Db *gorm.DB
+}
+
+// Edges of the sequence, in evaluation order
+func (gs *GraphService) Edges(sequenceID uint) []api.StepEdge {
+	edges := []api.StepEdge{}
+	gs.Db.Where("sequence_id = ?", sequenceID).Order("from_step_id, priority, id").Find(&edges)
+	return edges
+}
+
+// Validate every edge must join two steps of the sequence, the graph must be acyclic & every step reachable from the first one
+func (gs *GraphService) Validate(sequenceID uint, graph *api.SequenceGraph) error {
+	steps := (&SequenceStepsService{Db: gs.Db}).GetBySequenceID(sequenceID)
+	stepTypes := map[uint]string{}
+	for _, step := range steps {
+		stepTypes[step.ID] = step.Type
+	}
+
+	for i := range graph.Edges {
+		edge := &graph.Edges[i]
+		if _, err := govalidator.ValidateStruct(edge); err != nil {
+			return fmt.Errorf("Edges[%d]: %w", i, err)
+		}
+		if err := validateCondition(edge); err != nil {
+			return fmt.Errorf("Edges[%d]: %w", i, err)
+		}
+		fromType, found := stepTypes[edge.FromStepID]
+		if !found {
+			return fmt.Errorf("Edges[%d]: FromStepID: step %d not found in sequence", i, edge.FromStepID)
+		}
+		if _, found := stepTypes[edge.ToStepID]; !found {
+			return fmt.Errorf("Edges[%d]: ToStepID: step %d not found in sequence", i, edge.ToStepID)
+		}
+		if isEngagementCondition(edge.Condition) && fromType != api.StepTypeEmail {
+			return fmt.Errorf("Edges[%d]: Condition: %s needs an email step to start from", i, edge.Condition)
+		}
+	}
+	if len(graph.Edges) == 0 {
+		return nil
+	}
+
+	next := map[uint][]uint{}
+	for _, edge := range graph.Edges {
+		next[edge.FromStepID] = append(next[edge.FromStepID], edge.ToStepID)
+	}
+	if cycle := findCycle(steps, next); cycle != nil {
+		return fmt.Errorf("Edges: cycle through steps %v", cycle)
+	}
+
+	reached := map[uint]bool{}
+	visit(steps[0].ID, next, reached)
+	for _, step := range steps {
+		if !reached[step.ID] {
+			return fmt.Errorf("Edges: step %d is unreachable from step %d", step.ID, steps[0].ID)
+		}
+	}
+	return nil
+}
+
+// Revalidate the edges of the sequence against its current steps (e.g. after a step was created, moved or deleted),
+// nil when it has none
+func (gs *GraphService) Revalidate(sequenceID uint) error {
+	edges := gs.Edges(sequenceID)
+	if len(edges) == 0 {
+		return nil
+	}
+	return gs.Validate(sequenceID, &api.SequenceGraph{Edges: edges})
+}
+
+// isEngagementCondition conditions about the email of the source step
+func isEngagementCondition(condition string) bool {
+	switch condition {
+	case api.EdgeOpened, api.EdgeClicked, api.EdgeNotOpened, api.EdgeNotClicked:
+		return true
+	}
+	return false
+}
+
+func validateCondition(edge *api.StepEdge) error {
+	switch edge.Condition {
+	case api.EdgeNotOpened, api.EdgeNotClicked:
+		if edge.WithinDays == 0 {
+			return fmt.Errorf("WithinDays: required with %s", edge.Condition)
+		}
+	case api.EdgeAttribute:
+		attributes := append([]string{"status"}, api.EdgeAttributes...)
+		edge.Attribute = strings.ToLower(edge.Attribute)
+		if !govalidator.IsIn(edge.Attribute, attributes...) && !isCustomAttribute(edge.Attribute) {
+			return fmt.Errorf("Attribute: must be one of %s or %s<name>", strings.Join(attributes, ", "), api.AttributePrefix)
+		}
+		if edge.Value == "" {
+			return errors.New("Value: required with attribute")
+		}
+		if _, err := path.Match(edge.Value, ""); err != nil {
+			return fmt.Errorf("Value: %q is not a valid pattern", edge.Value)
+		}
+	}
+	if edge.Condition != api.EdgeNotOpened && edge.Condition != api.EdgeNotClicked && edge.WithinDays != 0 {
+		return fmt.Errorf("WithinDays: only allowed with not_opened & not_clicked")
+	}
+	if edge.Condition != api.EdgeAttribute && (edge.Attribute != "" || edge.Value != "") {
+		return fmt.Errorf("Attribute: only allowed with attribute")
+	}
+	return nil
+}
+
+// findCycle returns the steps of a cycle (first one repeated at the end), nil when there is none
+func findCycle(steps []api.SequenceStep, next map[uint][]uint) []uint {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[uint]int{}
+	var stack []uint
+
+	var walk func(id uint) []uint
+	walk = func(id uint) []uint {
+		state[id] = visiting
+		stack = append(stack, id)
+		for _, to := range next[id] {
+			if state[to] == visiting {
+				for i := range stack {
+					if stack[i] == to {
+						return append(append([]uint{}, stack[i:]...), to)
+					}
+				}
+			}
+			if state[to] == unvisited {
+				if cycle := walk(to); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+		return nil
+	}
+
+	for _, step := range steps {
+		if state[step.ID] == unvisited {
+			if cycle := walk(step.ID); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+func visit(id uint, next map[uint][]uint, reached map[uint]bool) {
+	if reached[id] {
+		return
+	}
+	reached[id] = true
+	for _, to := range next[id] {
+		visit(to, next, reached)
+	}
+}
+
+// Replace the edges of the sequence, enrollments continue from the step they're at
+func (gs *GraphService) Replace(sequenceID uint, graph api.SequenceGraph) error {
+	return gs.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("sequence_id = ?", sequenceID).Delete(&api.StepEdge{}).Error; err != nil {
+			return err
+		}
+		for i := range graph.Edges {
+			edge := graph.Edges[i]
+			edge.ID = 0
+			edge.SequenceID = sequenceID
+			if err := tx.Create(&edge).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// outgoing edges of the step, in evaluation order
+func outgoing(edges []api.StepEdge, stepID uint) []api.StepEdge {
+	var from []api.StepEdge
+	for _, edge := range edges {
+		if edge.FromStepID == stepID {
+			from = append(from, edge)
+		}
+	}
+	return from
+}
+
+// dueAt when the edge gets evaluated: the target's wait days after the send (within the schedule),
+// not before the `WithinDays` of not_opened & not_clicked are over
+func dueAt(edge api.StepEdge, target *api.SequenceStep, sentAt time.Time, planner *Planner) time.Time {
+	due := planner.SendTime(sentAt, target.WaitDays)
+	if edge.Condition == api.EdgeNotOpened || edge.Condition == api.EdgeNotClicked {
+		if within := sentAt.AddDate(0, 0, int(edge.WithinDays)); within.After(due) {
+			due = planner.NextEligible(within)
+		}
+	}
+	return due
+}
+
+// holds whether the condition of the edge is met, `send` is the email of its source step (zero for other step types)
+func holds(edge api.StepEdge, send *api.EmailSend, contact *api.Contact) bool {
+	switch edge.Condition {
+	case api.EdgeOpened:
+		return send.OpenedAt != nil
+	case api.EdgeClicked:
+		return send.ClickedAt != nil
+	case api.EdgeNotOpened:
+		return send.OpenedAt == nil || send.OpenedAt.After(send.SentAt.AddDate(0, 0, int(edge.WithinDays)))
+	case api.EdgeNotClicked:
+		return send.ClickedAt == nil || send.ClickedAt.After(send.SentAt.AddDate(0, 0, int(edge.WithinDays)))
+	case api.EdgeAttribute:
+		matched, _ := path.Match(strings.ToLower(edge.Value), strings.ToLower(attributeOf(contact, edge.Attribute)))
+		return matched
+	}
+	return true
+}
+
+func attributeOf(contact *api.Contact, attribute string) string {
+	switch attribute {
+	case "email":
+		return contact.Email
+	case "first_name":
+		return contact.FirstName
+	case "last_name":
+		return contact.LastName
+	case "time_zone":
+		return contact.TimeZone
+	case "status":
+		return contact.Status
+	}
+	if name, ok := strings.CutPrefix(attribute, api.AttributePrefix); ok {
+		return contact.Attributes[name]
+	}
+	return ""
+}
+
+// Next evaluates the edges of the enrollment's current step at `now`: returns the step to send,
+// or when to evaluate again (the first edge not due yet), neither when the enrollment is done
+func (gs *GraphService) Next(enrollment *api.Enrollment, contact *api.Contact, steps []api.SequenceStep, edges []api.StepEdge, planner *Planner, now time.Time) (*api.SequenceStep, *time.Time) {
+	if enrollment.CurrentStepID == 0 {
+		return &steps[0], nil
+	}
+
+	// none for other step types
+	var send api.EmailSend
+	gs.Db.Where("enrollment_id = ? AND step_id = ?", enrollment.ID, enrollment.CurrentStepID).Order("id DESC").Limit(1).Find(&send)
+	doneAt := send.SentAt
+	if enrollment.CurrentStepAt != nil {
+		doneAt = *enrollment.CurrentStepAt
+	}
+
+	for _, edge := range outgoing(edges, enrollment.CurrentStepID) {
+		target := stepByID(steps, edge.ToStepID)
+		if target == nil {
+			continue
+		}
+		if due := dueAt(edge, target, doneAt, planner); due.After(now) {
+			return nil, &due
+		}
+		if holds(edge, &send, contact) {
+			return target, nil
+		}
+	}
+	return nil, nil
+}
+
+// FirstDue when the first edge of the step gets evaluated after its send, nil when it has none (end of the sequence)
+func (gs *GraphService) FirstDue(stepID uint, steps []api.SequenceStep, edges []api.StepEdge, sentAt time.Time, planner *Planner) *time.Time {
+	for _, edge := range outgoing(edges, stepID) {
+		if target := stepByID(steps, edge.ToStepID); target != nil {
+			due := dueAt(edge, target, sentAt, planner)
+			return &due
+		}
+	}
+	return nil
+}
+
+func stepByID(steps []api.SequenceStep, id uint) *api.SequenceStep {
+	for i := range steps {
+		if steps[i].ID == id {
+			return &steps[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobService queues jobs & manages them on behalf of the API, the `JobWorker` runs them
+type JobService struct {
+	Db *gorm.DB
+}
+
+const defaultJobMaxAttempts = 5
+
+func (js *JobService) List(workspace string, status string) []api.Job {
+	jobs := []api.Job{}
+	query := js.Db.Where("workspace = ?", workspace)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Order("id DESC").Find(&jobs)
+	return jobs
+}
+
+func (js *JobService) GetByID(workspace string, id uint) *api.Job {
+	var foundJob api.Job
+	js.Db.Where("workspace = ? AND id = ?", workspace, id).First(&foundJob)
+	return &foundJob
+}
+
+// Enqueue a job due right away, `payload` is stored as JSON
+func (js *JobService) Enqueue(workspace string, jobType string, payload any) (*api.Job, error) {
+	return js.enqueue(workspace, jobType, payload, defaultJobMaxAttempts)
+}
+
+func (js *JobService) enqueue(workspace string, jobType string, payload any, maxAttempts uint) (*api.Job, error) {
+	job := &api.Job{
+		Workspace:   workspace,
+		Type:        jobType,
+		Payload:     api.ToJSON(payload),
+		Status:      api.JobPending,
+		MaxAttempts: maxAttempts,
+		RunAt:       time.Now().UTC(),
+	}
+	return job, js.Db.Create(job).Error
+}
+
+// Cancel pending or running jobs, a running job is interrupted once its worker renews the lease
+// Returns false when the job was finished already
+func (js *JobService) Cancel(job *api.Job) bool {
+	now := time.Now().UTC()
+	result := js.Db.Model(&api.Job{}).
+		Where("id = ? AND status IN ?", job.ID, []string{api.JobPending, api.JobRunning}).
+		Updates(map[string]any{"status": api.JobCanceled, "finished_at": now})
+	if result.RowsAffected == 0 {
+		return false
+	}
+	js.Db.First(job, job.ID)
+	return true
+}
+
+// Retry queues a dead or canceled job again, with a fresh set of attempts
+// Returns false for other statuses
+func (js *JobService) Retry(job *api.Job) bool {
+	result := js.Db.Model(&api.Job{}).
+		Where("id = ? AND status IN ?", job.ID, []string{api.JobDead, api.JobCanceled}).
+		Updates(map[string]any{"status": api.JobPending, "attempts": 0, "run_at": time.Now().UTC(), "finished_at": nil})
+	if result.RowsAffected == 0 {
+		return false
+	}
+	js.Db.First(job, job.ID)
+	return true
+}
+
+// JobHandler runs a job, the result is stored as JSON. Failed jobs are retried, unless the error is `Permanent`
+// `ctx` is cancelled when the job gets cancelled or the worker stops
+type JobHandler func(ctx context.Context, job *api.Job) (any, error)
+
+type permanentError struct {
+	err error
+}
+
+func (pe permanentError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe permanentError) Unwrap() error {
+	return pe.err
+}
+
+// Permanent failures aren't retried, the job is dead right away
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type registeredType struct {
+	handler     JobHandler
+	concurrency int
+}
+
+// JobWorker runs due jobs, at most `Concurrency` at a time & at most the concurrency of its type
+// across every worker (jobs running with a valid lease are counted). Failed attempts are retried
+// with exponential backoff (`BaseBackoff`, `2*BaseBackoff`, `4*BaseBackoff`...) until `MaxAttempts` of the job
+type JobWorker struct {
+	Db          *gorm.DB
+	ID          string // identifies the worker in leases
+	Concurrency int
+	Lease       time.Duration
+	BaseBackoff time.Duration
+	Now         func() time.Time // overridable in tests
+
+	types    map[string]registeredType
+	mu       sync.Mutex
+	inFlight int
+	wg       sync.WaitGroup
+}
+
+// NewJobWorker handles the job types of the API
+func NewJobWorker(db *gorm.DB) *JobWorker {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	jw := &JobWorker{
+		Db:          db,
+		ID:          fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), hex.EncodeToString(suffix)),
+		Concurrency: 4,
+		Lease:       time.Minute,
+		BaseBackoff: 10 * time.Second,
+		Now:         func() time.Time { return time.Now().UTC() },
+		types:       map[string]registeredType{},
+	}
+	jw.Handle(api.JobTypeContactImport, 2, (&ContactImportService{Db: db}).RunJob)
+	jw.Handle(api.JobTypeBulkEnroll, 2, (&EnrollmentService{Db: db}).RunBulkJob)
+	jw.Handle(api.JobTypeWebhookDelivery, 4, (&WebhookService{Db: db}).RunDeliveryJob)
+	jw.Handle(api.JobTypeSequenceExport, 2, (&SequenceDocumentService{Db: db}).RunExportJob)
+	return jw
+}
+
+// Handle registers the handler of a job type, at most `concurrency` jobs of the type run at once
+func (jw *JobWorker) Handle(jobType string, concurrency int, handler JobHandler) {
+	jw.types[jobType] = registeredType{handler: handler, concurrency: concurrency}
+}
+
+// Run starts due jobs every `interval` until `ctx` is done, running jobs are interrupted then (& queued again)
+func (jw *JobWorker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			jw.wg.Wait()
+			return
+		case <-ticker.C:
+			jw.startDue(ctx)
+		}
+	}
+}
+
+// RunDue runs the due jobs & waits for them, returns how many were started
+func (jw *JobWorker) RunDue(ctx context.Context) int {
+	started := jw.startDue(ctx)
+	jw.wg.Wait()
+	return started
+}
+
+func (jw *JobWorker) startDue(ctx context.Context) int {
+	jw.expireLost()
+
+	names := make([]string, 0, len(jw.types))
+	for name := range jw.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	started := 0
+	for _, name := range names {
+		for jw.reserveSlot() {
+			job := jw.claim(name, jw.types[name].concurrency)
+			if job == nil {
+				jw.releaseSlot()
+				break
+			}
+
+			started++
+			jw.wg.Add(1)
+			go func(handler JobHandler) {
+				defer jw.wg.Done()
+				defer jw.releaseSlot()
+				jw.run(ctx, job, handler)
+			}(jw.types[name].handler)
+		}
+	}
+	return started
+}
+
+func (jw *JobWorker) reserveSlot() bool {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	if jw.inFlight >= jw.Concurrency {
+		return false
+	}
+	jw.inFlight++
+	return true
+}
+
+func (jw *JobWorker) releaseSlot() {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	jw.inFlight--
+}
+
+// isFull `concurrency` jobs of the type run with a valid lease, whichever worker runs them
+func (jw *JobWorker) isFull(jobType string, concurrency int) bool {
+	var count int64
+	jw.Db.Model(&api.Job{}).
+		Where("type = ? AND status = ? AND lease_expires_at >= ?", jobType, api.JobRunning, jw.Now()).
+		Count(&count)
+	return int(count) >= concurrency
+}
+
+// expireLost jobs whose worker went away during their last attempt (their lease expired) are dead
+func (jw *JobWorker) expireLost() {
+	now := jw.Now()
+	result := jw.Db.Model(&api.Job{}).
+		Where("status = ? AND lease_expires_at < ? AND attempts >= max_attempts", api.JobRunning, now).
+		Updates(map[string]any{"status": api.JobDead, "last_error": "lease expired", "finished_at": now})
+	if result.RowsAffected > 0 {
+		log.Printf("%d jobs dead, their lease expired after the last attempt", result.RowsAffected)
+	}
+}
+
+// claim leases the next due job of the type (pending or running with an expired lease), nil when there is none
+// or `concurrency` jobs of the type run already (with a valid lease, whichever worker runs them)
+func (jw *JobWorker) claim(jobType string, concurrency int) *api.Job {
+	for {
+		now := jw.Now()
+		var job api.Job
+		found := jw.Db.Where("type = ? AND ((status = ? AND run_at <= ?) OR (status = ? AND lease_expires_at < ? AND attempts < max_attempts))",
+			jobType, api.JobPending, now, api.JobRunning, now).
+			Order("run_at, id").
+			Limit(1).
+			Find(&job)
+		if found.RowsAffected == 0 {
+			return nil
+		}
+
+		// `attempts` & `status` guard against another worker claiming it meanwhile, the count against exceeding
+		// the concurrency: both are checked by the update itself, so claims of other workers can't interleave
+		running := jw.Db.Model(&api.Job{}).Select("COUNT(*)").
+			Where("type = ? AND status = ? AND lease_expires_at >= ?", jobType, api.JobRunning, now)
+		leaseExpiresAt := now.Add(jw.Lease)
+		result := jw.Db.Model(&api.Job{}).
+			Where("id = ? AND attempts = ? AND status = ? AND (?) < ?", job.ID, job.Attempts, job.Status, running, concurrency).
+			Updates(map[string]any{
+				"status":           api.JobRunning,
+				"attempts":         job.Attempts + 1,
+				"leased_by":        jw.ID,
+				"lease_expires_at": leaseExpiresAt,
+			})
+		if result.Error != nil {
+			log.Printf("job %d: %v", job.ID, result.Error)
+			return nil
+		}
+		if result.RowsAffected == 0 {
+			if jw.isFull(jobType, concurrency) {
+				return nil
+			}
+			continue
+		}
+		job.Status = api.JobRunning
+		job.Attempts++
+		job.LeasedBy = jw.ID
+		job.LeaseExpiresAt = &leaseExpiresAt
+		return &job
+	}
+}
+
+// run the job, renewing its lease meanwhile, & record the outcome
+func (jw *JobWorker) run(ctx context.Context, job *api.Job, handler JobHandler) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jw.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !jw.renew(job) {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	result, err := handler(jobCtx, job)
+	close(done)
+
+	now := jw.Now()
+	updates := map[string]any{"leased_by": "", "lease_expires_at": nil}
+	var permanent permanentError
+	switch {
+	case ctx.Err() != nil:
+		// the worker stops, another one picks the job up again: the interrupted attempt doesn't count
+		updates["status"] = api.JobPending
+		updates["attempts"] = gorm.Expr("attempts - 1")
+		updates["run_at"] = now
+	case err == nil:
+		updates["status"] = api.JobSucceeded
+		updates["result"] = api.ToJSON(result)
+		updates["last_error"] = ""
+		updates["finished_at"] = now
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		updates["status"] = api.JobDead
+		updates["last_error"] = err.Error()
+		updates["finished_at"] = now
+	default:
+		updates["status"] = api.JobPending
+		updates["last_error"] = err.Error()
+		updates["run_at"] = now.Add(jw.BaseBackoff << (job.Attempts - 1))
+	}
+
+	// a cancelled (or reclaimed) job isn't ours anymore
+	saved := jw.Db.Model(&api.Job{}).Where("id = ? AND status = ? AND leased_by = ?", job.ID, api.JobRunning, jw.ID).Updates(updates)
+	if saved.Error != nil {
+		log.Printf("job %d: %v", job.ID, saved.Error)
+	}
+	if err != nil {
+		log.Printf("job %d (%s) attempt %d: %v", job.ID, job.Type, job.Attempts, err)
+	}
+}
+
+// renew extends the lease, false when the job isn't ours anymore (e.g. cancelled)
+func (jw *JobWorker) renew(job *api.Job) bool {
+	result := jw.Db.Model(&api.Job{}).
+		Where("id = ? AND status = ? AND leased_by = ?", job.ID, api.JobRunning, jw.ID).
+		Update("lease_expires_at", jw.Now().Add(jw.Lease))
+	return result.RowsAffected > 0
+}
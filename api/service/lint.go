@@ -0,0 +1,300 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"golang.org/x/net/html"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LintPolicyEnv `warn` saves email content despite lint errors, it's rejected by default (`block`)
+const LintPolicyEnv = "SEQUENCES_LINT_POLICY"
+
+const (
+	spamScoreLimit   = 5.0        // a spam score from this on is an error
+	wordsPerLinkMin  = 10         // less text per link is a warning
+	imageSizeMax     = 1200       // pixels of width or height
+	inlineImageMax   = 100 * 1024 // bytes of a `data:` image
+	htmlIssuesMax    = 3          // unbalanced tags reported, the first ones explain the rest
+	textAlternateMin = 5          // words of the plain-text alternative
+)
+
+// spamWords each one found adds 1 to the spam score of the content, 2 of the subject
+var spamWords = []string{
+	"100% free", "act now", "buy now", "cash bonus", "click here", "double your", "earn money", "free gift",
+	"guaranteed", "limited time", "make money", "no obligation", "risk-free", "special promotion", "urgent",
+	"winner", "you have been selected",
+}
+
+// htmlVoidElements are never closed
+var htmlVoidElements = []string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr"}
+
+// htmlImpliedEndTags elements whose end tag is optional (HTML5), by the start tags closing them when open
+// They're also closed by the end tag of their parent & at the end of the content
+var htmlImpliedEndTags = map[string][]string{
+	"p": {"address", "article", "aside", "blockquote", "details", "div", "dl", "fieldset", "figcaption", "figure", "footer", "form",
+		"h1", "h2", "h3", "h4", "h5", "h6", "header", "hgroup", "hr", "main", "menu", "nav", "ol", "p", "pre", "section", "table", "ul"},
+	"li":       {"li"},
+	"dt":       {"dt", "dd"},
+	"dd":       {"dt", "dd"},
+	"option":   {"option", "optgroup"},
+	"optgroup": {"optgroup"},
+	"rt":       {"rt", "rp"},
+	"rp":       {"rt", "rp"},
+	"thead":    {"tbody", "tfoot"},
+	"tbody":    {"tbody", "tfoot"},
+	"tfoot":    {},
+	"tr":       {"tr", "tbody", "tfoot"},
+	"td":       {"td", "th", "tr", "tbody", "tfoot"},
+	"th":       {"td", "th", "tr", "tbody", "tfoot"},
+	"colgroup": {},
+	"caption":  {},
+	"head":     {"body"},
+	"body":     {},
+	"html":     {},
+}
+
+var (
+	singleBracePattern = regexp.MustCompile(`(^|[^{])\{\s*([a-z_]+(\.[a-z0-9_]+)?)\s*\}($|[^}])`)
+	wordPattern        = regexp.MustCompile(`[\p{L}\p{N}]+`)
+)
+
+// LintPolicy is `warn` or `block`
+func LintPolicy() string {
+	if strings.ToLower(os.Getenv(LintPolicyEnv)) == api.LintPolicyWarn {
+		return api.LintPolicyWarn
+	}
+	return api.LintPolicyBlock
+}
+
+// LintStep reports on the subject & content of email steps, nil for other types
+func LintStep(step *api.SequenceStep) *api.LintReport {
+	if step.Type != "" && step.Type != api.StepTypeEmail {
+		return nil
+	}
+	return LintContent(step.Subject, step.Content)
+}
+
+// lintErrors of the content under the `block` policy, joined into one validation error
+func lintErrors(subject string, content string) error {
+	if LintPolicy() != api.LintPolicyBlock {
+		return nil
+	}
+	var messages []string
+	for _, issue := range LintContent(subject, content).Issues {
+		if issue.Severity == api.LintError {
+			messages = append(messages, issue.Message)
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// LintContent checks the email as written, i.e. before its variables are replaced
+func LintContent(subject string, content string) *api.LintReport {
+	linter := &contentLinter{report: &api.LintReport{Issues: []api.LintIssue{}}}
+	linter.variables("Subject", subject)
+	linter.variables("Content", content)
+	linter.spam("Subject", subject, 2)
+	linter.spam("Content", content, 1)
+	linter.html(content)
+
+	if !hasVariable(content, UnsubscribeVariable) {
+		linter.add(api.LintWarning, api.LintRuleUnsubscribe, "Content: no {{"+UnsubscribeVariable+"}} placeholder, an unsubscribe footer is appended")
+	}
+	if linter.report.SpamScore >= spamScoreLimit {
+		linter.add(api.LintError, api.LintRuleSpam, fmt.Sprintf("Content: spam score %.1f reaches the limit of %.1f", linter.report.SpamScore, spamScoreLimit))
+	}
+	return linter.report
+}
+
+// hasVariable whether `{{name}}` appears in the text
+func hasVariable(text string, name string) bool {
+	for _, match := range variablePattern.FindAllStringSubmatch(text, -1) {
+		if strings.ToLower(match[1]) == name {
+			return true
+		}
+	}
+	return false
+}
+
+type contentLinter struct {
+	report *api.LintReport
+}
+
+func (cl *contentLinter) add(severity string, rule string, message string) {
+	cl.report.Issues = append(cl.report.Issues, api.LintIssue{Severity: severity, Rule: rule, Message: message})
+}
+
+// variables unknown ones & stray braces are errors, they would reach the contact as is
+func (cl *contentLinter) variables(field string, text string) {
+	for _, match := range variablePattern.FindAllStringSubmatch(text, -1) {
+		if name := strings.ToLower(match[1]); !isTemplateVariable(name) {
+			cl.add(api.LintError, api.LintRuleVariable, fmt.Sprintf("%s: unknown variable %s", field, match[0]))
+		}
+	}
+	rest := variablePattern.ReplaceAllString(text, "")
+	if strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		cl.add(api.LintError, api.LintRuleVariable, field+": unbalanced {{ }} of a variable")
+	}
+	for _, match := range singleBracePattern.FindAllStringSubmatch(rest, -1) {
+		if isTemplateVariable(strings.ToLower(match[2])) {
+			cl.add(api.LintError, api.LintRuleVariable, fmt.Sprintf("%s: variable {%s} needs double braces", field, match[2]))
+		}
+	}
+}
+
+// spam trigger words count `weight` each, shouting adds to the score of the subject
+func (cl *contentLinter) spam(field string, text string, weight float64) {
+	lower := strings.ToLower(text)
+	for _, word := range spamWords {
+		if strings.Contains(lower, word) {
+			cl.report.SpamScore += weight
+			cl.add(api.LintWarning, api.LintRuleSpam, fmt.Sprintf("%s: spam trigger %q", field, word))
+		}
+	}
+	if field != "Subject" {
+		return
+	}
+	if letters := strings.Map(keepLetters, text); len([]rune(letters)) >= 6 && strings.ToUpper(letters) == letters {
+		cl.report.SpamScore += 2
+		cl.add(api.LintWarning, api.LintRuleSpam, "Subject: all capitals")
+	}
+	if strings.Contains(text, "!!") {
+		cl.report.SpamScore += 1.5
+		cl.add(api.LintWarning, api.LintRuleSpam, "Subject: repeated exclamation marks")
+	}
+}
+
+func keepLetters(r rune) rune {
+	if unicode.IsLetter(r) {
+		return r
+	}
+	return -1
+}
+
+// html walks the tags once: balance, links & images, and the text the plain-text alternative is made of
+func (cl *contentLinter) html(content string) {
+	var open []string
+	var text strings.Builder
+	links, images, unbalanced := 0, 0, 0
+	unbalance := func(message string) {
+		if unbalanced++; unbalanced <= htmlIssuesMax {
+			cl.add(api.LintError, api.LintRuleHTML, "Content: "+message)
+		}
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				unbalance(tokenizer.Err().Error())
+			}
+			break
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.TextToken:
+			text.WriteString(token.Data + " ")
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch token.Data {
+			case "a":
+				links++
+			case "img":
+				images++
+				cl.image(token)
+			}
+			if tokenType == html.StartTagToken && !govalidator.IsIn(token.Data, htmlVoidElements...) {
+				// e.g. `<p>` after `<p>…` or `<li>` after `<li>…`
+				for len(open) > 0 && govalidator.IsIn(token.Data, htmlImpliedEndTags[open[len(open)-1]]...) {
+					open = open[:len(open)-1]
+				}
+				open = append(open, token.Data)
+			}
+		case html.EndTagToken:
+			if govalidator.IsIn(token.Data, htmlVoidElements...) {
+				continue
+			}
+			// e.g. `</ul>` after `<li>…`
+			if implied := impliedEnd(open, token.Data); implied > 0 {
+				open = open[:len(open)-implied]
+			}
+			if len(open) == 0 || open[len(open)-1] != token.Data {
+				expected := "nothing"
+				if len(open) > 0 {
+					expected = "<" + open[len(open)-1] + ">"
+				}
+				unbalance(fmt.Sprintf("</%s> doesn't close %s", token.Data, expected))
+				// a later match re-syncs, e.g. after a missing `</li>`
+				for i := len(open) - 1; i >= 0; i-- {
+					if open[i] == token.Data {
+						open = open[:i]
+						break
+					}
+				}
+				continue
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		if _, optional := htmlImpliedEndTags[open[i]]; !optional {
+			unbalance(fmt.Sprintf("<%s> is never closed", open[i]))
+		}
+	}
+
+	words := len(wordPattern.FindAllString(variablePattern.ReplaceAllString(text.String(), "x"), -1))
+	if words < textAlternateMin {
+		message := "Content: too little text for a plain-text alternative"
+		if images > 0 {
+			message = "Content: image-only, there is no text for a plain-text alternative"
+			cl.report.SpamScore += 2
+		}
+		cl.add(api.LintWarning, api.LintRuleText, message)
+	}
+	if links > 0 && words/links < wordsPerLinkMin {
+		cl.report.SpamScore += 1.5
+		cl.add(api.LintWarning, api.LintRuleLinks, fmt.Sprintf("Content: %d links for %d words", links, words))
+	}
+}
+
+// impliedEnd the number of open elements closed implicitly before the end tag `tag`: the elements with an
+// optional end tag above it (none if `tag` isn't open or another element is left open)
+func impliedEnd(open []string, tag string) int {
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i] == tag {
+			return len(open) - 1 - i
+		}
+		if _, optional := htmlImpliedEndTags[open[i]]; !optional {
+			return 0
+		}
+	}
+	return 0
+}
+
+// image oversized dimensions or inline data
+func (cl *contentLinter) image(token html.Token) {
+	for _, attribute := range token.Attr {
+		switch attribute.Key {
+		case "width", "height":
+			size, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(attribute.Val), "px"))
+			if err == nil && size > imageSizeMax {
+				cl.add(api.LintWarning, api.LintRuleImage, fmt.Sprintf("Content: image %s %d exceeds %dpx", attribute.Key, size, imageSizeMax))
+			}
+		case "src":
+			if strings.HasPrefix(attribute.Val, "data:") && len(attribute.Val) > inlineImageMax*4/3 {
+				cl.add(api.LintWarning, api.LintRuleImage, fmt.Sprintf("Content: inline image exceeds %dKB", inlineImageMax/1024))
+			}
+		}
+	}
+}
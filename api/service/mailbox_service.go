@@ -0,0 +1,262 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"hash/fnv"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// MailboxService manages the sending identities & which of them sends to a contact
+type MailboxService struct {
+	Db *gorm.DB
+}
+
+// smtpCredentials is what gets encrypted into `Mailbox.SMTPCredentials`
+type smtpCredentials struct {
+	Username string
+	Password string
+}
+
+const defaultSMTPPort = 587
+
+func (ms *MailboxService) List() []api.Mailbox {
+	mailboxes := []api.Mailbox{}
+	ms.Db.Order("id").Find(&mailboxes)
+	for i := range mailboxes {
+		ms.loadUsername(&mailboxes[i])
+	}
+	return mailboxes
+}
+
+func (ms *MailboxService) GetByID(id uint) *api.Mailbox {
+	var foundMailbox api.Mailbox
+	ms.Db.Where("id = ?", id).First(&foundMailbox)
+	ms.loadUsername(&foundMailbox)
+	return &foundMailbox
+}
+
+// AddressAvailable `id` is the mailbox being updated (0 on create)
+func (ms *MailboxService) AddressAvailable(address string, id uint) bool {
+	result := ms.Db.Where("address = ? AND id <> ?", strings.ToLower(address), id).Find(&api.Mailbox{})
+	return result.RowsAffected == 0
+}
+
+func (ms *MailboxService) Create(mailbox *api.Mailbox) error {
+	if err := ms.sealCredentials(mailbox); err != nil {
+		return err
+	}
+	return ms.Db.Create(mailbox).Error
+}
+
+// Update keeps the stored SMTP password when none is given
+func (ms *MailboxService) Update(foundMailbox *api.Mailbox, mailbox api.Mailbox) error {
+	if mailbox.SMTPPassword == "" {
+		credentials, err := ms.credentials(foundMailbox)
+		if err != nil {
+			return err
+		}
+		mailbox.SMTPPassword = credentials.Password
+	}
+
+	foundMailbox.FromName = mailbox.FromName
+	foundMailbox.Address = mailbox.Address
+	foundMailbox.ReplyTo = mailbox.ReplyTo
+	foundMailbox.Signature = mailbox.Signature
+	foundMailbox.SMTPHost = mailbox.SMTPHost
+	foundMailbox.SMTPPort = mailbox.SMTPPort
+	foundMailbox.SMTPUsername = mailbox.SMTPUsername
+	foundMailbox.SMTPPassword = mailbox.SMTPPassword
+	if err := ms.sealCredentials(foundMailbox); err != nil {
+		return err
+	}
+	return ms.Db.Save(foundMailbox).Error
+}
+
+// InUse mailboxes assigned to a sequence or sending to active (or paused) enrollments can't be deleted
+func (ms *MailboxService) InUse(id uint) bool {
+	if ms.Db.Where("mailbox_id = ?", id).Find(&api.SequenceMailbox{}).RowsAffected > 0 {
+		return true
+	}
+	return ms.Db.Where("mailbox_id = ? AND status IN ?", id, []string{api.EnrollmentActive, api.EnrollmentPaused}).Find(&api.Enrollment{}).RowsAffected > 0
+}
+
+func (ms *MailboxService) Delete(mailbox *api.Mailbox) {
+	ms.Db.Delete(mailbox)
+}
+
+// ValidateMailbox lowercases the address, `SMTPPort` defaults to 587
+func ValidateMailbox(mailbox *api.Mailbox) error {
+	if _, err := govalidator.ValidateStruct(mailbox); err != nil {
+		return err
+	}
+
+	mailbox.Address = strings.ToLower(mailbox.Address)
+	if mailbox.SMTPHost == "" {
+		if mailbox.SMTPPort != 0 || mailbox.SMTPUsername != "" || mailbox.SMTPPassword != "" {
+			return fmt.Errorf("SMTPHost: required with SMTP port or credentials")
+		}
+		return nil
+	}
+	if mailbox.SMTPPort == 0 {
+		mailbox.SMTPPort = defaultSMTPPort
+	}
+	if mailbox.SMTPPort > 65535 {
+		return fmt.Errorf("SMTPPort: %d is not a port", mailbox.SMTPPort)
+	}
+	return nil
+}
+
+// credentials decrypts the SMTP username & password
+func (ms *MailboxService) credentials(mailbox *api.Mailbox) (smtpCredentials, error) {
+	var credentials smtpCredentials
+	if mailbox.SMTPCredentials == "" {
+		return credentials, nil
+	}
+
+	plaintext, err := decrypt(ms.Db, mailbox.SMTPCredentials)
+	if err != nil {
+		return credentials, fmt.Errorf("mailbox %d credentials: %w", mailbox.ID, err)
+	}
+	err = json.Unmarshal([]byte(plaintext), &credentials)
+	return credentials, err
+}
+
+// sealCredentials encrypts username & password into `SMTPCredentials` & clears the password
+func (ms *MailboxService) sealCredentials(mailbox *api.Mailbox) error {
+	mailbox.SMTPCredentials = ""
+	if mailbox.SMTPUsername != "" || mailbox.SMTPPassword != "" {
+		sealed, err := encrypt(ms.Db, api.ToJSON(smtpCredentials{Username: mailbox.SMTPUsername, Password: mailbox.SMTPPassword}))
+		if err != nil {
+			return err
+		}
+		mailbox.SMTPCredentials = sealed
+	}
+	mailbox.SMTPPassword = ""
+	return nil
+}
+
+// loadUsername the username is shown, unlike the password
+func (ms *MailboxService) loadUsername(mailbox *api.Mailbox) {
+	if credentials, err := ms.credentials(mailbox); err == nil {
+		mailbox.SMTPUsername = credentials.Username
+	}
+}
+
+// Assigned mailboxes of the sequence, in rotation order
+func (ms *MailboxService) Assigned(sequenceID uint) []api.Mailbox {
+	mailboxes := []api.Mailbox{}
+	ms.Db.Joins("JOIN sequence_mailboxes ON sequence_mailboxes.mailbox_id = mailboxes.id").
+		Where("sequence_mailboxes.sequence_id = ?", sequenceID).
+		Order("sequence_mailboxes.position").
+		Find(&mailboxes)
+	for i := range mailboxes {
+		ms.loadUsername(&mailboxes[i])
+	}
+	return mailboxes
+}
+
+// ValidateAssignment every mailbox must exist (once), `Rotation` defaults to round-robin
+func (ms *MailboxService) ValidateAssignment(assignment *api.SequenceMailboxes) error {
+	if _, err := govalidator.ValidateStruct(assignment); err != nil {
+		return err
+	}
+	if assignment.Rotation == "" {
+		assignment.Rotation = api.MailboxRotationRoundRobin
+	}
+
+	seen := map[uint]bool{}
+	for _, id := range assignment.MailboxIDs {
+		if seen[id] {
+			return fmt.Errorf("MailboxIDs: %d is listed twice", id)
+		}
+		seen[id] = true
+		if ms.GetByID(id).ID == 0 {
+			return fmt.Errorf("MailboxIDs: mailbox %d not found", id)
+		}
+	}
+	return nil
+}
+
+// Assign replaces the mailboxes of the sequence, enrollments keep the mailbox they were sent from so far
+func (ms *MailboxService) Assign(sequence *api.Sequence, assignment api.SequenceMailboxes) error {
+	return ms.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("sequence_id = ?", sequence.ID).Delete(&api.SequenceMailbox{}).Error; err != nil {
+			return err
+		}
+		for i, id := range assignment.MailboxIDs {
+			if err := tx.Create(&api.SequenceMailbox{SequenceID: sequence.ID, MailboxID: id, Position: uint(i)}).Error; err != nil {
+				return err
+			}
+		}
+
+		sequence.MailboxRotation = assignment.Rotation
+		return tx.Model(sequence).Update("mailbox_rotation", assignment.Rotation).Error
+	})
+}
+
+// Pick the mailbox sending to the enrollment, nil when the sequence has none (the scheduler's `From` is used then)
+// The picked mailbox is set on the enrollment, which keeps it for the follow-ups
+func (ms *MailboxService) Pick(sequence *api.Sequence, enrollment *api.Enrollment, now time.Time) *api.Mailbox {
+	if enrollment.MailboxID != 0 {
+		if foundMailbox := ms.GetByID(enrollment.MailboxID); foundMailbox.ID != 0 {
+			return foundMailbox
+		}
+	}
+
+	mailboxes := ms.Assigned(sequence.ID)
+	if len(mailboxes) == 0 {
+		return nil
+	}
+
+	var picked *api.Mailbox
+	if sequence.MailboxRotation == api.MailboxRotationSticky {
+		picked = ms.pickSticky(mailboxes, enrollment)
+	} else {
+		picked = ms.pickRoundRobin(sequence, mailboxes, now)
+	}
+	enrollment.MailboxID = picked.ID
+	return picked
+}
+
+// pickSticky prefers the mailbox of another enrollment of the contact, otherwise it's fixed by the contact ID
+func (ms *MailboxService) pickSticky(mailboxes []api.Mailbox, enrollment *api.Enrollment) *api.Mailbox {
+	var previous api.Enrollment
+	if ms.Db.Where("contact_id = ? AND mailbox_id <> 0 AND id <> ?", enrollment.ContactID, enrollment.ID).Order("id DESC").Find(&previous).RowsAffected > 0 {
+		for i := range mailboxes {
+			if mailboxes[i].ID == previous.MailboxID {
+				return &mailboxes[i]
+			}
+		}
+	}
+
+	hash := fnv.New32a()
+	fmt.Fprint(hash, enrollment.ContactID)
+	return &mailboxes[hash.Sum32()%uint32(len(mailboxes))]
+}
+
+// pickRoundRobin the least recently picked mailbox (never picked ones first, in assignment order)
+func (ms *MailboxService) pickRoundRobin(sequence *api.Sequence, mailboxes []api.Mailbox, now time.Time) *api.Mailbox {
+	var next api.SequenceMailbox
+	ms.Db.Where("sequence_id = ?", sequence.ID).Order("last_picked_at IS NOT NULL, last_picked_at, position").First(&next)
+	ms.Db.Model(&api.SequenceMailbox{}).
+		Where("sequence_id = ? AND mailbox_id = ?", next.SequenceID, next.MailboxID).
+		Update("last_picked_at", now)
+
+	for i := range mailboxes {
+		if mailboxes[i].ID == next.MailboxID {
+			return &mailboxes[i]
+		}
+	}
+	return &mailboxes[0]
+}
+
+// FromHeader e.g. `"Jane Doe" <jane@example.com>`
+func FromHeader(mailbox *api.Mailbox) string {
+	return (&mail.Address{Name: mailbox.FromName, Address: mailbox.Address}).String()
+}
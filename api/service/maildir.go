@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MaildirPoller processes the messages delivered to `Dir/new` as replies, moving them to `Dir/cur`
+// (flagged as seen) afterwards, also when they couldn't be matched
+type MaildirPoller struct {
+	Db  *gorm.DB
+	Dir string
+}
+
+// Run polls every `interval` until `ctx` is done
+func (mp *MaildirPoller) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := mp.PollOnce(); err != nil {
+				log.Printf("maildir %s: %v", mp.Dir, err)
+			}
+		}
+	}
+}
+
+// PollOnce returns the number of matched replies
+func (mp *MaildirPoller) PollOnce() (int, error) {
+	entries, err := os.ReadDir(filepath.Join(mp.Dir, "new"))
+	if err != nil {
+		return 0, err
+	}
+
+	replyService := ReplyService{Db: mp.Db}
+	matched := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(mp.Dir, "new", entry.Name())
+		if ok, err := mp.process(&replyService, path); err != nil {
+			log.Printf("maildir message %s: %v", entry.Name(), err)
+		} else if ok {
+			matched++
+		}
+
+		if err := os.Rename(path, filepath.Join(mp.Dir, "cur", entry.Name()+":2,S")); err != nil {
+			return matched, err
+		}
+	}
+	return matched, nil
+}
+
+func (mp *MaildirPoller) process(replyService *ReplyService, path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	result, err := replyService.Process("", file)
+	if err != nil {
+		return false, err
+	}
+	return result.Matched, nil
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"golang.org/x/net/html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Threading headers, follow-ups are sent as replies to the first email of the enrollment
+const (
+	InReplyToHeader  = "In-Reply-To"
+	ReferencesHeader = "References"
+)
+
+// textBlocks start on a new paragraph of the plain-text alternative
+var textBlocks = []string{"blockquote", "div", "h1", "h2", "h3", "h4", "h5", "h6", "ol", "p", "table", "ul"}
+
+// textSkipped contents aren't shown by mail clients
+var textSkipped = []string{"head", "script", "style", "title"}
+
+var (
+	spacePattern      = regexp.MustCompile(`[ \t\r\n]+`)
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// BuildMessage is the RFC 5322 message of `email`: multipart/alternative with the plain-text alternative
+// (`Text`, generated from `HTML` when empty) first. Inline images make the HTML part multipart/related,
+// other attachments wrap everything into multipart/mixed. `Date` & `Message-ID` are added when missing from `Headers`.
+// The boundaries are derived from the content, the same email builds the same message.
+func BuildMessage(email Email) []byte {
+	text := email.Text
+	if text == "" {
+		text = HTMLToText(email.HTML)
+	}
+
+	headers := map[string]string{
+		"From":         unfold(email.From),
+		"To":           unfold(email.To),
+		"Subject":      encodeHeader(unfold(email.Subject)),
+		"MIME-Version": "1.0",
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   "<" + randomHex(16) + "@" + domainOf(email.From) + ">",
+	}
+	for name, value := range email.Headers {
+		headers[name] = unfold(value)
+	}
+
+	var inline, attached []Attachment
+	for _, attachment := range email.Attachments {
+		if attachment.ContentID != "" {
+			inline = append(inline, attachment)
+		} else {
+			attached = append(attached, attachment)
+		}
+	}
+	hash := contentHash(headers, text, email.HTML, email.Attachments)
+
+	contentType, body := multipartBody("alternative", "seq-"+hash, func(parts *multipart.Writer) {
+		writeTextPart(parts, "text/plain; charset=UTF-8", text)
+		if len(inline) == 0 {
+			writeTextPart(parts, "text/html; charset=UTF-8", email.HTML)
+			return
+		}
+		_, relatedBody := multipartBody("related", "rel-"+hash, func(parts *multipart.Writer) {
+			writeTextPart(parts, "text/html; charset=UTF-8", email.HTML)
+			for _, attachment := range inline {
+				writeAttachmentPart(parts, attachment)
+			}
+		})
+		// RFC 2387 names the type of the root part
+		writePart(parts, mime.FormatMediaType("multipart/related", map[string]string{"boundary": "rel-" + hash, "type": "text/html"}), relatedBody)
+	})
+	if len(attached) > 0 {
+		alternativeType, alternativeBody := contentType, body
+		contentType, body = multipartBody("mixed", "mix-"+hash, func(parts *multipart.Writer) {
+			writePart(parts, alternativeType, alternativeBody)
+			for _, attachment := range attached {
+				writeAttachmentPart(parts, attachment)
+			}
+		})
+	}
+	headers["Content-Type"] = contentType
+
+	var message bytes.Buffer
+	writeHeaders(&message, headers)
+	message.WriteString("\r\n")
+	message.Write(body)
+	return message.Bytes()
+}
+
+// multipartBody of the parts `write` adds, along with its content type
+func multipartBody(subtype string, boundary string, write func(parts *multipart.Writer)) (string, []byte) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	_ = parts.SetBoundary(boundary)
+	write(parts)
+	_ = parts.Close()
+	return mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary}), body.Bytes()
+}
+
+// writePart adds a nested multipart body
+func writePart(parts *multipart.Writer, contentType string, body []byte) {
+	part, _ := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	_, _ = part.Write(body)
+}
+
+// unfold replaces line breaks by spaces, no header can be injected through a value
+func unfold(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
+
+// writeHeaders sorted by name, `References` is folded between its message IDs
+func writeHeaders(buffer *bytes.Buffer, headers map[string]string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := headers[name]
+		if name == ReferencesHeader {
+			value = strings.Join(strings.Fields(value), "\r\n ")
+		}
+		fmt.Fprintf(buffer, "%s: %s\r\n", name, value)
+	}
+}
+
+// encodeHeader as RFC 2047 encoded-words when not ASCII, folded between the words
+func encodeHeader(value string) string {
+	return strings.ReplaceAll(mime.QEncoding.Encode("UTF-8", value), "?= =?", "?=\r\n =?")
+}
+
+func writeTextPart(parts *multipart.Writer, contentType string, content string) {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, _ := parts.CreatePart(header)
+
+	encoder := quotedprintable.NewWriter(part)
+	_, _ = encoder.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\n", "\r\n")))
+	_ = encoder.Close()
+}
+
+// writeAttachmentPart base64 encoded, inline parts are referenced by their `Content-ID`
+func writeAttachmentPart(parts *multipart.Writer, attachment Attachment) {
+	disposition := "attachment"
+	header := textproto.MIMEHeader{}
+	if attachment.ContentID != "" {
+		disposition = "inline"
+		header.Set("Content-ID", "<"+attachment.ContentID+">")
+	}
+	header.Set("Content-Type", mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Name}))
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	header.Set("Content-Transfer-Encoding", "base64")
+	part, _ := parts.CreatePart(header)
+
+	encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+	for len(encoded) > 76 {
+		_, _ = io.WriteString(part, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	_, _ = io.WriteString(part, encoded)
+}
+
+// contentHash the boundaries are made of, they can't appear in the (encoded) parts
+func contentHash(headers map[string]string, text string, html string, attachments []Attachment) string {
+	hash := sha256.New()
+	for _, name := range []string{"Message-ID", "Date", "Subject"} {
+		hash.Write([]byte(headers[name] + "\x00"))
+	}
+	for _, part := range []string{text, html} {
+		hash.Write([]byte(part + "\x00"))
+	}
+	for _, attachment := range attachments {
+		hash.Write([]byte(attachment.Name + "\x00" + attachment.ContentID + "\x00"))
+		hash.Write(attachment.Content)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// HTMLToText is the plain-text alternative of an HTML content: paragraphs & line breaks are kept,
+// links are followed by their target, images are replaced by their alt text
+func HTMLToText(content string) string {
+	var text strings.Builder
+	var href string
+	var linkText strings.Builder
+	skipped := 0
+
+	write := func(s string) {
+		if href != "" {
+			linkText.WriteString(s)
+		}
+		text.WriteString(s)
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.TextToken:
+			if skipped == 0 {
+				write(spacePattern.ReplaceAllString(token.Data, " "))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch {
+			case govalidator.IsIn(token.Data, textSkipped...):
+				if tokenType == html.StartTagToken {
+					skipped++
+				}
+			case govalidator.IsIn(token.Data, textBlocks...):
+				write("\n\n")
+			case token.Data == "br" || token.Data == "tr":
+				write("\n")
+			case token.Data == "li":
+				write("\n- ")
+			case token.Data == "td" || token.Data == "th":
+				write(" ")
+			case token.Data == "img":
+				write(attributeValue(token, "alt"))
+			case token.Data == "a":
+				href, _ = strings.CutPrefix(attributeValue(token, "href"), "mailto:")
+				linkText.Reset()
+			}
+		case html.EndTagToken:
+			switch {
+			case govalidator.IsIn(token.Data, textSkipped...):
+				if skipped > 0 {
+					skipped--
+				}
+			case govalidator.IsIn(token.Data, textBlocks...):
+				write("\n\n")
+			case token.Data == "a":
+				target := href
+				href = ""
+				if target != "" && strings.TrimSpace(linkText.String()) != target {
+					write(" (" + target + ")")
+				}
+			}
+		}
+	}
+
+	lines := strings.Split(text.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")) + "\n"
+}
+
+func attributeValue(token html.Token, key string) string {
+	for _, attribute := range token.Attr {
+		if attribute.Key == key {
+			return attribute.Val
+		}
+	}
+	return ""
+}
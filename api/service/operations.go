@@ -0,0 +1,495 @@
+package service
+
+import (
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// OperationError `Code` is the HTTP status the REST API responds with in the same case
+// `Exists` tells conflicts with an existing entity (e.g. a taken name) from conflicts with the state of one
+type OperationError struct {
+	Code    int
+	Message string
+	Exists  bool
+}
+
+func (oe *OperationError) Error() string {
+	return oe.Message
+}
+
+func newOperationError(code int, msg string) *OperationError {
+	return &OperationError{Code: code, Message: msg}
+}
+
+func newExistsError(msg string) *OperationError {
+	return &OperationError{Code: http.StatusConflict, Message: msg, Exists: true}
+}
+
+// Caller identifies who performs the operation (recorded in audit log)
+type Caller struct {
+	Actor     string
+	Workspace string
+	RequestID string
+}
+
+// Operations validates, audits (see `AuditService.Transaction`) & publishes mutations of sequences & steps
+// The one place for their checks, shared by REST, GraphQL, gRPC & the CLI
+type Operations struct {
+	sequenceService      SequenceService
+	sequenceStepsService SequenceStepsService
+	documentService      SequenceDocumentService
+	auditService         AuditService
+	scheduleService      ScheduleService
+	assetService         AssetService
+	variantService       VariantService
+}
+
+func NewOperations(db *gorm.DB) *Operations {
+	return &Operations{
+		sequenceService:      SequenceService{Db: db},
+		sequenceStepsService: SequenceStepsService{Db: db},
+		documentService:      SequenceDocumentService{Db: db},
+		auditService:         AuditService{Db: db},
+		scheduleService:      ScheduleService{Db: db},
+		assetService:         AssetService{Db: db, Store: LocalAssetStore{}},
+		variantService:       VariantService{Db: db},
+	}
+}
+
+func (o *Operations) ListSequences() []api.Sequence {
+	return o.sequenceService.List()
+}
+
+// GetSequence includes the (ordered) steps
+func (o *Operations) GetSequence(id uint) (*api.Sequence, error) {
+	foundSequence := o.sequenceService.GetWithSteps(uint64(id))
+	if foundSequence.ID == 0 {
+		return nil, newOperationError(http.StatusNotFound, "Sequence not found.")
+	}
+	return foundSequence, nil
+}
+
+func (o *Operations) CreateSequence(caller Caller, sequence api.Sequence) (*api.Sequence, error) {
+	if _, err := govalidator.ValidateStruct(&sequence); err != nil {
+		return nil, newOperationError(http.StatusBadRequest, err.Error())
+	}
+	if err := o.scheduleService.Validate(&sequence.Schedule); err != nil {
+		return nil, newOperationError(http.StatusBadRequest, err.Error())
+	}
+	if err := ValidateInitialStatus(&sequence); err != nil {
+		return nil, newOperationError(http.StatusBadRequest, err.Error())
+	}
+	if foundSequence := o.sequenceService.GetByName(sequence.Name); foundSequence.ID > 0 {
+		return nil, newExistsError(fmt.Sprintf("Name already assigned to sequence: %d", foundSequence.ID))
+	}
+
+	err := o.auditService.Transaction(func(tx *gorm.DB) error {
+		(&SequenceService{Db: tx}).Create(&sequence)
+		return o.audit(tx, caller, api.AuditActionCreate, api.AuditEntitySequence, sequence.ID, nil, &sequence)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sequence, nil
+}
+
+func (o *Operations) UpdateSequence(caller Caller, id uint, sequence api.Sequence) (*api.Sequence, error) {
+	foundSequence := o.sequenceService.GetByID(id)
+	if foundSequence.ID == 0 {
+		return nil, newOperationError(http.StatusNotFound, "Sequence not found.")
+	}
+	if _, err := govalidator.ValidateStruct(&sequence); err != nil {
+		return nil, newOperationError(http.StatusBadRequest, err.Error())
+	}
+	if otherSequence := o.sequenceService.GetOtherSequenceWithSameName(sequence.Name, id); otherSequence.ID > 0 {
+		return nil, newExistsError(fmt.Sprintf("Name already assigned to sequence: %d", otherSequence.ID))
+	}
+
+	before := *foundSequence
+	err := o.auditService.Transaction(func(tx *gorm.DB) error {
+		(&SequenceService{Db: tx}).Update(foundSequence, sequence)
+		return o.audit(tx, caller, api.AuditActionUpdate, api.AuditEntitySequence, id, &before, foundSequence)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return foundSequence, nil
+}
+
+// DeleteSequence removes the sequence along with its steps
+func (o *Operations) DeleteSequence(caller Caller, id uint) error {
+	foundSequence, err := o.GetSequence(id)
+	if err != nil {
+		return err
+	}
+	return o.auditService.Transaction(func(tx *gorm.DB) error {
+		if err := (&SequenceService{Db: tx}).Delete(foundSequence); err != nil {
+			return err
+		}
+		for _, step := range foundSequence.SequenceSteps {
+			if err := o.audit(tx, caller, api.AuditActionDelete, api.AuditEntitySequenceStep, step.ID, &step, nil); err != nil {
+				return err
+			}
+			if err := o.publishStep(tx, caller, api.AuditActionDelete, step); err != nil {
+				return err
+			}
+		}
+		return o.audit(tx, caller, api.AuditActionDelete, api.AuditEntitySequence, foundSequence.ID, foundSequence, nil)
+	})
+}
+
+func (o *Operations) GetStep(id uint) (*api.SequenceStep, error) {
+	foundSequenceStep := o.sequenceStepsService.GetByID(id)
+	if foundSequenceStep.ID == 0 {
+		return nil, newOperationError(http.StatusNotFound, "Step not found.")
+	}
+	return foundSequenceStep, nil
+}
+
+// ListSteps returns steps in sending order
+func (o *Operations) ListSteps(sequenceID uint) ([]api.SequenceStep, error) {
+	if foundSequence := o.sequenceService.GetByID(sequenceID); foundSequence.ID == 0 {
+		return nil, newOperationError(http.StatusNotFound, "Sequence not found.")
+	}
+	return o.sequenceStepsService.GetBySequenceID(sequenceID), nil
+}
+
+func (o *Operations) CreateStep(caller Caller, step api.SequenceStep) (*api.SequenceStep, error) {
+	if err := ValidateStep(&step); err != nil {
+		return nil, newOperationError(http.StatusBadRequest, err.Error())
+	}
+	if err := o.assetService.ValidateStepAssets(&step); err != nil {
+		return nil, newOperationError(http.StatusBadRequest, err.Error())
+	}
+	if foundSequence := o.sequenceService.GetByID(step.SequenceID); foundSequence.ID == 0 {
+		return nil, newOperationError(http.StatusBadRequest, "Sequence not found.")
+	}
+	// Assumption: steps have unique subject per sequence
+	if !o.sequenceStepsService.SubjectAvailablePerSequence(step.Subject, step.SequenceID) {
+		return nil, newExistsError("Subject already taken.")
+	}
+
+	err := o.auditService.Transaction(func(tx *gorm.DB) error {
+		(&SequenceStepsService{Db: tx}).Create(&step)
+		if err := revalidateGraph(tx, step.SequenceID); err != nil {
+			return err
+		}
+		if err := o.audit(tx, caller, api.AuditActionCreate, api.AuditEntitySequenceStep, step.ID, nil, &step); err != nil {
+			return err
+		}
+		return o.publishStep(tx, caller, api.AuditActionCreate, step)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &step, nil
+}
+
+func (o *Operations) UpdateStep(caller Caller, id uint, step api.SequenceStep) (*api.SequenceStep, error) {
+	foundSequenceStep, err := o.GetStep(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateStep(&step); err != nil {
+		return nil, newOperationError(http.StatusBadRequest, err.Error())
+	}
+	if err := o.assetService.ValidateStepAssets(&step); err != nil {
+		return nil, newOperationError(http.StatusBadRequest, err.Error())
+	}
+	if o.losesVariants(step) {
+		return nil, newOperationError(http.StatusConflict, stepHasVariantsMsg)
+	}
+
+	before := *foundSequenceStep
+	err = o.auditService.Transaction(func(tx *gorm.DB) error {
+		(&SequenceStepsService{Db: tx}).Update(foundSequenceStep, step)
+		if err := revalidateGraph(tx, foundSequenceStep.SequenceID); err != nil {
+			return err
+		}
+		if err := o.audit(tx, caller, api.AuditActionUpdate, api.AuditEntitySequenceStep, id, &before, foundSequenceStep); err != nil {
+			return err
+		}
+		return o.publishStep(tx, caller, api.AuditActionUpdate, *foundSequenceStep)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return foundSequenceStep, nil
+}
+
+// DeleteStep steps of an active sequence are only deleted with `force`
+func (o *Operations) DeleteStep(caller Caller, id uint, force bool) error {
+	foundSequenceStep, err := o.GetStep(id)
+	if err != nil {
+		return err
+	}
+	if !StepsDeletable(o.sequenceService.GetByID(foundSequenceStep.SequenceID), force) {
+		return newOperationError(http.StatusConflict, "Sequence is active, its steps are only deleted with force.")
+	}
+
+	return o.auditService.Transaction(func(tx *gorm.DB) error {
+		(&SequenceStepsService{Db: tx}).Delete(foundSequenceStep)
+		if err := revalidateGraph(tx, foundSequenceStep.SequenceID); err != nil {
+			return err
+		}
+		if err := o.audit(tx, caller, api.AuditActionDelete, api.AuditEntitySequenceStep, id, foundSequenceStep, nil); err != nil {
+			return err
+		}
+		return o.publishStep(tx, caller, api.AuditActionDelete, *foundSequenceStep)
+	})
+}
+
+// ApplyBatch validates every operation up front, if any of them fails nothing is applied: the response holds
+// the result of each operation then, along with an `OperationError` (400)
+func (o *Operations) ApplyBatch(caller Caller, sequenceID uint, batchRequest api.BatchStepsRequest) (*api.BatchStepsResponse, error) {
+	foundSequence := o.sequenceService.GetByID(sequenceID)
+	if foundSequence.ID == 0 {
+		return nil, newOperationError(http.StatusNotFound, "Sequence not found.")
+	}
+	if len(batchRequest.Operations) == 0 {
+		return nil, newOperationError(http.StatusBadRequest, "No operations provided.")
+	}
+	if !StepsDeletable(foundSequence, batchRequest.Force) {
+		for _, operation := range batchRequest.Operations {
+			if operation.Op == api.BatchOpDelete {
+				return nil, newOperationError(http.StatusConflict, "Sequence is active, its steps are only deleted with force.")
+			}
+		}
+	}
+
+	existing := make(map[uint]api.SequenceStep)
+	for _, step := range o.sequenceStepsService.GetBySequenceID(foundSequence.ID) {
+		existing[step.ID] = step
+	}
+	results, steps, valid := o.validateBatch(foundSequence.ID, batchRequest.Operations, existing)
+	if !valid {
+		response := &api.BatchStepsResponse{Error: "Batch rejected, no operations were applied.", Results: results}
+		return response, newOperationError(http.StatusBadRequest, response.Error)
+	}
+
+	var applied []api.SequenceStep
+	err := o.auditService.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if applied, err = (&SequenceStepsService{Db: tx}).ApplyBatch(batchRequest.Operations, steps); err != nil {
+			return err
+		}
+		if err := revalidateGraph(tx, foundSequence.ID); err != nil {
+			return err
+		}
+		for i, operation := range batchRequest.Operations {
+			step := applied[i]
+			// batch operations are named after the audit actions
+			var before, after *api.SequenceStep
+			switch operation.Op {
+			case api.BatchOpCreate:
+				after = &step
+			case api.BatchOpUpdate:
+				previous := existing[step.ID]
+				before, after = &previous, &step
+			case api.BatchOpDelete:
+				before = &step
+			}
+			if err := o.audit(tx, caller, operation.Op, api.AuditEntitySequenceStep, step.ID, before, after); err != nil {
+				return err
+			}
+			if err := o.publishStep(tx, caller, operation.Op, step); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range batchRequest.Operations {
+		results[i].Step = &applied[i]
+	}
+	return &api.BatchStepsResponse{Results: results}, nil
+}
+
+// validateBatch checks every operation on its own (inline images of the content included) & subjects uniqueness
+// against the state after the whole batch. Returns the steps to write (the step to delete for deletes)
+func (o *Operations) validateBatch(sequenceID uint, operations []api.BatchStepOperation, existing map[uint]api.SequenceStep) ([]api.BatchStepResult, []api.SequenceStep, bool) {
+	results := make([]api.BatchStepResult, len(operations))
+	steps := make([]api.SequenceStep, len(operations))
+	valid := true
+	fail := func(i int, status int, msg string) {
+		results[i].Status = status
+		results[i].Error = msg
+		valid = false
+	}
+
+	// subjects which stay untouched by this batch
+	subjects := make(map[string]int)
+	touched := make(map[uint]int)
+	for i, operation := range operations {
+		if operation.Op == api.BatchOpUpdate || operation.Op == api.BatchOpDelete {
+			touched[operation.ID] = i
+		}
+	}
+	for id, step := range existing {
+		if _, ok := touched[id]; !ok {
+			subjects[step.Subject] = -1
+		}
+	}
+
+	seenIDs := make(map[uint]bool)
+	for i, operation := range operations {
+		results[i] = api.BatchStepResult{Index: i, Op: operation.Op, Status: http.StatusOK}
+		if operation.Op == api.BatchOpCreate {
+			results[i].Status = http.StatusCreated
+		}
+
+		switch operation.Op {
+		case api.BatchOpCreate, api.BatchOpUpdate, api.BatchOpDelete:
+		default:
+			fail(i, http.StatusBadRequest, fmt.Sprintf("Unknown operation: %q", operation.Op))
+			continue
+		}
+
+		if operation.Op != api.BatchOpCreate {
+			if _, ok := existing[operation.ID]; !ok {
+				fail(i, http.StatusNotFound, "Step not found.")
+				continue
+			}
+			if seenIDs[operation.ID] {
+				fail(i, http.StatusConflict, "Step already referenced in this batch.")
+				continue
+			}
+			seenIDs[operation.ID] = true
+		}
+
+		step := existing[operation.ID]
+		if operation.Op == api.BatchOpDelete {
+			steps[i] = step
+			continue
+		}
+		if operation.Op == api.BatchOpCreate {
+			step = api.SequenceStep{SequenceID: sequenceID}
+		}
+		step = operation.Apply(step)
+		if err := ValidateStep(&step); err != nil {
+			fail(i, http.StatusBadRequest, err.Error())
+			continue
+		}
+		if err := o.assetService.ValidateStepAssets(&step); err != nil {
+			fail(i, http.StatusBadRequest, err.Error())
+			continue
+		}
+		if operation.Op == api.BatchOpUpdate && o.losesVariants(step) {
+			fail(i, http.StatusConflict, stepHasVariantsMsg)
+			continue
+		}
+
+		if other, taken := subjects[step.Subject]; taken {
+			msg := "Subject already taken."
+			if other >= 0 {
+				msg = fmt.Sprintf("Subject already used by operation: %d", other)
+			}
+			fail(i, http.StatusConflict, msg)
+			continue
+		}
+		subjects[step.Subject] = i
+		steps[i] = step
+	}
+
+	return results, steps, valid
+}
+
+const stepHasVariantsMsg = "Step has A/B variants, only email steps have them: delete them first."
+
+// losesVariants a step with variants can't change its type, variants are only sent by email steps
+func (o *Operations) losesVariants(step api.SequenceStep) bool {
+	return step.Type != api.StepTypeEmail && len(o.variantService.List(step.ID)) > 0
+}
+
+func (o *Operations) Import(caller Caller, document api.SequenceDocument, dryRun bool) (*api.SequenceImportResult, error) {
+	if err := o.documentService.Validate(&document); err != nil {
+		return nil, newOperationError(http.StatusBadRequest, err.Error())
+	}
+
+	plan := o.documentService.Plan(&document)
+	if !dryRun {
+		err := o.auditService.Transaction(func(tx *gorm.DB) error {
+			if err := (&SequenceDocumentService{Db: tx}).Apply(plan); err != nil {
+				return err
+			}
+			for _, record := range plan.AuditRecords(api.AuditRecord{Actor: caller.Actor, RequestID: caller.RequestID}) {
+				if err := o.auditService.Record(tx, &record); err != nil {
+					return err
+				}
+			}
+			return (&WebhookService{Db: tx}).PublishImport(caller.Workspace, plan)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &api.SequenceImportResult{
+		DryRun:     dryRun,
+		Action:     plan.Action,
+		SequenceID: plan.Sequence.ID,
+		Changes:    plan.Changes,
+	}, nil
+}
+
+func (o *Operations) Export(id uint) (*api.SequenceDocument, error) {
+	foundSequence, err := o.GetSequence(id)
+	if err != nil {
+		return nil, err
+	}
+	document := o.documentService.Export(foundSequence)
+	return &document, nil
+}
+
+// publishStep writes the webhook deliveries of the step event within `tx`, the transaction of the mutation
+func (o *Operations) publishStep(tx *gorm.DB, caller Caller, action string, step api.SequenceStep) error {
+	return (&WebhookService{Db: tx}).PublishStep(caller.Workspace, action, step)
+}
+
+// QueueExport queues a `sequence_export` job of the sequence, the job is polled for the document
+func (o *Operations) QueueExport(caller Caller, id uint) (*api.Job, error) {
+	if foundSequence := o.sequenceService.GetByID(id); foundSequence.ID == 0 {
+		return nil, newOperationError(http.StatusNotFound, "Sequence not found.")
+	}
+
+	var job *api.Job
+	err := o.auditService.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if job, err = (&JobService{Db: tx}).Enqueue(caller.Workspace, api.JobTypeSequenceExport, api.SequenceExportJob{SequenceID: id}); err != nil {
+			return err
+		}
+		return o.audit(tx, caller, api.AuditActionCreate, api.AuditEntityJob, job.ID, nil, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// audit records within `tx`, the transaction of the mutation
+// revalidateGraph step changes of a sequence with edges must keep them valid: a new step would be unreachable,
+// deleting a step drops its edges & moving a step first changes where enrollments start
+func revalidateGraph(tx *gorm.DB, sequenceID uint) error {
+	if err := (&GraphService{Db: tx}).Revalidate(sequenceID); err != nil {
+		return newOperationError(http.StatusConflict, "Steps conflict with the edges of the sequence: "+err.Error())
+	}
+	return nil
+}
+
+func (o *Operations) audit(tx *gorm.DB, caller Caller, action string, entity string, entityID uint, before any, after any) error {
+	return o.auditService.Record(tx, &api.AuditRecord{
+		Actor:     caller.Actor,
+		Entity:    entity,
+		EntityID:  entityID,
+		Action:    action,
+		Before:    api.ToJSON(before),
+		After:     api.ToJSON(after),
+		RequestID: caller.RequestID,
+	})
+}
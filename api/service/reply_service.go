@@ -0,0 +1,160 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"io"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const replySecretKey = "reply_secret"
+
+var messageIDPattern = regexp.MustCompile(`<([^<>\s]+)>`)
+
+// ReplyService matches inbound emails to the emails they answer, by `In-Reply-To`/`References`
+// or by the plus-addressed `Reply-To` of the sent email (e.g. `replies+12-5f0c...@example.com`)
+type ReplyService struct {
+	Db *gorm.DB
+}
+
+// List newest first
+func (rs *ReplyService) List(workspace string) []api.Reply {
+	replies := []api.Reply{}
+	rs.Db.Where("workspace = ?", workspace).Order("id DESC").Find(&replies)
+	return replies
+}
+
+// PlusAddress tags `address` with a signed enrollment ID, replies to it are matched even without threading headers
+func (rs *ReplyService) PlusAddress(address string, enrollmentID uint) string {
+	local, domain, found := strings.Cut(address, "@")
+	if !found {
+		return address
+	}
+	id := strconv.FormatUint(uint64(enrollmentID), 10)
+	return local + "+" + id + "-" + rs.sign(id) + "@" + domain
+}
+
+// Process matches & records a raw MIME message, `workspace` restricts matching to emails sent within it
+// (empty for any workspace, e.g. when polling the server's own mailbox)
+// Auto-replies (RFC 3834 `Auto-Submitted`, e.g. out of office) are ignored
+func (rs *ReplyService) Process(workspace string, reader io.Reader) (*api.InboundReplyResult, error) {
+	message, err := mail.ReadMessage(reader)
+	if err != nil {
+		return nil, err
+	}
+	header := message.Header
+
+	if autoSubmitted := strings.ToLower(strings.TrimSpace(header.Get("Auto-Submitted"))); autoSubmitted != "" && autoSubmitted != "no" {
+		return &api.InboundReplyResult{Ignored: "auto-reply (Auto-Submitted: " + autoSubmitted + ")"}, nil
+	}
+	if precedence := strings.ToLower(header.Get("Precedence")); precedence == "auto_reply" || precedence == "bulk" {
+		return &api.InboundReplyResult{Ignored: "auto-reply (Precedence: " + precedence + ")"}, nil
+	}
+
+	emailSend, matchedBy := rs.match(header)
+	if emailSend == nil {
+		return &api.InboundReplyResult{}, nil
+	}
+
+	var contact api.Contact
+	rs.Db.Where("id = ?", emailSend.ContactID).First(&contact)
+	if contact.ID == 0 || (workspace != "" && contact.Workspace != workspace) {
+		return &api.InboundReplyResult{}, nil
+	}
+
+	reply := api.Reply{
+		Workspace:    contact.Workspace,
+		EnrollmentID: emailSend.EnrollmentID,
+		EmailSendID:  emailSend.ID,
+		ContactID:    contact.ID,
+		SequenceID:   emailSend.SequenceID,
+		MessageID:    strings.Trim(strings.TrimSpace(header.Get("Message-Id")), "<>"),
+		Subject:      header.Get("Subject"),
+		MatchedBy:    matchedBy,
+	}
+	if from, err := mail.ParseAddress(header.Get("From")); err == nil {
+		reply.FromEmail = strings.ToLower(from.Address)
+	}
+	err = rs.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&reply).Error; err != nil {
+			return err
+		}
+
+		enrollmentService := EnrollmentService{Db: tx}
+		enrollment := enrollmentService.GetByID(emailSend.EnrollmentID)
+		if enrollment.ID != 0 {
+			enrollmentService.Stop(enrollment, api.EnrollmentReplied)
+		}
+		return (&WebhookService{Db: tx}).Publish(reply.Workspace, api.WebhookEventEmailReplied, reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.InboundReplyResult{Matched: true, Reply: &reply}, nil
+}
+
+// match threading headers win over plus-addressing, they point at the exact email
+func (rs *ReplyService) match(header mail.Header) (*api.EmailSend, string) {
+	var messageIDs []string
+	for _, match := range messageIDPattern.FindAllStringSubmatch(header.Get("In-Reply-To")+" "+header.Get("References"), -1) {
+		messageIDs = append(messageIDs, match[1])
+	}
+	if len(messageIDs) > 0 {
+		var emailSend api.EmailSend
+		rs.Db.Where("message_id IN ?", messageIDs).Order("id DESC").First(&emailSend)
+		if emailSend.ID != 0 {
+			return &emailSend, api.ReplyMatchedByMessageID
+		}
+	}
+
+	for _, key := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		addresses, err := header.AddressList(key)
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			enrollmentID, ok := rs.verifyPlusAddress(address.Address)
+			if !ok {
+				continue
+			}
+			var emailSend api.EmailSend
+			rs.Db.Where("enrollment_id = ?", enrollmentID).Order("id DESC").First(&emailSend)
+			if emailSend.ID != 0 {
+				return &emailSend, api.ReplyMatchedByPlusAddress
+			}
+		}
+	}
+	return nil, ""
+}
+
+// verifyPlusAddress returns the enrollment ID of a validly tagged address
+func (rs *ReplyService) verifyPlusAddress(address string) (uint, bool) {
+	local, _, _ := strings.Cut(strings.ToLower(address), "@")
+	_, tag, found := strings.Cut(local, "+")
+	if !found {
+		return 0, false
+	}
+	id, signature, found := strings.Cut(tag, "-")
+	if !found || !hmac.Equal([]byte(signature), []byte(rs.sign(id))) {
+		return 0, false
+	}
+	enrollmentID, err := api.StrToUint(id)
+	if err != nil {
+		return 0, false
+	}
+	return uint(enrollmentID), true
+}
+
+func (rs *ReplyService) sign(id string) string {
+	secret := (&SettingService{Db: rs.Db}).Secret(replySecretKey)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("reply:" + id))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
@@ -0,0 +1,373 @@
+package service
+
+import (
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // time zones don't depend on the host's zoneinfo
+)
+
+const (
+	timeOfDayLayout = "15:04"
+	dateLayout      = "2006-01-02"
+
+	// maxScheduleDays bounds the search for the next eligible day (e.g. a calendar holding every date of a year)
+	maxScheduleDays = 2 * 366
+)
+
+// ScheduleService computes send times honoring the `SendSchedule` of sequences & manages holiday calendars
+type ScheduleService struct {
+	Db *gorm.DB
+}
+
+func (ss *ScheduleService) ListCalendars() []api.HolidayCalendar {
+	calendars := []api.HolidayCalendar{}
+	ss.Db.Order("id").Find(&calendars)
+	return calendars
+}
+
+func (ss *ScheduleService) GetCalendarByID(id uint) *api.HolidayCalendar {
+	var foundCalendar api.HolidayCalendar
+	ss.Db.Where("id = ?", id).First(&foundCalendar)
+	return &foundCalendar
+}
+
+func (ss *ScheduleService) CalendarNameAvailable(name string, id uint) bool {
+	result := ss.Db.Where("name = ? AND id != ?", name, id).Find(&api.HolidayCalendar{})
+	return result.RowsAffected == 0
+}
+
+func (ss *ScheduleService) CreateCalendar(calendar *api.HolidayCalendar) {
+	ss.Db.Create(&calendar)
+}
+
+func (ss *ScheduleService) UpdateCalendar(foundCalendar *api.HolidayCalendar, calendar api.HolidayCalendar) {
+	foundCalendar.Name = calendar.Name
+	foundCalendar.Dates = calendar.Dates
+	ss.Db.Save(&foundCalendar)
+}
+
+// CalendarInUse calendars referenced by sequences can't be deleted
+func (ss *ScheduleService) CalendarInUse(id uint) bool {
+	result := ss.Db.Where("schedule_holiday_calendar_id = ?", id).Find(&api.Sequence{})
+	return result.RowsAffected > 0
+}
+
+func (ss *ScheduleService) DeleteCalendar(calendar *api.HolidayCalendar) {
+	ss.Db.Delete(&calendar)
+}
+
+// ValidateCalendar dates are normalized (sorted, without duplicates)
+func ValidateCalendar(calendar *api.HolidayCalendar) error {
+	if strings.TrimSpace(calendar.Name) == "" {
+		return fmt.Errorf("Name: non zero value required")
+	}
+	for _, date := range calendar.Dates {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return fmt.Errorf("Dates: %q is not a YYYY-MM-DD date", date)
+		}
+	}
+	slices.Sort(calendar.Dates)
+	calendar.Dates = slices.Compact(calendar.Dates)
+	return nil
+}
+
+// Validate normalizes the day names to lowercase
+func (ss *ScheduleService) Validate(schedule *api.SendSchedule) error {
+	for i, day := range schedule.Days {
+		schedule.Days[i] = strings.ToLower(strings.TrimSpace(day))
+		if !slices.Contains(api.Weekdays, schedule.Days[i]) {
+			return fmt.Errorf("Days: unknown day %q, expected one of %v", day, api.Weekdays)
+		}
+	}
+
+	from, err := parseTimeOfDay(schedule.From, 0)
+	if err != nil {
+		return fmt.Errorf("From: %v", err)
+	}
+	until, err := parseTimeOfDay(schedule.Until, 24*time.Hour)
+	if err != nil {
+		return fmt.Errorf("Until: %v", err)
+	}
+	if from >= until {
+		return fmt.Errorf("Until: must be after From")
+	}
+
+	if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+		return fmt.Errorf("TimeZone: %v", err)
+	}
+	var holidays []string
+	if schedule.HolidayCalendarID != 0 {
+		calendar := ss.GetCalendarByID(schedule.HolidayCalendarID)
+		if calendar.ID == 0 {
+			return fmt.Errorf("HolidayCalendarID: calendar %d not found", schedule.HolidayCalendarID)
+		}
+		holidays = calendar.Dates
+	}
+	return validateSendDays(*schedule, holidays)
+}
+
+// ValidateCalendarUpdate rejects dates leaving a schedule using the calendar without any send day
+func (ss *ScheduleService) ValidateCalendarUpdate(id uint, calendar api.HolidayCalendar) error {
+	var sequences []api.Sequence
+	ss.Db.Where("schedule_holiday_calendar_id = ?", id).Find(&sequences)
+	for _, sequence := range sequences {
+		if err := validateSendDays(sequence.Schedule, calendar.Dates); err != nil {
+			return fmt.Errorf("Dates: schedule of sequence %d: %v", sequence.ID, err)
+		}
+	}
+	return nil
+}
+
+// validateSendDays enrollments of a schedule without a send day within `maxScheduleDays` could never be sent
+func validateSendDays(schedule api.SendSchedule, holidays []string) error {
+	planner := newPlanner(schedule, schedule.TimeZone, holidays)
+	if _, ok := planner.nextEligible(time.Now()); !ok {
+		return fmt.Errorf("Days: no send day within the next %d days (every day is a holiday)", maxScheduleDays)
+	}
+	return nil
+}
+
+// UpdateSchedule active enrollments keep their next send time, it's checked against the new schedule when due
+func (ss *ScheduleService) UpdateSchedule(sequence *api.Sequence, schedule api.SendSchedule) {
+	sequence.Schedule = schedule
+	ss.Db.Model(&sequence).Updates(map[string]any{
+		"schedule_days":                api.ToJSON(schedule.Days),
+		"schedule_from":                schedule.From,
+		"schedule_until":               schedule.Until,
+		"schedule_time_zone":           schedule.TimeZone,
+		"schedule_business_days_only":  schedule.BusinessDaysOnly,
+		"schedule_holiday_calendar_id": schedule.HolidayCalendarID,
+	})
+}
+
+// Planner for sending the steps of `sequence` to `contact`, in the schedule's time zone when the contact's is unknown
+// (contacts saved before time zones were validated)
+func (ss *ScheduleService) Planner(sequence *api.Sequence, contact *api.Contact) *Planner {
+	schedule := sequence.Schedule
+	timeZone := contact.TimeZone
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		log.Printf("contact %d: %v, using the time zone of sequence %d", contact.ID, err, sequence.ID)
+		timeZone = ""
+	}
+	if timeZone == "" {
+		timeZone = schedule.TimeZone
+	}
+
+	var holidays []string
+	if schedule.HolidayCalendarID != 0 {
+		holidays = ss.GetCalendarByID(schedule.HolidayCalendarID).Dates
+	}
+	return newPlanner(schedule, timeZone, holidays)
+}
+
+func newPlanner(schedule api.SendSchedule, timeZone string, holidays []string) *Planner {
+	planner := &Planner{schedule: schedule, location: time.UTC, holidays: map[string]bool{}}
+	if location, err := time.LoadLocation(timeZone); err == nil {
+		planner.location = location
+	}
+	for _, date := range holidays {
+		planner.holidays[date] = true
+	}
+
+	planner.from, _ = parseTimeOfDay(schedule.From, 0)
+	planner.until, _ = parseTimeOfDay(schedule.Until, 24*time.Hour)
+	return planner
+}
+
+// Preview projects the send times of the remaining steps, starting at `start` unless the contact is
+// already enrolled (then the enrollment's progress is used). Sequences with edges follow the path of the contact:
+// the preview ends where it depends on how the contact engages (the last step lists its `Branches`), it also ends
+// with a manual task (the next step is due once the task is done)
+func (ss *ScheduleService) Preview(sequence *api.Sequence, contact *api.Contact, start time.Time) []api.SendPreview {
+	steps := (&SequenceStepsService{Db: ss.Db}).GetBySequenceID(sequence.ID)
+	edges := (&GraphService{Db: ss.Db}).Edges(sequence.ID)
+	planner := ss.Planner(sequence, contact)
+
+	var enrollment api.Enrollment
+	ss.Db.Where("sequence_id = ? AND contact_id = ?", sequence.ID, contact.ID).First(&enrollment)
+
+	index := 0 // of the next step, without edges
+	var step *api.SequenceStep
+	var sendAt time.Time
+	switch {
+	case enrollment.ID == 0:
+		if len(steps) > 0 {
+			step = &steps[0]
+			sendAt = planner.SendTime(start, steps[0].WaitDays)
+		}
+	case enrollment.Status == api.EnrollmentActive && enrollment.NextSendAt != nil:
+		sendAt = planner.NextEligible(*enrollment.NextSendAt)
+		switch {
+		case len(edges) == 0:
+			index = int(enrollment.NextStep)
+			if index < len(steps) {
+				step = &steps[index]
+			}
+		case enrollment.CurrentStepID == 0:
+			step = &steps[0]
+		case enrollment.CurrentStepAt != nil:
+			step, sendAt, _ = follow(enrollment.CurrentStepID, steps, edges, contact, *enrollment.CurrentStepAt, planner)
+		}
+	default:
+		return []api.SendPreview{} // nothing is sent anymore
+	}
+
+	previews := []api.SendPreview{}
+	for step != nil {
+		preview := api.SendPreview{StepID: step.ID, Position: step.Position, Type: step.Type, TimeZone: planner.Location().String()}
+		switch step.Type {
+		case api.StepTypeEmail:
+			preview.Subject = step.Subject
+		case api.StepTypeWaitUntil:
+			if step.WaitUntil.After(sendAt) {
+				sendAt = *step.WaitUntil
+			}
+		}
+		preview.SendAt = sendAt.UTC()
+		preview.LocalAt = sendAt.In(planner.Location()).Format(time.RFC3339)
+
+		doneAt := sendAt
+		step = nil
+		switch {
+		case preview.Type == api.StepTypeManualTask:
+		case len(edges) > 0:
+			step, sendAt, preview.Branches = follow(preview.StepID, steps, edges, contact, doneAt, planner)
+		case index+1 < len(steps):
+			index++
+			step = &steps[index]
+			sendAt = planner.SendTime(doneAt, step.WaitDays)
+		}
+		previews = append(previews, preview)
+	}
+	return previews
+}
+
+// follow the edges of a step done at `doneAt`: returns the next step & when it's due, or the steps the contact
+// may go on to when that depends on how the contact engages (neither at the end of the sequence)
+func follow(stepID uint, steps []api.SequenceStep, edges []api.StepEdge, contact *api.Contact, doneAt time.Time, planner *Planner) (*api.SequenceStep, time.Time, []uint) {
+	from := outgoing(edges, stepID)
+	for i, edge := range from {
+		target := stepByID(steps, edge.ToStepID)
+		if target == nil {
+			continue
+		}
+		if isEngagementCondition(edge.Condition) {
+			var branches []uint
+			for _, other := range from[i:] {
+				if !slices.Contains(branches, other.ToStepID) {
+					branches = append(branches, other.ToStepID)
+				}
+			}
+			return nil, time.Time{}, branches
+		}
+		// attribute conditions only depend on the contact
+		if holds(edge, &api.EmailSend{}, contact) {
+			return target, dueAt(edge, target, doneAt, planner), nil
+		}
+	}
+	return nil, time.Time{}, nil
+}
+
+// Planner computes send times in the contact's time zone
+type Planner struct {
+	schedule api.SendSchedule
+	location *time.Location
+	holidays map[string]bool
+	from     time.Duration // since local midnight
+	until    time.Duration
+}
+
+func (p *Planner) Location() *time.Location {
+	return p.location
+}
+
+// Delay adds the wait days of a step to `t`, only counting business days (Mon-Fri, no holidays) when configured
+func (p *Planner) Delay(t time.Time, waitDays uint) time.Time {
+	if !p.schedule.BusinessDaysOnly {
+		return t.Add(time.Duration(waitDays) * 24 * time.Hour)
+	}
+
+	local := t.In(p.location)
+	for remaining := waitDays; remaining > 0; {
+		local = local.AddDate(0, 0, 1)
+		if p.isBusinessDay(local) {
+			remaining--
+		}
+	}
+	return local.UTC()
+}
+
+// NextEligible is `t` itself when it's inside the sending window, the start of the next window otherwise
+// Schedules without an eligible day are rejected by `ScheduleService.Validate`
+func (p *Planner) NextEligible(t time.Time) time.Time {
+	if next, ok := p.nextEligible(t); ok {
+		return next
+	}
+	// no eligible day (e.g. a schedule saved before the check), don't block forever
+	return t.UTC()
+}
+
+func (p *Planner) nextEligible(t time.Time) (time.Time, bool) {
+	local := t.In(p.location)
+	for i := 0; i < maxScheduleDays; i++ {
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, p.location)
+		if p.isSendDay(midnight) {
+			windowStart := addTimeOfDay(midnight, p.from)
+			windowEnd := addTimeOfDay(midnight, p.until)
+			if local.Before(windowStart) {
+				return windowStart.UTC(), true
+			}
+			if local.Before(windowEnd) {
+				return local.UTC(), true
+			}
+		}
+		local = time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, p.location)
+	}
+	return time.Time{}, false
+}
+
+// IsEligible `t` is inside the sending window
+func (p *Planner) IsEligible(t time.Time) bool {
+	return p.NextEligible(t).Equal(t.UTC())
+}
+
+// SendTime of a step waiting `waitDays` after `previous` (the enrollment or the previous step)
+func (p *Planner) SendTime(previous time.Time, waitDays uint) time.Time {
+	return p.NextEligible(p.Delay(previous, waitDays))
+}
+
+func (p *Planner) isSendDay(local time.Time) bool {
+	if p.holidays[local.Format(dateLayout)] {
+		return false
+	}
+	return len(p.schedule.Days) == 0 || slices.Contains(p.schedule.Days, api.Weekdays[local.Weekday()])
+}
+
+func (p *Planner) isBusinessDay(local time.Time) bool {
+	weekday := local.Weekday()
+	return weekday != time.Saturday && weekday != time.Sunday && !p.holidays[local.Format(dateLayout)]
+}
+
+// addTimeOfDay uses the wall clock, so windows stay put across DST changes
+func addTimeOfDay(midnight time.Time, offset time.Duration) time.Time {
+	hours := int(offset / time.Hour)
+	minutes := int(offset % time.Hour / time.Minute)
+	return time.Date(midnight.Year(), midnight.Month(), midnight.Day(), hours, minutes, 0, 0, midnight.Location())
+}
+
+// parseTimeOfDay returns `empty` for empty values
+func parseTimeOfDay(value string, empty time.Duration) (time.Duration, error) {
+	if value == "" {
+		return empty, nil
+	}
+	t, err := time.Parse(timeOfDayLayout, value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,395 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"html"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Headers added to every email, see RFC 8058 (one-click unsubscribe)
+const (
+	ListUnsubscribeHeader     = "List-Unsubscribe"
+	ListUnsubscribePostHeader = "List-Unsubscribe-Post"
+	ListUnsubscribeOneClick   = "List-Unsubscribe=One-Click"
+)
+
+// Scheduler sends the due step of active enrollments, one step per enrollment & run
+// Other step types than emails are dispatched too: manual tasks are opened, waits held & HTTP calls made
+type Scheduler struct {
+	Db        *gorm.DB
+	Sender    Sender
+	From      string
+	PublicURL string // where `/u/:token` is reachable from the outside
+	// ReplyAddress when set, `Reply-To` is plus-tagged with the enrollment (see `ReplyService.PlusAddress`): the `ReplyTo`
+	// of the sending mailbox if it has one (replies still reach its owner), this address otherwise
+	ReplyAddress string
+	RetryWait    time.Duration
+	BatchSize    int
+	// Lease an enrollment is claimed for while its step is processed, other schedulers pick it up again once it expired
+	Lease time.Duration
+	// Jitter waits a random duration below it after each send, so that emails don't go out in bursts
+	Jitter     time.Duration
+	HTTPClient *http.Client     // of `http_call` steps
+	Assets     AssetStore       // attachments & inline images of the steps
+	Now        func() time.Time // overridable in tests
+}
+
+func NewScheduler(db *gorm.DB, sender Sender, from string, publicURL string) *Scheduler {
+	return &Scheduler{
+		Db:         db,
+		Sender:     sender,
+		From:       from,
+		PublicURL:  publicURL,
+		RetryWait:  10 * time.Minute,
+		BatchSize:  100,
+		Lease:      10 * time.Minute,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Assets:     LocalAssetStore{},
+		Now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run sends due steps every `interval` until `ctx` is done
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RunDue(ctx)
+		}
+	}
+}
+
+// RunDue processes every due active enrollment of active sequences, returns the number of emails sent
+func (s *Scheduler) RunDue(ctx context.Context) int {
+	var enrollments []api.Enrollment
+	s.Db.Joins("JOIN sequences ON sequences.id = enrollments.sequence_id AND sequences.status = ?", api.SequenceActive).
+		Where("enrollments.status = ? AND enrollments.next_send_at <= ?", api.EnrollmentActive, s.Now()).
+		Order("enrollments.next_send_at, enrollments.id").
+		Limit(s.BatchSize).
+		Find(&enrollments)
+
+	sent := 0
+	for i := range enrollments {
+		if !s.claim(&enrollments[i]) {
+			continue
+		}
+		ok, err := s.process(ctx, &enrollments[i])
+		if err != nil {
+			log.Printf("enrollment %d: %v", enrollments[i].ID, err)
+		}
+		if ok {
+			sent++
+			if !s.wait(ctx) {
+				break
+			}
+		}
+	}
+	return sent
+}
+
+// claim leases the enrollment by pushing its `NextSendAt` by `Lease`, processing it sets the actual next send time
+// The update only applies when `NextSendAt` didn't change since the enrollment was loaded: false when another scheduler
+// claimed it meanwhile. Enrollments of a scheduler that went away are due again once the lease expired
+func (s *Scheduler) claim(enrollment *api.Enrollment) bool {
+	leaseExpiresAt := s.Now().Add(s.Lease)
+	result := s.Db.Model(&api.Enrollment{}).
+		Where("id = ? AND status = ? AND next_send_at = ?", enrollment.ID, api.EnrollmentActive, enrollment.NextSendAt).
+		Update("next_send_at", leaseExpiresAt)
+	if result.Error != nil {
+		log.Printf("enrollment %d: %v", enrollment.ID, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	enrollment.NextSendAt = &leaseExpiresAt
+	return true
+}
+
+// wait sleeps up to `Jitter`, returns false when `ctx` is done meanwhile
+func (s *Scheduler) wait(ctx context.Context) bool {
+	if s.Jitter <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(s.Jitter))))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// process `sent` is false when nothing was sent (e.g. contact is suppressed, send failed)
+func (s *Scheduler) process(ctx context.Context, enrollment *api.Enrollment) (sent bool, err error) {
+	// the sequence (or the enrollment) may have been paused since the batch was loaded
+	enrollmentService := EnrollmentService{Db: s.Db}
+	sequence := (&SequenceService{Db: s.Db}).GetByID(enrollment.SequenceID)
+	if sequence.Status != api.SequenceActive || enrollmentService.GetByID(enrollment.ID).Status != api.EnrollmentActive {
+		return false, nil
+	}
+
+	var contact api.Contact
+	if err := s.Db.Where("id = ?", enrollment.ContactID).First(&contact).Error; err != nil {
+		return false, fmt.Errorf("contact %d: %w", enrollment.ContactID, err)
+	}
+
+	if (&SuppressionService{Db: s.Db}).IsSuppressed(contact.Workspace, contact.Email) {
+		enrollmentService.Stop(enrollment, api.EnrollmentSuppressed)
+		return false, nil
+	}
+
+	steps := (&SequenceStepsService{Db: s.Db}).GetBySequenceID(enrollment.SequenceID)
+	planner := (&ScheduleService{Db: s.Db}).Planner(sequence, &contact)
+	graphService := GraphService{Db: s.Db}
+	edges := graphService.Edges(enrollment.SequenceID)
+
+	// with edges, the next step depends on how the contact reacted to the last one
+	var step *api.SequenceStep
+	if len(edges) == 0 {
+		if int(enrollment.NextStep) < len(steps) {
+			step = &steps[enrollment.NextStep]
+		}
+	} else if len(steps) > 0 {
+		var evaluateAt *time.Time
+		step, evaluateAt = graphService.Next(enrollment, &contact, steps, edges, planner, s.Now())
+		if evaluateAt != nil {
+			enrollment.NextSendAt = evaluateAt
+			s.Db.Save(&enrollment)
+			return false, nil
+		}
+	}
+	if step == nil {
+		enrollmentService.Stop(enrollment, api.EnrollmentCompleted)
+		return false, nil
+	}
+
+	switch step.Type {
+	case api.StepTypeManualTask:
+		_, err := (&TaskService{Db: s.Db}).Open(enrollment, &contact, step)
+		return false, err
+	case api.StepTypeWaitUntil:
+		if now := s.Now(); now.Before(*step.WaitUntil) {
+			enrollment.NextSendAt = step.WaitUntil
+			s.Db.Save(&enrollment)
+		} else {
+			enrollmentService.Advance(enrollment, step.ID, now)
+		}
+		return false, nil
+	case api.StepTypeHTTPCall:
+		if err := s.call(ctx, enrollment, &contact, step); err != nil {
+			retryAt := s.Now().Add(s.RetryWait)
+			enrollment.NextSendAt = &retryAt
+			enrollment.LastError = err.Error()
+			s.Db.Save(&enrollment)
+			return false, err
+		}
+		enrollmentService.Advance(enrollment, step.ID, s.Now())
+		return false, nil
+	}
+
+	// the schedule may have changed since the send time was computed
+	if now := s.Now(); !planner.IsEligible(now) {
+		nextSendAt := planner.NextEligible(now)
+		enrollment.NextSendAt = &nextSendAt
+		s.Db.Save(&enrollment)
+		return false, nil
+	}
+
+	// follow-ups come from the mailbox of the first step
+	mailbox := (&MailboxService{Db: s.Db}).Pick(sequence, enrollment, s.Now())
+	from := s.From
+	if mailbox != nil {
+		from = mailbox.Address
+	}
+
+	// throttled sends wait until every bucket has a token again
+	ok, retryAt, err := (&ThrottleService{Db: s.Db}).Take(mailboxOf(from), domainOf(contact.Email), s.Now())
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		nextSendAt := planner.NextEligible(retryAt)
+		enrollment.NextSendAt = &nextSendAt
+		s.Db.Save(&enrollment)
+		return false, nil
+	}
+
+	// a failed send doesn't use up the token it took
+	releaseToken := func() {
+		if err := (&ThrottleService{Db: s.Db}).Release(mailboxOf(from), domainOf(contact.Email), s.Now()); err != nil {
+			log.Printf("enrollment %d: releasing throttle token: %v", enrollment.ID, err)
+		}
+	}
+
+	email, emailSend, err := s.render(sequence, enrollment, &contact, step, mailbox)
+	if err != nil {
+		releaseToken()
+		return false, err
+	}
+	if err := s.Sender.Send(ctx, email); err != nil {
+		releaseToken()
+		retryAt := planner.NextEligible(s.Now().Add(s.RetryWait))
+		enrollment.NextSendAt = &retryAt
+		enrollment.LastError = err.Error()
+		s.Db.Save(&enrollment)
+		return false, err
+	}
+
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&emailSend).Error; err != nil {
+			return err
+		}
+		if enrollment.ThreadID == "" {
+			enrollment.ThreadID = emailSend.MessageID
+		}
+		if err := (&WebhookService{Db: tx}).Publish(contact.Workspace, api.WebhookEventEmailSent, emailSend); err != nil {
+			return err
+		}
+		(&EnrollmentService{Db: tx}).Advance(enrollment, step.ID, emailSend.SentAt)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// call requests the URL of an `http_call` step, any status but 2xx fails the call
+func (s *Scheduler) call(ctx context.Context, enrollment *api.Enrollment, contact *api.Contact, step *api.SequenceStep) error {
+	body := step.Content
+	if body == "" {
+		body = api.ToJSON(api.StepCall{EnrollmentID: enrollment.ID, SequenceID: enrollment.SequenceID, StepID: step.ID, Contact: *contact})
+	}
+
+	request, err := http.NewRequestWithContext(ctx, step.Method, step.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := s.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("step %d: unexpected response status: %s", step.ID, response.Status)
+	}
+	return nil
+}
+
+// render adds tracking, the unsubscribe link to the content & the matching headers, the mailbox (if any) sets sender & signature
+// The subject & content come from the step's variant for the enrollment, if it has variants. Follow-ups reply to the first email.
+func (s *Scheduler) render(sequence *api.Sequence, enrollment *api.Enrollment, contact *api.Contact, step *api.SequenceStep, mailbox *api.Mailbox) (Email, api.EmailSend, error) {
+	unsubscribeURL := (&UnsubscribeService{Db: s.Db}).URL(s.PublicURL, enrollment.ID)
+
+	subject, content, variantID := step.Subject, step.Content, uint(0)
+	if variant := (&VariantService{Db: s.Db}).Choose(step, enrollment.ID); variant != nil {
+		subject, content, variantID = variant.Subject, variant.Content, variant.ID
+	}
+
+	email := Email{
+		From:    s.From,
+		To:      contact.Email,
+		Subject: renderVariables(subject, contact, nil),
+		HTML:    content,
+		Headers: map[string]string{
+			ListUnsubscribeHeader:     "<" + unsubscribeURL + ">",
+			ListUnsubscribePostHeader: ListUnsubscribeOneClick,
+		},
+	}
+
+	if mailbox != nil {
+		email.From = FromHeader(mailbox)
+		if mailbox.Signature != "" {
+			email.HTML += "\n" + mailbox.Signature
+		}
+		if mailbox.ReplyTo != "" {
+			email.Headers["Reply-To"] = mailbox.ReplyTo
+		}
+		if mailbox.SMTPHost != "" {
+			credentials, err := (&MailboxService{Db: s.Db}).credentials(mailbox)
+			if err != nil {
+				return email, api.EmailSend{}, err
+			}
+			email.SMTP = &SMTPServer{Host: mailbox.SMTPHost, Port: mailbox.SMTPPort, Username: credentials.Username, Password: credentials.Password}
+		}
+	}
+	email.HTML = renderVariables(email.HTML, contact, html.EscapeString)
+	trackingID := randomHex(16)
+	email.HTML = (&TrackingService{Db: s.Db}).AddTracking(email.HTML, sequence, s.PublicURL, trackingID)
+	// the footer link is left out when the content places the unsubscribe link itself
+	var placed bool
+	if email.HTML, placed = renderUnsubscribe(email.HTML, html.EscapeString(unsubscribeURL)); !placed {
+		email.HTML += unsubscribeFooter(unsubscribeURL)
+	}
+
+	// replies are only detected through the plus-tagged address
+	if s.ReplyAddress != "" {
+		replyAddress := s.ReplyAddress
+		if mailbox != nil && mailbox.ReplyTo != "" {
+			replyAddress = mailbox.ReplyTo
+		}
+		email.Headers["Reply-To"] = (&ReplyService{Db: s.Db}).PlusAddress(replyAddress, enrollment.ID)
+	}
+
+	messageID := randomHex(16) + "@" + domainOf(email.From)
+	email.Headers["Message-ID"] = "<" + messageID + ">"
+	email.Headers["Date"] = s.Now().Format(time.RFC1123Z)
+	if enrollment.ThreadID != "" {
+		email.Headers[InReplyToHeader] = "<" + enrollment.ThreadID + ">"
+		email.Headers[ReferencesHeader] = "<" + enrollment.ThreadID + ">"
+	}
+	email.Text = HTMLToText(email.HTML)
+	attachments, err := (&AssetService{Db: s.Db, Store: s.Assets}).Parts(step, email.HTML)
+	if err != nil {
+		return email, api.EmailSend{}, err
+	}
+	email.Attachments = attachments
+
+	emailSend := api.EmailSend{
+		EnrollmentID: enrollment.ID,
+		SequenceID:   enrollment.SequenceID,
+		StepID:       step.ID,
+		ContactID:    contact.ID,
+		MailboxID:    enrollment.MailboxID,
+		VariantID:    variantID,
+		MessageID:    messageID,
+		TrackingID:   trackingID,
+		ToEmail:      contact.Email,
+		Subject:      email.Subject,
+		SentAt:       s.Now(),
+	}
+	return email, emailSend, nil
+}
+
+func unsubscribeFooter(unsubscribeURL string) string {
+	return fmt.Sprintf("\n<p style=\"font-size:small\"><a href=\"%s\">Unsubscribe</a></p>", html.EscapeString(unsubscribeURL))
+}
+
+// domainOf falls back to `localhost` for addresses without domain
+func domainOf(address string) string {
+	address = strings.TrimSuffix(strings.TrimSpace(address), ">")
+	if at := strings.LastIndex(address, "@"); at >= 0 && at < len(address)-1 {
+		return address[at+1:]
+	}
+	return "localhost"
+}
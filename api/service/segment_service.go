@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"path"
+	"slices"
+	"strings"
+)
+
+// SegmentService manages the saved contact filters of workspaces & evaluates them
+type SegmentService struct {
+	Db *gorm.DB
+}
+
+func (ss *SegmentService) List(workspace string) []api.Segment {
+	segments := []api.Segment{}
+	ss.Db.Where("workspace = ?", workspace).Order("id").Find(&segments)
+	return segments
+}
+
+func (ss *SegmentService) GetByID(workspace string, id uint) *api.Segment {
+	var foundSegment api.Segment
+	ss.Db.Where("workspace = ? AND id = ?", workspace, id).First(&foundSegment)
+	return &foundSegment
+}
+
+// NameAvailable `id` is the segment being updated (0 on create)
+func (ss *SegmentService) NameAvailable(workspace string, name string, id uint) bool {
+	result := ss.Db.Where("workspace = ? AND name = ? AND id <> ?", workspace, name, id).Find(&api.Segment{})
+	return result.RowsAffected == 0
+}
+
+func (ss *SegmentService) Create(workspace string, segment *api.Segment) {
+	segment.Workspace = workspace
+	ss.Db.Create(segment)
+}
+
+func (ss *SegmentService) Update(foundSegment *api.Segment, segment api.Segment) {
+	foundSegment.Name = segment.Name
+	foundSegment.Rules = segment.Rules
+	ss.Db.Save(foundSegment)
+}
+
+// InUse segments sequences enroll from or exclude can't be deleted
+func (ss *SegmentService) InUse(id uint) bool {
+	result := ss.Db.Where("auto_enroll_segment_id = ? OR auto_enroll_exclude_segment_id = ?", id, id).Find(&api.Sequence{})
+	return result.RowsAffected > 0
+}
+
+func (ss *SegmentService) Delete(segment *api.Segment) {
+	ss.Db.Delete(segment)
+}
+
+// ValidateSegment lowercases rule values, a segment without rules has every contact of the workspace
+func ValidateSegment(segment *api.Segment) error {
+	if _, err := govalidator.ValidateStruct(segment); err != nil {
+		return err
+	}
+
+	attributes := append([]string{"status", api.SegmentAttributeTag}, api.EdgeAttributes...)
+	for i := range segment.Rules {
+		rule := &segment.Rules[i]
+		if _, err := govalidator.ValidateStruct(rule); err != nil {
+			return fmt.Errorf("Rules[%d]: %w", i, err)
+		}
+		rule.Attribute = strings.ToLower(rule.Attribute)
+		if !govalidator.IsIn(rule.Attribute, attributes...) && !isCustomAttribute(rule.Attribute) {
+			return fmt.Errorf("Rules[%d]: Attribute: must be one of %s or %s<name>", i, strings.Join(attributes, ", "), api.AttributePrefix)
+		}
+		tagOperator := rule.Operator == api.SegmentOpHas || rule.Operator == api.SegmentOpNotHas
+		if tagOperator != (rule.Attribute == api.SegmentAttributeTag) {
+			return fmt.Errorf("Rules[%d]: Operator: has & not_has are the only operators of tag", i)
+		}
+		rule.Value = strings.ToLower(strings.TrimSpace(rule.Value))
+		if _, err := path.Match(rule.Value, ""); err != nil {
+			return fmt.Errorf("Rules[%d]: Value: %q is not a valid pattern", i, rule.Value)
+		}
+	}
+	return nil
+}
+
+// Matches the contact (of the segment's workspace) matches every rule
+func (ss *SegmentService) Matches(segment *api.Segment, contact *api.Contact) bool {
+	if segment.ID == 0 || contact.Workspace != segment.Workspace {
+		return false
+	}
+	for _, rule := range segment.Rules {
+		if !matchesRule(rule, contact) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesRule(rule api.SegmentRule, contact *api.Contact) bool {
+	if rule.Attribute == api.SegmentAttributeTag {
+		return slices.Contains(contact.Tags, rule.Value) == (rule.Operator == api.SegmentOpHas)
+	}
+
+	value := strings.ToLower(attributeOf(contact, rule.Attribute))
+	switch rule.Operator {
+	case api.SegmentOpEquals:
+		return value == rule.Value
+	case api.SegmentOpNotEquals:
+		return value != rule.Value
+	case api.SegmentOpContains:
+		return strings.Contains(value, rule.Value)
+	case api.SegmentOpMatches:
+		matched, _ := path.Match(rule.Value, value)
+		return matched
+	}
+	return false
+}
+
+// Members contacts of the segment, in creation order
+func (ss *SegmentService) Members(segment *api.Segment) []api.Contact {
+	members := []api.Contact{}
+	for _, contact := range (&ContactService{Db: ss.Db}).List(segment.Workspace) {
+		if ss.Matches(segment, &contact) {
+			members = append(members, contact)
+		}
+	}
+	return members
+}
+
+// ValidateAutoEnrollment both segments must belong to `workspace`, `Reenrollment` defaults to never
+func (ss *SegmentService) ValidateAutoEnrollment(workspace string, settings *api.AutoEnrollment) error {
+	if _, err := govalidator.ValidateStruct(settings); err != nil {
+		return err
+	}
+	if settings.Reenrollment == "" {
+		settings.Reenrollment = api.ReenrollNever
+	}
+	if settings.SegmentID != 0 && ss.GetByID(workspace, settings.SegmentID).ID == 0 {
+		return fmt.Errorf("SegmentID: segment %d not found", settings.SegmentID)
+	}
+	if settings.ExcludeSegmentID != 0 && ss.GetByID(workspace, settings.ExcludeSegmentID).ID == 0 {
+		return fmt.Errorf("ExcludeSegmentID: segment %d not found", settings.ExcludeSegmentID)
+	}
+	if settings.ExcludeSegmentID != 0 && settings.ExcludeSegmentID == settings.SegmentID {
+		return errors.New("ExcludeSegmentID: can't be the enrolled segment")
+	}
+	return nil
+}
+
+func isCustomAttribute(attribute string) bool {
+	name, ok := strings.CutPrefix(attribute, api.AttributePrefix)
+	return ok && strings.TrimSpace(name) != ""
+}
+
+// normalizeTags lowercase, without blanks & duplicates
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
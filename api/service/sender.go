@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+// Email is what the scheduler hands over to a `Sender`, `Headers` come on top of the usual ones
+type Email struct {
+	From        string
+	To          string
+	Subject     string
+	HTML        string
+	Text        string // plain-text alternative, generated from `HTML` when empty
+	Headers     map[string]string
+	Attachments []Attachment
+	SMTP        *SMTPServer // of the sending mailbox, if it has one
+}
+
+// Attachment of an email, inlined (referenced by `cid:<ContentID>` from the HTML) when it has a `ContentID`
+type Attachment struct {
+	Name        string
+	ContentType string
+	ContentID   string
+	Content     []byte
+}
+
+// SMTPServer holds decrypted credentials, it's never stored as is
+type SMTPServer struct {
+	Host     string
+	Port     uint
+	Username string
+	Password string
+}
+
+// Sender delivers rendered emails (e.g. via SMTP or an email provider API)
+type Sender interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// LogSender only logs the emails, used until a real sender is configured
+type LogSender struct{}
+
+func (LogSender) Send(_ context.Context, email Email) error {
+	log.Printf("email to %s: %q (Message-ID %s)", email.To, email.Subject, email.Headers["Message-ID"])
+	return nil
+}
+
+// SMTPSender delivers every email through the SMTP server of its mailbox (STARTTLS is used when offered)
+type SMTPSender struct{}
+
+func (SMTPSender) Send(_ context.Context, email Email) error {
+	if email.SMTP == nil {
+		return fmt.Errorf("no SMTP server configured for %s", email.From)
+	}
+
+	var auth smtp.Auth
+	if email.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", email.SMTP.Username, email.SMTP.Password, email.SMTP.Host)
+	}
+	addr := net.JoinHostPort(email.SMTP.Host, strconv.Itoa(int(email.SMTP.Port)))
+	return smtp.SendMail(addr, auth, mailboxOf(email.From), []string{email.To}, BuildMessage(email))
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"reflect"
+	"time"
+)
+
+// SequenceDocumentService converts sequences from/to `api.SequenceDocument` (import & export)
+type SequenceDocumentService struct {
+	Db *gorm.DB
+}
+
+// StepChange before & after state of an updated step
+type StepChange struct {
+	Before api.SequenceStep
+	After  api.SequenceStep
+}
+
+// ImportPlan describes what an import would change, it's applied only when not in dry-run mode
+type ImportPlan struct {
+	Action   string
+	Before   api.Sequence // zero value when sequence is created
+	Sequence api.Sequence
+	Create   []api.SequenceStep
+	Update   []StepChange
+	Delete   []api.SequenceStep
+	Changes  []string
+}
+
+func (sds *SequenceDocumentService) Export(sequence *api.Sequence) api.SequenceDocument {
+	steps := make([]api.SequenceDocumentStep, 0, len(sequence.SequenceSteps))
+	for _, step := range sequence.SequenceSteps {
+		documentStep := api.SequenceDocumentStep{
+			Subject:   step.Subject,
+			Content:   step.Content,
+			WaitDays:  step.WaitDays,
+			WaitUntil: step.WaitUntil,
+			URL:       step.URL,
+			Method:    step.Method,
+		}
+		// email steps are the default
+		if step.Type != api.StepTypeEmail {
+			documentStep.Type = step.Type
+		}
+		steps = append(steps, documentStep)
+	}
+
+	return api.SequenceDocument{
+		Version: api.SequenceDocumentVersion,
+		Sequence: api.SequenceDocumentSpec{
+			Name:                 sequence.Name,
+			OpenTrackingEnabled:  sequence.OpenTrackingEnabled,
+			ClickTrackingEnabled: sequence.ClickTrackingEnabled,
+			Steps:                steps,
+		},
+	}
+}
+
+// RunExportJob exports the sequence of a `sequence_export` job, the document is the result
+func (sds *SequenceDocumentService) RunExportJob(ctx context.Context, job *api.Job) (any, error) {
+	var payload api.SequenceExportJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return nil, Permanent(err)
+	}
+	foundSequence := (&SequenceService{Db: sds.Db}).GetWithSteps(uint64(payload.SequenceID))
+	if foundSequence.ID == 0 {
+		return nil, Permanent(fmt.Errorf("sequence %d not found", payload.SequenceID))
+	}
+	return sds.Export(foundSequence), nil
+}
+
+// Validate applies the same rules as the regular create endpoints
+func (sds *SequenceDocumentService) Validate(document *api.SequenceDocument) error {
+	if document.Version != api.SequenceDocumentVersion {
+		return fmt.Errorf("unsupported document version: %d", document.Version)
+	}
+
+	sequence := api.Sequence{Name: document.Sequence.Name}
+	if _, err := govalidator.ValidateStruct(&sequence); err != nil {
+		return err
+	}
+
+	subjects := make(map[string]bool)
+	for i, documentStep := range document.Sequence.Steps {
+		step := newDocumentStep(documentStep)
+		if err := ValidateStep(&step); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		if err := (&AssetService{Db: sds.Db}).ValidateStepAssets(&step); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		document.Sequence.Steps[i].Method = step.Method
+		if subjects[step.Subject] {
+			return fmt.Errorf("step %d: duplicate subject %q", i+1, step.Subject)
+		}
+		subjects[step.Subject] = true
+	}
+
+	return nil
+}
+
+// Plan matches the document against the existing sequence (by name) & its steps (by subject)
+func (sds *SequenceDocumentService) Plan(document *api.SequenceDocument) *ImportPlan {
+	spec := document.Sequence
+	plan := &ImportPlan{Action: api.ImportActionCreate}
+
+	var existing api.Sequence
+	sds.Db.Preload("SequenceSteps").Where("name = ?", spec.Name).Find(&existing)
+	if existing.ID > 0 {
+		plan.Action = api.ImportActionUpdate
+		plan.Before = existing
+		plan.Before.SequenceSteps = nil
+	} else {
+		plan.Changes = append(plan.Changes, fmt.Sprintf("create sequence %q", spec.Name))
+	}
+
+	plan.Sequence = existing
+	plan.Sequence.SequenceSteps = nil
+	plan.Sequence.Name = spec.Name
+	if plan.Sequence.OpenTrackingEnabled != spec.OpenTrackingEnabled {
+		plan.Sequence.OpenTrackingEnabled = spec.OpenTrackingEnabled
+		plan.addSequenceChange("OpenTrackingEnabled", spec.OpenTrackingEnabled)
+	}
+	if plan.Sequence.ClickTrackingEnabled != spec.ClickTrackingEnabled {
+		plan.Sequence.ClickTrackingEnabled = spec.ClickTrackingEnabled
+		plan.addSequenceChange("ClickTrackingEnabled", spec.ClickTrackingEnabled)
+	}
+
+	existingSteps := make(map[string]api.SequenceStep)
+	for _, step := range existing.SequenceSteps {
+		existingSteps[step.Subject] = step
+	}
+
+	for i, documentStep := range spec.Steps {
+		position := uint(i + 1)
+		step, found := existingSteps[documentStep.Subject]
+		if !found {
+			step := newDocumentStep(documentStep)
+			step.SequenceID = existing.ID
+			step.Position = position
+			plan.Create = append(plan.Create, step)
+			plan.Changes = append(plan.Changes, fmt.Sprintf("create step %q", documentStep.Subject))
+			continue
+		}
+		delete(existingSteps, documentStep.Subject)
+
+		updated := step
+		fromDocument := newDocumentStep(documentStep)
+		updated.Type = fromDocument.Type
+		updated.Content = documentStep.Content
+		updated.Position = position
+		updated.WaitDays = documentStep.WaitDays
+		updated.URL = documentStep.URL
+		updated.Method = documentStep.Method
+		if !sameTime(step.WaitUntil, documentStep.WaitUntil) {
+			updated.WaitUntil = documentStep.WaitUntil
+		}
+		// attachments aren't part of documents, the step keeps them
+		if !reflect.DeepEqual(updated, step) {
+			plan.Update = append(plan.Update, StepChange{Before: step, After: updated})
+			plan.Changes = append(plan.Changes, fmt.Sprintf("update step %q", step.Subject))
+		}
+	}
+
+	// whatever is left isn't part of the document anymore
+	for _, step := range existing.SequenceSteps {
+		if _, stale := existingSteps[step.Subject]; stale {
+			plan.Delete = append(plan.Delete, step)
+			plan.Changes = append(plan.Changes, fmt.Sprintf("delete step %q", step.Subject))
+		}
+	}
+
+	if plan.Action == api.ImportActionUpdate && len(plan.Changes) == 0 {
+		plan.Action = api.ImportActionUnchanged
+	}
+
+	return plan
+}
+
+// newDocumentStep steps without type are emails
+func newDocumentStep(documentStep api.SequenceDocumentStep) api.SequenceStep {
+	step := api.SequenceStep{
+		Type:      documentStep.Type,
+		Subject:   documentStep.Subject,
+		Content:   documentStep.Content,
+		WaitDays:  documentStep.WaitDays,
+		WaitUntil: documentStep.WaitUntil,
+		URL:       documentStep.URL,
+		Method:    documentStep.Method,
+	}
+	if step.Type == "" {
+		step.Type = api.StepTypeEmail
+	}
+	return step
+}
+
+func sameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (plan *ImportPlan) addSequenceChange(field string, value bool) {
+	if plan.Action == api.ImportActionUpdate {
+		plan.Changes = append(plan.Changes, fmt.Sprintf("set %s to %t", field, value))
+	}
+}
+
+// Apply writes the plan in a single transaction, created records get their IDs assigned in place
+func (sds *SequenceDocumentService) Apply(plan *ImportPlan) error {
+	if plan.Action == api.ImportActionUnchanged {
+		return nil
+	}
+
+	return sds.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("SequenceSteps").Save(&plan.Sequence).Error; err != nil {
+			return err
+		}
+
+		for _, step := range plan.Delete {
+			if err := tx.Delete(&step).Error; err != nil {
+				return err
+			}
+		}
+		for i := range plan.Update {
+			if err := tx.Save(&plan.Update[i].After).Error; err != nil {
+				return err
+			}
+		}
+		for i := range plan.Create {
+			plan.Create[i].SequenceID = plan.Sequence.ID
+			if err := tx.Create(&plan.Create[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// AuditRecords lists the records of an applied plan, `template` carries actor & request ID
+func (plan *ImportPlan) AuditRecords(template api.AuditRecord) []api.AuditRecord {
+	var records []api.AuditRecord
+	add := func(action string, entity string, entityID uint, before any, after any) {
+		record := template
+		record.Action = action
+		record.Entity = entity
+		record.EntityID = entityID
+		record.Before = api.ToJSON(before)
+		record.After = api.ToJSON(after)
+		records = append(records, record)
+	}
+
+	switch plan.Action {
+	case api.ImportActionCreate:
+		add(api.AuditActionCreate, api.AuditEntitySequence, plan.Sequence.ID, nil, &plan.Sequence)
+	case api.ImportActionUpdate:
+		if plan.Before.OpenTrackingEnabled != plan.Sequence.OpenTrackingEnabled ||
+			plan.Before.ClickTrackingEnabled != plan.Sequence.ClickTrackingEnabled {
+			add(api.AuditActionUpdate, api.AuditEntitySequence, plan.Sequence.ID, &plan.Before, &plan.Sequence)
+		}
+	}
+
+	for _, step := range plan.Delete {
+		add(api.AuditActionDelete, api.AuditEntitySequenceStep, step.ID, &step, nil)
+	}
+	for _, change := range plan.Update {
+		add(api.AuditActionUpdate, api.AuditEntitySequenceStep, change.After.ID, &change.Before, &change.After)
+	}
+	for _, step := range plan.Create {
+		add(api.AuditActionCreate, api.AuditEntitySequenceStep, step.ID, nil, &step)
+	}
+
+	return records
+}
@@ -1,9 +1,10 @@
 package service
 
 import (
+	"errors"
 	"github.com/sitetester/sequence-api/api"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
+	"time"
 )
 
 type SequenceService struct {
@@ -31,7 +32,9 @@ func (ss *SequenceService) GetOtherSequenceWithSameName(name string, id uint) *a
 
 func (ss *SequenceService) GetWithSteps(id uint64) *api.Sequence {
 	var foundSequence api.Sequence
-	ss.Db.Preload(clause.Associations).Where("id = ?", id).Find(&foundSequence)
+	ss.Db.Preload("SequenceSteps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	}).Where("id = ?", id).Find(&foundSequence)
 	return &foundSequence
 }
 
@@ -43,6 +46,124 @@ func (ss *SequenceService) Update(foundSequence *api.Sequence, sequence api.Sequ
 	ss.Db.Omit("SequenceStep").Save(&foundSequence)
 }
 
+func (ss *SequenceService) UpdateAutoEnrollment(sequence *api.Sequence, settings api.AutoEnrollment) {
+	sequence.AutoEnrollment = settings
+	ss.Db.Model(sequence).Updates(map[string]any{
+		"auto_enroll_segment_id":               settings.SegmentID,
+		"auto_enroll_exclude_segment_id":       settings.ExcludeSegmentID,
+		"auto_enroll_exclude_active_elsewhere": settings.ExcludeActiveElsewhere,
+		"auto_enroll_reenrollment":             settings.Reenrollment,
+		"auto_enroll_reenroll_after_days":      settings.ReenrollAfterDays,
+	})
+}
+
+// ValidateInitialStatus sequences start as drafts or active (when empty)
+func ValidateInitialStatus(sequence *api.Sequence) error {
+	if sequence.Status == "" {
+		sequence.Status = api.SequenceActive
+	}
+	if sequence.Status != api.SequenceDraft && sequence.Status != api.SequenceActive {
+		return errors.New("Status: must be one of draft, active")
+	}
+	return nil
+}
+
+// Create auto-enrollment starts disabled, it needs the segment checks of `PUT /sequences/:id/auto-enrollment`
 func (sss *SequenceService) Create(sequence *api.Sequence) {
+	sequence.AutoEnrollment = api.AutoEnrollment{}
+	sequence.PausedAt = nil
 	sss.Db.Omit("SequenceStep").Create(&sequence)
 }
+
+// Transition moves the sequence to `to` when it's in one of the `from` statuses, returns false otherwise
+// `PausedAt` is set while paused
+func (ss *SequenceService) Transition(sequence *api.Sequence, from []string, to string, now time.Time) bool {
+	var pausedAt *time.Time
+	if to == api.SequencePaused {
+		pausedAt = &now
+	}
+	result := ss.Db.Model(&api.Sequence{}).
+		Where("id = ? AND status IN ?", sequence.ID, from).
+		Updates(map[string]any{"status": to, "paused_at": pausedAt})
+	if result.RowsAffected == 0 {
+		return false
+	}
+	*sequence = *ss.GetByID(sequence.ID)
+	return true
+}
+
+func (ss *SequenceService) List() []api.Sequence {
+	sequences := []api.Sequence{}
+	ss.Db.Order("id").Find(&sequences)
+	return sequences
+}
+
+// Delete removes the sequence along with its steps (& their variants), edges & mailbox assignments
+func (ss *SequenceService) Delete(sequence *api.Sequence) error {
+	return ss.Db.Transaction(func(tx *gorm.DB) error {
+		// bulk deletes skip the `AfterDelete` hook of the steps
+		stepIDs := tx.Model(&api.SequenceStep{}).Select("id").Where("sequence_id = ?", sequence.ID)
+		if err := tx.Where("step_id IN (?)", stepIDs).Delete(&api.StepVariant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sequence_id = ?", sequence.ID).Delete(&api.SequenceStep{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sequence_id = ?", sequence.ID).Delete(&api.StepEdge{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sequence_id = ?", sequence.ID).Delete(&api.SequenceMailbox{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&sequence).Error
+	})
+}
+
+// GetByIDs loads all given sequences with a single query, keyed by ID (unknown IDs are missing)
+func (ss *SequenceService) GetByIDs(ids []uint) map[uint]api.Sequence {
+	var sequences []api.Sequence
+	ss.Db.Where("id IN ?", ids).Find(&sequences)
+
+	byID := make(map[uint]api.Sequence, len(sequences))
+	for _, sequence := range sequences {
+		byID[sequence.ID] = sequence
+	}
+	return byID
+}
+
+// GetStats aggregates stats of all given sequences with a query per source table (steps & bounces), keyed by sequence ID
+func (ss *SequenceService) GetStats(ids []uint) map[uint]api.SequenceStats {
+	var rows []api.SequenceStats
+	ss.Db.Model(&api.SequenceStep{}).
+		Select("sequence_id, COUNT(*) AS step_count, COALESCE(SUM(wait_days), 0) AS total_wait_days").
+		Where("sequence_id IN ?", ids).
+		Group("sequence_id").
+		Scan(&rows)
+
+	var bounceRows []api.SequenceStats
+	ss.Db.Model(&api.BounceEvent{}).
+		Select("sequence_id, "+
+			"SUM(CASE WHEN type = ? AND classification = ? THEN 1 ELSE 0 END) AS hard_bounces, "+
+			"SUM(CASE WHEN type = ? AND classification = ? THEN 1 ELSE 0 END) AS soft_bounces, "+
+			"SUM(CASE WHEN type = ? THEN 1 ELSE 0 END) AS complaints",
+			api.BounceTypeBounce, api.BounceHard, api.BounceTypeBounce, api.BounceSoft, api.BounceTypeComplaint).
+		Where("sequence_id IN ?", ids).
+		Group("sequence_id").
+		Scan(&bounceRows)
+
+	stats := make(map[uint]api.SequenceStats, len(ids))
+	for _, id := range ids {
+		stats[id] = api.SequenceStats{SequenceID: id}
+	}
+	for _, row := range rows {
+		stats[row.SequenceID] = row
+	}
+	for _, row := range bounceRows {
+		sequenceStats := stats[row.SequenceID]
+		sequenceStats.HardBounces = row.HardBounces
+		sequenceStats.SoftBounces = row.SoftBounces
+		sequenceStats.Complaints = row.Complaints
+		stats[row.SequenceID] = sequenceStats
+	}
+	return stats
+}
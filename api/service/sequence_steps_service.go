@@ -1,8 +1,14 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
 	"github.com/sitetester/sequence-api/api"
 	"gorm.io/gorm"
+	"net/http"
+	"strings"
 )
 
 type SequenceStepsService struct {
@@ -21,9 +27,82 @@ func (sss *SequenceStepsService) SubjectAvailablePerSequence(subject string, seq
 	return result.RowsAffected == 0
 }
 
+// httpCallMethods allowed for `http_call` steps
+var httpCallMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// ValidateStep checks the fields of the step's type, `Type` defaults to email & `Method` of HTTP calls to POST
+// Fields of other types must be empty
+func ValidateStep(step *api.SequenceStep) error {
+	if _, err := govalidator.ValidateStruct(step); err != nil {
+		return err
+	}
+	if step.Type == "" {
+		step.Type = api.StepTypeEmail
+	}
+	// every type is named by its subject
+	if err := minLength("Subject", step.Subject, 3); err != nil {
+		return err
+	}
+
+	if step.Type != api.StepTypeWaitUntil && step.WaitUntil != nil {
+		return fmt.Errorf("WaitUntil: only allowed for %s steps", api.StepTypeWaitUntil)
+	}
+	if step.Type != api.StepTypeHTTPCall && (step.URL != "" || step.Method != "") {
+		return fmt.Errorf("URL: only allowed for %s steps", api.StepTypeHTTPCall)
+	}
+
+	switch step.Type {
+	case api.StepTypeEmail:
+		if err := minLength("Content", step.Content, 3); err != nil {
+			return err
+		}
+		return lintErrors(step.Subject, step.Content)
+	case api.StepTypeWaitUntil:
+		if step.WaitUntil == nil {
+			return errors.New("WaitUntil: non zero value required")
+		}
+		if step.Content != "" {
+			return fmt.Errorf("Content: not allowed for %s steps", api.StepTypeWaitUntil)
+		}
+	case api.StepTypeHTTPCall:
+		if !govalidator.IsRequestURL(step.URL) || !(strings.HasPrefix(step.URL, "http://") || strings.HasPrefix(step.URL, "https://")) {
+			return fmt.Errorf("URL: %q is not an http(s) URL", step.URL)
+		}
+		step.Method = strings.ToUpper(step.Method)
+		if step.Method == "" {
+			step.Method = http.MethodPost
+		}
+		if !govalidator.IsIn(step.Method, httpCallMethods...) {
+			return fmt.Errorf("Method: must be one of %s", strings.Join(httpCallMethods, ", "))
+		}
+		if step.Content != "" && !json.Valid([]byte(step.Content)) {
+			return errors.New("Content: must be JSON for http_call steps")
+		}
+	}
+	return nil
+}
+
+// minLength mirrors the errors of `valid:"required,minstringlength(n)"`
+func minLength(field string, value string, n int) error {
+	if value == "" {
+		return fmt.Errorf("%s: non zero value required", field)
+	}
+	if len([]rune(value)) < n {
+		return fmt.Errorf("%s: %s does not validate as minstringlength(%d)", field, value, n)
+	}
+	return nil
+}
+
 func (sss *SequenceStepsService) Update(foundSequenceStep *api.SequenceStep, sequenceStep api.SequenceStep) {
+	foundSequenceStep.Type = sequenceStep.Type
 	foundSequenceStep.Subject = sequenceStep.Subject
 	foundSequenceStep.Content = sequenceStep.Content
+	foundSequenceStep.WaitUntil = sequenceStep.WaitUntil
+	foundSequenceStep.URL = sequenceStep.URL
+	foundSequenceStep.Method = sequenceStep.Method
+	foundSequenceStep.Position = sequenceStep.Position
+	foundSequenceStep.WaitDays = sequenceStep.WaitDays
+	foundSequenceStep.Attachments = sequenceStep.Attachments
 	sss.Db.Save(&foundSequenceStep)
 }
 
@@ -34,3 +113,63 @@ func (sss *SequenceStepsService) Create(sequenceStep *api.SequenceStep) {
 func (sss *SequenceStepsService) Delete(sequenceStep *api.SequenceStep) {
 	sss.Db.Delete(&sequenceStep)
 }
+
+// StepsDeletable steps of active sequences are only deleted with `force`: enrollments in flight would skip a step
+// (or get one twice) as the remaining steps move up
+func StepsDeletable(sequence *api.Sequence, force bool) bool {
+	return force || sequence.Status != api.SequenceActive
+}
+
+func (sss *SequenceStepsService) GetBySequenceID(sequenceID uint) []api.SequenceStep {
+	steps := []api.SequenceStep{}
+	sss.Db.Where("sequence_id = ?", sequenceID).Order("position, id").Find(&steps)
+	return steps
+}
+
+// ApplyBatch writes the validated `steps` of the operations (the step to delete for deletes), run it in a
+// transaction (see `Operations.ApplyBatch`). Returns the applied steps, in the order of the operations
+func (sss *SequenceStepsService) ApplyBatch(operations []api.BatchStepOperation, steps []api.SequenceStep) ([]api.SequenceStep, error) {
+	applied := make([]api.SequenceStep, len(operations))
+
+	// deletes first, so their subjects can be reused by the creates/updates of the same batch
+	for i, operation := range operations {
+		if operation.Op != api.BatchOpDelete {
+			continue
+		}
+		step := steps[i]
+		if err := sss.Db.Delete(&step).Error; err != nil {
+			return nil, err
+		}
+		applied[i] = step
+	}
+
+	for i, operation := range operations {
+		step := steps[i]
+		switch operation.Op {
+		case api.BatchOpCreate:
+			if err := sss.Db.Create(&step).Error; err != nil {
+				return nil, err
+			}
+		case api.BatchOpUpdate:
+			if err := sss.Db.Save(&step).Error; err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		applied[i] = step
+	}
+	return applied, nil
+}
+
+// GetBySequenceIDs loads steps of all given sequences with a single query, keyed by sequence ID
+func (sss *SequenceStepsService) GetBySequenceIDs(sequenceIDs []uint) map[uint][]api.SequenceStep {
+	var steps []api.SequenceStep
+	sss.Db.Where("sequence_id IN ?", sequenceIDs).Order("position, id").Find(&steps)
+
+	bySequenceID := make(map[uint][]api.SequenceStep, len(sequenceIDs))
+	for _, step := range steps {
+		bySequenceID[step.SequenceID] = append(bySequenceID[step.SequenceID], step)
+	}
+	return bySequenceID
+}
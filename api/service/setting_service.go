@@ -0,0 +1,20 @@
+package service
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SettingService struct {
+	Db *gorm.DB
+}
+
+// Secret returns the secret stored under `key`, generating it on first use
+// Concurrent first uses agree on the secret which got inserted first
+func (ss *SettingService) Secret(key string) string {
+	setting := api.Setting{Key: key, Value: randomHex(32)}
+	ss.Db.Clauses(clause.OnConflict{DoNothing: true}).Create(&setting)
+	ss.Db.Where("key = ?", key).First(&setting)
+	return setting.Value
+}
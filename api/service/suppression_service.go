@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SuppressionService the suppression list of a workspace is checked by the scheduler before every send
+type SuppressionService struct {
+	Db *gorm.DB
+}
+
+// List `reason` is ignored when empty
+func (ss *SuppressionService) List(workspace string, reason string) []api.Suppression {
+	query := ss.Db.Where("workspace = ?", workspace).Order("id")
+	if reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+
+	suppressions := []api.Suppression{}
+	query.Find(&suppressions)
+	return suppressions
+}
+
+func (ss *SuppressionService) GetByID(workspace string, id uint) *api.Suppression {
+	var foundSuppression api.Suppression
+	ss.Db.Where("workspace = ? AND id = ?", workspace, id).First(&foundSuppression)
+	return &foundSuppression
+}
+
+func (ss *SuppressionService) IsSuppressed(workspace string, email string) bool {
+	result := ss.Db.Where("workspace = ? AND email = ?", workspace, strings.ToLower(email)).Find(&api.Suppression{})
+	return result.RowsAffected > 0
+}
+
+// Add returns false (without changing anything) when the email is already on the list
+func (ss *SuppressionService) Add(workspace string, suppression *api.Suppression) bool {
+	suppression.Workspace = workspace
+	suppression.Email = strings.ToLower(suppression.Email)
+	if ss.IsSuppressed(workspace, suppression.Email) {
+		return false
+	}
+	ss.Db.Create(&suppression)
+	return true
+}
+
+func (ss *SuppressionService) Delete(suppression *api.Suppression) {
+	ss.Db.Delete(&suppression)
+}
+
+// ValidateSuppression `Reason` defaults to manual
+func ValidateSuppression(suppression *api.Suppression) error {
+	if suppression.Reason == "" {
+		suppression.Reason = api.SuppressionManual
+	}
+	if _, err := govalidator.ValidateStruct(suppression); err != nil {
+		return err
+	}
+	if !slices.Contains(api.SuppressionReasons, suppression.Reason) {
+		return fmt.Errorf("Reason: must be one of %v", api.SuppressionReasons)
+	}
+	return nil
+}
+
+var suppressionCSVHeader = []string{"email", "reason", "created_at"}
+
+// ImportCSV reads `email[,reason]` lines (an `email` header line is skipped), returns the added suppressions
+// Invalid lines are reported in the result, the valid ones are imported anyway
+func (ss *SuppressionService) ImportCSV(workspace string, reader io.Reader) (*api.SuppressionImportResult, []api.Suppression, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	result := &api.SuppressionImportResult{}
+	var added []api.Suppression
+	for line := 1; ; line++ {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if line == 1 && strings.EqualFold(record[0], suppressionCSVHeader[0]) {
+			continue
+		}
+
+		suppression := api.Suppression{Email: strings.TrimSpace(record[0])}
+		if len(record) > 1 {
+			suppression.Reason = strings.TrimSpace(record[1])
+		}
+		if err := ValidateSuppression(&suppression); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+
+		if !ss.Add(workspace, &suppression) {
+			result.Skipped++
+			continue
+		}
+		result.Imported++
+		added = append(added, suppression)
+	}
+	return result, added, nil
+}
+
+// ExportCSV writes the whole list of the workspace, with a header line
+func (ss *SuppressionService) ExportCSV(workspace string, writer io.Writer) error {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(suppressionCSVHeader); err != nil {
+		return err
+	}
+	for _, suppression := range ss.List(workspace, "") {
+		record := []string{suppression.Email, suppression.Reason, suppression.CreatedAt.UTC().Format(time.RFC3339)}
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
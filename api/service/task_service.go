@@ -0,0 +1,74 @@
+package service
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"time"
+)
+
+// TaskService manages the tasks of `manual_task` steps, enrollments wait for them to be resolved
+type TaskService struct {
+	Db *gorm.DB
+}
+
+// List tasks of the workspace with `status`, oldest first
+func (ts *TaskService) List(workspace string, status string) []api.Task {
+	tasks := []api.Task{}
+	ts.Db.Where("workspace = ? AND status = ?", workspace, status).Order("id").Find(&tasks)
+	return tasks
+}
+
+func (ts *TaskService) GetByID(workspace string, id uint) *api.Task {
+	var foundTask api.Task
+	ts.Db.Where("workspace = ? AND id = ?", workspace, id).First(&foundTask)
+	return &foundTask
+}
+
+// Open creates the task of `step` for the enrollment, which stops being scheduled until the task is resolved
+func (ts *TaskService) Open(enrollment *api.Enrollment, contact *api.Contact, step *api.SequenceStep) (*api.Task, error) {
+	task := api.Task{
+		Workspace:    contact.Workspace,
+		EnrollmentID: enrollment.ID,
+		SequenceID:   enrollment.SequenceID,
+		StepID:       step.ID,
+		ContactID:    contact.ID,
+		Title:        step.Subject,
+		Instructions: step.Content,
+		Status:       api.TaskOpen,
+	}
+	err := ts.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&task).Error; err != nil {
+			return err
+		}
+		enrollment.NextSendAt = nil
+		if err := tx.Save(enrollment).Error; err != nil {
+			return err
+		}
+		return (&WebhookService{Db: tx}).Publish(task.Workspace, api.WebhookEventTaskCreated, task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// Resolve completes or skips the open task, its enrollment (if still waiting for it) moves on to the next step
+// (a paused enrollment stays paused, its next step is held until resumed)
+func (ts *TaskService) Resolve(task *api.Task, status string, now time.Time) {
+	task.Status = status
+	task.ResolvedAt = &now
+	ts.Db.Save(task)
+
+	enrollmentService := EnrollmentService{Db: ts.Db}
+	enrollment := enrollmentService.GetByID(task.EnrollmentID)
+	if (enrollment.Status == api.EnrollmentActive || enrollment.Status == api.EnrollmentPaused) && enrollment.NextSendAt == nil {
+		enrollmentService.Advance(enrollment, task.StepID, now)
+	}
+}
+
+// SkipOpen skips the open tasks of a stopped enrollment
+func (ts *TaskService) SkipOpen(enrollmentID uint, now time.Time) {
+	ts.Db.Model(&api.Task{}).
+		Where("enrollment_id = ? AND status = ?", enrollmentID, api.TaskOpen).
+		Updates(map[string]any{"status": api.TaskSkipped, "resolved_at": now})
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// UnsubscribeVariable is replaced by the unsubscribe link, the unsubscribe footer is left out then
+const UnsubscribeVariable = "unsubscribe_url"
+
+// TemplateVariables `{{name}}` in subjects & contents is replaced by the contact's value when sent,
+// custom attributes are `{{attributes.<name>}}`
+var TemplateVariables = []string{"email", "first_name", "last_name", "time_zone", UnsubscribeVariable}
+
+var (
+	variablePattern      = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+	attributeNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// isTemplateVariable `name` is lowercased already
+func isTemplateVariable(name string) bool {
+	if govalidator.IsIn(name, TemplateVariables...) {
+		return true
+	}
+	attribute, ok := strings.CutPrefix(name, api.AttributePrefix)
+	return ok && attributeNamePattern.MatchString(attribute)
+}
+
+// renderVariables replaces the variables of the contact, `escape` (when set) is applied to the values
+// Unknown variables & `{{unsubscribe_url}}` are left as is
+func renderVariables(text string, contact *api.Contact, escape func(string) string) string {
+	return variablePattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := strings.ToLower(variablePattern.FindStringSubmatch(match)[1])
+		if name == UnsubscribeVariable || !isTemplateVariable(name) {
+			return match
+		}
+		value := attributeOf(contact, name)
+		if escape != nil {
+			value = escape(value)
+		}
+		return value
+	})
+}
+
+// renderUnsubscribe replaces `{{unsubscribe_url}}`, returns false when there is none
+func renderUnsubscribe(content string, unsubscribeURL string) (string, bool) {
+	replaced := false
+	content = variablePattern.ReplaceAllStringFunc(content, func(match string) string {
+		if strings.ToLower(variablePattern.FindStringSubmatch(match)[1]) != UnsubscribeVariable {
+			return match
+		}
+		replaced = true
+		return unsubscribeURL
+	})
+	return content, replaced
+}
+
+// PreviewStep renders the email step for `contact` (the unsubscribe link stays a placeholder),
+// variables the contact has no value for are lint warnings
+func PreviewStep(step *api.SequenceStep, contact *api.Contact) api.StepPreview {
+	report := LintContent(step.Subject, step.Content)
+	for _, field := range []struct{ name, text string }{{"Subject", step.Subject}, {"Content", step.Content}} {
+		for _, match := range variablePattern.FindAllStringSubmatch(field.text, -1) {
+			name := strings.ToLower(match[1])
+			if name != UnsubscribeVariable && isTemplateVariable(name) && attributeOf(contact, name) == "" {
+				report.Issues = append(report.Issues, api.LintIssue{Severity: api.LintWarning, Rule: api.LintRuleVariable,
+					Message: fmt.Sprintf("%s: %s is empty for the contact", field.name, match[0])})
+			}
+		}
+	}
+	return api.StepPreview{
+		Subject: renderVariables(step.Subject, contact, nil),
+		Content: renderVariables(step.Content, contact, html.EscapeString),
+		Lint:    *report,
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"math"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// ThrottleService keeps sends within the configured throttles, buckets are kept in the DB
+// so that every scheduler (process) draws from the same tokens
+type ThrottleService struct {
+	Db *gorm.DB
+}
+
+// takeAttempts concurrent updates of the same bucket make a take start over, up to this many times
+const takeAttempts = 5
+
+var errBucketConflict = errors.New("rate bucket changed concurrently")
+
+func (ts *ThrottleService) List() []api.Throttle {
+	throttles := []api.Throttle{}
+	ts.Db.Order("id").Find(&throttles)
+	return throttles
+}
+
+func (ts *ThrottleService) GetByID(id uint) *api.Throttle {
+	var foundThrottle api.Throttle
+	ts.Db.Where("id = ?", id).First(&foundThrottle)
+	return &foundThrottle
+}
+
+func (ts *ThrottleService) Create(throttle *api.Throttle) {
+	ts.Db.Create(throttle)
+}
+
+// Delete removes the buckets of the throttle too
+func (ts *ThrottleService) Delete(throttle *api.Throttle) {
+	ts.Db.Transaction(func(tx *gorm.DB) error {
+		tx.Where("throttle_id = ?", throttle.ID).Delete(&api.RateBucket{})
+		return tx.Delete(throttle).Error
+	})
+}
+
+// ValidateThrottle lowercases `Key`
+func ValidateThrottle(throttle *api.Throttle) error {
+	if _, err := govalidator.ValidateStruct(throttle); err != nil {
+		return err
+	}
+
+	throttle.Key = strings.ToLower(strings.TrimSpace(throttle.Key))
+	if throttle.Scope == api.ThrottleScopeGlobal && throttle.Key != "" {
+		return errors.New("Key: must be empty for global throttles")
+	}
+	if throttle.Scope == api.ThrottleScopeMailbox && throttle.Key != "" && !govalidator.IsEmail(throttle.Key) {
+		return fmt.Errorf("Key: %q is not an email address", throttle.Key)
+	}
+	return nil
+}
+
+// Take consumes a token of every throttle matching the mailbox & recipient domain, either all or none of them
+// When a bucket is empty, `retryAt` is the earliest time all of them have a token again
+func (ts *ThrottleService) Take(mailbox string, domain string, now time.Time) (ok bool, retryAt time.Time, err error) {
+	mailbox, domain = strings.ToLower(mailbox), strings.ToLower(domain)
+	throttles := ts.matching(mailbox, domain)
+	if len(throttles) == 0 {
+		return true, now, nil
+	}
+
+	for attempt := 0; attempt < takeAttempts; attempt++ {
+		err = ts.Db.Transaction(func(tx *gorm.DB) error {
+			ok, retryAt, err = take(tx, throttles, mailbox, domain, now)
+			return err
+		})
+		if !errors.Is(err, errBucketConflict) {
+			return ok, retryAt, err
+		}
+	}
+	return false, now, err
+}
+
+// Release gives back the tokens of a `Take` whose send failed, buckets don't exceed their limit
+func (ts *ThrottleService) Release(mailbox string, domain string, now time.Time) (err error) {
+	mailbox, domain = strings.ToLower(mailbox), strings.ToLower(domain)
+	throttles := ts.matching(mailbox, domain)
+
+	for attempt := 0; attempt < takeAttempts; attempt++ {
+		err = ts.Db.Transaction(func(tx *gorm.DB) error {
+			for _, throttle := range throttles {
+				bucket := loadBucket(tx, throttle, bucketKey(throttle, mailbox, domain), now)
+				if bucket.ID == 0 {
+					continue // full anyway
+				}
+				bucket.Tokens = math.Min(float64(throttle.Limit), bucket.Tokens+1)
+				if err := saveBucket(tx, &bucket); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if !errors.Is(err, errBucketConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// matching throttles of the mailbox & recipient domain
+func (ts *ThrottleService) matching(mailbox string, domain string) []api.Throttle {
+	var throttles []api.Throttle
+	ts.Db.Where("scope = ?", api.ThrottleScopeGlobal).
+		Or("scope = ? AND key IN ?", api.ThrottleScopeMailbox, []string{"", mailbox}).
+		Or("scope = ? AND key IN ?", api.ThrottleScopeDomain, []string{"", domain}).
+		Find(&throttles)
+	return throttles
+}
+
+func take(tx *gorm.DB, throttles []api.Throttle, mailbox string, domain string, now time.Time) (bool, time.Time, error) {
+	buckets := make([]api.RateBucket, len(throttles))
+	retryAt := now
+	for i, throttle := range throttles {
+		buckets[i] = loadBucket(tx, throttle, bucketKey(throttle, mailbox, domain), now)
+		if buckets[i].Tokens < 1 {
+			wait := time.Duration((1 - buckets[i].Tokens) / refillRate(throttle) * float64(time.Second))
+			if at := now.Add(wait); at.After(retryAt) {
+				retryAt = at
+			}
+		}
+	}
+	if retryAt.After(now) {
+		return false, retryAt, nil
+	}
+
+	for i := range buckets {
+		bucket := &buckets[i]
+		bucket.Tokens--
+		if bucket.ID == 0 {
+			// a concurrent take may have created it meanwhile (unique index)
+			if err := tx.Create(bucket).Error; err != nil {
+				return false, now, errBucketConflict
+			}
+			continue
+		}
+		if err := saveBucket(tx, bucket); err != nil {
+			return false, now, err
+		}
+	}
+	return true, now, nil
+}
+
+// saveBucket `errBucketConflict` when the bucket was updated concurrently since it was loaded
+func saveBucket(tx *gorm.DB, bucket *api.RateBucket) error {
+	result := tx.Model(&api.RateBucket{}).
+		Where("id = ? AND version = ?", bucket.ID, bucket.Version).
+		Updates(map[string]any{"tokens": bucket.Tokens, "refilled_at": bucket.RefilledAt, "version": bucket.Version + 1})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errBucketConflict
+	}
+	return nil
+}
+
+// Usage lists the buckets refilled up to `now`, buckets not used yet are only listed for keyed & global throttles
+func (ts *ThrottleService) Usage(now time.Time) []api.ThrottleUsage {
+	usage := []api.ThrottleUsage{}
+	for _, throttle := range ts.List() {
+		var buckets []api.RateBucket
+		ts.Db.Where("throttle_id = ?", throttle.ID).Order("key").Find(&buckets)
+		if len(buckets) == 0 && (throttle.Key != "" || throttle.Scope == api.ThrottleScopeGlobal) {
+			buckets = append(buckets, api.RateBucket{Key: throttle.Key, Tokens: float64(throttle.Limit), RefilledAt: now})
+		}
+
+		for _, bucket := range buckets {
+			refill(&bucket, throttle, now)
+			remaining := uint(math.Floor(bucket.Tokens))
+			usage = append(usage, api.ThrottleUsage{
+				ThrottleID: throttle.ID,
+				Scope:      throttle.Scope,
+				Key:        bucket.Key,
+				Period:     throttle.Period,
+				Limit:      throttle.Limit,
+				Used:       throttle.Limit - remaining,
+				Remaining:  remaining,
+				FullAt:     now.Add(time.Duration((float64(throttle.Limit) - bucket.Tokens) / refillRate(throttle) * float64(time.Second))),
+			})
+		}
+	}
+	return usage
+}
+
+// loadBucket returns a full (unsaved) bucket when there is none yet
+func loadBucket(tx *gorm.DB, throttle api.Throttle, key string, now time.Time) api.RateBucket {
+	bucket := api.RateBucket{ThrottleID: throttle.ID, Key: key, Tokens: float64(throttle.Limit), RefilledAt: now}
+	tx.Where("throttle_id = ? AND key = ?", throttle.ID, key).Find(&bucket)
+	refill(&bucket, throttle, now)
+	return bucket
+}
+
+// refill adds the tokens accrued since the last refill, up to the limit
+func refill(bucket *api.RateBucket, throttle api.Throttle, now time.Time) {
+	if elapsed := now.Sub(bucket.RefilledAt); elapsed > 0 {
+		bucket.Tokens = math.Min(float64(throttle.Limit), bucket.Tokens+elapsed.Seconds()*refillRate(throttle))
+		bucket.RefilledAt = now
+	}
+}
+
+// refillRate tokens per second
+func refillRate(throttle api.Throttle) float64 {
+	period := time.Hour
+	if throttle.Period == api.ThrottlePeriodDay {
+		period = 24 * time.Hour
+	}
+	return float64(throttle.Limit) / period.Seconds()
+}
+
+// bucketKey throttles without key have a bucket per mailbox/domain
+func bucketKey(throttle api.Throttle, mailbox string, domain string) string {
+	if throttle.Key != "" || throttle.Scope == api.ThrottleScopeGlobal {
+		return throttle.Key
+	}
+	if throttle.Scope == api.ThrottleScopeMailbox {
+		return mailbox
+	}
+	return domain
+}
+
+// mailboxOf the bare address of a `From` value like `Jane <jane@example.com>`
+func mailboxOf(from string) string {
+	if address, err := mail.ParseAddress(from); err == nil {
+		return strings.ToLower(address.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(from))
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"html"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const trackingSecretKey = "tracking_secret"
+
+// TrackingPixel is a transparent 1x1 GIF
+var TrackingPixel = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\x00\x00\x00!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+// hrefPattern absolute links of the content, other schemes (mailto: etc.) aren't tracked
+var hrefPattern = regexp.MustCompile(`href="(https?://[^"]+)"`)
+
+// TrackingService records opens (tracking pixel) & clicks (redirect through the public `/c/:token` endpoint) of sent emails
+// Click tokens sign the target URL, so the endpoint can't be abused as an open redirect
+type TrackingService struct {
+	Db *gorm.DB
+}
+
+// AddTracking appends the pixel & rewrites the links of `content`, depending on the tracking settings of the sequence
+func (ts *TrackingService) AddTracking(content string, sequence *api.Sequence, baseURL string, trackingID string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if sequence.ClickTrackingEnabled {
+		content = hrefPattern.ReplaceAllStringFunc(content, func(match string) string {
+			target := html.UnescapeString(hrefPattern.FindStringSubmatch(match)[1])
+			return `href="` + html.EscapeString(ts.ClickURL(baseURL, trackingID, target)) + `"`
+		})
+	}
+	if sequence.OpenTrackingEnabled {
+		content += "\n" + `<img src="` + html.EscapeString(baseURL+"/o/"+trackingID) + `" width="1" height="1" alt="" style="display:none">`
+	}
+	return content
+}
+
+// ClickURL is `<baseURL>/c/<trackingID>.<signature>?url=<target>`
+func (ts *TrackingService) ClickURL(baseURL string, trackingID string, target string) string {
+	return baseURL + "/c/" + trackingID + "." + ts.sign(trackingID+"|"+target) + "?url=" + url.QueryEscape(target)
+}
+
+// Open records the first open, returns false for unknown tracking IDs
+func (ts *TrackingService) Open(trackingID string, now time.Time) bool {
+	emailSend := ts.find(trackingID)
+	if emailSend == nil {
+		return false
+	}
+	if emailSend.OpenedAt == nil {
+		emailSend.OpenedAt = &now
+		ts.record(emailSend, "opened_at", now, api.WebhookEventEmailOpened)
+	}
+	return true
+}
+
+// Click verifies the token & records the first click, a click implies an open (e.g. images blocked by the email client)
+func (ts *TrackingService) Click(token string, target string, now time.Time) bool {
+	trackingID, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(ts.sign(trackingID+"|"+target))) {
+		return false
+	}
+	emailSend := ts.find(trackingID)
+	if emailSend == nil {
+		return false
+	}
+
+	if emailSend.OpenedAt == nil {
+		ts.Open(trackingID, now)
+	}
+	if emailSend.ClickedAt == nil {
+		emailSend.ClickedAt = &now
+		ts.record(emailSend, "clicked_at", now, api.WebhookEventEmailClicked)
+	}
+	return true
+}
+
+// record sets `column` of the email & publishes `eventType` to the workspace of its contact, failures are only logged
+// (tracking requests always get their pixel or redirect)
+func (ts *TrackingService) record(emailSend *api.EmailSend, column string, now time.Time, eventType string) {
+	var contact api.Contact
+	ts.Db.Where("id = ?", emailSend.ContactID).First(&contact)
+
+	err := ts.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(emailSend).Update(column, now).Error; err != nil {
+			return err
+		}
+		return (&WebhookService{Db: tx}).Publish(contact.Workspace, eventType, emailSend)
+	})
+	if err != nil {
+		log.Printf("email send %d, %s: %v", emailSend.ID, column, err)
+	}
+}
+
+func (ts *TrackingService) find(trackingID string) *api.EmailSend {
+	if trackingID == "" {
+		return nil
+	}
+	var emailSend api.EmailSend
+	if ts.Db.Where("tracking_id = ?", trackingID).Find(&emailSend).RowsAffected == 0 {
+		return nil
+	}
+	return &emailSend
+}
+
+func (ts *TrackingService) sign(value string) string {
+	mac := hmac.New(sha256.New, []byte((&SettingService{Db: ts.Db}).Secret(trackingSecretKey)))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
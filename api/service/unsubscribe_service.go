@@ -0,0 +1,76 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+)
+
+const unsubscribeSecretKey = "unsubscribe_secret"
+
+// UnsubscribeService tokens identify an enrollment & are signed, so they can't be guessed
+// from the (sequential) enrollment IDs
+type UnsubscribeService struct {
+	Db *gorm.DB
+}
+
+// Token is `<enrollmentID>.<signature>`
+func (us *UnsubscribeService) Token(enrollmentID uint) string {
+	id := strconv.FormatUint(uint64(enrollmentID), 10)
+	return id + "." + us.sign(id)
+}
+
+// URL of the public unsubscribe endpoint, `baseURL` is where the server is reachable from the outside
+func (us *UnsubscribeService) URL(baseURL string, enrollmentID uint) string {
+	return strings.TrimRight(baseURL, "/") + "/u/" + us.Token(enrollmentID)
+}
+
+// Verify returns the enrollment ID of a valid token
+func (us *UnsubscribeService) Verify(token string) (uint, bool) {
+	id, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(us.sign(id))) {
+		return 0, false
+	}
+	enrollmentID, err := api.StrToUint(id)
+	if err != nil {
+		return 0, false
+	}
+	return uint(enrollmentID), true
+}
+
+// Unsubscribe adds the contact to the suppression list of its workspace & stops the enrollment
+// Unsubscribing again is a no-op (the link may be clicked more than once)
+func (us *UnsubscribeService) Unsubscribe(enrollment *api.Enrollment) error {
+	var contact api.Contact
+	if err := us.Db.Where("id = ?", enrollment.ContactID).First(&contact).Error; err != nil {
+		return fmt.Errorf("contact %d: %w", enrollment.ContactID, err)
+	}
+
+	return us.Db.Transaction(func(tx *gorm.DB) error {
+		suppressionService := SuppressionService{Db: tx}
+		suppressionService.Add(contact.Workspace, &api.Suppression{Email: contact.Email, Reason: api.SuppressionUnsubscribed})
+
+		enrollmentService := EnrollmentService{Db: tx}
+		if !enrollmentService.Stop(enrollment, api.EnrollmentUnsubscribed) {
+			return nil
+		}
+		webhookService := WebhookService{Db: tx}
+		return webhookService.Publish(contact.Workspace, api.WebhookEventContactUnsubscribed, api.UnsubscribeEvent{
+			Contact:    contact,
+			Workspace:  contact.Workspace,
+			SequenceID: enrollment.SequenceID,
+		})
+	})
+}
+
+func (us *UnsubscribeService) sign(id string) string {
+	secret := (&SettingService{Db: us.Db}).Secret(unsubscribeSecretKey)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe:" + id))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
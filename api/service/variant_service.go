@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"hash/fnv"
+	"log"
+)
+
+// VariantService manages the A/B variants of steps & picks the one an enrollment gets
+type VariantService struct {
+	Db *gorm.DB
+}
+
+// originalVariantName names the stats of emails sent without variant
+const originalVariantName = "original"
+
+func (vs *VariantService) List(stepID uint) []api.StepVariant {
+	variants := []api.StepVariant{}
+	vs.Db.Where("step_id = ?", stepID).Order("id").Find(&variants)
+	return variants
+}
+
+func (vs *VariantService) GetByID(stepID uint, id uint) *api.StepVariant {
+	var foundVariant api.StepVariant
+	vs.Db.Where("step_id = ? AND id = ?", stepID, id).First(&foundVariant)
+	return &foundVariant
+}
+
+// NameAvailable `id` is the variant being updated (0 on create)
+func (vs *VariantService) NameAvailable(stepID uint, name string, id uint) bool {
+	result := vs.Db.Where("step_id = ? AND name = ? AND id <> ?", stepID, name, id).Find(&api.StepVariant{})
+	return result.RowsAffected == 0
+}
+
+func (vs *VariantService) Create(variant *api.StepVariant) {
+	vs.Db.Create(variant)
+}
+
+func (vs *VariantService) Update(foundVariant *api.StepVariant, variant api.StepVariant) {
+	foundVariant.Name = variant.Name
+	foundVariant.Subject = variant.Subject
+	foundVariant.Content = variant.Content
+	foundVariant.Weight = variant.Weight
+	vs.Db.Save(foundVariant)
+}
+
+// Delete resets the winner of the step when it's the deleted variant
+func (vs *VariantService) Delete(variant *api.StepVariant) {
+	vs.Db.Transaction(func(tx *gorm.DB) error {
+		tx.Model(&api.SequenceStep{}).
+			Where("id = ? AND promotion_winner_variant_id = ?", variant.StepID, variant.ID).
+			Update("promotion_winner_variant_id", 0)
+		return tx.Delete(variant).Error
+	})
+}
+
+// ValidateVariant `Weight` defaults to 1, only email steps have variants
+func ValidateVariant(step *api.SequenceStep, variant *api.StepVariant) error {
+	if step.Type != api.StepTypeEmail {
+		return fmt.Errorf("Step: variants are only allowed for %s steps", api.StepTypeEmail)
+	}
+	if _, err := govalidator.ValidateStruct(variant); err != nil {
+		return err
+	}
+	if variant.Weight == 0 {
+		variant.Weight = 1
+	}
+	return lintErrors(variant.Subject, variant.Content)
+}
+
+// ValidatePromotion the winner must be a variant of the step
+func (vs *VariantService) ValidatePromotion(step *api.SequenceStep, promotion *api.VariantPromotion) error {
+	if _, err := govalidator.ValidateStruct(promotion); err != nil {
+		return err
+	}
+	if promotion.Metric != "" && promotion.SampleSize == 0 {
+		return errors.New("SampleSize: required with Metric")
+	}
+	if promotion.WinnerVariantID != 0 && vs.GetByID(step.ID, promotion.WinnerVariantID).ID == 0 {
+		return fmt.Errorf("WinnerVariantID: variant %d not found", promotion.WinnerVariantID)
+	}
+	return nil
+}
+
+func (vs *VariantService) UpdatePromotion(step *api.SequenceStep, promotion api.VariantPromotion) {
+	step.Promotion = promotion
+	vs.Db.Model(step).Updates(map[string]any{
+		"promotion_metric":            promotion.Metric,
+		"promotion_sample_size":       promotion.SampleSize,
+		"promotion_winner_variant_id": promotion.WinnerVariantID,
+	})
+}
+
+// Choose the variant `enrollmentID` gets for `step`, nil when the step has none
+// Without winner, the pick only depends on enrollment, step & weights, so a retried send gets the same variant
+func (vs *VariantService) Choose(step *api.SequenceStep, enrollmentID uint) *api.StepVariant {
+	variants := vs.List(step.ID)
+	if len(variants) == 0 {
+		return nil
+	}
+
+	winnerID := step.Promotion.WinnerVariantID
+	if winnerID == 0 {
+		winnerID = vs.promote(step)
+	}
+	for i := range variants {
+		if variants[i].ID == winnerID {
+			return &variants[i]
+		}
+	}
+
+	total := uint32(0)
+	for _, variant := range variants {
+		total += uint32(max(variant.Weight, 1))
+	}
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%d:%d", enrollmentID, step.ID)
+	pick := hash.Sum32() % total
+	for i := range variants {
+		weight := uint32(max(variants[i].Weight, 1))
+		if pick < weight {
+			return &variants[i]
+		}
+		pick -= weight
+	}
+	return &variants[len(variants)-1]
+}
+
+// promote sets the winner once every variant reached the sample size, returns its ID (0 while there is none)
+// Ties go to the older variant
+func (vs *VariantService) promote(step *api.SequenceStep) uint {
+	if step.Promotion.Metric == "" || step.Promotion.SampleSize == 0 {
+		return 0
+	}
+
+	var winner *api.VariantStats
+	stats := vs.Stats(step)
+	for i := range stats {
+		if stats[i].VariantID == 0 {
+			continue
+		}
+		if stats[i].Sent < int(step.Promotion.SampleSize) {
+			return 0
+		}
+		if winner == nil || rate(stats[i], step.Promotion.Metric) > rate(*winner, step.Promotion.Metric) {
+			winner = &stats[i]
+		}
+	}
+	if winner == nil {
+		return 0
+	}
+
+	log.Printf("step %d: variant %d promoted by %s", step.ID, winner.VariantID, step.Promotion.Metric)
+	promotion := step.Promotion
+	promotion.WinnerVariantID = winner.VariantID
+	vs.UpdatePromotion(step, promotion)
+	return winner.VariantID
+}
+
+func rate(stats api.VariantStats, metric string) float64 {
+	if metric == api.PromoteByReplyRate {
+		return stats.ReplyRate
+	}
+	return stats.OpenRate
+}
+
+// Stats per variant of the step (in creation order), emails sent before the step had variants come first
+func (vs *VariantService) Stats(step *api.SequenceStep) []api.VariantStats {
+	var rows []api.VariantStats
+	vs.Db.Model(&api.EmailSend{}).
+		Select("variant_id, COUNT(*) AS sent, COUNT(opened_at) AS opened, COUNT(clicked_at) AS clicked, "+
+			"SUM(CASE WHEN EXISTS (SELECT 1 FROM replies WHERE replies.email_send_id = email_sends.id) THEN 1 ELSE 0 END) AS replied").
+		Where("step_id = ?", step.ID).
+		Group("variant_id").
+		Scan(&rows)
+
+	byVariantID := map[uint]api.VariantStats{}
+	for _, row := range rows {
+		byVariantID[row.VariantID] = row
+	}
+
+	stats := []api.VariantStats{}
+	if original, ok := byVariantID[0]; ok {
+		original.Name = originalVariantName
+		stats = append(stats, original)
+	}
+	for _, variant := range vs.List(step.ID) {
+		variantStats := byVariantID[variant.ID]
+		variantStats.VariantID = variant.ID
+		variantStats.Name = variant.Name
+		variantStats.Winner = variant.ID == step.Promotion.WinnerVariantID
+		stats = append(stats, variantStats)
+	}
+
+	for i := range stats {
+		if sent := float64(stats[i].Sent); sent > 0 {
+			stats[i].OpenRate = float64(stats[i].Opened) / sent
+			stats[i].ClickRate = float64(stats[i].Clicked) / sent
+			stats[i].ReplyRate = float64(stats[i].Replied) / sent
+		}
+	}
+	return stats
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Headers sent along with every webhook delivery
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookService deliveries are sent by `webhook_delivery` jobs (see `RunDeliveryJob`)
+type WebhookService struct {
+	Db *gorm.DB
+}
+
+// webhookMaxAttempts of a delivery, retried with the backoff of the `JobWorker`
+const webhookMaxAttempts = 8
+
+func (ws *WebhookService) List(workspace string) []api.WebhookSubscription {
+	subscriptions := []api.WebhookSubscription{}
+	ws.Db.Where("workspace = ?", workspace).Order("id").Find(&subscriptions)
+	return subscriptions
+}
+
+func (ws *WebhookService) GetByID(workspace string, id uint) *api.WebhookSubscription {
+	var foundSubscription api.WebhookSubscription
+	ws.Db.Where("workspace = ? AND id = ?", workspace, id).First(&foundSubscription)
+	return &foundSubscription
+}
+
+// Create generates a secret when none was given
+func (ws *WebhookService) Create(workspace string, subscription *api.WebhookSubscription) {
+	subscription.Workspace = workspace
+	if subscription.Secret == "" {
+		subscription.Secret = "whsec_" + randomHex(24)
+	}
+	ws.Db.Create(&subscription)
+}
+
+// Update keeps the current secret when none was given
+func (ws *WebhookService) Update(foundSubscription *api.WebhookSubscription, subscription api.WebhookSubscription) {
+	foundSubscription.URL = subscription.URL
+	foundSubscription.EventTypes = subscription.EventTypes
+	foundSubscription.Disabled = subscription.Disabled
+	if subscription.Secret != "" {
+		foundSubscription.Secret = subscription.Secret
+	}
+	ws.Db.Save(&foundSubscription)
+}
+
+// Delete removes the subscription along with its deliveries, their unfinished jobs are cancelled
+func (ws *WebhookService) Delete(subscription *api.WebhookSubscription) error {
+	return ws.Db.Transaction(func(tx *gorm.DB) error {
+		jobIDs := tx.Model(&api.WebhookDelivery{}).Select("job_id").Where("subscription_id = ?", subscription.ID)
+		if err := tx.Model(&api.Job{}).
+			Where("id IN (?) AND status IN ?", jobIDs, []string{api.JobPending, api.JobRunning}).
+			Updates(map[string]any{"status": api.JobCanceled, "finished_at": time.Now().UTC()}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", subscription.ID).Delete(&api.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&subscription).Error
+	})
+}
+
+// ValidateEventTypes at least one (known) event type is required
+func ValidateEventTypes(eventTypes []string) error {
+	if len(eventTypes) == 0 {
+		return fmt.Errorf("EventTypes: at least one of %v required", api.WebhookEventTypes)
+	}
+	for _, eventType := range eventTypes {
+		if !slices.Contains(api.WebhookEventTypes, eventType) {
+			return fmt.Errorf("EventTypes: unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// Publish writes a pending delivery for every enabled subscription of `workspace` interested in `eventType` (outbox),
+// along with the `webhook_delivery` job sending it. Bind `Db` to the transaction of the mutation the event is about
+func (ws *WebhookService) Publish(workspace string, eventType string, data any) error {
+	var subscriptions []api.WebhookSubscription
+	if err := ws.Db.Where("workspace = ? AND disabled = ?", workspace, false).Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	event := api.WebhookEvent{ID: "evt_" + randomHex(16), Type: eventType, CreatedAt: time.Now().UTC(), Data: data}
+	payload := api.ToJSON(event)
+
+	for _, subscription := range subscriptions {
+		if !slices.Contains(subscription.EventTypes, eventType) {
+			continue
+		}
+		delivery := api.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      eventType,
+			Payload:        payload,
+			Status:         api.WebhookDeliveryPending,
+		}
+		if err := ws.Db.Create(&delivery).Error; err != nil {
+			return err
+		}
+		if err := ws.enqueue(workspace, &delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueue the job of a pending delivery
+func (ws *WebhookService) enqueue(workspace string, delivery *api.WebhookDelivery) error {
+	job, err := (&JobService{Db: ws.Db}).enqueue(workspace, api.JobTypeWebhookDelivery, api.WebhookDeliveryJob{DeliveryID: delivery.ID}, webhookMaxAttempts)
+	if err != nil {
+		return err
+	}
+	delivery.JobID = job.ID
+	return ws.Db.Model(delivery).Update("job_id", job.ID).Error
+}
+
+// PublishStep `action` is one of the audit actions (create, update, delete)
+func (ws *WebhookService) PublishStep(workspace string, action string, step api.SequenceStep) error {
+	switch action {
+	case api.AuditActionCreate:
+		return ws.Publish(workspace, api.WebhookEventStepCreated, step)
+	case api.AuditActionUpdate:
+		return ws.Publish(workspace, api.WebhookEventStepUpdated, step)
+	case api.AuditActionDelete:
+		return ws.Publish(workspace, api.WebhookEventStepDeleted, step)
+	}
+	return nil
+}
+
+// PublishImport publishes the step changes of an applied import
+func (ws *WebhookService) PublishImport(workspace string, plan *ImportPlan) error {
+	for _, step := range plan.Delete {
+		if err := ws.PublishStep(workspace, api.AuditActionDelete, step); err != nil {
+			return err
+		}
+	}
+	for _, change := range plan.Update {
+		if err := ws.PublishStep(workspace, api.AuditActionUpdate, change.After); err != nil {
+			return err
+		}
+	}
+	for _, step := range plan.Create {
+		if err := ws.PublishStep(workspace, api.AuditActionCreate, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListDeliveries newest first, `status` is ignored when empty
+func (ws *WebhookService) ListDeliveries(subscriptionID uint, status string) []api.WebhookDelivery {
+	query := ws.Db.Where("subscription_id = ?", subscriptionID).Order("id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	deliveries := []api.WebhookDelivery{}
+	query.Find(&deliveries)
+	return deliveries
+}
+
+func (ws *WebhookService) GetDelivery(subscriptionID uint, id uint) *api.WebhookDelivery {
+	var foundDelivery api.WebhookDelivery
+	ws.Db.Where("id = ? AND subscription_id = ?", id, subscriptionID).First(&foundDelivery)
+	return &foundDelivery
+}
+
+// Redeliver queues the delivery again with a new job (a fresh set of attempts), whatever its current status
+func (ws *WebhookService) Redeliver(workspace string, delivery *api.WebhookDelivery) error {
+	return ws.Db.Transaction(func(tx *gorm.DB) error {
+		delivery.Status = api.WebhookDeliveryPending
+		delivery.Attempts = 0
+		if err := tx.Save(delivery).Error; err != nil {
+			return err
+		}
+		return (&WebhookService{Db: tx}).enqueue(workspace, delivery)
+	})
+}
+
+// WebhookSignature is the hex HMAC-SHA256 of `timestamp.body`, sent as `sha256=<signature>`
+// Receivers should recompute it & compare with `hmac.Equal`
+func WebhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookClient sends the deliveries, a receiver can't hold up a job for longer than its timeout
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// RunDeliveryJob makes an attempt of the delivery of a `webhook_delivery` job, failed attempts are retried by the job
+// (the delivery is `failed` once the job is out of attempts). Deliveries which aren't pending anymore are skipped
+func (ws *WebhookService) RunDeliveryJob(ctx context.Context, job *api.Job) (any, error) {
+	var payload api.WebhookDeliveryJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return nil, Permanent(err)
+	}
+	var delivery api.WebhookDelivery
+	if ws.Db.Where("id = ?", payload.DeliveryID).Find(&delivery).RowsAffected == 0 {
+		return nil, Permanent(fmt.Errorf("webhook delivery %d not found", payload.DeliveryID))
+	}
+	if delivery.Status != api.WebhookDeliveryPending || delivery.JobID != job.ID {
+		return nil, nil
+	}
+	subscription := ws.GetByID(job.Workspace, delivery.SubscriptionID)
+
+	statusCode, err := ws.send(ctx, subscription, &delivery)
+	if ctx.Err() != nil {
+		// interrupted (the worker stops or the job got cancelled), the attempt doesn't count
+		return nil, ctx.Err()
+	}
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		now := time.Now().UTC()
+		delivery.Status = api.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+	case subscription.ID == 0:
+		err = Permanent(err)
+		fallthrough
+	case job.Attempts >= job.MaxAttempts:
+		delivery.Status = api.WebhookDeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+	}
+	if saveErr := ws.Db.Save(&delivery).Error; saveErr != nil {
+		return nil, saveErr
+	}
+	return api.WebhookDeliveryResult{StatusCode: statusCode}, err
+}
+
+// send `statusCode` is 0 when no response was received
+func (ws *WebhookService) send(ctx context.Context, subscription *api.WebhookSubscription, delivery *api.WebhookDelivery) (int, error) {
+	if subscription.ID == 0 {
+		return 0, fmt.Errorf("subscription %d not found", delivery.SubscriptionID)
+	}
+
+	body := []byte(delivery.Payload)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookEventHeader, delivery.EventType)
+	request.Header.Set(WebhookDeliveryHeader, delivery.EventID)
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(WebhookSignatureHeader, "sha256="+WebhookSignature(subscription.Secret, timestamp, body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
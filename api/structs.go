@@ -1,5 +1,11 @@
 package api
 
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
 // Sequence https://gorm.io/docs/models.html#Conventions
 // DB table name will be `sequences` (plural)
 type Sequence struct {
@@ -7,15 +13,116 @@ type Sequence struct {
 	Name                 string ` valid:"alphanum,required,minstringlength(3),maxstringlength(30)" gorm:"unique"`
 	OpenTrackingEnabled  bool
 	ClickTrackingEnabled bool
-	SequenceSteps        []SequenceStep `json:"-"` // wouldn't show in JSON output
+	Schedule             SendSchedule   `gorm:"embedded;embeddedPrefix:schedule_"`              // set on create, changed via `PUT /sequences/:id/schedule`
+	MailboxRotation      string         `gorm:"not null;default:round_robin" json:",omitempty"` // changed via `PUT /sequences/:id/mailboxes`
+	AutoEnrollment       AutoEnrollment `gorm:"embedded;embeddedPrefix:auto_enroll_"`           // changed via `PUT /sequences/:id/auto-enrollment`
+	Status               string         `gorm:"not null;default:active"`                        // set on create (draft or active), changed via `POST /sequences/:id/<transition>`
+	PausedAt             *time.Time     `json:",omitempty"`                                     // while paused
+	SequenceSteps        []SequenceStep `json:"-"`                                              // wouldn't show in JSON output
 }
 
+// Sequence statuses, only the steps of `active` sequences get sent (enrollments of the others wait)
+const (
+	SequenceDraft    = "draft" // being set up, activated via `POST /sequences/:id/activate`
+	SequenceActive   = "active"
+	SequencePaused   = "paused"   // sends are held until resumed, due times are shifted by the pause then
+	SequenceArchived = "archived" // for good, contacts can't be enrolled anymore
+)
+
+var SequenceStatuses = []string{SequenceDraft, SequenceActive, SequencePaused, SequenceArchived}
+
+// Step types, each one validates its own fields (see `service.ValidateStep`)
+const (
+	StepTypeEmail      = "email"       // `Subject` & `Content` are sent to the contact
+	StepTypeManualTask = "manual_task" // opens a task (`Subject` as title, `Content` as instructions), the enrollment waits until it's completed or skipped
+	StepTypeWaitUntil  = "wait_until"  // holds the enrollment until `WaitUntil`
+	StepTypeHTTPCall   = "http_call"   // sends `Content` (or `StepCall` when empty) to `URL`
+)
+
+var StepTypes = []string{StepTypeEmail, StepTypeManualTask, StepTypeWaitUntil, StepTypeHTTPCall}
+
 // SequenceStep https://gorm.io/docs/has_many.html#Has-Many
+// `Subject` names the step whatever its type (unique per sequence)
 type SequenceStep struct {
-	ID         uint   `gorm:"primaryKey"`
-	Subject    string `valid:"required,minstringlength(3)"`
-	Content    string `valid:"required,minstringlength(3)"`
-	SequenceID uint
+	ID          uint   `gorm:"primaryKey"`
+	Type        string `gorm:"not null;default:email" valid:"in(email|manual_task|wait_until|http_call)"` // email when empty
+	Subject     string
+	Content     string
+	WaitUntil   *time.Time `json:",omitempty"` // wait_until
+	URL         string     `json:",omitempty"` // http_call
+	Method      string     `json:",omitempty"` // http_call, POST by default
+	SequenceID  uint
+	Position    uint             // steps are sent in ascending order (ties are broken by ID)
+	WaitDays    uint             // days to wait after the previous step
+	Promotion   VariantPromotion `gorm:"embedded;embeddedPrefix:promotion_"` // of the step's variants (if any)
+	Attachments []uint           `gorm:"serializer:json" json:",omitempty"`  // asset IDs, of email steps
+	Lint        *LintReport      `gorm:"-" json:",omitempty"`                // of email steps, in responses to create & update
+}
+
+// SequenceStepUpdate body of `PUT /sequence-steps/:id`, omitted fields keep their current value
+// Changing `Type` clears the fields of the previous type (`WaitUntil`, `URL`, `Method` & `Attachments`) which aren't given
+type SequenceStepUpdate struct {
+	Type        *string
+	Subject     *string
+	Content     *string
+	WaitUntil   *time.Time
+	URL         *string
+	Method      *string
+	Position    *uint
+	WaitDays    *uint
+	Attachments *[]uint
+}
+
+// Apply returns `step` with the given fields replaced
+func (ssu SequenceStepUpdate) Apply(step SequenceStep) SequenceStep {
+	if ssu.Type != nil && *ssu.Type != step.Type {
+		step.Type = *ssu.Type
+		step.WaitUntil, step.URL, step.Method, step.Attachments = nil, "", "", nil
+	}
+	if ssu.Subject != nil {
+		step.Subject = *ssu.Subject
+	}
+	if ssu.Content != nil {
+		step.Content = *ssu.Content
+	}
+	if ssu.WaitUntil != nil {
+		step.WaitUntil = ssu.WaitUntil
+	}
+	if ssu.URL != nil {
+		step.URL = *ssu.URL
+	}
+	if ssu.Method != nil {
+		step.Method = *ssu.Method
+	}
+	if ssu.Position != nil {
+		step.Position = *ssu.Position
+	}
+	if ssu.WaitDays != nil {
+		step.WaitDays = *ssu.WaitDays
+	}
+	if ssu.Attachments != nil {
+		step.Attachments = *ssu.Attachments
+	}
+	return step
+}
+
+// StepCall is the JSON body `http_call` steps without `Content` send
+type StepCall struct {
+	EnrollmentID uint
+	SequenceID   uint
+	StepID       uint
+	Contact      Contact
+}
+
+// AfterDelete removes the variants & edges along with the step https://gorm.io/docs/hooks.html
+func (ss *SequenceStep) AfterDelete(tx *gorm.DB) error {
+	if ss.ID == 0 {
+		return nil
+	}
+	if err := tx.Where("step_id = ?", ss.ID).Delete(&StepVariant{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("from_step_id = ? OR to_step_id = ?", ss.ID, ss.ID).Delete(&StepEdge{}).Error
 }
 
 type SequenceWithSteps struct {
@@ -23,6 +130,172 @@ type SequenceWithSteps struct {
 	Steps    *[]SequenceStep
 }
 
+// SequenceStats is aggregated from the steps of a sequence & the bounces of its emails
+type SequenceStats struct {
+	SequenceID    uint `json:"sequenceId"`
+	StepCount     int  `json:"stepCount"`
+	TotalWaitDays int  `json:"totalWaitDays"`
+	HardBounces   int  `json:"hardBounces"`
+	SoftBounces   int  `json:"softBounces"`
+	Complaints    int  `json:"complaints"`
+}
+
 type ErrorResponse struct {
 	Error string
 }
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+
+	AuditEntitySequence            = "Sequence"
+	AuditEntitySequenceStep        = "SequenceStep"
+	AuditEntityWebhookSubscription = "WebhookSubscription"
+	AuditEntityContact             = "Contact"
+	AuditEntityEnrollment          = "Enrollment"
+	AuditEntitySuppression         = "Suppression"
+	AuditEntityHolidayCalendar     = "HolidayCalendar"
+	AuditEntityThrottle            = "Throttle"
+	AuditEntityMailbox             = "Mailbox"
+	AuditEntityStepVariant         = "StepVariant"
+	AuditEntitySequenceGraph       = "SequenceGraph"
+	AuditEntityTask                = "Task"
+	AuditEntitySegment             = "Segment"
+	AuditEntityContactImport       = "ContactImport"
+	AuditEntityJob                 = "Job"
+	AuditEntityAsset               = "Asset"
+)
+
+var ErrAuditAppendOnly = errors.New("audit log is append-only")
+
+// AuditRecord keeps track of a single mutation (who changed what & when)
+// `Before` & `After` hold the JSON encoded entity, empty for create & delete respectively
+type AuditRecord struct {
+	ID        uint `gorm:"primaryKey"`
+	Actor     string
+	Entity    string `gorm:"index"`
+	EntityID  uint
+	Action    string
+	Before    string
+	After     string
+	RequestID string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// BeforeUpdate https://gorm.io/docs/hooks.html
+func (ar *AuditRecord) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+func (ar *AuditRecord) BeforeDelete(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+const (
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+)
+
+// BatchStepOperation `ID` is required for update & delete. The fields of the step are those of `SequenceStepUpdate`:
+// applied to a new step by create, omitted fields keep their value on update
+type BatchStepOperation struct {
+	Op string
+	ID uint
+	SequenceStepUpdate
+}
+
+// BatchStepsRequest deleting steps of an active sequence requires `Force` (see `service.StepsDeletable`)
+type BatchStepsRequest struct {
+	Operations []BatchStepOperation
+	Force      bool `json:",omitempty"`
+}
+
+type BatchStepResult struct {
+	Index  int
+	Op     string
+	Status int
+	Error  string        `json:",omitempty"`
+	Step   *SequenceStep `json:",omitempty"`
+}
+
+type BatchStepsResponse struct {
+	Error   string `json:",omitempty"`
+	Results []BatchStepResult
+}
+
+const SequenceDocumentVersion = 1
+
+// SequenceDocument is the versioned import/export format (JSON or YAML), meant to be kept under version control
+type SequenceDocument struct {
+	Version  int                  `json:"version" yaml:"version"`
+	Sequence SequenceDocumentSpec `json:"sequence" yaml:"sequence"`
+}
+
+type SequenceDocumentSpec struct {
+	Name                 string                 `json:"name" yaml:"name"`
+	OpenTrackingEnabled  bool                   `json:"openTrackingEnabled" yaml:"openTrackingEnabled"`
+	ClickTrackingEnabled bool                   `json:"clickTrackingEnabled" yaml:"clickTrackingEnabled"`
+	Steps                []SequenceDocumentStep `json:"steps" yaml:"steps"`
+}
+
+// SequenceDocumentStep order inside `Steps` defines the step `Position`
+type SequenceDocumentStep struct {
+	Type      string     `json:"type,omitempty" yaml:"type,omitempty"`
+	Subject   string     `json:"subject" yaml:"subject"`
+	Content   string     `json:"content" yaml:"content"`
+	WaitDays  uint       `json:"waitDays" yaml:"waitDays"`
+	WaitUntil *time.Time `json:"waitUntil,omitempty" yaml:"waitUntil,omitempty"`
+	URL       string     `json:"url,omitempty" yaml:"url,omitempty"`
+	Method    string     `json:"method,omitempty" yaml:"method,omitempty"`
+}
+
+const (
+	ImportActionCreate    = "create"
+	ImportActionUpdate    = "update"
+	ImportActionUnchanged = "unchanged"
+)
+
+type SequenceImportResult struct {
+	DryRun     bool
+	Action     string
+	SequenceID uint `json:",omitempty"`
+	Changes    []string
+}
+
+// ApiKey only the SHA-256 hash of the key is stored, `Prefix` is kept to identify the key (e.g. in audit log)
+// Contacts & suppressions are scoped to the `Workspace` of the key
+type ApiKey struct {
+	ID        uint `gorm:"primaryKey"`
+	Name      string
+	Prefix    string
+	Workspace string `gorm:"not null;default:default"`
+	KeyHash   string `gorm:"unique" json:"-"`
+	CreatedAt time.Time
+}
+
+// GraphQLRequest is the body of `POST /v1/graphql`
+type GraphQLRequest struct {
+	Query         string         `json:"query" valid:"required"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+type GraphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLResponse `Data` follows the shape of the query
+type GraphQLResponse struct {
+	Data   any            `json:"data,omitempty"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// Setting is a key/value pair kept in the DB, e.g. generated signing secrets
+type Setting struct {
+	Key   string `gorm:"primaryKey"`
+	Value string
+}
@@ -0,0 +1,37 @@
+package api
+
+import "time"
+
+// Suppression reasons
+const (
+	SuppressionUnsubscribed = "unsubscribed"
+	SuppressionBounced      = "bounced"    // hard bounce
+	SuppressionComplained   = "complained" // spam complaint
+	SuppressionManual       = "manual"
+)
+
+var SuppressionReasons = []string{SuppressionUnsubscribed, SuppressionBounced, SuppressionComplained, SuppressionManual}
+
+// Suppression emails on the list of a workspace never get any email from it
+// `Email` is stored lowercase
+type Suppression struct {
+	ID        uint   `gorm:"primaryKey"`
+	Workspace string `gorm:"uniqueIndex:idx_suppressions_workspace_email" json:"-"`
+	Email     string `valid:"email,required" gorm:"uniqueIndex:idx_suppressions_workspace_email"`
+	Reason    string `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// SuppressionImportResult `Errors` are reported per (1-based) CSV line, valid lines are imported anyway
+type SuppressionImportResult struct {
+	Imported int
+	Skipped  int      // already on the list
+	Errors   []string `json:",omitempty"`
+}
+
+// UnsubscribeEvent is the data of `contact.unsubscribed` webhook events
+type UnsubscribeEvent struct {
+	Contact    Contact `json:"contact"`
+	Workspace  string  `json:"workspace"`
+	SequenceID uint    `json:"sequenceId"`
+}
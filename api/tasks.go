@@ -0,0 +1,28 @@
+package api
+
+import "time"
+
+// Task statuses, completed & skipped tasks both move the enrollment on to its next step
+const (
+	TaskOpen      = "open"
+	TaskCompleted = "completed"
+	TaskSkipped   = "skipped"
+)
+
+var TaskStatuses = []string{TaskOpen, TaskCompleted, TaskSkipped}
+
+// Task is opened when an enrollment reaches a `manual_task` step, listed in the inbox (`GET /tasks`) until resolved
+// Open tasks of stopped enrollments are skipped
+type Task struct {
+	ID           uint   `gorm:"primaryKey"`
+	Workspace    string `gorm:"index" json:"-"`
+	EnrollmentID uint   `gorm:"index"`
+	SequenceID   uint
+	StepID       uint
+	ContactID    uint
+	Title        string
+	Instructions string `json:",omitempty"`
+	Status       string `gorm:"index"`
+	ResolvedAt   *time.Time
+	CreatedAt    time.Time
+}
@@ -0,0 +1,51 @@
+package api
+
+import "time"
+
+// Throttle scopes, the bucket of a send is picked by the sending mailbox (`From` address) or the recipient's domain
+const (
+	ThrottleScopeMailbox = "mailbox"
+	ThrottleScopeDomain  = "domain"
+	ThrottleScopeGlobal  = "global"
+)
+
+var ThrottleScopes = []string{ThrottleScopeMailbox, ThrottleScopeDomain, ThrottleScopeGlobal}
+
+const (
+	ThrottlePeriodHour = "hour"
+	ThrottlePeriodDay  = "day"
+)
+
+// Throttle allows at most `Limit` sends per `Period`, refilled continuously (token bucket)
+// `Key` restricts it to a single mailbox address or domain, an empty key applies to each of them separately
+type Throttle struct {
+	ID        uint   `gorm:"primaryKey"`
+	Scope     string `valid:"in(mailbox|domain|global),required"`
+	Key       string // stored lowercase, always empty for global throttles
+	Period    string `valid:"in(hour|day),required"`
+	Limit     uint   `valid:"required"`
+	CreatedAt time.Time
+}
+
+// RateBucket holds the tokens left of a throttle for one mailbox/domain, shared by every scheduler through the DB
+// `Version` guards against concurrent updates (optimistic locking)
+type RateBucket struct {
+	ID         uint   `gorm:"primaryKey"`
+	ThrottleID uint   `gorm:"uniqueIndex:idx_rate_buckets_throttle_key"`
+	Key        string `gorm:"uniqueIndex:idx_rate_buckets_throttle_key"`
+	Tokens     float64
+	Version    uint
+	RefilledAt time.Time
+}
+
+// ThrottleUsage is the state of a bucket at the time of the request
+type ThrottleUsage struct {
+	ThrottleID uint
+	Scope      string
+	Key        string
+	Period     string
+	Limit      uint
+	Used       uint
+	Remaining  uint
+	FullAt     time.Time // when the bucket is refilled completely
+}
@@ -1,8 +1,23 @@
 package api
 
-import "strconv"
+import (
+	"encoding/json"
+	"strconv"
+)
 
 func StrToUint(IDStr string) (uint64, error) {
 	return strconv.ParseUint(IDStr, 10, 64)
 
 }
+
+// ToJSON returns empty string for `nil` (or values which can't be encoded)
+func ToJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,43 @@
+package api
+
+import "time"
+
+// Metrics a winning variant can be promoted by
+const (
+	PromoteByOpenRate  = "open_rate"
+	PromoteByReplyRate = "reply_rate"
+)
+
+// StepVariant is an alternative subject & content of a step (A/B test)
+// Once a step has variants, each enrollment gets one of them (picked by `Weight`) instead of the step's own subject & content
+type StepVariant struct {
+	ID        uint   `gorm:"primaryKey"`
+	StepID    uint   `gorm:"index"`
+	Name      string `valid:"required,maxstringlength(30)"`
+	Subject   string `valid:"required,minstringlength(3)"`
+	Content   string `valid:"required,minstringlength(3)"`
+	Weight    uint   // share of the enrollments relative to the other variants, 1 when 0
+	CreatedAt time.Time
+}
+
+// VariantPromotion is the A/B test setup of a step, changed via `PUT /sequence-steps/:id/promotion`
+// With a `Metric`, the variant with the best rate wins once every variant was sent `SampleSize` times
+type VariantPromotion struct {
+	Metric          string `valid:"in(open_rate|reply_rate)"`
+	SampleSize      uint
+	WinnerVariantID uint // every later enrollment gets the winner, set manually or by the auto-promotion
+}
+
+// VariantStats are counted per sent email, `VariantID` is 0 for emails sent with the step's own subject & content
+type VariantStats struct {
+	VariantID uint
+	Name      string
+	Sent      int
+	Opened    int
+	Clicked   int
+	Replied   int
+	OpenRate  float64
+	ClickRate float64
+	ReplyRate float64
+	Winner    bool
+}
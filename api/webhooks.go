@@ -0,0 +1,87 @@
+package api
+
+import "time"
+
+// Webhook event types, subscriptions pick the ones they are interested in
+const (
+	WebhookEventStepCreated         = "step.created"
+	WebhookEventStepUpdated         = "step.updated"
+	WebhookEventStepDeleted         = "step.deleted"
+	WebhookEventEmailSent           = "email.sent"
+	WebhookEventEmailOpened         = "email.opened"
+	WebhookEventEmailClicked        = "email.clicked"
+	WebhookEventEmailBounced        = "email.bounced"
+	WebhookEventEmailComplained     = "email.complained"
+	WebhookEventEmailReplied        = "email.replied"
+	WebhookEventContactUnsubscribed = "contact.unsubscribed"
+	WebhookEventTaskCreated         = "task.created"
+)
+
+var WebhookEventTypes = []string{
+	WebhookEventStepCreated,
+	WebhookEventStepUpdated,
+	WebhookEventStepDeleted,
+	WebhookEventEmailSent,
+	WebhookEventEmailOpened,
+	WebhookEventEmailClicked,
+	WebhookEventEmailBounced,
+	WebhookEventEmailComplained,
+	WebhookEventEmailReplied,
+	WebhookEventContactUnsubscribed,
+	WebhookEventTaskCreated,
+}
+
+// WebhookSubscription `Secret` signs the payloads, it's only returned when the subscription is created
+// (a random one is generated when omitted). Subscriptions only receive the events of their `Workspace`
+type WebhookSubscription struct {
+	ID         uint     `gorm:"primaryKey"`
+	Workspace  string   `gorm:"index;not null;default:default" json:"-"`
+	URL        string   `valid:"required,url"`
+	Secret     string   `json:",omitempty"`
+	EventTypes []string `gorm:"serializer:json"`
+	Disabled   bool     // disabled subscriptions don't receive new events
+	CreatedAt  time.Time
+}
+
+// Webhook delivery statuses, `failed` deliveries exhausted their attempts (until redelivered manually)
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is the outbox: a row per event & subscription, written when the event happens
+// & sent by its job until delivered (2xx response) or out of attempts
+type WebhookDelivery struct {
+	ID             uint `gorm:"primaryKey"`
+	SubscriptionID uint `gorm:"index"`
+	EventID        string
+	EventType      string
+	Payload        string
+	Status         string `gorm:"index"`
+	Attempts       uint   // made so far
+	JobID          uint   `gorm:"index"` // of the `webhook_delivery` job sending it, its `RunAt` is when the next attempt is due
+	LastStatusCode int    `json:",omitempty"`
+	LastError      string `json:",omitempty"`
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// WebhookDeliveryJob is the payload of `webhook_delivery` jobs
+type WebhookDeliveryJob struct {
+	DeliveryID uint
+}
+
+// WebhookDeliveryResult is the result of `webhook_delivery` jobs
+type WebhookDeliveryResult struct {
+	StatusCode int
+}
+
+// WebhookEvent is the JSON body POSTed to subscribers
+type WebhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      any       `json:"data"`
+}
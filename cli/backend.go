@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"gorm.io/gorm"
+)
+
+// Backend is implemented by both the local (direct DB) & remote (HTTP API) modes
+type Backend interface {
+	ListSequences() ([]api.Sequence, error)
+	GetSequence(id uint) (*api.SequenceWithSteps, error)
+	CreateSequence(sequence api.Sequence) (*api.Sequence, error)
+	DeleteSequence(id uint) error
+
+	GetStep(id uint) (*api.SequenceStep, error)
+	AddStep(step api.SequenceStep) (*api.SequenceStep, error)
+	EditStep(id uint, step api.SequenceStep) (*api.SequenceStep, error)
+	RemoveStep(id uint, force bool) error
+
+	Import(document api.SequenceDocument, dryRun bool) (*api.SequenceImportResult, error)
+	Export(id uint) (*api.SequenceDocument, error)
+}
+
+// cliCaller is recorded in audit log for changes done through local backend
+var cliCaller = service.Caller{Actor: "cli", Workspace: api.DefaultWorkspace}
+
+// localBackend works on the DB through the same operations as the API, applying the same validation rules
+type localBackend struct {
+	operations *service.Operations
+}
+
+func newLocalBackend(db *gorm.DB) *localBackend {
+	return &localBackend{operations: service.NewOperations(db)}
+}
+
+func (lb *localBackend) ListSequences() ([]api.Sequence, error) {
+	return lb.operations.ListSequences(), nil
+}
+
+func (lb *localBackend) GetSequence(id uint) (*api.SequenceWithSteps, error) {
+	foundSequence, err := lb.operations.GetSequence(id)
+	if err != nil {
+		return nil, err
+	}
+	return &api.SequenceWithSteps{Sequence: foundSequence, Steps: &foundSequence.SequenceSteps}, nil
+}
+
+func (lb *localBackend) CreateSequence(sequence api.Sequence) (*api.Sequence, error) {
+	return lb.operations.CreateSequence(cliCaller, sequence)
+}
+
+func (lb *localBackend) DeleteSequence(id uint) error {
+	return lb.operations.DeleteSequence(cliCaller, id)
+}
+
+func (lb *localBackend) GetStep(id uint) (*api.SequenceStep, error) {
+	return lb.operations.GetStep(id)
+}
+
+func (lb *localBackend) AddStep(step api.SequenceStep) (*api.SequenceStep, error) {
+	return lb.operations.CreateStep(cliCaller, step)
+}
+
+func (lb *localBackend) EditStep(id uint, step api.SequenceStep) (*api.SequenceStep, error) {
+	return lb.operations.UpdateStep(cliCaller, id, step)
+}
+
+func (lb *localBackend) RemoveStep(id uint, force bool) error {
+	return lb.operations.DeleteStep(cliCaller, id, force)
+}
+
+func (lb *localBackend) Import(document api.SequenceDocument, dryRun bool) (*api.SequenceImportResult, error) {
+	return lb.operations.Import(cliCaller, document, dryRun)
+}
+
+func (lb *localBackend) Export(id uint) (*api.SequenceDocument, error) {
+	return lb.operations.Export(id)
+}
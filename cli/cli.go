@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/config"
+	"gorm.io/gorm"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const usage = `Usage: sequence-api [global flags] <command> [args]
+
+Commands:
+  serve [--addr :8081] [--grpc-addr :9091] start the HTTP & gRPC APIs (default when no command is given)
+  migrate                                 create/migrate the DB schema
+  sequences list|get <id>|create|delete <id>
+  steps add|edit <id>|rm <id>
+  import <file.json|file.yaml> [--dry-run]
+  export <id> [--format json|yaml]
+  apikey create --name <name> [--workspace <ws>] (local only)
+
+Global flags:
+`
+
+// options are shared by all commands, set via global flags
+type options struct {
+	dbPath string
+	remote string
+	apiKey string
+	output string
+	stdout io.Writer
+}
+
+// Run parses `args` (without the program name) & executes the matching command
+func Run(args []string, stdout io.Writer) error {
+	opts := options{stdout: stdout}
+
+	fs := flag.NewFlagSet("sequence-api", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	fs.StringVar(&opts.dbPath, "db", "./db/sequences.db", "SQLite DB path, used when --remote is not set")
+	fs.StringVar(&opts.remote, "remote", os.Getenv("SEQUENCES_API_URL"), "base URL of a running API, e.g. http://localhost:8081")
+	fs.StringVar(&opts.apiKey, "api-key", os.Getenv("SEQUENCES_API_KEY"), "API key sent with remote requests")
+	fs.StringVar(&opts.output, "output", "table", "output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprint(stdout, usage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.output != "table" && opts.output != "json" {
+		return fmt.Errorf("unsupported output format: %q", opts.output)
+	}
+
+	args = fs.Args()
+	if len(args) == 0 {
+		return serve(opts, nil)
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "serve":
+		return serve(opts, args)
+	case "migrate":
+		return migrate(opts)
+	case "sequences":
+		return withBackend(opts, func(backend Backend) error { return sequencesCommand(opts, backend, args) })
+	case "steps":
+		return withBackend(opts, func(backend Backend) error { return stepsCommand(opts, backend, args) })
+	case "import":
+		return withBackend(opts, func(backend Backend) error { return importCommand(opts, backend, args) })
+	case "export":
+		return withBackend(opts, func(backend Backend) error { return exportCommand(opts, backend, args) })
+	case "apikey":
+		return apiKeyCommand(opts, args)
+	case "help", "-h", "--help":
+		fs.Usage()
+		return nil
+	}
+
+	return fmt.Errorf("unknown command: %q (see `help`)", command)
+}
+
+func withBackend(opts options, fn func(backend Backend) error) error {
+	if opts.remote != "" {
+		return fn(newRemoteBackend(opts.remote, opts.apiKey))
+	}
+	return fn(newLocalBackend(openDb(opts.dbPath)))
+}
+
+func migrate(opts options) error {
+	openDb(opts.dbPath) // schema is migrated on open
+	fmt.Fprintf(opts.stdout, "Migrated %s\n", opts.dbPath)
+	return nil
+}
+
+func openDb(path string) *gorm.DB {
+	// SQLite creates the file, but not its directory
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		panic(err)
+	}
+	return config.SetupDb(path)
+}
+
+// parseArgs allows flags before & after positional arguments (`steps edit 5 --subject x`)
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func newFlagSet(name string, opts options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(opts.stdout)
+	return fs
+}
+
+func requireID(positional []string, what string) (uint, error) {
+	if len(positional) != 1 {
+		return 0, fmt.Errorf("exactly one %s ID expected", what)
+	}
+	id, err := api.StrToUint(positional[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s ID %q", what, positional[0])
+	}
+	return uint(id), nil
+}
+
+func subcommand(args []string, allowed ...string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("missing subcommand, one of: %s", strings.Join(allowed, ", "))
+	}
+	for _, name := range allowed {
+		if args[0] == name {
+			return args[0], args[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("unknown subcommand %q, one of: %s", args[0], strings.Join(allowed, ", "))
+}
@@ -0,0 +1,300 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/grpcapi"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/sitetester/sequence-api/config"
+	"gopkg.in/yaml.v3"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func serve(opts options, args []string) error {
+	fs := newFlagSet("serve", opts)
+	addr := fs.String("addr", ":8081", "listen address")
+	grpcAddr := fs.String("grpc-addr", ":9091", "gRPC listen address (empty to disable)")
+	schedulerInterval := fs.Duration("scheduler-interval", time.Minute, "how often due steps are sent")
+	from := fs.String("from", "sequences@localhost", "sender address of the emails")
+	publicURL := fs.String("public-url", "http://localhost:8081", "where this server is reachable from the outside (used in unsubscribe links)")
+	replyAddress := fs.String("reply-address", "", "Reply-To address, plus-tagged per enrollment to match replies (empty to disable)")
+	useSMTP := fs.Bool("smtp", false, "send through the SMTP server of each sequence's mailbox (emails are only logged otherwise)")
+	sendJitter := fs.Duration("send-jitter", 0, "random pause of up to this duration after each send")
+	maildir := fs.String("maildir", "", "maildir polled for replies (empty to disable)")
+	maildirInterval := fs.Duration("maildir-interval", time.Minute, "how often the maildir is polled")
+	jobInterval := fs.Duration("job-interval", 5*time.Second, "how often due background jobs (imports, webhook deliveries...) are started")
+	jobConcurrency := fs.Int("job-concurrency", 4, "background jobs run at once")
+	autoEnrollInterval := fs.Duration("auto-enroll-interval", 5*time.Minute, "how often sequences auto-enroll the members of their segment")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	envGinMode := config.DotEnvVar("EnvGinMode")
+	if envGinMode != "" {
+		gin.SetMode(envGinMode)
+	} else {
+		gin.SetMode(gin.DebugMode)
+	}
+
+	if gin.Mode() == gin.ReleaseMode {
+		config.SetupFileLogger()
+	}
+
+	db := openDb(opts.dbPath)
+	if *grpcAddr != "" {
+		listener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			return err
+		}
+		grpcServer := grpcapi.NewServer(db)
+		defer grpcServer.Stop()
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Printf("gRPC server stopped: %v", err)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var sender service.Sender = service.LogSender{}
+	if *useSMTP {
+		sender = service.SMTPSender{}
+	}
+	scheduler := service.NewScheduler(db, sender, *from, *publicURL)
+	scheduler.ReplyAddress = *replyAddress
+	scheduler.Jitter = *sendJitter
+	go scheduler.Run(ctx, *schedulerInterval)
+	go (&service.AutoEnrollService{Db: db}).Run(ctx, *autoEnrollInterval)
+	jobWorker := service.NewJobWorker(db)
+	jobWorker.Concurrency = *jobConcurrency
+	go jobWorker.Run(ctx, *jobInterval)
+	if *maildir != "" {
+		go (&service.MaildirPoller{Db: db, Dir: *maildir}).Run(ctx, *maildirInterval)
+	}
+
+	engine := config.SetupRouter(db)
+	return engine.Run(*addr)
+}
+
+func sequencesCommand(opts options, backend Backend, args []string) error {
+	name, args, err := subcommand(args, "list", "get", "create", "delete")
+	if err != nil {
+		return err
+	}
+
+	fs := newFlagSet("sequences "+name, opts)
+	var sequence api.Sequence
+	if name == "create" {
+		fs.StringVar(&sequence.Name, "name", "", "sequence name")
+		fs.BoolVar(&sequence.OpenTrackingEnabled, "open-tracking", false, "enable open tracking")
+		fs.BoolVar(&sequence.ClickTrackingEnabled, "click-tracking", false, "enable click tracking")
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "list":
+		sequences, err := backend.ListSequences()
+		if err != nil {
+			return err
+		}
+		return printSequences(opts, sequences)
+	case "get":
+		id, err := requireID(positional, "sequence")
+		if err != nil {
+			return err
+		}
+		sequenceWithSteps, err := backend.GetSequence(id)
+		if err != nil {
+			return err
+		}
+		return printSequenceWithSteps(opts, sequenceWithSteps)
+	case "create":
+		created, err := backend.CreateSequence(sequence)
+		if err != nil {
+			return err
+		}
+		return printSequences(opts, []api.Sequence{*created})
+	default: // delete
+		id, err := requireID(positional, "sequence")
+		if err != nil {
+			return err
+		}
+		if err := backend.DeleteSequence(id); err != nil {
+			return err
+		}
+		fmt.Fprintf(opts.stdout, "Deleted sequence %d\n", id)
+		return nil
+	}
+}
+
+func stepsCommand(opts options, backend Backend, args []string) error {
+	name, args, err := subcommand(args, "add", "edit", "rm")
+	if err != nil {
+		return err
+	}
+
+	fs := newFlagSet("steps "+name, opts)
+	var step api.SequenceStep
+	force := fs.Bool("force", false, "delete even if the sequence is active (rm only)")
+	if name != "rm" {
+		fs.UintVar(&step.SequenceID, "sequence", 0, "sequence ID (add only)")
+		fs.StringVar(&step.Subject, "subject", "", "email subject")
+		fs.StringVar(&step.Content, "content", "", "email content")
+		fs.UintVar(&step.Position, "position", 0, "position within the sequence")
+		fs.UintVar(&step.WaitDays, "wait-days", 0, "days to wait after the previous step")
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "add":
+		created, err := backend.AddStep(step)
+		if err != nil {
+			return err
+		}
+		return printSteps(opts, []api.SequenceStep{*created})
+	case "edit":
+		id, err := requireID(positional, "step")
+		if err != nil {
+			return err
+		}
+		foundStep, err := backend.GetStep(id)
+		if err != nil {
+			return err
+		}
+
+		// only flags which were given override the current values
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "subject":
+				foundStep.Subject = step.Subject
+			case "content":
+				foundStep.Content = step.Content
+			case "position":
+				foundStep.Position = step.Position
+			case "wait-days":
+				foundStep.WaitDays = step.WaitDays
+			}
+		})
+
+		updated, err := backend.EditStep(id, *foundStep)
+		if err != nil {
+			return err
+		}
+		return printSteps(opts, []api.SequenceStep{*updated})
+	default: // rm
+		id, err := requireID(positional, "step")
+		if err != nil {
+			return err
+		}
+		if err := backend.RemoveStep(id, *force); err != nil {
+			return err
+		}
+		fmt.Fprintf(opts.stdout, "Deleted step %d\n", id)
+		return nil
+	}
+}
+
+// importCommand the file format is picked by extension (.yaml/.yml or JSON otherwise)
+func importCommand(opts options, backend Backend, args []string) error {
+	fs := newFlagSet("import", opts)
+	dryRun := fs.Bool("dry-run", false, "only report what would change")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("exactly one file expected")
+	}
+
+	content, err := os.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+
+	var document api.SequenceDocument
+	switch filepath.Ext(positional[0]) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &document)
+	default:
+		err = json.Unmarshal(content, &document)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := backend.Import(document, *dryRun)
+	if err != nil {
+		return err
+	}
+	return printImportResult(opts, result)
+}
+
+// exportCommand always prints the document itself, `--output` doesn't apply
+func exportCommand(opts options, backend Backend, args []string) error {
+	fs := newFlagSet("export", opts)
+	format := fs.String("format", "json", "document format: json or yaml")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	id, err := requireID(positional, "sequence")
+	if err != nil {
+		return err
+	}
+
+	document, err := backend.Export(id)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		return printJSON(opts, document)
+	case "yaml":
+		encoder := yaml.NewEncoder(opts.stdout)
+		encoder.SetIndent(2)
+		return encoder.Encode(document)
+	}
+	return fmt.Errorf("unsupported format: %q", *format)
+}
+
+// apiKeyCommand keys can only be created with direct DB access
+func apiKeyCommand(opts options, args []string) error {
+	_, args, err := subcommand(args, "create")
+	if err != nil {
+		return err
+	}
+
+	fs := newFlagSet("apikey create", opts)
+	name := fs.String("name", "", "name describing the key owner/purpose")
+	workspace := fs.String("workspace", api.DefaultWorkspace, "workspace the key gives access to")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return errors.New("--name is required")
+	}
+	if opts.remote != "" {
+		return errors.New("API keys can only be created locally (without --remote)")
+	}
+
+	apiKeyService := service.ApiKeyService{Db: openDb(opts.dbPath)}
+	rawKey, apiKey := apiKeyService.CreateForWorkspace(*name, *workspace)
+	return printApiKey(opts, rawKey, apiKey)
+}
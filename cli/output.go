@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"strings"
+	"text/tabwriter"
+)
+
+func printJSON(opts options, v any) error {
+	encoder := json.NewEncoder(opts.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printTable first row is the header, columns are tab separated
+func printTable(opts options, rows [][]string) error {
+	writer := tabwriter.NewWriter(opts.stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+func printSequences(opts options, sequences []api.Sequence) error {
+	if opts.output == "json" {
+		return printJSON(opts, sequences)
+	}
+
+	rows := [][]string{{"ID", "NAME", "OPEN TRACKING", "CLICK TRACKING"}}
+	for _, sequence := range sequences {
+		rows = append(rows, []string{
+			fmt.Sprint(sequence.ID),
+			sequence.Name,
+			fmt.Sprint(sequence.OpenTrackingEnabled),
+			fmt.Sprint(sequence.ClickTrackingEnabled),
+		})
+	}
+	return printTable(opts, rows)
+}
+
+func printSequenceWithSteps(opts options, sequenceWithSteps *api.SequenceWithSteps) error {
+	if opts.output == "json" {
+		return printJSON(opts, sequenceWithSteps)
+	}
+
+	if err := printSequences(opts, []api.Sequence{*sequenceWithSteps.Sequence}); err != nil {
+		return err
+	}
+	fmt.Fprintln(opts.stdout)
+	return printSteps(opts, *sequenceWithSteps.Steps)
+}
+
+func printSteps(opts options, steps []api.SequenceStep) error {
+	if opts.output == "json" {
+		return printJSON(opts, steps)
+	}
+
+	rows := [][]string{{"ID", "SEQUENCE", "POSITION", "WAIT DAYS", "SUBJECT"}}
+	for _, step := range steps {
+		rows = append(rows, []string{
+			fmt.Sprint(step.ID),
+			fmt.Sprint(step.SequenceID),
+			fmt.Sprint(step.Position),
+			fmt.Sprint(step.WaitDays),
+			step.Subject,
+		})
+	}
+	return printTable(opts, rows)
+}
+
+func printImportResult(opts options, result *api.SequenceImportResult) error {
+	if opts.output == "json" {
+		return printJSON(opts, result)
+	}
+
+	prefix := ""
+	if result.DryRun {
+		prefix = "(dry run) "
+	}
+	fmt.Fprintf(opts.stdout, "%s%s sequence %d\n", prefix, result.Action, result.SequenceID)
+	for _, change := range result.Changes {
+		fmt.Fprintf(opts.stdout, "  - %s\n", change)
+	}
+	return nil
+}
+
+func printApiKey(opts options, rawKey string, apiKey *api.ApiKey) error {
+	if opts.output == "json" {
+		return printJSON(opts, map[string]any{"ApiKey": apiKey, "Key": rawKey})
+	}
+
+	fmt.Fprintf(opts.stdout, "Created API key %d (%s)\n", apiKey.ID, apiKey.Name)
+	fmt.Fprintf(opts.stdout, "Key: %s\n", rawKey)
+	fmt.Fprintln(opts.stdout, "Store it now, it can't be shown again.")
+	return nil
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/client"
+)
+
+// remoteBackend talks to a running API through the typed client
+type remoteBackend struct {
+	client *client.Client
+	ctx    context.Context
+}
+
+func newRemoteBackend(baseUrl string, apiKey string) *remoteBackend {
+	return &remoteBackend{
+		client: client.New(baseUrl, client.WithAPIKey(apiKey)),
+		ctx:    context.Background(),
+	}
+}
+
+func (rb *remoteBackend) ListSequences() ([]api.Sequence, error) {
+	return rb.client.ListSequences(rb.ctx)
+}
+
+func (rb *remoteBackend) GetSequence(id uint) (*api.SequenceWithSteps, error) {
+	return rb.client.GetSequence(rb.ctx, id)
+}
+
+func (rb *remoteBackend) CreateSequence(sequence api.Sequence) (*api.Sequence, error) {
+	return rb.client.CreateSequence(rb.ctx, sequence)
+}
+
+func (rb *remoteBackend) DeleteSequence(id uint) error {
+	return rb.client.DeleteSequence(rb.ctx, id)
+}
+
+func (rb *remoteBackend) GetStep(id uint) (*api.SequenceStep, error) {
+	return rb.client.GetStep(rb.ctx, id)
+}
+
+func (rb *remoteBackend) AddStep(step api.SequenceStep) (*api.SequenceStep, error) {
+	return rb.client.CreateStep(rb.ctx, step)
+}
+
+// EditStep `UpdateStep` of the client doesn't decode the updated step, so it's fetched again
+func (rb *remoteBackend) EditStep(id uint, step api.SequenceStep) (*api.SequenceStep, error) {
+	if err := rb.client.UpdateStep(rb.ctx, id, step); err != nil {
+		return nil, err
+	}
+	return rb.client.GetStep(rb.ctx, id)
+}
+
+func (rb *remoteBackend) RemoveStep(id uint, force bool) error {
+	return rb.client.DeleteStep(rb.ctx, id, force)
+}
+
+func (rb *remoteBackend) Import(document api.SequenceDocument, dryRun bool) (*api.SequenceImportResult, error) {
+	return rb.client.ImportSequence(rb.ctx, document, dryRun)
+}
+
+func (rb *remoteBackend) Export(id uint) (*api.SequenceDocument, error) {
+	return rb.client.ExportSequence(rb.ctx, id)
+}
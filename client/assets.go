@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"net/url"
+)
+
+func (c *Client) ListAssets(ctx context.Context) ([]api.Asset, error) {
+	var assets []api.Asset
+	err := c.Do(ctx, http.MethodGet, "/assets", nil, &assets)
+	return assets, err
+}
+
+// UploadAsset `content` is uploaded as is, the server sniffs its type (PDF or image)
+func (c *Client) UploadAsset(ctx context.Context, name string, content []byte) (*api.Asset, error) {
+	var asset api.Asset
+	query := url.Values{"name": {name}}
+	if err := c.do(ctx, http.MethodPost, "/assets?"+query.Encode(), "application/octet-stream", content, decodeJSON(&asset)); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (c *Client) GetAsset(ctx context.Context, id uint) (*api.Asset, error) {
+	var asset api.Asset
+	if err := c.Do(ctx, http.MethodGet, idPath("/assets/%d", id), nil, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (c *Client) GetAssetContent(ctx context.Context, id uint) ([]byte, error) {
+	var content []byte
+	err := c.do(ctx, http.MethodGet, idPath("/assets/%d/content", id), "", nil, readBody(&content))
+	return content, err
+}
+
+func (c *Client) DeleteAsset(ctx context.Context, id uint) error {
+	return c.Do(ctx, http.MethodDelete, idPath("/assets/%d", id), nil, nil)
+}
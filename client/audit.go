@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AuditFilter zero values are ignored
+type AuditFilter struct {
+	Entity   string
+	EntityID uint
+	From     time.Time
+	To       time.Time
+}
+
+func (c *Client) ListAudit(ctx context.Context, filter AuditFilter) ([]api.AuditRecord, error) {
+	query := url.Values{}
+	if filter.Entity != "" {
+		query.Set("entity", filter.Entity)
+	}
+	if filter.EntityID > 0 {
+		query.Set("entity_id", strconv.FormatUint(uint64(filter.EntityID), 10))
+	}
+	if !filter.From.IsZero() {
+		query.Set("from", filter.From.Format(time.RFC3339))
+	}
+	if !filter.To.IsZero() {
+		query.Set("to", filter.To.Format(time.RFC3339))
+	}
+
+	var records []api.AuditRecord
+	err := c.Do(ctx, http.MethodGet, "/audit?"+query.Encode(), nil, &records)
+	return records, err
+}
+
+// OpenAPI returns the raw OpenAPI 3 document
+func (c *Client) OpenAPI(ctx context.Context) (map[string]any, error) {
+	var document map[string]any
+	err := c.Do(ctx, http.MethodGet, "/openapi.json", nil, &document)
+	return document, err
+}
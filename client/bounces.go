@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"net/url"
+)
+
+// ListBounces `bounceType` is ignored when empty
+func (c *Client) ListBounces(ctx context.Context, bounceType string) ([]api.BounceEvent, error) {
+	path := "/bounces"
+	if bounceType != "" {
+		path += "?" + url.Values{"type": {bounceType}}.Encode()
+	}
+
+	var events []api.BounceEvent
+	err := c.Do(ctx, http.MethodGet, path, nil, &events)
+	return events, err
+}
+
+func (c *Client) ReportBounces(ctx context.Context, bounces []api.InboundBounce) ([]api.BounceEvent, error) {
+	var events []api.BounceEvent
+	err := c.Do(ctx, http.MethodPost, "/bounces", api.InboundBouncesRequest{Events: bounces}, &events)
+	return events, err
+}
+
+// ReportBounceMessage sends a DSN or ARF message as received, e.g. straight from the bounce mailbox
+func (c *Client) ReportBounceMessage(ctx context.Context, message []byte) ([]api.BounceEvent, error) {
+	var events []api.BounceEvent
+	err := c.do(ctx, http.MethodPost, "/bounces", "message/rfc822", message, decodeJSON(&events))
+	return events, err
+}
@@ -0,0 +1,181 @@
+// Package client is a typed Go client for the sequences API
+//
+//	c := client.New("http://localhost:8081", client.WithAPIKey(key))
+//	sequence, err := c.CreateSequence(ctx, api.Sequence{Name: "Onboarding"})
+//	if errors.Is(err, client.ErrConflict) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// kept in sync with `config.ApiVersion` & `middleware` headers, without importing the server side packages
+const (
+	apiVersion      = "/v1"
+	apiKeyHeader    = "X-Api-Key"
+	requestIDHeader = "X-Request-Id"
+)
+
+type Client struct {
+	baseUrl    string
+	apiKey     string
+	httpClient *http.Client
+	maxRetries int
+	retryWait  time.Duration
+}
+
+type Option func(*Client)
+
+// WithAPIKey sends the key as `X-Api-Key` header with every request
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) { c.apiKey = apiKey }
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetries idempotent requests (GET, PUT, DELETE) are retried on network errors, 429 & 5xx responses,
+// waiting `wait`, `2*wait`, `4*wait`... in between. Use `maxRetries = 0` to disable retries
+func WithRetries(maxRetries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryWait = wait
+	}
+}
+
+// New `baseUrl` is the server root (e.g. http://localhost:8081), the API version prefix is added
+func New(baseUrl string, options ...Option) *Client {
+	c := &Client{
+		baseUrl:    strings.TrimRight(baseUrl, "/") + apiVersion,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		maxRetries: 3,
+		retryWait:  100 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+type requestIDKey struct{}
+
+// WithRequestID the ID is sent as `X-Request-Id` header (and ends up in the audit log)
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// Do sends `in` as JSON body (when not nil) & decodes JSON response into `out` (when not nil)
+// Non 2xx responses are returned as `*Error`
+func (c *Client) Do(ctx context.Context, method string, path string, in any, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	return c.do(ctx, method, path, "application/json", body, decodeJSON(out))
+}
+
+// do `handle` is called for 2xx responses only
+func (c *Client) do(ctx context.Context, method string, path string, contentType string, body []byte, handle func(*http.Response) error) error {
+	attempts := 1
+	if isIdempotent(method) {
+		attempts += c.maxRetries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			wait := c.retryWait << (attempt - 1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		var retry bool
+		retry, err = c.attempt(ctx, method, path, contentType, body, handle)
+		if !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (c *Client) attempt(ctx context.Context, method string, path string, contentType string, body []byte, handle func(*http.Response) error) (bool, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.baseUrl+path, reader)
+	if err != nil {
+		return false, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		request.Header.Set(apiKeyHeader, c.apiKey)
+	}
+	if requestID, ok := ctx.Value(requestIDKey{}).(string); ok {
+		request.Header.Set(requestIDHeader, requestID)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		// a cancelled context isn't worth retrying
+		return ctx.Err() == nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return isRetryable(response.StatusCode), newError(response)
+	}
+	return false, handle(response)
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+func idPath(format string, id uint) string {
+	return fmt.Sprintf(format, id)
+}
+
+func decodeJSON(out any) func(*http.Response) error {
+	return func(response *http.Response) error {
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(response.Body).Decode(out)
+	}
+}
+
+func readBody(body *[]byte) func(*http.Response) error {
+	return func(response *http.Response) error {
+		var err error
+		*body, err = io.ReadAll(response.Body)
+		return err
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+func (c *Client) ListContacts(ctx context.Context) ([]api.Contact, error) {
+	var contacts []api.Contact
+	err := c.Do(ctx, http.MethodGet, "/contacts", nil, &contacts)
+	return contacts, err
+}
+
+func (c *Client) CreateContact(ctx context.Context, contact api.Contact) (*api.Contact, error) {
+	var created api.Contact
+	if err := c.Do(ctx, http.MethodPost, "/contacts", contact, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) GetContact(ctx context.Context, id uint) (*api.Contact, error) {
+	var contact api.Contact
+	if err := c.Do(ctx, http.MethodGet, idPath("/contacts/%d", id), nil, &contact); err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+func (c *Client) DeleteContact(ctx context.Context, id uint) error {
+	return c.Do(ctx, http.MethodDelete, idPath("/contacts/%d", id), nil, nil)
+}
+
+func (c *Client) ListEnrollments(ctx context.Context, sequenceID uint) ([]api.Enrollment, error) {
+	var enrollments []api.Enrollment
+	err := c.Do(ctx, http.MethodGet, idPath("/sequences/%d/enrollments", sequenceID), nil, &enrollments)
+	return enrollments, err
+}
+
+func (c *Client) Enroll(ctx context.Context, sequenceID uint, contactID uint) (*api.Enrollment, error) {
+	var enrollment api.Enrollment
+	request := api.EnrollmentRequest{ContactID: contactID}
+	if err := c.Do(ctx, http.MethodPost, idPath("/sequences/%d/enrollments", sequenceID), request, &enrollment); err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+func (c *Client) PauseEnrollment(ctx context.Context, sequenceID uint, enrollmentID uint) (*api.Enrollment, error) {
+	return c.changeEnrollment(ctx, sequenceID, enrollmentID, "pause")
+}
+
+// ResumeEnrollment the next step of the enrollment is shifted by the pause
+func (c *Client) ResumeEnrollment(ctx context.Context, sequenceID uint, enrollmentID uint) (*api.Enrollment, error) {
+	return c.changeEnrollment(ctx, sequenceID, enrollmentID, "resume")
+}
+
+func (c *Client) StopEnrollment(ctx context.Context, sequenceID uint, enrollmentID uint) (*api.Enrollment, error) {
+	return c.changeEnrollment(ctx, sequenceID, enrollmentID, "stop")
+}
+
+func (c *Client) changeEnrollment(ctx context.Context, sequenceID uint, enrollmentID uint, change string) (*api.Enrollment, error) {
+	var enrollment api.Enrollment
+	path := fmt.Sprintf("/sequences/%d/enrollments/%d/%s", sequenceID, enrollmentID, change)
+	if err := c.Do(ctx, http.MethodPost, path, nil, &enrollment); err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+func (c *Client) UpdateContact(ctx context.Context, id uint, contact api.Contact) (*api.Contact, error) {
+	var updated api.Contact
+	if err := c.Do(ctx, http.MethodPut, idPath("/contacts/%d", id), contact, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// ImportContactsCSV uploads the CSV as is (e.g. straight from a file), the returned import is processed in the background
+// `options` carries the `Mapping` (column to field), `Existing` & `SequenceID` of the import
+func (c *Client) ImportContactsCSV(ctx context.Context, csv []byte, options api.ContactImport) (*api.ContactImport, error) {
+	query := url.Values{}
+	for column, field := range options.Mapping {
+		query.Set("map["+column+"]", field)
+	}
+	if options.Existing != "" {
+		query.Set("existing", options.Existing)
+	}
+	if options.SequenceID != 0 {
+		query.Set("sequence_id", strconv.FormatUint(uint64(options.SequenceID), 10))
+	}
+
+	var contactImport api.ContactImport
+	if err := c.do(ctx, http.MethodPost, "/contacts/import?"+query.Encode(), "text/csv", csv, decodeJSON(&contactImport)); err != nil {
+		return nil, err
+	}
+	return &contactImport, nil
+}
+
+func (c *Client) GetContactImport(ctx context.Context, id uint) (*api.ContactImport, error) {
+	var contactImport api.ContactImport
+	if err := c.Do(ctx, http.MethodGet, idPath("/contacts/imports/%d", id), nil, &contactImport); err != nil {
+		return nil, err
+	}
+	return &contactImport, nil
+}
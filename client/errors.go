@@ -0,0 +1,55 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+)
+
+// Error is returned for non 2xx responses, `Message` comes from `api.ErrorResponse`
+type Error struct {
+	StatusCode int
+	Message    string
+	RequestID  string
+	// BatchResults per operation results of a rejected `BatchSteps` call
+	BatchResults []api.BatchStepResult
+}
+
+// Sentinels to be used with `errors.Is`, only the status code is compared
+var (
+	ErrBadRequest   = &Error{StatusCode: http.StatusBadRequest}
+	ErrUnauthorized = &Error{StatusCode: http.StatusUnauthorized}
+	ErrNotFound     = &Error{StatusCode: http.StatusNotFound}
+	ErrConflict     = &Error{StatusCode: http.StatusConflict}
+)
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.StatusCode == e.StatusCode
+}
+
+// errorBody `api.BatchStepsResponse` is a superset of `api.ErrorResponse`
+type errorBody struct {
+	Error   string
+	Results []api.BatchStepResult
+}
+
+func newError(response *http.Response) *Error {
+	var body errorBody
+	json.NewDecoder(response.Body).Decode(&body) // body isn't always JSON (e.g. 404 for unknown routes)
+
+	return &Error{
+		StatusCode:   response.StatusCode,
+		Message:      body.Error,
+		RequestID:    response.Header.Get(requestIDHeader),
+		BatchResults: body.Results,
+	}
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+)
+
+// GraphQL decodes `data` of the response into `data` (when not nil). Query & resolver errors
+// don't fail the request, they are returned alongside the (partial) data
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]any, data any) ([]api.GraphQLError, error) {
+	var response struct {
+		Data   json.RawMessage
+		Errors []api.GraphQLError
+	}
+	request := api.GraphQLRequest{Query: query, Variables: variables}
+	if err := c.Do(ctx, http.MethodPost, "/graphql", request, &response); err != nil {
+		return nil, err
+	}
+
+	if data != nil && len(response.Data) > 0 {
+		if err := json.Unmarshal(response.Data, data); err != nil {
+			return response.Errors, err
+		}
+	}
+	return response.Errors, nil
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"net/url"
+)
+
+// ListJobs `status` filters on it when not empty
+func (c *Client) ListJobs(ctx context.Context, status string) ([]api.Job, error) {
+	path := "/jobs"
+	if status != "" {
+		path += "?" + url.Values{"status": {status}}.Encode()
+	}
+
+	var jobs []api.Job
+	err := c.Do(ctx, http.MethodGet, path, nil, &jobs)
+	return jobs, err
+}
+
+func (c *Client) GetJob(ctx context.Context, id uint) (*api.Job, error) {
+	var job api.Job
+	if err := c.Do(ctx, http.MethodGet, idPath("/jobs/%d", id), nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *Client) CancelJob(ctx context.Context, id uint) (*api.Job, error) {
+	var job api.Job
+	if err := c.Do(ctx, http.MethodPost, idPath("/jobs/%d/cancel", id), nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *Client) RetryJob(ctx context.Context, id uint) (*api.Job, error) {
+	var job api.Job
+	if err := c.Do(ctx, http.MethodPost, idPath("/jobs/%d/retry", id), nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// QueueExport the document is the result of the returned job
+func (c *Client) QueueExport(ctx context.Context, sequenceID uint) (*api.Job, error) {
+	var job api.Job
+	if err := c.Do(ctx, http.MethodPost, idPath("/sequences/%d/export", sequenceID), nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// BulkEnroll the enrollments are made by the returned job
+func (c *Client) BulkEnroll(ctx context.Context, sequenceID uint, contactIDs []uint) (*api.Job, error) {
+	var job api.Job
+	request := api.BulkEnrollmentRequest{ContactIDs: contactIDs}
+	if err := c.Do(ctx, http.MethodPost, idPath("/sequences/%d/enrollments/bulk", sequenceID), request, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+)
+
+func (c *Client) ListMailboxes(ctx context.Context) ([]api.Mailbox, error) {
+	var mailboxes []api.Mailbox
+	err := c.Do(ctx, http.MethodGet, "/mailboxes", nil, &mailboxes)
+	return mailboxes, err
+}
+
+func (c *Client) CreateMailbox(ctx context.Context, mailbox api.Mailbox) (*api.Mailbox, error) {
+	var created api.Mailbox
+	if err := c.Do(ctx, http.MethodPost, "/mailboxes", mailbox, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) GetMailbox(ctx context.Context, id uint) (*api.Mailbox, error) {
+	var mailbox api.Mailbox
+	if err := c.Do(ctx, http.MethodGet, idPath("/mailboxes/%d", id), nil, &mailbox); err != nil {
+		return nil, err
+	}
+	return &mailbox, nil
+}
+
+// UpdateMailbox an empty `SMTPPassword` keeps the stored one
+func (c *Client) UpdateMailbox(ctx context.Context, id uint, mailbox api.Mailbox) (*api.Mailbox, error) {
+	var updated api.Mailbox
+	if err := c.Do(ctx, http.MethodPut, idPath("/mailboxes/%d", id), mailbox, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (c *Client) DeleteMailbox(ctx context.Context, id uint) error {
+	return c.Do(ctx, http.MethodDelete, idPath("/mailboxes/%d", id), nil, nil)
+}
+
+func (c *Client) GetSequenceMailboxes(ctx context.Context, sequenceID uint) (*api.SequenceMailboxes, error) {
+	var assignment api.SequenceMailboxes
+	if err := c.Do(ctx, http.MethodGet, idPath("/sequences/%d/mailboxes", sequenceID), nil, &assignment); err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+func (c *Client) UpdateSequenceMailboxes(ctx context.Context, sequenceID uint, assignment api.SequenceMailboxes) (*api.SequenceMailboxes, error) {
+	var updated api.SequenceMailboxes
+	if err := c.Do(ctx, http.MethodPut, idPath("/sequences/%d/mailboxes", sequenceID), assignment, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
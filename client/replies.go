@@ -0,0 +1,22 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+)
+
+func (c *Client) ListReplies(ctx context.Context) ([]api.Reply, error) {
+	var replies []api.Reply
+	err := c.Do(ctx, http.MethodGet, "/replies", nil, &replies)
+	return replies, err
+}
+
+// ReportReply sends an inbound email as received (raw MIME)
+func (c *Client) ReportReply(ctx context.Context, message []byte) (*api.InboundReplyResult, error) {
+	var result api.InboundReplyResult
+	if err := c.do(ctx, http.MethodPost, "/replies", "message/rfc822", message, decodeJSON(&result)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func (c *Client) UpdateSequenceSchedule(ctx context.Context, id uint, schedule api.SendSchedule) (*api.Sequence, error) {
+	var sequence api.Sequence
+	if err := c.Do(ctx, http.MethodPut, idPath("/sequences/%d/schedule", id), schedule, &sequence); err != nil {
+		return nil, err
+	}
+	return &sequence, nil
+}
+
+// PreviewSends `start` is the assumed enrollment time, now when zero
+func (c *Client) PreviewSends(ctx context.Context, sequenceID uint, contactID uint, start time.Time) ([]api.SendPreview, error) {
+	query := url.Values{"contact_id": {fmt.Sprint(contactID)}}
+	if !start.IsZero() {
+		query.Set("start", start.Format(time.RFC3339))
+	}
+
+	var previews []api.SendPreview
+	err := c.Do(ctx, http.MethodGet, idPath("/sequences/%d/preview", sequenceID)+"?"+query.Encode(), nil, &previews)
+	return previews, err
+}
+
+func (c *Client) ListHolidayCalendars(ctx context.Context) ([]api.HolidayCalendar, error) {
+	var calendars []api.HolidayCalendar
+	err := c.Do(ctx, http.MethodGet, "/holiday-calendars", nil, &calendars)
+	return calendars, err
+}
+
+func (c *Client) CreateHolidayCalendar(ctx context.Context, calendar api.HolidayCalendar) (*api.HolidayCalendar, error) {
+	var created api.HolidayCalendar
+	if err := c.Do(ctx, http.MethodPost, "/holiday-calendars", calendar, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) GetHolidayCalendar(ctx context.Context, id uint) (*api.HolidayCalendar, error) {
+	var calendar api.HolidayCalendar
+	if err := c.Do(ctx, http.MethodGet, idPath("/holiday-calendars/%d", id), nil, &calendar); err != nil {
+		return nil, err
+	}
+	return &calendar, nil
+}
+
+func (c *Client) UpdateHolidayCalendar(ctx context.Context, id uint, calendar api.HolidayCalendar) (*api.HolidayCalendar, error) {
+	var updated api.HolidayCalendar
+	if err := c.Do(ctx, http.MethodPut, idPath("/holiday-calendars/%d", id), calendar, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (c *Client) DeleteHolidayCalendar(ctx context.Context, id uint) error {
+	return c.Do(ctx, http.MethodDelete, idPath("/holiday-calendars/%d", id), nil, nil)
+}
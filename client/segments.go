@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+)
+
+func (c *Client) ListSegments(ctx context.Context) ([]api.Segment, error) {
+	var segments []api.Segment
+	err := c.Do(ctx, http.MethodGet, "/segments", nil, &segments)
+	return segments, err
+}
+
+func (c *Client) CreateSegment(ctx context.Context, segment api.Segment) (*api.Segment, error) {
+	var created api.Segment
+	if err := c.Do(ctx, http.MethodPost, "/segments", segment, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) GetSegment(ctx context.Context, id uint) (*api.Segment, error) {
+	var segment api.Segment
+	if err := c.Do(ctx, http.MethodGet, idPath("/segments/%d", id), nil, &segment); err != nil {
+		return nil, err
+	}
+	return &segment, nil
+}
+
+func (c *Client) UpdateSegment(ctx context.Context, id uint, segment api.Segment) (*api.Segment, error) {
+	var updated api.Segment
+	if err := c.Do(ctx, http.MethodPut, idPath("/segments/%d", id), segment, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (c *Client) DeleteSegment(ctx context.Context, id uint) error {
+	return c.Do(ctx, http.MethodDelete, idPath("/segments/%d", id), nil, nil)
+}
+
+func (c *Client) ListSegmentContacts(ctx context.Context, id uint) ([]api.Contact, error) {
+	var contacts []api.Contact
+	err := c.Do(ctx, http.MethodGet, idPath("/segments/%d/contacts", id), nil, &contacts)
+	return contacts, err
+}
+
+// UpdateAutoEnrollment enrolls the current members of the segment right away
+func (c *Client) UpdateAutoEnrollment(ctx context.Context, sequenceID uint, settings api.AutoEnrollment) (*api.Sequence, error) {
+	var sequence api.Sequence
+	if err := c.Do(ctx, http.MethodPut, idPath("/sequences/%d/auto-enrollment", sequenceID), settings, &sequence); err != nil {
+		return nil, err
+	}
+	return &sequence, nil
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+)
+
+func (c *Client) ListSequences(ctx context.Context) ([]api.Sequence, error) {
+	var sequences []api.Sequence
+	err := c.Do(ctx, http.MethodGet, "/sequences", nil, &sequences)
+	return sequences, err
+}
+
+func (c *Client) CreateSequence(ctx context.Context, sequence api.Sequence) (*api.Sequence, error) {
+	var created api.Sequence
+	if err := c.Do(ctx, http.MethodPost, "/sequences", sequence, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) UpdateSequence(ctx context.Context, id uint, sequence api.Sequence) error {
+	return c.Do(ctx, http.MethodPut, idPath("/sequences/%d", id), sequence, nil)
+}
+
+func (c *Client) GetSequence(ctx context.Context, id uint) (*api.SequenceWithSteps, error) {
+	var sequenceWithSteps api.SequenceWithSteps
+	if err := c.Do(ctx, http.MethodGet, idPath("/sequences/%d", id), nil, &sequenceWithSteps); err != nil {
+		return nil, err
+	}
+	return &sequenceWithSteps, nil
+}
+
+// DeleteSequence deletes the steps of the sequence too
+func (c *Client) DeleteSequence(ctx context.Context, id uint) error {
+	return c.Do(ctx, http.MethodDelete, idPath("/sequences/%d", id), nil, nil)
+}
+
+func (c *Client) GetSequenceStats(ctx context.Context, id uint) (*api.SequenceStats, error) {
+	var stats api.SequenceStats
+	if err := c.Do(ctx, http.MethodGet, idPath("/sequences/%d/stats", id), nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *Client) ExportSequence(ctx context.Context, id uint) (*api.SequenceDocument, error) {
+	var document api.SequenceDocument
+	if err := c.Do(ctx, http.MethodGet, idPath("/sequences/%d/export", id), nil, &document); err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+func (c *Client) ExportSequenceYAML(ctx context.Context, id uint) ([]byte, error) {
+	var body []byte
+	err := c.do(ctx, http.MethodGet, idPath("/sequences/%d/export?format=yaml", id), "", nil, readBody(&body))
+	return body, err
+}
+
+func (c *Client) ImportSequence(ctx context.Context, document api.SequenceDocument, dryRun bool) (*api.SequenceImportResult, error) {
+	var result api.SequenceImportResult
+	if err := c.Do(ctx, http.MethodPost, importPath(dryRun), document, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ImportSequenceYAML sends the document as is, e.g. straight from a file
+func (c *Client) ImportSequenceYAML(ctx context.Context, document []byte, dryRun bool) (*api.SequenceImportResult, error) {
+	var result api.SequenceImportResult
+	err := c.do(ctx, http.MethodPost, importPath(dryRun), "application/yaml", document, decodeJSON(&result))
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func importPath(dryRun bool) string {
+	return fmt.Sprintf("/sequences/import?dry_run=%t", dryRun)
+}
+
+func (c *Client) GetSequenceEdges(ctx context.Context, sequenceID uint) (*api.SequenceGraph, error) {
+	var graph api.SequenceGraph
+	if err := c.Do(ctx, http.MethodGet, idPath("/sequences/%d/edges", sequenceID), nil, &graph); err != nil {
+		return nil, err
+	}
+	return &graph, nil
+}
+
+// UpdateSequenceEdges replaces every edge of the sequence
+func (c *Client) UpdateSequenceEdges(ctx context.Context, sequenceID uint, graph api.SequenceGraph) (*api.SequenceGraph, error) {
+	var updated api.SequenceGraph
+	if err := c.Do(ctx, http.MethodPut, idPath("/sequences/%d/edges", sequenceID), graph, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// ActivateSequence starts sending the steps of a draft
+func (c *Client) ActivateSequence(ctx context.Context, id uint) (*api.Sequence, error) {
+	return c.transitionSequence(ctx, id, "activate")
+}
+
+// PauseSequence holds every step of an active sequence until it's resumed
+func (c *Client) PauseSequence(ctx context.Context, id uint) (*api.Sequence, error) {
+	return c.transitionSequence(ctx, id, "pause")
+}
+
+// ResumeSequence due times of the enrollments are shifted by the pause
+func (c *Client) ResumeSequence(ctx context.Context, id uint) (*api.Sequence, error) {
+	return c.transitionSequence(ctx, id, "resume")
+}
+
+func (c *Client) ArchiveSequence(ctx context.Context, id uint) (*api.Sequence, error) {
+	return c.transitionSequence(ctx, id, "archive")
+}
+
+func (c *Client) transitionSequence(ctx context.Context, id uint, transition string) (*api.Sequence, error) {
+	var sequence api.Sequence
+	if err := c.Do(ctx, http.MethodPost, idPath("/sequences/%d/", id)+transition, nil, &sequence); err != nil {
+		return nil, err
+	}
+	return &sequence, nil
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+)
+
+func (c *Client) CreateStep(ctx context.Context, step api.SequenceStep) (*api.SequenceStep, error) {
+	var created api.SequenceStep
+	if err := c.Do(ctx, http.MethodPost, "/sequence-steps", step, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) UpdateStep(ctx context.Context, id uint, step api.SequenceStep) error {
+	return c.Do(ctx, http.MethodPut, idPath("/sequence-steps/%d", id), step, nil)
+}
+
+func (c *Client) GetStep(ctx context.Context, id uint) (*api.SequenceStep, error) {
+	var step api.SequenceStep
+	if err := c.Do(ctx, http.MethodGet, idPath("/sequence-steps/%d", id), nil, &step); err != nil {
+		return nil, err
+	}
+	return &step, nil
+}
+
+// PreviewStep renders an email step for the contact, along with its lint report
+func (c *Client) PreviewStep(ctx context.Context, id uint, contactID uint) (*api.StepPreview, error) {
+	var preview api.StepPreview
+	if err := c.Do(ctx, http.MethodGet, idPath("/sequence-steps/%d/preview", id)+"?contact_id="+fmt.Sprint(contactID), nil, &preview); err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// DeleteStep steps of an active sequence are only deleted with `force`
+func (c *Client) DeleteStep(ctx context.Context, id uint, force bool) error {
+	path := idPath("/sequence-steps/%d", id)
+	if force {
+		path += "?force=true"
+	}
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// BatchSteps is never retried (not idempotent). A rejected batch returns `*Error` with `BatchResults`
+func (c *Client) BatchSteps(ctx context.Context, sequenceID uint, batchRequest api.BatchStepsRequest) (*api.BatchStepsResponse, error) {
+	var batchResponse api.BatchStepsResponse
+	if err := c.Do(ctx, http.MethodPost, idPath("/sequences/%d/steps:batch", sequenceID), batchRequest, &batchResponse); err != nil {
+		return nil, err
+	}
+	return &batchResponse, nil
+}
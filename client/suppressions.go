@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"net/url"
+)
+
+// ListSuppressions `reason` is ignored when empty
+func (c *Client) ListSuppressions(ctx context.Context, reason string) ([]api.Suppression, error) {
+	path := "/suppressions"
+	if reason != "" {
+		path += "?" + url.Values{"reason": {reason}}.Encode()
+	}
+
+	var suppressions []api.Suppression
+	err := c.Do(ctx, http.MethodGet, path, nil, &suppressions)
+	return suppressions, err
+}
+
+func (c *Client) CreateSuppression(ctx context.Context, suppression api.Suppression) (*api.Suppression, error) {
+	var created api.Suppression
+	if err := c.Do(ctx, http.MethodPost, "/suppressions", suppression, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) DeleteSuppression(ctx context.Context, id uint) error {
+	return c.Do(ctx, http.MethodDelete, idPath("/suppressions/%d", id), nil, nil)
+}
+
+// ImportSuppressionsCSV sends `email[,reason]` lines as is, e.g. straight from a file
+func (c *Client) ImportSuppressionsCSV(ctx context.Context, csv []byte) (*api.SuppressionImportResult, error) {
+	var result api.SuppressionImportResult
+	if err := c.do(ctx, http.MethodPost, "/suppressions/import", "text/csv", csv, decodeJSON(&result)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ExportSuppressionsCSV(ctx context.Context) ([]byte, error) {
+	var body []byte
+	err := c.do(ctx, http.MethodGet, "/suppressions/export", "", nil, readBody(&body))
+	return body, err
+}
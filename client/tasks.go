@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"net/url"
+)
+
+// ListTasks `status` defaults to open when empty
+func (c *Client) ListTasks(ctx context.Context, status string) ([]api.Task, error) {
+	path := "/tasks"
+	if status != "" {
+		path += "?" + url.Values{"status": {status}}.Encode()
+	}
+
+	var tasks []api.Task
+	err := c.Do(ctx, http.MethodGet, path, nil, &tasks)
+	return tasks, err
+}
+
+func (c *Client) GetTask(ctx context.Context, id uint) (*api.Task, error) {
+	var task api.Task
+	if err := c.Do(ctx, http.MethodGet, idPath("/tasks/%d", id), nil, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (c *Client) CompleteTask(ctx context.Context, id uint) (*api.Task, error) {
+	var task api.Task
+	if err := c.Do(ctx, http.MethodPost, idPath("/tasks/%d/complete", id), nil, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (c *Client) SkipTask(ctx context.Context, id uint) (*api.Task, error) {
+	var task api.Task
+	if err := c.Do(ctx, http.MethodPost, idPath("/tasks/%d/skip", id), nil, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+)
+
+func (c *Client) ListThrottles(ctx context.Context) ([]api.Throttle, error) {
+	var throttles []api.Throttle
+	err := c.Do(ctx, http.MethodGet, "/throttles", nil, &throttles)
+	return throttles, err
+}
+
+func (c *Client) CreateThrottle(ctx context.Context, throttle api.Throttle) (*api.Throttle, error) {
+	var created api.Throttle
+	if err := c.Do(ctx, http.MethodPost, "/throttles", throttle, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) DeleteThrottle(ctx context.Context, id uint) error {
+	return c.Do(ctx, http.MethodDelete, idPath("/throttles/%d", id), nil, nil)
+}
+
+func (c *Client) GetThrottleUsage(ctx context.Context) ([]api.ThrottleUsage, error) {
+	var usage []api.ThrottleUsage
+	err := c.Do(ctx, http.MethodGet, "/throttles/usage", nil, &usage)
+	return usage, err
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+)
+
+func variantPath(stepID uint, variantID uint) string {
+	return fmt.Sprintf("/sequence-steps/%d/variants/%d", stepID, variantID)
+}
+
+func (c *Client) ListVariants(ctx context.Context, stepID uint) ([]api.StepVariant, error) {
+	var variants []api.StepVariant
+	err := c.Do(ctx, http.MethodGet, idPath("/sequence-steps/%d/variants", stepID), nil, &variants)
+	return variants, err
+}
+
+func (c *Client) CreateVariant(ctx context.Context, stepID uint, variant api.StepVariant) (*api.StepVariant, error) {
+	var created api.StepVariant
+	if err := c.Do(ctx, http.MethodPost, idPath("/sequence-steps/%d/variants", stepID), variant, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) UpdateVariant(ctx context.Context, stepID uint, variantID uint, variant api.StepVariant) (*api.StepVariant, error) {
+	var updated api.StepVariant
+	if err := c.Do(ctx, http.MethodPut, variantPath(stepID, variantID), variant, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (c *Client) DeleteVariant(ctx context.Context, stepID uint, variantID uint) error {
+	return c.Do(ctx, http.MethodDelete, variantPath(stepID, variantID), nil, nil)
+}
+
+func (c *Client) UpdateVariantPromotion(ctx context.Context, stepID uint, promotion api.VariantPromotion) (*api.SequenceStep, error) {
+	var step api.SequenceStep
+	if err := c.Do(ctx, http.MethodPut, idPath("/sequence-steps/%d/promotion", stepID), promotion, &step); err != nil {
+		return nil, err
+	}
+	return &step, nil
+}
+
+func (c *Client) GetVariantStats(ctx context.Context, stepID uint) ([]api.VariantStats, error) {
+	var stats []api.VariantStats
+	err := c.Do(ctx, http.MethodGet, idPath("/sequence-steps/%d/variant-stats", stepID), nil, &stats)
+	return stats, err
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"net/http"
+	"net/url"
+)
+
+func (c *Client) ListWebhooks(ctx context.Context) ([]api.WebhookSubscription, error) {
+	var subscriptions []api.WebhookSubscription
+	err := c.Do(ctx, http.MethodGet, "/webhooks", nil, &subscriptions)
+	return subscriptions, err
+}
+
+// CreateWebhook the returned subscription is the only one holding the `Secret`
+func (c *Client) CreateWebhook(ctx context.Context, subscription api.WebhookSubscription) (*api.WebhookSubscription, error) {
+	var created api.WebhookSubscription
+	if err := c.Do(ctx, http.MethodPost, "/webhooks", subscription, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) GetWebhook(ctx context.Context, id uint) (*api.WebhookSubscription, error) {
+	var subscription api.WebhookSubscription
+	if err := c.Do(ctx, http.MethodGet, idPath("/webhooks/%d", id), nil, &subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (c *Client) UpdateWebhook(ctx context.Context, id uint, subscription api.WebhookSubscription) (*api.WebhookSubscription, error) {
+	var updated api.WebhookSubscription
+	if err := c.Do(ctx, http.MethodPut, idPath("/webhooks/%d", id), subscription, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id uint) error {
+	return c.Do(ctx, http.MethodDelete, idPath("/webhooks/%d", id), nil, nil)
+}
+
+// ListWebhookDeliveries `status` is ignored when empty
+func (c *Client) ListWebhookDeliveries(ctx context.Context, id uint, status string) ([]api.WebhookDelivery, error) {
+	path := idPath("/webhooks/%d/deliveries", id)
+	if status != "" {
+		path += "?" + url.Values{"status": {status}}.Encode()
+	}
+
+	var deliveries []api.WebhookDelivery
+	err := c.Do(ctx, http.MethodGet, path, nil, &deliveries)
+	return deliveries, err
+}
+
+func (c *Client) RedeliverWebhook(ctx context.Context, id uint, deliveryID uint) (*api.WebhookDelivery, error) {
+	var delivery api.WebhookDelivery
+	path := fmt.Sprintf("/webhooks/%d/deliveries/%d/redeliver", id, deliveryID)
+	if err := c.Do(ctx, http.MethodPost, path, nil, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
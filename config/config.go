@@ -5,6 +5,8 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/sitetester/sequence-api/api"
 	"github.com/sitetester/sequence-api/api/controller"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/openapi"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"io"
@@ -41,6 +43,29 @@ func SetupDb(path string) *gorm.DB {
 	// Migrate the schema
 	db.AutoMigrate(&api.Sequence{})
 	db.AutoMigrate(&api.SequenceStep{})
+	db.AutoMigrate(&api.AuditRecord{})
+	db.AutoMigrate(&api.ApiKey{})
+	db.AutoMigrate(&api.WebhookSubscription{})
+	db.AutoMigrate(&api.WebhookDelivery{})
+	db.AutoMigrate(&api.Setting{})
+	db.AutoMigrate(&api.Contact{})
+	db.AutoMigrate(&api.Enrollment{})
+	db.AutoMigrate(&api.EmailSend{})
+	db.AutoMigrate(&api.Suppression{})
+	db.AutoMigrate(&api.BounceEvent{})
+	db.AutoMigrate(&api.Reply{})
+	db.AutoMigrate(&api.HolidayCalendar{})
+	db.AutoMigrate(&api.Throttle{})
+	db.AutoMigrate(&api.RateBucket{})
+	db.AutoMigrate(&api.Mailbox{})
+	db.AutoMigrate(&api.SequenceMailbox{})
+	db.AutoMigrate(&api.StepVariant{})
+	db.AutoMigrate(&api.StepEdge{})
+	db.AutoMigrate(&api.Task{})
+	db.AutoMigrate(&api.Segment{})
+	db.AutoMigrate(&api.ContactImport{})
+	db.AutoMigrate(&api.Job{})
+	db.AutoMigrate(&api.Asset{})
 
 	return db
 }
@@ -51,9 +76,34 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 	engine := gin.Default()
 	// Recovery middleware recovers from any panics and writes a 500 if there was one.
 	engine.Use(gin.Recovery())
+	engine.Use(middleware.RequestID(), middleware.Actor(db))
 
 	sequenceController := controller.NewSequenceController(db)
 	sequenceStepsController := controller.NewSequenceStepsController(db)
+	auditController := controller.NewAuditController(db)
+	graphQLController := controller.NewGraphQLController(db)
+	webhookController := controller.NewWebhookController(db)
+	contactController := controller.NewContactController(db)
+	suppressionController := controller.NewSuppressionController(db)
+	unsubscribeController := controller.NewUnsubscribeController(db)
+	bounceController := controller.NewBounceController(db)
+	replyController := controller.NewReplyController(db)
+	holidayCalendarController := controller.NewHolidayCalendarController(db)
+	throttleController := controller.NewThrottleController(db)
+	assetController := controller.NewAssetController(db)
+	mailboxController := controller.NewMailboxController(db)
+	variantController := controller.NewVariantController(db)
+	trackingController := controller.NewTrackingController(db)
+	taskController := controller.NewTaskController(db)
+	segmentController := controller.NewSegmentController(db)
+	jobController := controller.NewJobController(db)
+
+	// Public unsubscribe link of every email (outside the API version group, it's part of sent emails)
+	engine.GET("/u/:token", unsubscribeController.Confirm)
+	engine.POST("/u/:token", unsubscribeController.Unsubscribe)
+	// Open tracking pixel & tracked links (when enabled for the sequence)
+	engine.GET("/o/:token", trackingController.Open)
+	engine.GET("/c/:token", trackingController.Click)
 
 	// WARNING! Currently, there is no authentication/authorization for this API
 	// Some kind of token/key must be provided to avoid data loss
@@ -62,18 +112,137 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		// http://localhost:8081/api/v1/
 		// Or http://127.0.0.1:8081/api/v1/
 		v1.GET("/", func(ctx *gin.Context) { ctx.String(200, "It works!") })
+		v1.GET("/openapi.json", func(ctx *gin.Context) { ctx.JSON(200, openapi.Document(ApiVersion)) })
 
 		// Sequences
+		v1.GET("/sequences", sequenceController.List)
 		v1.POST("/sequences", sequenceController.Create)
+		v1.POST("/sequences/import", sequenceController.Import)
 		v1.PUT("/sequences/:id", sequenceController.Update)
 		v1.GET("/sequences/:id", sequenceController.ViewWithSteps)
+		v1.DELETE("/sequences/:id", sequenceController.Delete)
+		v1.GET("/sequences/:id/export", sequenceController.Export)
+		v1.POST("/sequences/:id/export", sequenceController.QueueExport)
+		v1.GET("/sequences/:id/stats", sequenceController.Stats)
+		v1.PUT("/sequences/:id/schedule", sequenceController.UpdateSchedule)
+		v1.GET("/sequences/:id/preview", sequenceController.Preview)
+		v1.GET("/sequences/:id/mailboxes", sequenceController.Mailboxes)
+		v1.PUT("/sequences/:id/mailboxes", sequenceController.UpdateMailboxes)
+		v1.GET("/sequences/:id/edges", sequenceController.Edges)
+		v1.PUT("/sequences/:id/edges", sequenceController.UpdateEdges)
+		v1.PUT("/sequences/:id/auto-enrollment", sequenceController.UpdateAutoEnrollment)
+		v1.POST("/sequences/:id/activate", sequenceController.Activate)
+		v1.POST("/sequences/:id/pause", sequenceController.Pause)
+		v1.POST("/sequences/:id/resume", sequenceController.Resume)
+		v1.POST("/sequences/:id/archive", sequenceController.Archive)
+		v1.POST("/sequences/:id/steps:action", sequenceStepsController.Batch) // steps:batch
+		v1.GET("/sequences/:id/enrollments", contactController.Enrollments)
+		v1.POST("/sequences/:id/enrollments", contactController.Enroll)
+		v1.POST("/sequences/:id/enrollments/bulk", contactController.BulkEnroll)
+		v1.POST("/sequences/:id/enrollments/:enrollmentID/pause", contactController.PauseEnrollment)
+		v1.POST("/sequences/:id/enrollments/:enrollmentID/resume", contactController.ResumeEnrollment)
+		v1.POST("/sequences/:id/enrollments/:enrollmentID/stop", contactController.StopEnrollment)
 
 		// Steps
 		v1.POST("/sequence-steps", sequenceStepsController.Create)
 		v1.PUT("/sequence-steps/:id", sequenceStepsController.Update)
 		v1.DELETE("/sequence-steps/:id", sequenceStepsController.Delete)
 		v1.GET("/sequence-steps/:id", sequenceStepsController.View)
+		v1.GET("/sequence-steps/:id/preview", sequenceStepsController.Preview)
+
+		// A/B variants of a step
+		v1.GET("/sequence-steps/:id/variants", variantController.List)
+		v1.POST("/sequence-steps/:id/variants", variantController.Create)
+		v1.PUT("/sequence-steps/:id/variants/:variantID", variantController.Update)
+		v1.DELETE("/sequence-steps/:id/variants/:variantID", variantController.Delete)
+		v1.PUT("/sequence-steps/:id/promotion", variantController.UpdatePromotion)
+		v1.GET("/sequence-steps/:id/variant-stats", variantController.Stats)
+
+		// Audit log (read-only)
+		v1.GET("/audit", auditController.List)
+
+		// Webhooks
+		v1.GET("/webhooks", webhookController.List)
+		v1.POST("/webhooks", webhookController.Create)
+		v1.GET("/webhooks/:id", webhookController.View)
+		v1.PUT("/webhooks/:id", webhookController.Update)
+		v1.DELETE("/webhooks/:id", webhookController.Delete)
+		v1.GET("/webhooks/:id/deliveries", webhookController.Deliveries)
+		v1.POST("/webhooks/:id/deliveries/:deliveryID/redeliver", webhookController.Redeliver)
+
+		// Holiday calendars (referenced by sequence schedules)
+		v1.GET("/holiday-calendars", holidayCalendarController.List)
+		v1.POST("/holiday-calendars", holidayCalendarController.Create)
+		v1.GET("/holiday-calendars/:id", holidayCalendarController.View)
+		v1.PUT("/holiday-calendars/:id", holidayCalendarController.Update)
+		v1.DELETE("/holiday-calendars/:id", holidayCalendarController.Delete)
+
+		// Mailboxes (sending identities, assigned to sequences)
+		v1.GET("/mailboxes", mailboxController.List)
+		v1.POST("/mailboxes", mailboxController.Create)
+		v1.GET("/mailboxes/:id", mailboxController.View)
+		v1.PUT("/mailboxes/:id", mailboxController.Update)
+		v1.DELETE("/mailboxes/:id", mailboxController.Delete)
+
+		// Files attached to (or inlined into) email steps
+		v1.GET("/assets", assetController.List)
+		v1.POST("/assets", assetController.Upload)
+		v1.GET("/assets/:id", assetController.View)
+		v1.GET("/assets/:id/content", assetController.Content)
+		v1.DELETE("/assets/:id", assetController.Delete)
+
+		// Send throttles (token buckets shared by all schedulers)
+		v1.GET("/throttles", throttleController.List)
+		v1.POST("/throttles", throttleController.Create)
+		v1.DELETE("/throttles/:id", throttleController.Delete)
+		v1.GET("/throttles/usage", throttleController.Usage)
+
+		// Contacts (scoped to the workspace of the API key)
+		v1.GET("/contacts", contactController.List)
+		v1.POST("/contacts", contactController.Create)
+		v1.GET("/contacts/:id", contactController.View)
+		v1.PUT("/contacts/:id", contactController.Update)
+		v1.DELETE("/contacts/:id", contactController.Delete)
+		v1.POST("/contacts/import", contactController.Import)
+		v1.GET("/contacts/imports/:id", contactController.ViewImport)
+
+		// Segments (saved contact filters, scoped to the workspace of the API key)
+		v1.GET("/segments", segmentController.List)
+		v1.POST("/segments", segmentController.Create)
+		v1.GET("/segments/:id", segmentController.View)
+		v1.PUT("/segments/:id", segmentController.Update)
+		v1.DELETE("/segments/:id", segmentController.Delete)
+		v1.GET("/segments/:id/contacts", segmentController.Contacts)
+
+		// Task inbox of manual steps (scoped to the workspace of the API key)
+		v1.GET("/tasks", taskController.List)
+		v1.GET("/tasks/:id", taskController.View)
+		v1.POST("/tasks/:id/complete", taskController.Complete)
+		v1.POST("/tasks/:id/skip", taskController.Skip)
+
+		// Background jobs (scoped to the workspace of the API key)
+		v1.GET("/jobs", jobController.List)
+		v1.GET("/jobs/:id", jobController.View)
+		v1.POST("/jobs/:id/cancel", jobController.Cancel)
+		v1.POST("/jobs/:id/retry", jobController.Retry)
+
+		// Suppression list (scoped to the workspace of the API key)
+		v1.GET("/suppressions", suppressionController.List)
+		v1.POST("/suppressions", suppressionController.Create)
+		v1.DELETE("/suppressions/:id", suppressionController.Delete)
+		v1.GET("/suppressions/export", suppressionController.Export)
+		v1.POST("/suppressions/import", suppressionController.Import)
+
+		// Bounces & complaints (DSN/ARF messages or normalized JSON events)
+		v1.GET("/bounces", bounceController.List)
+		v1.POST("/bounces", bounceController.Receive)
+
+		// Replies (raw MIME messages, matched to sent emails)
+		v1.GET("/replies", replyController.List)
+		v1.POST("/replies", replyController.Receive)
 
+		// GraphQL (queries & mutations over sequences and steps)
+		v1.POST("/graphql", graphQLController.Execute)
 	}
 
 	return engine
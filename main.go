@@ -1,27 +1,15 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
-	"github.com/sitetester/sequence-api/config"
+	"fmt"
+	"github.com/sitetester/sequence-api/cli"
+	"os"
 )
 
+// main without arguments starts the API (same as `serve`), see `help` for other commands
 func main() {
-	envGinMode := config.DotEnvVar("EnvGinMode")
-	if envGinMode != "" {
-		gin.SetMode(envGinMode)
-	} else {
-		gin.SetMode(gin.DebugMode)
-	}
-
-	if gin.Mode() == gin.ReleaseMode {
-		config.SetupFileLogger()
-	}
-
-	db := config.SetupDb("./db/sequences.db")
-	engine := config.SetupRouter(db)
-
-	err := engine.Run(":8081")
-	if err != nil {
-		panic(err)
+	if err := cli.Run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
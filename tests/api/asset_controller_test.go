@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"testing"
+	"time"
+)
+
+var (
+	testPDF = []byte("%PDF-1.4\n1 0 obj << /Type /Catalog >> endobj\ntrailer << /Root 1 0 R >>\n%%EOF\n")
+	testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+)
+
+// Will run sequentially
+func TestAssetController(t *testing.T) {
+	setupTestEnv()
+	t.Setenv(service.AssetDirEnv, t.TempDir())
+
+	assertions := assert.New(t)
+	var pdf, png *api.Asset
+
+	t.Run("Upload", func(t *testing.T) {
+		var err error
+		pdf, err = apiClient.UploadAsset(ctx, "One pager.pdf", testPDF)
+		checkNoError(t, err)
+		assertions.Equal("application/pdf", pdf.ContentType)
+		assertions.Equal(int64(len(testPDF)), pdf.Size)
+
+		png, err = apiClient.UploadAsset(ctx, "logo.png", testPNG)
+		checkNoError(t, err)
+		assertions.Equal("image/png", png.ContentType)
+
+		content, err := apiClient.GetAssetContent(ctx, pdf.ID)
+		checkNoError(t, err)
+		assertions.Equal(testPDF, content)
+	})
+
+	t.Run("UploadFailsForInvalidAssets", func(t *testing.T) {
+		_, err := apiClient.UploadAsset(ctx, "", testPDF)
+		checkFailsWithError(t, err, http.StatusBadRequest, "Name: non zero value required")
+
+		_, err = apiClient.UploadAsset(ctx, "notes.txt", []byte("just some notes"))
+		checkFailsWithError(t, err, http.StatusUnsupportedMediaType, "Asset is text/plain, must be one of application/pdf")
+
+		_, err = apiClient.UploadAsset(ctx, "huge.pdf", append(append([]byte{}, testPDF...), make([]byte, api.AssetMaxSize)...))
+		checkFailsWithError(t, err, http.StatusRequestEntityTooLarge, "Asset exceeds 5242880 bytes.")
+	})
+
+	sequenceID := createSequence(t, api.Sequence{Name: "AssetSequence1"})
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+	content := fmt.Sprintf(`<p>Hi {{first_name}}, our one pager is attached, have a look when you find a minute.</p><img src="cid:asset-%d" alt="Example">`, png.ID)
+
+	t.Run("CreateStepFailsForInvalidAssets", func(t *testing.T) {
+		_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Intro", Content: content, Attachments: []uint{999999}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Attachments: asset 999999 not found")
+
+		_, err = apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Intro", Content: fmt.Sprintf(`<img src="cid:asset-%d">`, pdf.ID)})
+		checkFailsWithError(t, err, http.StatusBadRequest, fmt.Sprintf("Content: asset %d is application/pdf, must be one of image/gif", pdf.ID))
+
+		_, err = apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Call", Type: api.StepTypeManualTask, Content: "Call them", Attachments: []uint{pdf.ID}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Attachments: only allowed for email steps")
+	})
+
+	step, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Intro", Content: content, Attachments: []uint{pdf.ID}})
+	checkNoError(t, err)
+	assertions.Equal([]uint{pdf.ID}, step.Attachments)
+
+	t.Run("DeleteFailsForAssetInUse", func(t *testing.T) {
+		checkFailsWithError(t, apiClient.DeleteAsset(ctx, pdf.ID), http.StatusConflict, "Asset is used by a step.")
+		checkFailsWithError(t, apiClient.DeleteAsset(ctx, png.ID), http.StatusConflict, "Asset is used by a step.")
+	})
+
+	t.Run("SendIncludesAssets", func(t *testing.T) {
+		_, err := apiClient.Enroll(ctx, sequenceID, createContact(t, "assets@example.com").ID)
+		checkNoError(t, err)
+
+		sender := &recordingSender{}
+		scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+		scheduler.Now = func() time.Time { return time.Now().UTC().Add(time.Hour) }
+		assertions.Equal(1, scheduler.RunDue(ctx))
+
+		email := sender.last()
+		if assertions.Len(email.Attachments, 2) {
+			assertions.Equal(service.Attachment{Name: "logo.png", ContentType: "image/png", ContentID: png.ContentID(), Content: testPNG}, email.Attachments[0])
+			assertions.Equal(service.Attachment{Name: "One pager.pdf", ContentType: "application/pdf", Content: testPDF}, email.Attachments[1])
+		}
+
+		// multipart/mixed: the alternative (text & related HTML with the inline image), then the PDF
+		message, err := mail.ReadMessage(bytes.NewReader(service.BuildMessage(email)))
+		checkNoError(t, err)
+		types := partTypes(t, message.Header.Get("Content-Type"), message.Body)
+		assertions.Equal([]string{"multipart/alternative", "text/plain", "multipart/related", "text/html", "image/png", "application/pdf"}, types)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		checkNoError(t, apiClient.DeleteStep(ctx, step.ID, true))
+		checkNoError(t, apiClient.DeleteAsset(ctx, pdf.ID))
+		checkNoError(t, apiClient.DeleteAsset(ctx, png.ID))
+
+		_, err := apiClient.GetAsset(ctx, pdf.ID)
+		checkFailsWithError(t, err, http.StatusNotFound, "Asset not found.")
+	})
+}
+
+// partTypes lists the media types of the (nested) parts of a multipart body, depth first
+func partTypes(t *testing.T, contentType string, body io.Reader) []string {
+	_, params, err := mime.ParseMediaType(contentType)
+	checkNoError(t, err)
+
+	var types []string
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		types = append(types, mediaType)
+		if mediaType == "multipart/related" || mediaType == "multipart/alternative" {
+			types = append(types, partTypes(t, part.Header.Get("Content-Type"), part)...)
+		}
+	}
+	return types
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/middleware"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/sitetester/sequence-api/client"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func fetchAuditRecords(t *testing.T, filter client.AuditFilter) []api.AuditRecord {
+	records, err := apiClient.ListAudit(ctx, filter)
+	checkNoError(t, err)
+	return records
+}
+
+// Will run sequentially
+func TestAudit(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	baseSequence := api.Sequence{
+		Name:                 "AuditSequence1",
+		OpenTrackingEnabled:  false,
+		ClickTrackingEnabled: true,
+	}
+	apiKeyService := service.ApiKeyService{Db: Db}
+	rawKey, apiKey := apiKeyService.Create("audit test")
+	keyClient := newTestClient(client.WithAPIKey(rawKey))
+
+	var sequenceID uint
+	t.Run("RecordsCreate", func(t *testing.T) {
+		deleteSequenceByName(baseSequence.Name)
+
+		sequenceResult, err := keyClient.CreateSequence(client.WithRequestID(ctx, "audit-request-1"), baseSequence)
+		checkNoError(t, err)
+		sequenceID = sequenceResult.ID
+
+		records := fetchAuditRecords(t, client.AuditFilter{Entity: api.AuditEntitySequence, EntityID: sequenceID})
+		if assertions.NotEmpty(records) {
+			record := records[len(records)-1]
+			assertions.Equal(api.AuditActionCreate, record.Action)
+			assertions.Equal("apikey:"+apiKey.Prefix, record.Actor)
+			assertions.Equal("audit-request-1", record.RequestID)
+			assertions.Empty(record.Before)
+			assertions.Contains(record.After, baseSequence.Name)
+		}
+	})
+
+	t.Run("FailsForInvalidApiKey", func(t *testing.T) {
+		_, err := newTestClient(client.WithAPIKey("sk_invalid")).CreateSequence(ctx, baseSequence)
+		assertions.ErrorIs(err, client.ErrUnauthorized)
+		checkFailsWithError(t, err, http.StatusUnauthorized, "Invalid API key.")
+	})
+
+	t.Run("RecordsUpdateWithBeforeAndAfter", func(t *testing.T) {
+		updateInput := baseSequence
+		updateInput.OpenTrackingEnabled = true
+		checkNoError(t, apiClient.UpdateSequence(ctx, sequenceID, updateInput))
+
+		records := fetchAuditRecords(t, client.AuditFilter{Entity: api.AuditEntitySequence, EntityID: sequenceID})
+		if assertions.NotEmpty(records) {
+			record := records[len(records)-1]
+			assertions.Equal(api.AuditActionUpdate, record.Action)
+			assertions.Equal(middleware.AnonymousActor, record.Actor)
+			assertions.NotEmpty(record.RequestID) // auto generated
+			assertions.Contains(record.Before, `"OpenTrackingEnabled":false`)
+			assertions.Contains(record.After, `"OpenTrackingEnabled":true`)
+		}
+	})
+
+	t.Run("FiltersByTime", func(t *testing.T) {
+		records := fetchAuditRecords(t, client.AuditFilter{EntityID: sequenceID, From: time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)})
+		assertions.Empty(records)
+	})
+
+	t.Run("FailsForInvalidTime", func(t *testing.T) {
+		err := apiClient.Do(ctx, http.MethodGet, "/audit?from=yesterday", nil, nil)
+		checkFailsWithError(t, err, http.StatusBadRequest, "cannot parse")
+	})
+
+	t.Run("RollsBackMutationWithoutRecord", func(t *testing.T) {
+		deleteSequenceByName("AuditSequence2")
+		failRecords := func(db *gorm.DB) {
+			if db.Statement.Table == "audit_records" {
+				_ = db.AddError(errors.New("audit log unavailable"))
+			}
+		}
+		checkNoError(t, Db.Callback().Create().Before("gorm:create").Register("test:fail_audit", failRecords))
+		defer func() { _ = Db.Callback().Create().Remove("test:fail_audit") }()
+
+		_, err := apiClient.CreateSequence(ctx, api.Sequence{Name: "AuditSequence2"})
+		checkFailsWithError(t, err, http.StatusInternalServerError, "audit log unavailable")
+		assertions.Zero((&service.SequenceService{Db: Db}).GetByName("AuditSequence2").ID)
+
+		err = apiClient.UpdateSequence(ctx, sequenceID, api.Sequence{Name: "AuditSequence2"})
+		checkFailsWithError(t, err, http.StatusInternalServerError, "audit log unavailable")
+		assertions.Equal(baseSequence.Name, (&service.SequenceService{Db: Db}).GetByID(sequenceID).Name)
+	})
+
+	t.Run("IsAppendOnly", func(t *testing.T) {
+		var record api.AuditRecord
+		Db.Where("entity_id = ?", sequenceID).First(&record)
+
+		assertions.ErrorIs(Db.Delete(&record).Error, api.ErrAuditAppendOnly)
+		record.Actor = "someone else"
+		assertions.ErrorIs(Db.Save(&record).Error, api.ErrAuditAppendOnly)
+	})
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readReport fills in the recipient & `Message-ID` of the bounced email
+func readReport(t *testing.T, name string, email string, messageID string) []byte {
+	content, err := os.ReadFile("testdata/" + name)
+	checkNoError(t, err)
+	return []byte(strings.NewReplacer("{{EMAIL}}", email, "{{MESSAGE_ID}}", messageID).Replace(string(content)))
+}
+
+func lastMessageID(t *testing.T, contactID uint) string {
+	var emailSend api.EmailSend
+	checkNoError(t, Db.Where("contact_id = ?", contactID).Order("id DESC").First(&emailSend).Error)
+	return emailSend.MessageID
+}
+
+// Will run sequentially
+func TestBounces(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	sender := &recordingSender{}
+	scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+	scheduler.Now = func() time.Time { return time.Now().UTC().Add(time.Hour) }
+
+	sequenceID := createSequence(t, api.Sequence{Name: "BounceSequence1"})
+	for i, subject := range []string{"Hello", "Following up"} {
+		_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: subject, Content: "blah contents", Position: uint(i), WaitDays: uint(i)})
+		checkNoError(t, err)
+	}
+
+	hard := createContact(t, "hard@example.com")
+	soft := createContact(t, "soft@example.com")
+	complainer := createContact(t, "complainer@example.com")
+	for _, contact := range []*api.Contact{hard, soft, complainer} {
+		_, err := apiClient.Enroll(ctx, sequenceID, contact.ID)
+		checkNoError(t, err)
+	}
+	assertions.Equal(3, scheduler.RunDue(ctx))
+
+	enrollmentStatus := func(contactID uint) string {
+		enrollments, err := apiClient.ListEnrollments(ctx, sequenceID)
+		checkNoError(t, err)
+		for _, enrollment := range enrollments {
+			if enrollment.ContactID == contactID {
+				return enrollment.Status
+			}
+		}
+		return ""
+	}
+
+	t.Run("RejectsInvalidEvents", func(t *testing.T) {
+		_, err := apiClient.ReportBounces(ctx, []api.InboundBounce{{Type: "bounce", Email: "soft@example.com", Classification: "medium"}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Classification")
+
+		_, err = apiClient.ReportBounces(ctx, nil)
+		checkFailsWithError(t, err, http.StatusBadRequest, "No bounces or complaints provided.")
+
+		_, err = apiClient.ReportBounceMessage(ctx, []byte("Subject: hi\nContent-Type: text/plain\n\nhello"))
+		checkFailsWithError(t, err, http.StatusBadRequest, "multipart/report expected")
+	})
+
+	t.Run("HardBounceFromDSN", func(t *testing.T) {
+		events, err := apiClient.ReportBounceMessage(ctx, readReport(t, "dsn_hard_bounce.eml", "hard@example.com", lastMessageID(t, hard.ID)))
+		checkNoError(t, err)
+		if assertions.Len(events, 1) {
+			assertions.Equal(api.BounceHard, events[0].Classification)
+			assertions.Equal("5.1.1", events[0].Status)
+			assertions.Equal(sequenceID, events[0].SequenceID)
+			assertions.Contains(events[0].Diagnostic, "User unknown")
+		}
+
+		assertions.Equal(api.EnrollmentBounced, enrollmentStatus(hard.ID))
+		contact, err := apiClient.GetContact(ctx, hard.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.ContactBounced, contact.Status)
+
+		suppressions, err := apiClient.ListSuppressions(ctx, api.SuppressionBounced)
+		checkNoError(t, err)
+		assertions.True(containsEmail(suppressions, "hard@example.com"))
+	})
+
+	t.Run("SoftBounceOnlyRecorded", func(t *testing.T) {
+		events, err := apiClient.ReportBounces(ctx, []api.InboundBounce{{Type: api.BounceTypeBounce, Email: "soft@example.com", Status: "4.2.2"}})
+		checkNoError(t, err)
+		if assertions.Len(events, 1) {
+			assertions.Equal(api.BounceSoft, events[0].Classification)
+			assertions.Equal(sequenceID, events[0].SequenceID) // matched through the latest email sent to the contact
+		}
+
+		assertions.Equal(api.EnrollmentActive, enrollmentStatus(soft.ID))
+		suppressions, err := apiClient.ListSuppressions(ctx, "")
+		checkNoError(t, err)
+		assertions.False(containsEmail(suppressions, "soft@example.com"))
+	})
+
+	t.Run("ComplaintFromARF", func(t *testing.T) {
+		events, err := apiClient.ReportBounceMessage(ctx, readReport(t, "arf_complaint.eml", "complainer@example.com", lastMessageID(t, complainer.ID)))
+		checkNoError(t, err)
+		if assertions.Len(events, 1) {
+			assertions.Equal(api.BounceTypeComplaint, events[0].Type)
+			assertions.Equal("complainer@example.com", events[0].Email)
+			assertions.Equal("abuse", events[0].Diagnostic)
+		}
+
+		assertions.Equal(api.EnrollmentComplained, enrollmentStatus(complainer.ID))
+		suppressions, err := apiClient.ListSuppressions(ctx, api.SuppressionComplained)
+		checkNoError(t, err)
+		assertions.True(containsEmail(suppressions, "complainer@example.com"))
+	})
+
+	t.Run("StatsCountBounces", func(t *testing.T) {
+		stats, err := apiClient.GetSequenceStats(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(2, stats.StepCount)
+		assertions.Equal(1, stats.HardBounces)
+		assertions.Equal(1, stats.SoftBounces)
+		assertions.Equal(1, stats.Complaints)
+
+		// only the soft bounced contact gets the next step
+		scheduler.Now = func() time.Time { return time.Now().UTC().Add(25 * time.Hour) }
+		assertions.Equal(1, scheduler.RunDue(ctx))
+		assertions.Equal("soft@example.com", sender.last().To)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		events, err := apiClient.ListBounces(ctx, api.BounceTypeComplaint)
+		checkNoError(t, err)
+		assertions.NotEmpty(events)
+		for _, event := range events {
+			assertions.Equal(api.BounceTypeComplaint, event.Type)
+		}
+	})
+}
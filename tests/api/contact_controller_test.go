@@ -0,0 +1,272 @@
+package api
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/sitetester/sequence-api/client"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingSender keeps the sent emails instead of delivering them
+type recordingSender struct {
+	mu     sync.Mutex
+	emails []service.Email
+}
+
+func (rs *recordingSender) Send(_ context.Context, email service.Email) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.emails = append(rs.emails, email)
+	return nil
+}
+
+func (rs *recordingSender) last() service.Email {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.emails[len(rs.emails)-1]
+}
+
+// createContact removes leftovers of a previous run (including its enrollments) first
+func createContact(t *testing.T, email string) *api.Contact {
+	var previous api.Contact
+	if Db.Where("workspace = ? AND email = ?", api.DefaultWorkspace, email).Find(&previous).RowsAffected > 0 {
+		Db.Where("contact_id = ?", previous.ID).Delete(&api.Enrollment{})
+		Db.Delete(&previous)
+	}
+	Db.Where("workspace = ? AND email = ?", api.DefaultWorkspace, email).Delete(&api.Suppression{})
+
+	contact, err := apiClient.CreateContact(ctx, api.Contact{Email: email, FirstName: "Jane"})
+	checkNoError(t, err)
+	return contact
+}
+
+// publicRequest calls routes outside the API version group (not covered by the client)
+func publicRequest(method string, target string, form url.Values) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// Will run sequentially
+func TestContactsAndUnsubscribe(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	sender := &recordingSender{}
+	var offset time.Duration
+	scheduler := service.NewScheduler(Db, sender, "Sales <sales@example.com>", "https://mail.example.com/")
+	scheduler.Now = func() time.Time { return time.Now().UTC().Add(offset) }
+
+	sequenceID := createSequence(t, api.Sequence{Name: "UnsubscribeSequence1"})
+	for i, subject := range []string{"Hello", "Following up", "Last one"} {
+		_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: subject, Content: "<p>blah contents</p>", Position: uint(i), WaitDays: uint(i)})
+		checkNoError(t, err)
+	}
+
+	t.Run("CreateContactFailsForInvalidEmail", func(t *testing.T) {
+		_, err := apiClient.CreateContact(ctx, api.Contact{Email: "not-an-email"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Email")
+	})
+
+	contact := createContact(t, "jane@example.com")
+
+	t.Run("CreateContactFailsForTakenEmail", func(t *testing.T) {
+		_, err := apiClient.CreateContact(ctx, api.Contact{Email: "Jane@Example.com"})
+		checkFailsWithError(t, err, http.StatusConflict, "Email already taken.")
+	})
+
+	t.Run("ContactsAreScopedToWorkspace", func(t *testing.T) {
+		apiKeyService := service.ApiKeyService{Db: Db}
+		rawKey, _ := apiKeyService.CreateForWorkspace("OtherWorkspaceKey", "other")
+		otherClient := newTestClient(client.WithAPIKey(rawKey))
+
+		_, err := otherClient.GetContact(ctx, contact.ID)
+		checkFailsWih404(t, err)
+		_, err = otherClient.Enroll(ctx, sequenceID, contact.ID)
+		checkFailsWithError(t, err, http.StatusBadRequest, "Contact not found.")
+	})
+
+	var enrollment *api.Enrollment
+	t.Run("Enroll", func(t *testing.T) {
+		var err error
+		enrollment, err = apiClient.Enroll(ctx, sequenceID, contact.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.EnrollmentActive, enrollment.Status)
+
+		_, err = apiClient.Enroll(ctx, sequenceID, contact.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Contact already enrolled.")
+	})
+
+	var unsubscribeURL string
+	t.Run("SendsWithUnsubscribeLinkAndHeaders", func(t *testing.T) {
+		// the enrollment is claimed by one of the schedulers only
+		other := service.NewScheduler(Db, sender, "Sales <sales@example.com>", "https://mail.example.com/")
+		other.Now = scheduler.Now
+		var sent atomic.Int32
+		var wg sync.WaitGroup
+		for _, concurrent := range []*service.Scheduler{scheduler, other} {
+			wg.Add(1)
+			go func(concurrent *service.Scheduler) {
+				defer wg.Done()
+				sent.Add(int32(concurrent.RunDue(ctx)))
+			}(concurrent)
+		}
+		wg.Wait()
+		assertions.Equal(int32(1), sent.Load())
+
+		email := sender.last()
+		assertions.Equal("jane@example.com", email.To)
+		assertions.Equal("Hello", email.Subject)
+		assertions.Equal(service.ListUnsubscribeOneClick, email.Headers[service.ListUnsubscribePostHeader])
+		assertions.Contains(email.Headers["Message-ID"], "@example.com>")
+
+		listUnsubscribe := email.Headers[service.ListUnsubscribeHeader]
+		assertions.True(strings.HasPrefix(listUnsubscribe, "<https://mail.example.com/u/"), listUnsubscribe)
+		unsubscribeURL = strings.Trim(listUnsubscribe, "<>")
+		assertions.Contains(email.HTML, unsubscribeURL)
+
+		// the second step waits a day
+		assertions.Zero(scheduler.RunDue(ctx))
+		offset += 24 * time.Hour
+		assertions.Equal(1, scheduler.RunDue(ctx))
+		assertions.Equal("Following up", sender.last().Subject)
+	})
+
+	path := strings.TrimPrefix(unsubscribeURL, "https://mail.example.com")
+	t.Run("UnsubscribeRejectsInvalidToken", func(t *testing.T) {
+		recorder := publicRequest(http.MethodPost, path+"0", nil)
+		checkStatusCode(t, http.StatusNotFound, recorder.Code)
+
+		recorder = publicRequest(http.MethodGet, "/u/1.abc", nil)
+		checkStatusCode(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("UnsubscribeConfirmationDoesNotUnsubscribe", func(t *testing.T) {
+		recorder := publicRequest(http.MethodGet, path, nil)
+		checkStatusCode(t, http.StatusOK, recorder.Code)
+		assertions.Contains(recorder.Body.String(), `method="post"`)
+
+		enrollments, err := apiClient.ListEnrollments(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(api.EnrollmentActive, enrollments[0].Status)
+	})
+
+	t.Run("OneClickUnsubscribe", func(t *testing.T) {
+		recorder := publicRequest(http.MethodPost, path, url.Values{"List-Unsubscribe": {"One-Click"}})
+		checkStatusCode(t, http.StatusOK, recorder.Code)
+
+		enrollments, err := apiClient.ListEnrollments(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(api.EnrollmentUnsubscribed, enrollments[0].Status)
+
+		suppressions, err := apiClient.ListSuppressions(ctx, api.SuppressionUnsubscribed)
+		checkNoError(t, err)
+		assertions.True(containsEmail(suppressions, "jane@example.com"))
+
+		// no further steps go out
+		offset += 7 * 24 * time.Hour
+		assertions.Zero(scheduler.RunDue(ctx))
+
+		// clicking again is fine
+		recorder = publicRequest(http.MethodPost, path, nil)
+		checkStatusCode(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("SchedulerSkipsSuppressedContacts", func(t *testing.T) {
+		other := createContact(t, "john@example.com")
+		_, err := apiClient.CreateSuppression(ctx, api.Suppression{Email: "JOHN@example.com"})
+		checkNoError(t, err)
+
+		_, err = apiClient.Enroll(ctx, sequenceID, other.ID)
+		checkNoError(t, err)
+		assertions.Zero(scheduler.RunDue(ctx))
+
+		enrollments, err := apiClient.ListEnrollments(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(api.EnrollmentSuppressed, enrollments[1].Status)
+	})
+
+	t.Run("DeleteContact", func(t *testing.T) {
+		checkNoError(t, apiClient.DeleteContact(ctx, contact.ID))
+
+		_, err := apiClient.GetContact(ctx, contact.ID)
+		checkFailsWithError(t, err, http.StatusNotFound, "Contact not found.")
+
+		// the unsubscribe link of a deleted enrollment is gone as well
+		recorder := publicRequest(http.MethodGet, path, nil)
+		checkStatusCode(t, http.StatusNotFound, recorder.Code)
+	})
+}
+
+func TestSuppressions(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+	Db.Where("workspace = ?", api.DefaultWorkspace).Delete(&api.Suppression{})
+
+	t.Run("CreateFailsForUnknownReason", func(t *testing.T) {
+		_, err := apiClient.CreateSuppression(ctx, api.Suppression{Email: "a@example.com", Reason: "bored"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Reason: must be one of")
+	})
+
+	var suppression *api.Suppression
+	t.Run("Create", func(t *testing.T) {
+		var err error
+		suppression, err = apiClient.CreateSuppression(ctx, api.Suppression{Email: "A@example.com"})
+		checkNoError(t, err)
+		assertions.Equal("a@example.com", suppression.Email)
+		assertions.Equal(api.SuppressionManual, suppression.Reason)
+
+		_, err = apiClient.CreateSuppression(ctx, api.Suppression{Email: "a@example.com"})
+		checkFailsWithError(t, err, http.StatusConflict, "Email already suppressed.")
+	})
+
+	t.Run("ImportCSV", func(t *testing.T) {
+		csv := "email,reason\nb@example.com,unsubscribed\nc@example.com\na@example.com\nnot-an-email\n"
+		result, err := apiClient.ImportSuppressionsCSV(ctx, []byte(csv))
+		checkNoError(t, err)
+		assertions.Equal(2, result.Imported)
+		assertions.Equal(1, result.Skipped)
+		if assertions.Len(result.Errors, 1) {
+			assertions.Contains(result.Errors[0], "line 5")
+		}
+	})
+
+	t.Run("ExportCSV", func(t *testing.T) {
+		csv, err := apiClient.ExportSuppressionsCSV(ctx)
+		checkNoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(string(csv)), "\n")
+		assertions.Equal("email,reason,created_at", lines[0])
+		assertions.Len(lines, 4)
+		assertions.True(strings.HasPrefix(lines[2], "b@example.com,unsubscribed,"))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		checkNoError(t, apiClient.DeleteSuppression(ctx, suppression.ID))
+
+		err := apiClient.DeleteSuppression(ctx, suppression.ID)
+		checkFailsWithError(t, err, http.StatusNotFound, "Suppression not found.")
+	})
+}
+
+func containsEmail(suppressions []api.Suppression, email string) bool {
+	for _, suppression := range suppressions {
+		if suppression.Email == email {
+			return true
+		}
+	}
+	return false
+}
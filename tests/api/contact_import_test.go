@@ -0,0 +1,147 @@
+package api
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// Will run sequentially
+func TestContactImport(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	sequenceID := createSequence(t, api.Sequence{Name: "ImportSequence1"})
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+	_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Intro", Content: "blah contents"})
+	checkNoError(t, err)
+
+	existing := createContact(t, "import-existing@example.com")
+	for _, email := range []string{"import-ada@example.com", "import-grace@example.com"} {
+		Db.Where("email = ?", email).Delete(&api.Contact{})
+	}
+	defer Db.Where("email LIKE ?", "import-%@example.com").Delete(&api.Contact{})
+
+	worker := service.NewJobWorker(Db)
+	// runs the queued jobs, returns the state of import `id` afterwards
+	process := func(id uint) *api.ContactImport {
+		worker.RunDue(ctx)
+		contactImport, err := apiClient.GetContactImport(ctx, id)
+		checkNoError(t, err)
+		return contactImport
+	}
+
+	t.Run("ImportFailsForInvalidOptions", func(t *testing.T) {
+		cases := []struct {
+			options api.ContactImport
+			msg     string
+		}{
+			{api.ContactImport{Existing: "merge"}, "Existing: merge does not validate as in(skip|update)"},
+			{api.ContactImport{Mapping: map[string]string{"Company": "company"}}, `Mapping: "Company": must be one of email, first_name`},
+			{api.ContactImport{Mapping: map[string]string{"Company": "attributes.company"}}, "Mapping: no column mapped to email"},
+			{api.ContactImport{SequenceID: 999999}, "Sequence not found."},
+		}
+		for _, c := range cases {
+			_, err := apiClient.ImportContactsCSV(ctx, []byte("email\n"), c.options)
+			checkFailsWithError(t, err, http.StatusBadRequest, c.msg)
+		}
+	})
+
+	t.Run("ImportsMappedColumns", func(t *testing.T) {
+		csv := "E-mail,Given name,Company,Labels,Ignored\n" +
+			"Import-Ada@example.com,Ada,Analytical,\"Lead;VIP\",x\n" +
+			"not-an-email,Bob,,,\n" +
+			"import-ada@example.com,Ada again,,,\n" +
+			"import-existing@example.com,Changed,,,\n" +
+			"import-grace@example.com,Grace,Navy,lead,\n"
+		contactImport, err := apiClient.ImportContactsCSV(ctx, []byte(csv), api.ContactImport{
+			Mapping: map[string]string{
+				"E-mail":     "email",
+				"Given name": "first_name",
+				"Company":    "attributes.Company",
+				"Labels":     "tags",
+			},
+			SequenceID: sequenceID,
+		})
+		checkNoError(t, err)
+		assertions.Equal(api.ImportPending, contactImport.Status)
+		assertions.Equal(api.ImportExistingSkip, contactImport.Existing)
+
+		contactImport = process(contactImport.ID)
+		assertions.Equal(api.ImportCompleted, contactImport.Status)
+		job, err := apiClient.GetJob(ctx, contactImport.JobID)
+		checkNoError(t, err)
+		assertions.Equal(api.JobSucceeded, job.Status)
+		assertions.Equal(5, contactImport.Rows)
+		assertions.Equal(2, contactImport.Created)
+		assertions.Equal(1, contactImport.Skipped)
+		assertions.Equal(2, contactImport.Failed)
+		assertions.Equal(2, contactImport.Enrolled)
+		assertions.Equal([]string{
+			`line 3: Email: "not-an-email" is not an email address`,
+			"line 4: Email: duplicate of line 2",
+		}, contactImport.Errors)
+		assertions.NotNil(contactImport.FinishedAt)
+
+		ada := (&service.ContactService{Db: Db}).GetByEmail(api.DefaultWorkspace, "import-ada@example.com")
+		assertions.Equal("Ada", ada.FirstName)
+		assertions.Equal([]string{"lead", "vip"}, ada.Tags)
+		assertions.Equal(map[string]string{"company": "Analytical"}, ada.Attributes)
+		assertions.NotZero((&service.EnrollmentService{Db: Db}).GetByContact(sequenceID, ada.ID).ID)
+
+		unchanged, err := apiClient.GetContact(ctx, existing.ID)
+		checkNoError(t, err)
+		assertions.Equal("Jane", unchanged.FirstName)
+		assertions.Zero((&service.EnrollmentService{Db: Db}).GetByContact(sequenceID, existing.ID).ID)
+
+		// the upload is removed once imported
+		var stored api.ContactImport
+		Db.First(&stored, contactImport.ID)
+		_, err = os.Stat(stored.File)
+		assertions.True(os.IsNotExist(err))
+	})
+
+	t.Run("UpdatesExistingContacts", func(t *testing.T) {
+		csv := "email,first_name,time_zone,Plan\n" +
+			"import-existing@example.com,Janet,Europe/Berlin,pro\n" +
+			"import-grace@example.com,,Mars/Olympus,\n"
+		contactImport, err := apiClient.ImportContactsCSV(ctx, []byte(csv), api.ContactImport{Existing: api.ImportExistingUpdate})
+		checkNoError(t, err)
+
+		contactImport = process(contactImport.ID)
+		assertions.Equal(1, contactImport.Updated)
+		assertions.Equal(1, contactImport.Failed)
+		assertions.Contains(contactImport.Errors[0], "line 3: TimeZone: unknown time zone Mars/Olympus")
+
+		updated, err := apiClient.GetContact(ctx, existing.ID)
+		checkNoError(t, err)
+		assertions.Equal("Janet", updated.FirstName)
+		assertions.Equal("Europe/Berlin", updated.TimeZone)
+		assertions.Equal(map[string]string{"plan": "pro"}, updated.Attributes)
+	})
+
+	t.Run("FailsWithoutEmailColumn", func(t *testing.T) {
+		contactImport, err := apiClient.ImportContactsCSV(ctx, []byte("name,company\nAda,Analytical\n"), api.ContactImport{})
+		checkNoError(t, err)
+
+		contactImport = process(contactImport.ID)
+		assertions.Equal(api.ImportFailed, contactImport.Status)
+		assertions.Equal("no email column", contactImport.Error)
+		assertions.Zero(contactImport.Rows)
+
+		// not worth retrying
+		job, err := apiClient.GetJob(ctx, contactImport.JobID)
+		checkNoError(t, err)
+		assertions.Equal(api.JobDead, job.Status)
+		assertions.Equal(uint(1), job.Attempts)
+	})
+
+	t.Run("ViewFailsForUnknownImport", func(t *testing.T) {
+		_, err := apiClient.GetContactImport(ctx, 999999)
+		checkFailsWithError(t, err, http.StatusNotFound, "Import not found.")
+	})
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Will run sequentially
+func TestEdges(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	sequenceID := createSequence(t, api.Sequence{Name: "EdgeSequence1", OpenTrackingEnabled: true})
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+
+	steps := map[string]*api.SequenceStep{}
+	for _, step := range []api.SequenceStep{
+		{Subject: "Intro", WaitDays: 0},
+		{Subject: "Thanks for reading", WaitDays: 1},
+		{Subject: "Bump", WaitDays: 2},
+		{Subject: "Enterprise plan", WaitDays: 0},
+	} {
+		step.SequenceID = sequenceID
+		step.Content = "blah contents"
+		created, err := apiClient.CreateStep(ctx, step)
+		checkNoError(t, err)
+		steps[step.Subject] = created
+	}
+	intro, thanks, bump, enterprise := steps["Intro"], steps["Thanks for reading"], steps["Bump"], steps["Enterprise plan"]
+
+	otherSequenceID := createSequence(t, api.Sequence{Name: "EdgeSequence2"})
+	otherStep, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: otherSequenceID, Subject: "Other", Content: "blah contents"})
+	checkNoError(t, err)
+
+	edges := []api.StepEdge{
+		{FromStepID: intro.ID, ToStepID: thanks.ID, Condition: api.EdgeOpened},
+		{FromStepID: intro.ID, ToStepID: bump.ID, Condition: api.EdgeNotOpened, WithinDays: 3, Priority: 1},
+		{FromStepID: bump.ID, ToStepID: enterprise.ID, Condition: api.EdgeAttribute, Attribute: "email", Value: "*@BigCorp.com"},
+	}
+
+	t.Run("UpdateFailsForInvalidGraph", func(t *testing.T) {
+		_, err := apiClient.UpdateSequenceEdges(ctx, sequenceID, api.SequenceGraph{Edges: []api.StepEdge{
+			{FromStepID: intro.ID, ToStepID: bump.ID, Condition: api.EdgeNotOpened},
+		}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Edges[0]: WithinDays: required with not_opened")
+
+		_, err = apiClient.UpdateSequenceEdges(ctx, sequenceID, api.SequenceGraph{Edges: []api.StepEdge{
+			{FromStepID: intro.ID, ToStepID: otherStep.ID, Condition: api.EdgeAlways},
+		}})
+		checkFailsWithError(t, err, http.StatusBadRequest, fmt.Sprintf("Edges[0]: ToStepID: step %d not found in sequence", otherStep.ID))
+
+		_, err = apiClient.UpdateSequenceEdges(ctx, sequenceID, api.SequenceGraph{Edges: append(edges[:len(edges):len(edges)],
+			api.StepEdge{FromStepID: bump.ID, ToStepID: intro.ID, Condition: api.EdgeAlways},
+		)})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Edges: cycle through steps")
+
+		_, err = apiClient.UpdateSequenceEdges(ctx, sequenceID, api.SequenceGraph{Edges: edges[:2]})
+		checkFailsWithError(t, err, http.StatusBadRequest, fmt.Sprintf("Edges: step %d is unreachable from step %d", enterprise.ID, intro.ID))
+
+		_, err = apiClient.UpdateSequenceEdges(ctx, sequenceID, api.SequenceGraph{Edges: []api.StepEdge{
+			{FromStepID: intro.ID, ToStepID: bump.ID, Condition: api.EdgeAttribute, Attribute: "phone", Value: "+1*"},
+		}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Edges[0]: Attribute: must be one of status, email, first_name, last_name, time_zone or attributes.<name>")
+
+		_, err = apiClient.UpdateSequenceEdges(ctx, 0, api.SequenceGraph{})
+		checkFailsWithError(t, err, http.StatusNotFound, "Sequence not found.")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		graph, err := apiClient.UpdateSequenceEdges(ctx, sequenceID, api.SequenceGraph{Edges: edges})
+		checkNoError(t, err)
+		assertions.Len(graph.Edges, 3)
+
+		graph, err = apiClient.GetSequenceEdges(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Len(graph.Edges, 3)
+	})
+
+	now := time.Now().UTC().Add(time.Hour)
+	sender := &recordingSender{}
+	scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+	runAt := func(at time.Time) int {
+		scheduler.Now = func() time.Time { return at }
+		return scheduler.RunDue(ctx)
+	}
+
+	reader := createContact(t, "edge-reader@example.com")
+	silent := createContact(t, "edge-silent@bigcorp.com")
+	enrollments := map[uint]*api.Enrollment{}
+	for _, contact := range []*api.Contact{reader, silent} {
+		enrollment, err := apiClient.Enroll(ctx, sequenceID, contact.ID)
+		checkNoError(t, err)
+		enrollments[contact.ID] = enrollment
+	}
+	reload := func(contact *api.Contact) api.Enrollment {
+		var enrollment api.Enrollment
+		Db.First(&enrollment, enrollments[contact.ID].ID)
+		return enrollment
+	}
+
+	t.Run("FollowsEdges", func(t *testing.T) {
+		assertions.Equal(2, runAt(now))
+		assertions.Equal([]string{reader.Email, silent.Email}, recipients(sender))
+
+		// only the reader opened the intro
+		Db.Model(&api.EmailSend{}).Where("enrollment_id = ?", enrollments[reader.ID].ID).Update("opened_at", now.Add(time.Hour))
+
+		// the opened edge is due after the wait days of its target, the not_opened one after 3 days
+		day := now.Add(24*time.Hour + time.Minute)
+		assertions.Equal(1, runAt(day))
+		assertions.Equal(reader.Email, sender.last().To)
+		assertions.Equal("Thanks for reading", sender.last().Subject)
+
+		enrollment := reload(reader)
+		assertions.Equal(api.EnrollmentCompleted, enrollment.Status)
+		assertions.Equal(thanks.ID, enrollment.CurrentStepID)
+
+		enrollment = reload(silent)
+		assertions.Equal(api.EnrollmentActive, enrollment.Status)
+		if assertions.NotNil(enrollment.NextSendAt) {
+			assertions.WithinDuration(now.Add(3*24*time.Hour), *enrollment.NextSendAt, time.Second)
+		}
+
+		later := now.Add(3*24*time.Hour + time.Minute)
+		assertions.Equal(1, runAt(later))
+		assertions.Equal("Bump", sender.last().Subject)
+
+		// the attribute edge has no wait days
+		assertions.Equal(1, runAt(later))
+		assertions.Equal("Enterprise plan", sender.last().Subject)
+		assertions.Equal(api.EnrollmentCompleted, reload(silent).Status)
+		assertions.Equal(uint(3), reload(silent).NextStep)
+	})
+
+	t.Run("StepChangesMustKeepEdgesValid", func(t *testing.T) {
+		_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Nobody leads here", Content: "blah contents"})
+		checkFailsWithError(t, err, http.StatusConflict, "Steps conflict with the edges of the sequence: Edges: step")
+
+		// enterprise is only reached through bump
+		err = apiClient.DeleteStep(ctx, bump.ID, true)
+		checkFailsWithError(t, err, http.StatusConflict, fmt.Sprintf("Edges: step %d is unreachable from step %d", enterprise.ID, intro.ID))
+
+		// the first step is the entry
+		moved := *intro
+		moved.Position = 10
+		err = apiClient.UpdateStep(ctx, intro.ID, moved)
+		checkFailsWithError(t, err, http.StatusConflict, fmt.Sprintf("Edges: step %d is unreachable from step %d", bump.ID, thanks.ID))
+
+		_, err = apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Force: true, Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpDelete, ID: bump.ID},
+		}})
+		checkFailsWithError(t, err, http.StatusConflict, "Steps conflict with the edges of the sequence")
+
+		sequence, err := apiClient.GetSequence(ctx, sequenceID)
+		checkNoError(t, err)
+		if assertions.Len(*sequence.Steps, 4) {
+			assertions.Equal(intro.ID, (*sequence.Steps)[0].ID)
+		}
+	})
+
+	t.Run("DeleteStepRemovesEdges", func(t *testing.T) {
+		checkNoError(t, apiClient.DeleteStep(ctx, enterprise.ID, true))
+
+		graph, err := apiClient.GetSequenceEdges(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Len(graph.Edges, 2)
+
+		graph, err = apiClient.UpdateSequenceEdges(ctx, sequenceID, api.SequenceGraph{})
+		checkNoError(t, err)
+		assertions.Empty(graph.Edges)
+	})
+
+	t.Run("FollowsAttributeEdges", func(t *testing.T) {
+		attributeSequenceID := createSequence(t, api.Sequence{Name: "EdgeSequence3"})
+		defer Db.Where("sequence_id = ?", attributeSequenceID).Delete(&api.Enrollment{})
+
+		var created []*api.SequenceStep
+		for _, subject := range []string{"Welcome", "Enterprise onboarding", "Self-serve tips"} {
+			step, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: attributeSequenceID, Subject: subject, Content: "blah contents"})
+			checkNoError(t, err)
+			created = append(created, step)
+		}
+		_, err := apiClient.UpdateSequenceEdges(ctx, attributeSequenceID, api.SequenceGraph{Edges: []api.StepEdge{
+			{FromStepID: created[0].ID, ToStepID: created[1].ID, Condition: api.EdgeAttribute, Attribute: "Attributes.Plan", Value: "enterprise*"},
+			{FromStepID: created[0].ID, ToStepID: created[2].ID, Condition: api.EdgeAttribute, Attribute: "status", Value: "active", Priority: 1},
+		}})
+		checkNoError(t, err)
+
+		customer := createContact(t, "edge-customer@example.com")
+		Db.Model(customer).Update("attributes", `{"plan":"Enterprise Plus"}`)
+		prospect := createContact(t, "edge-prospect@example.com")
+		for _, contact := range []*api.Contact{customer, prospect} {
+			_, err := apiClient.Enroll(ctx, attributeSequenceID, contact.ID)
+			checkNoError(t, err)
+		}
+
+		sender := &recordingSender{}
+		attributeScheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+		attributeScheduler.Now = func() time.Time { return now }
+		assertions.Equal(2, attributeScheduler.RunDue(ctx))
+		assertions.Equal(2, attributeScheduler.RunDue(ctx))
+
+		subjects := map[string]string{}
+		for _, email := range sender.emails[2:] {
+			subjects[email.To] = email.Subject
+		}
+		assertions.Equal("Enterprise onboarding", subjects[customer.Email])
+		assertions.Equal("Self-serve tips", subjects[prospect.Email])
+	})
+}
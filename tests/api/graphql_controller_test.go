@@ -0,0 +1,218 @@
+package api
+
+import (
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/client"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type graphQLStep struct {
+	ID       string
+	Subject  string
+	WaitDays int
+}
+
+type graphQLSequence struct {
+	ID    string
+	Name  string
+	Steps []graphQLStep
+	Stats struct {
+		StepCount     int
+		TotalWaitDays int
+	}
+}
+
+// countStepQueries counts statements against the steps table while `run` executes
+func countStepQueries(t *testing.T, run func()) int64 {
+	var count atomic.Int64
+	counter := func(db *gorm.DB) {
+		if db.Statement.Table == "sequence_steps" {
+			count.Add(1)
+		}
+	}
+
+	checkNoError(t, Db.Callback().Query().After("gorm:query").Register("test:count_steps_query", counter))
+	checkNoError(t, Db.Callback().Row().After("gorm:row").Register("test:count_steps_row", counter))
+	defer Db.Callback().Query().Remove("test:count_steps_query")
+	defer Db.Callback().Row().Remove("test:count_steps_row")
+
+	run()
+	return count.Load()
+}
+
+// Will run sequentially
+func TestGraphQL(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	var sequenceIDs []uint
+	for i := 1; i <= 3; i++ {
+		sequenceID := createSequence(t, api.Sequence{Name: fmt.Sprintf("GraphQLSequence%d", i)})
+		for j := 1; j <= 2; j++ {
+			_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: fmt.Sprintf("Step%d", j), Content: "blah contents", WaitDays: uint(j)})
+			checkNoError(t, err)
+		}
+		sequenceIDs = append(sequenceIDs, sequenceID)
+	}
+
+	t.Run("QueryBatchesStepsAndStats", func(t *testing.T) {
+		var data struct{ Sequences []graphQLSequence }
+		queries := countStepQueries(t, func() {
+			gqlErrors, err := apiClient.GraphQL(ctx, `{ sequences { id name steps { subject waitDays } stats { stepCount totalWaitDays } } }`, nil, &data)
+			checkNoError(t, err)
+			assertions.Empty(gqlErrors)
+		})
+		// one query for the steps & one for the stats, regardless of the number of sequences
+		assertions.Equal(int64(2), queries)
+
+		found := map[string]graphQLSequence{}
+		for _, sequence := range data.Sequences {
+			found[sequence.Name] = sequence
+		}
+		sequence := found["GraphQLSequence2"]
+		assertions.Equal(fmt.Sprint(sequenceIDs[1]), sequence.ID)
+		assertions.Equal([]graphQLStep{{Subject: "Step1", WaitDays: 1}, {Subject: "Step2", WaitDays: 2}}, sequence.Steps)
+		assertions.Equal(2, sequence.Stats.StepCount)
+		assertions.Equal(3, sequence.Stats.TotalWaitDays)
+	})
+
+	t.Run("QuerySequenceByID", func(t *testing.T) {
+		var data struct{ Sequence *graphQLSequence }
+		query := `query($id: ID!) { sequence(id: $id) { name } }`
+
+		_, err := apiClient.GraphQL(ctx, query, map[string]any{"id": fmt.Sprint(sequenceIDs[0])}, &data)
+		checkNoError(t, err)
+		assertions.Equal("GraphQLSequence1", data.Sequence.Name)
+
+		_, err = apiClient.GraphQL(ctx, query, map[string]any{"id": "0"}, &data)
+		checkNoError(t, err)
+		assertions.Nil(data.Sequence)
+	})
+
+	t.Run("Mutations", func(t *testing.T) {
+		var created struct{ CreateStep graphQLStep }
+		gqlErrors, err := apiClient.GraphQL(ctx, `mutation($input: StepInput!) { createStep(input: $input) { id subject waitDays } }`,
+			map[string]any{"input": map[string]any{"sequenceId": fmt.Sprint(sequenceIDs[0]), "subject": "Step3", "content": "blah contents", "waitDays": 4}},
+			&created)
+		checkNoError(t, err)
+		assertions.Empty(gqlErrors)
+		assertions.Equal(4, created.CreateStep.WaitDays)
+
+		var updated struct{ UpdateStep graphQLStep }
+		_, err = apiClient.GraphQL(ctx, `mutation($id: ID!) { updateStep(id: $id, input: {subject: "Step3b", content: "new contents"}) { subject waitDays } }`,
+			map[string]any{"id": created.CreateStep.ID}, &updated)
+		checkNoError(t, err)
+		// omitted fields keep their value
+		assertions.Equal(graphQLStep{Subject: "Step3b", WaitDays: 4}, updated.UpdateStep)
+
+		gqlErrors, err = apiClient.GraphQL(ctx, `mutation($input: StepInput!) { createStep(input: $input) { id } }`,
+			map[string]any{"input": map[string]any{"sequenceId": fmt.Sprint(sequenceIDs[0]), "subject": "Step3b", "content": "blah contents"}},
+			nil)
+		checkNoError(t, err)
+		if assertions.Len(gqlErrors, 1) {
+			assertions.Equal("Subject already taken.", gqlErrors[0].Message)
+			assertions.EqualValues(http.StatusConflict, gqlErrors[0].Extensions["status"])
+		}
+
+		// `Int` is signed, delays are not
+		gqlErrors, err = apiClient.GraphQL(ctx, `mutation($id: ID!) { updateStep(id: $id, input: {subject: "Step3b", content: "new contents", waitDays: -1}) { id } }`,
+			map[string]any{"id": created.CreateStep.ID}, nil)
+		checkNoError(t, err)
+		if assertions.Len(gqlErrors, 1) {
+			assertions.Equal("waitDays: must not be negative", gqlErrors[0].Message)
+			assertions.EqualValues(http.StatusBadRequest, gqlErrors[0].Extensions["status"])
+		}
+		gqlErrors, err = apiClient.GraphQL(ctx, `mutation($input: StepInput!) { createStep(input: $input) { id } }`,
+			map[string]any{"input": map[string]any{"sequenceId": fmt.Sprint(sequenceIDs[0]), "subject": "Step4", "content": "blah contents", "position": -1}},
+			nil)
+		checkNoError(t, err)
+		if assertions.Len(gqlErrors, 1) {
+			assertions.Equal("position: must not be negative", gqlErrors[0].Message)
+		}
+
+		var deleted struct{ DeleteStep bool }
+		_, err = apiClient.GraphQL(ctx, `mutation($id: ID!) { deleteStep(id: $id, force: true) }`, map[string]any{"id": created.CreateStep.ID}, &deleted)
+		checkNoError(t, err)
+		assertions.True(deleted.DeleteStep)
+	})
+
+	t.Run("NonEmailSteps", func(t *testing.T) {
+		type typedStep struct {
+			ID        string
+			Type      string
+			Subject   string
+			Content   string
+			WaitUntil *time.Time
+			URL       *string
+			Method    *string
+		}
+		const fields = `id type subject content waitUntil url method`
+
+		waitUntil := time.Date(2030, 1, 15, 9, 0, 0, 0, time.UTC)
+		var waiting struct{ CreateStep typedStep }
+		gqlErrors, err := apiClient.GraphQL(ctx, `mutation($input: StepInput!) { createStep(input: $input) { `+fields+` } }`,
+			map[string]any{"input": map[string]any{"sequenceId": fmt.Sprint(sequenceIDs[1]), "type": api.StepTypeWaitUntil, "subject": "Wait for launch", "waitUntil": waitUntil.Format(time.RFC3339)}},
+			&waiting)
+		checkNoError(t, err)
+		assertions.Empty(gqlErrors)
+		assertions.Equal(api.StepTypeWaitUntil, waiting.CreateStep.Type)
+		if assertions.NotNil(waiting.CreateStep.WaitUntil) {
+			assertions.True(waitUntil.Equal(*waiting.CreateStep.WaitUntil))
+		}
+		assertions.Nil(waiting.CreateStep.URL)
+
+		var calling struct{ CreateStep typedStep }
+		gqlErrors, err = apiClient.GraphQL(ctx, `mutation($input: StepInput!) { createStep(input: $input) { `+fields+` } }`,
+			map[string]any{"input": map[string]any{"sequenceId": fmt.Sprint(sequenceIDs[1]), "type": api.StepTypeHTTPCall, "subject": "Notify CRM", "url": "https://crm.example.com/hook"}},
+			&calling)
+		checkNoError(t, err)
+		assertions.Empty(gqlErrors)
+		assertions.Equal(api.StepTypeHTTPCall, calling.CreateStep.Type)
+		if assertions.NotNil(calling.CreateStep.Method) {
+			assertions.Equal(http.MethodPost, *calling.CreateStep.Method)
+		}
+
+		// only the subject, the fields of the type are kept
+		var updated struct{ UpdateStep typedStep }
+		gqlErrors, err = apiClient.GraphQL(ctx, `mutation($id: ID!) { updateStep(id: $id, input: {subject: "Notify the CRM"}) { `+fields+` } }`,
+			map[string]any{"id": calling.CreateStep.ID}, &updated)
+		checkNoError(t, err)
+		assertions.Empty(gqlErrors)
+		assertions.Equal("Notify the CRM", updated.UpdateStep.Subject)
+		if assertions.NotNil(updated.UpdateStep.URL) {
+			assertions.Equal("https://crm.example.com/hook", *updated.UpdateStep.URL)
+		}
+
+		// turning it into an email clears its URL & method
+		gqlErrors, err = apiClient.GraphQL(ctx, `mutation($id: ID!) { updateStep(id: $id, input: {type: "email", content: "blah contents"}) { `+fields+` } }`,
+			map[string]any{"id": calling.CreateStep.ID}, &updated)
+		checkNoError(t, err)
+		assertions.Empty(gqlErrors)
+		assertions.Equal(typedStep{ID: calling.CreateStep.ID, Type: api.StepTypeEmail, Subject: "Notify the CRM", Content: "blah contents"}, updated.UpdateStep)
+
+		gqlErrors, err = apiClient.GraphQL(ctx, `mutation($id: ID!) { updateStep(id: $id, input: {url: "https://crm.example.com"}) { id } }`,
+			map[string]any{"id": waiting.CreateStep.ID}, nil)
+		checkNoError(t, err)
+		if assertions.Len(gqlErrors, 1) {
+			assertions.Equal("URL: only allowed for http_call steps", gqlErrors[0].Message)
+			assertions.EqualValues(http.StatusBadRequest, gqlErrors[0].Extensions["status"])
+		}
+	})
+
+	t.Run("FailsForEmptyQuery", func(t *testing.T) {
+		_, err := apiClient.GraphQL(ctx, "", nil, nil)
+		checkFailsWithError(t, err, http.StatusBadRequest, "query: non zero value required")
+	})
+
+	t.Run("FailsForInvalidApiKey", func(t *testing.T) {
+		_, err := newTestClient(client.WithAPIKey("sk_invalid")).GraphQL(ctx, `{ sequences { id } }`, nil, nil)
+		checkFailsWithError(t, err, http.StatusUnauthorized, "Invalid API key.")
+	})
+}
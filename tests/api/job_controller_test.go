@@ -0,0 +1,274 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Will run sequentially
+func TestJobs(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	Db.Where("type LIKE ?", "test_%").Delete(&api.Job{})
+	defer Db.Where("type LIKE ?", "test_%").Delete(&api.Job{})
+
+	jobService := service.JobService{Db: Db}
+	enqueue := func(jobType string) *api.Job {
+		job, err := jobService.Enqueue(api.DefaultWorkspace, jobType, map[string]string{"test": t.Name()})
+		checkNoError(t, err)
+		return job
+	}
+	reload := func(id uint) *api.Job {
+		job, err := apiClient.GetJob(ctx, id)
+		checkNoError(t, err)
+		return job
+	}
+
+	now := time.Now().UTC().Add(time.Second)
+	worker := service.NewJobWorker(Db)
+	worker.BaseBackoff = time.Minute
+	worker.Now = func() time.Time { return now }
+
+	flakyCalls := 0
+	worker.Handle("test_flaky", 1, func(ctx context.Context, job *api.Job) (any, error) {
+		flakyCalls++
+		if flakyCalls < 3 {
+			return nil, errors.New("boom")
+		}
+		return map[string]int{"Calls": flakyCalls}, nil
+	})
+	worker.Handle("test_broken", 1, func(ctx context.Context, job *api.Job) (any, error) {
+		return nil, errors.New("always broken")
+	})
+	worker.Handle("test_invalid", 1, func(ctx context.Context, job *api.Job) (any, error) {
+		return nil, service.Permanent(errors.New("bad payload"))
+	})
+	worker.Handle("test_ok", 1, func(ctx context.Context, job *api.Job) (any, error) {
+		return nil, nil
+	})
+
+	t.Run("RetriesWithBackoff", func(t *testing.T) {
+		job := enqueue("test_flaky")
+
+		assertions.Equal(1, worker.RunDue(ctx))
+		retried := reload(job.ID)
+		assertions.Equal(api.JobPending, retried.Status)
+		assertions.Equal(uint(1), retried.Attempts)
+		assertions.Equal("boom", retried.LastError)
+		assertions.WithinDuration(now.Add(time.Minute), retried.RunAt, time.Second)
+		assertions.Empty(retried.LeasedBy)
+		assertions.Equal(0, worker.RunDue(ctx))
+
+		now = now.Add(time.Minute)
+		assertions.Equal(1, worker.RunDue(ctx))
+		assertions.WithinDuration(now.Add(2*time.Minute), reload(job.ID).RunAt, time.Second)
+
+		now = now.Add(2 * time.Minute)
+		assertions.Equal(1, worker.RunDue(ctx))
+		succeeded := reload(job.ID)
+		assertions.Equal(api.JobSucceeded, succeeded.Status)
+		assertions.Equal(uint(3), succeeded.Attempts)
+		assertions.Equal(`{"Calls":3}`, succeeded.Result)
+		assertions.Empty(succeeded.LastError)
+		assertions.NotNil(succeeded.FinishedAt)
+	})
+
+	t.Run("DeadLetters", func(t *testing.T) {
+		job := enqueue("test_broken")
+		Db.Model(job).Update("max_attempts", 2)
+
+		worker.RunDue(ctx)
+		now = now.Add(time.Minute)
+		worker.RunDue(ctx)
+		dead := reload(job.ID)
+		assertions.Equal(api.JobDead, dead.Status)
+		assertions.Equal("always broken", dead.LastError)
+
+		deadJobs, err := apiClient.ListJobs(ctx, api.JobDead)
+		checkNoError(t, err)
+		if assertions.NotEmpty(deadJobs) {
+			assertions.Equal(job.ID, deadJobs[0].ID)
+		}
+
+		invalid := enqueue("test_invalid")
+		assertions.Equal(1, worker.RunDue(ctx))
+		assertions.Equal(api.JobDead, reload(invalid.ID).Status)
+		assertions.Equal(uint(1), reload(invalid.ID).Attempts)
+
+		retried, err := apiClient.RetryJob(ctx, job.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.JobPending, retried.Status)
+		assertions.Zero(retried.Attempts)
+		_, err = apiClient.RetryJob(ctx, job.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Job is neither dead nor canceled.")
+		Db.Delete(&api.Job{}, job.ID)
+	})
+
+	t.Run("CancelsPendingJob", func(t *testing.T) {
+		job := enqueue("test_ok")
+
+		canceled, err := apiClient.CancelJob(ctx, job.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.JobCanceled, canceled.Status)
+		assertions.Equal(0, worker.RunDue(ctx))
+
+		_, err = apiClient.CancelJob(ctx, job.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Job already finished.")
+	})
+
+	t.Run("CancelsRunningJob", func(t *testing.T) {
+		blocking := service.NewJobWorker(Db)
+		blocking.Lease = 150 * time.Millisecond
+		started := make(chan struct{})
+		blocking.Handle("test_blocking", 1, func(ctx context.Context, job *api.Job) (any, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		job := enqueue("test_blocking")
+
+		done := make(chan int)
+		go func() { done <- blocking.RunDue(ctx) }()
+		<-started
+		_, err := apiClient.CancelJob(ctx, job.ID)
+		checkNoError(t, err)
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the running job wasn't interrupted")
+		}
+		assertions.Equal(api.JobCanceled, reload(job.ID).Status)
+	})
+
+	t.Run("ReclaimsExpiredLeases", func(t *testing.T) {
+		expired := now.Add(-time.Minute)
+		lost := enqueue("test_ok")
+		Db.Model(lost).Updates(map[string]any{"status": api.JobRunning, "attempts": 1, "leased_by": "gone", "lease_expires_at": expired})
+		exhausted := enqueue("test_ok")
+		Db.Model(exhausted).Updates(map[string]any{"status": api.JobRunning, "attempts": 5, "leased_by": "gone", "lease_expires_at": expired})
+
+		assertions.Equal(1, worker.RunDue(ctx))
+		reclaimed := reload(lost.ID)
+		assertions.Equal(api.JobSucceeded, reclaimed.Status)
+		assertions.Equal(uint(2), reclaimed.Attempts)
+		assertions.Equal(api.JobDead, reload(exhausted.ID).Status)
+		assertions.Equal("lease expired", reload(exhausted.ID).LastError)
+	})
+
+	t.Run("LimitsConcurrencyPerType", func(t *testing.T) {
+		first := enqueue("test_ok")
+		second := enqueue("test_ok")
+
+		// running elsewhere, with a valid lease
+		Db.Model(first).Updates(map[string]any{"status": api.JobRunning, "attempts": 1, "leased_by": "other", "lease_expires_at": now.Add(time.Minute)})
+		assertions.Equal(0, worker.RunDue(ctx))
+
+		Db.Model(first).Update("status", api.JobSucceeded)
+		third := enqueue("test_ok")
+		assertions.Equal(1, worker.RunDue(ctx))
+		assertions.Equal(api.JobSucceeded, reload(second.ID).Status)
+		assertions.Equal(api.JobPending, reload(third.ID).Status)
+		assertions.Equal(1, worker.RunDue(ctx))
+	})
+
+	t.Run("LimitsConcurrencyAcrossWorkers", func(t *testing.T) {
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+		limited := func(ctx context.Context, job *api.Job) (any, error) {
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+
+			time.Sleep(50 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil, nil
+		}
+		for i := 0; i < 4; i++ {
+			enqueue("test_limited")
+		}
+
+		var wg sync.WaitGroup
+		started := 0
+		for i := 0; i < 3; i++ {
+			other := service.NewJobWorker(Db)
+			other.Handle("test_limited", 1, limited)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				count := other.RunDue(ctx)
+				mu.Lock()
+				started += count
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		assertions.Equal(1, maxRunning)
+		assertions.GreaterOrEqual(started, 1)
+	})
+
+	t.Run("GivesAttemptBackOnShutdown", func(t *testing.T) {
+		stopping := service.NewJobWorker(Db)
+		started := make(chan struct{})
+		stopping.Handle("test_stopping", 1, func(ctx context.Context, job *api.Job) (any, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		job := enqueue("test_stopping")
+
+		workerCtx, stop := context.WithCancel(ctx)
+		done := make(chan int)
+		go func() { done <- stopping.RunDue(workerCtx) }()
+		<-started
+		stop()
+		<-done
+
+		interrupted := reload(job.ID)
+		assertions.Equal(api.JobPending, interrupted.Status)
+		assertions.Zero(interrupted.Attempts)
+	})
+
+	t.Run("BulkEnrolls", func(t *testing.T) {
+		sequenceID := createSequence(t, api.Sequence{Name: "JobSequence1"})
+		defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+		first := createContact(t, "job-first@example.com")
+		second := createContact(t, "job-second@example.com")
+		_, err := apiClient.Enroll(ctx, sequenceID, second.ID)
+		checkNoError(t, err)
+
+		_, err = apiClient.BulkEnroll(ctx, sequenceID, nil)
+		checkFailsWithError(t, err, http.StatusBadRequest, "ContactIDs: non zero value required")
+
+		job, err := apiClient.BulkEnroll(ctx, sequenceID, []uint{first.ID, second.ID, 999999})
+		checkNoError(t, err)
+		assertions.Equal(api.JobTypeBulkEnroll, job.Type)
+		assertions.Equal(api.JobPending, job.Status)
+
+		service.NewJobWorker(Db).RunDue(ctx)
+		finished := reload(job.ID)
+		assertions.Equal(api.JobSucceeded, finished.Status)
+		assertions.Equal(`{"Enrolled":1,"Skipped":2}`, finished.Result)
+		assertions.NotZero((&service.EnrollmentService{Db: Db}).GetByContact(sequenceID, first.ID).ID)
+	})
+
+	t.Run("FailsForUnknownJob", func(t *testing.T) {
+		_, err := apiClient.GetJob(ctx, 999999)
+		checkFailsWithError(t, err, http.StatusNotFound, "Job not found.")
+
+		_, err = apiClient.ListJobs(ctx, "stuck")
+		checkFailsWithError(t, err, http.StatusBadRequest, "status: must be one of pending, running, succeeded, dead, canceled")
+	})
+}
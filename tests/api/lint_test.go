@@ -0,0 +1,128 @@
+package api
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hasIssue(report *api.LintReport, severity string, rule string) bool {
+	for _, issue := range report.Issues {
+		if issue.Severity == severity && issue.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Will run sequentially
+func TestContentLint(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+	sequenceID := createSequence(t, api.Sequence{Name: "LintSequence1"})
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+
+	t.Run("CreateReportsWarnings", func(t *testing.T) {
+		step, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Intro", Content: "<p>blah contents</p>"})
+		checkNoError(t, err)
+		assertions.NotNil(step.Lint)
+		assertions.False(step.Lint.HasErrors())
+		assertions.True(hasIssue(step.Lint, api.LintWarning, api.LintRuleText))
+		assertions.True(hasIssue(step.Lint, api.LintWarning, api.LintRuleUnsubscribe))
+	})
+
+	t.Run("CreateFailsForLintErrors", func(t *testing.T) {
+		for content, message := range map[string]string{
+			"<p>Hi {{company}}, <b>how are you?</p>": "Content: unknown variable {{company}}; Content: </p> doesn't close <b>",
+			"<p>Hi {first_name}, how are you?</p>":   "Content: variable {first_name} needs double braces",
+			"<p>Hi {{first_name}, how are you?</p>":  "Content: unbalanced {{ }} of a variable",
+		} {
+			_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Broken", Content: content})
+			checkFailsWithError(t, err, http.StatusBadRequest, message)
+		}
+
+		_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "URGENT WINNER!!", Content: "<p>Act now, it's guaranteed.</p>"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "reaches the limit of 5.0")
+	})
+
+	t.Run("AcceptsImpliedEndTags", func(t *testing.T) {
+		for _, content := range []string{
+			"<p>Hi {{first_name}}, a short note on our offer.<p>Let me know what you think about it.",
+			"<p>Our offer for your team:</p><ul><li>a shorter onboarding<li>a dedicated account manager</ul>",
+			"<table><tr><td>Plan<td>Price<tr><td>Team<td>$10</table><p>Reply to this email with any questions.",
+		} {
+			report := service.LintContent("Hello", content)
+			assertions.False(hasIssue(report, api.LintError, api.LintRuleHTML), content)
+		}
+
+		// other elements are still closed explicitly
+		report := service.LintContent("Hello", "<ul><li><b>a shorter onboarding<li>a dedicated account manager</ul>")
+		assertions.True(hasIssue(report, api.LintError, api.LintRuleHTML))
+	})
+
+	t.Run("WarnPolicySaves", func(t *testing.T) {
+		t.Setenv(service.LintPolicyEnv, api.LintPolicyWarn)
+		step, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Unknown", Content: "<p>Hi {{company}}, how are you today?</p>"})
+		checkNoError(t, err)
+		assertions.True(step.Lint.HasErrors())
+		checkNoError(t, apiClient.DeleteStep(ctx, step.ID, true))
+	})
+
+	followUp, err := apiClient.CreateStep(ctx, api.SequenceStep{
+		SequenceID: sequenceID, Subject: "Follow up for {{first_name}}", WaitDays: 1,
+		Content: `<p>Hi {{first_name}} {{last_name}}, a short note on our offer for your team this week.</p><a href="{{unsubscribe_url}}">Unsubscribe</a>`,
+	})
+	checkNoError(t, err)
+
+	t.Run("UpdateReportsWarnings", func(t *testing.T) {
+		followUp.Content += `<img src="https://example.com/banner.png" width="2000">`
+		checkNoError(t, apiClient.UpdateStep(ctx, followUp.ID, *followUp))
+		assertions.True(hasIssue(service.LintStep(followUp), api.LintWarning, api.LintRuleImage))
+
+		err := apiClient.UpdateStep(ctx, followUp.ID, api.SequenceStep{Subject: followUp.Subject, Content: followUp.Content + "</div>"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Content: </div> doesn't close nothing")
+	})
+
+	contact := createContact(t, "lint@example.com")
+
+	t.Run("Preview", func(t *testing.T) {
+		preview, err := apiClient.PreviewStep(ctx, followUp.ID, contact.ID)
+		checkNoError(t, err)
+		assertions.Equal("Follow up for Jane", preview.Subject)
+		assertions.True(strings.HasPrefix(preview.Content, "<p>Hi Jane , a short note"))
+		assertions.Contains(preview.Content, `href="{{unsubscribe_url}}"`)
+		assertions.Contains(preview.Lint.Issues, api.LintIssue{Severity: api.LintWarning, Rule: api.LintRuleVariable, Message: "Content: {{last_name}} is empty for the contact"})
+		assertions.False(hasIssue(&preview.Lint, api.LintWarning, api.LintRuleUnsubscribe))
+
+		_, err = apiClient.PreviewStep(ctx, followUp.ID, 999999)
+		checkFailsWithError(t, err, http.StatusNotFound, "Contact not found.")
+		_, err = apiClient.PreviewStep(ctx, 999999, contact.ID)
+		checkFailsWithError(t, err, http.StatusNotFound, "Step not found.")
+	})
+
+	t.Run("SendReplacesVariables", func(t *testing.T) {
+		_, err := apiClient.Enroll(ctx, sequenceID, contact.ID)
+		checkNoError(t, err)
+
+		sender := &recordingSender{}
+		scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+		for _, days := range []int{0, 2} {
+			at := time.Now().UTC().Add(time.Duration(days)*24*time.Hour + time.Hour)
+			scheduler.Now = func() time.Time { return at }
+			scheduler.RunDue(ctx)
+		}
+		if assertions.Len(sender.emails, 2) {
+			email := sender.last()
+			assertions.Equal("Follow up for Jane", email.Subject)
+			assertions.Contains(email.HTML, "<p>Hi Jane , a short note")
+			assertions.NotContains(email.HTML, "{{")
+			// placed by the content, no footer
+			assertions.Equal(1, strings.Count(email.HTML, `href="https://mail.example.com/u/`))
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Will run sequentially
+func TestMailboxes(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	var leftovers []uint
+	Db.Model(&api.Mailbox{}).Where("address LIKE ?", "%@mailbox.example").Pluck("id", &leftovers)
+	Db.Where("mailbox_id IN ?", leftovers).Delete(&api.SequenceMailbox{})
+	Db.Where("mailbox_id IN ?", leftovers).Delete(&api.Enrollment{})
+	Db.Where("id IN ?", leftovers).Delete(&api.Mailbox{})
+
+	t.Run("CreateFailsForInvalidMailbox", func(t *testing.T) {
+		_, err := apiClient.CreateMailbox(ctx, api.Mailbox{Address: "alice@mailbox.example"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "FromName: non zero value required")
+
+		_, err = apiClient.CreateMailbox(ctx, api.Mailbox{FromName: "Alice", Address: "alice@mailbox.example", SMTPPassword: "s3cret"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "SMTPHost: required with SMTP port or credentials")
+	})
+
+	var alice, bob *api.Mailbox
+	t.Run("Create", func(t *testing.T) {
+		var err error
+		alice, err = apiClient.CreateMailbox(ctx, api.Mailbox{
+			FromName:     "Alice",
+			Address:      "Alice@Mailbox.example",
+			SMTPHost:     "smtp.mailbox.example",
+			SMTPUsername: "alice",
+			SMTPPassword: "s3cret",
+		})
+		checkNoError(t, err)
+		assertions.Equal("alice@mailbox.example", alice.Address)
+		assertions.Equal(uint(587), alice.SMTPPort)
+		assertions.Equal("alice", alice.SMTPUsername)
+		assertions.Empty(alice.SMTPPassword)
+
+		// encrypted at rest
+		var stored api.Mailbox
+		Db.First(&stored, alice.ID)
+		assertions.NotEmpty(stored.SMTPCredentials)
+		assertions.NotContains(stored.SMTPCredentials, "s3cret")
+
+		bob, err = apiClient.CreateMailbox(ctx, api.Mailbox{FromName: "Bob", Address: "bob@mailbox.example", ReplyTo: "bob.replies@mailbox.example", Signature: "<p>Bob</p>"})
+		checkNoError(t, err)
+
+		_, err = apiClient.CreateMailbox(ctx, api.Mailbox{FromName: "Bob", Address: "bob@mailbox.example"})
+		checkFailsWithError(t, err, http.StatusConflict, "Address already taken.")
+	})
+
+	t.Run("UpdateKeepsPassword", func(t *testing.T) {
+		updated, err := apiClient.UpdateMailbox(ctx, alice.ID, api.Mailbox{FromName: "Alice Smith", Address: alice.Address, SMTPHost: alice.SMTPHost, SMTPUsername: "alice"})
+		checkNoError(t, err)
+		assertions.Equal("Alice Smith", updated.FromName)
+
+		found, err := apiClient.GetMailbox(ctx, alice.ID)
+		checkNoError(t, err)
+		assertions.Equal("alice", found.SMTPUsername)
+	})
+
+	sequenceID := createSequence(t, api.Sequence{Name: "MailboxSequence1"})
+	stickySequenceID := createSequence(t, api.Sequence{Name: "MailboxSequence2"})
+	defer Db.Where("sequence_id IN ?", []uint{sequenceID, stickySequenceID}).Delete(&api.Enrollment{})
+	for i, subject := range []string{"Hello", "Following up"} {
+		_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: subject, Content: "blah contents", Position: uint(i), WaitDays: uint(i)})
+		checkNoError(t, err)
+	}
+	_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: stickySequenceID, Subject: "Hello", Content: "blah contents"})
+	checkNoError(t, err)
+
+	t.Run("AssignFailsForInvalidMailboxes", func(t *testing.T) {
+		_, err := apiClient.UpdateSequenceMailboxes(ctx, sequenceID, api.SequenceMailboxes{MailboxIDs: []uint{alice.ID, 0}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "MailboxIDs: mailbox 0 not found")
+
+		_, err = apiClient.UpdateSequenceMailboxes(ctx, sequenceID, api.SequenceMailboxes{MailboxIDs: []uint{alice.ID, alice.ID}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "is listed twice")
+
+		_, err = apiClient.UpdateSequenceMailboxes(ctx, sequenceID, api.SequenceMailboxes{Rotation: "random"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Rotation: random does not validate as in(round_robin|sticky)")
+	})
+
+	t.Run("Assign", func(t *testing.T) {
+		assignment, err := apiClient.UpdateSequenceMailboxes(ctx, sequenceID, api.SequenceMailboxes{MailboxIDs: []uint{alice.ID, bob.ID}})
+		checkNoError(t, err)
+		assertions.Equal(api.MailboxRotationRoundRobin, assignment.Rotation)
+
+		found, err := apiClient.GetSequenceMailboxes(ctx, sequenceID)
+		checkNoError(t, err)
+		if assertions.Len(found.Mailboxes, 2) {
+			assertions.Equal(alice.ID, found.Mailboxes[0].ID)
+			assertions.Equal(bob.ID, found.Mailboxes[1].ID)
+		}
+	})
+
+	contacts := []*api.Contact{
+		createContact(t, "first@rotation.example"),
+		createContact(t, "second@rotation.example"),
+		createContact(t, "third@rotation.example"),
+	}
+	for _, contact := range contacts {
+		_, err := apiClient.Enroll(ctx, sequenceID, contact.ID)
+		checkNoError(t, err)
+	}
+
+	now := time.Now().UTC().Add(time.Hour)
+	sender := &recordingSender{}
+	scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+	scheduler.Now = func() time.Time { return now }
+
+	fromByRecipient := func() map[string]service.Email {
+		sender.mu.Lock()
+		defer sender.mu.Unlock()
+
+		emails := map[string]service.Email{}
+		for _, email := range sender.emails {
+			emails[email.To] = email
+		}
+		sender.emails = nil
+		return emails
+	}
+
+	t.Run("RoundRobin", func(t *testing.T) {
+		assertions.Equal(3, scheduler.RunDue(ctx))
+
+		emails := fromByRecipient()
+		assertions.Equal(`"Alice Smith" <alice@mailbox.example>`, emails["first@rotation.example"].From)
+		assertions.Equal(`"Bob" <bob@mailbox.example>`, emails["second@rotation.example"].From)
+		assertions.Equal(`"Alice Smith" <alice@mailbox.example>`, emails["third@rotation.example"].From)
+
+		if smtp := emails["first@rotation.example"].SMTP; assertions.NotNil(smtp) {
+			assertions.Equal(service.SMTPServer{Host: "smtp.mailbox.example", Port: 587, Username: "alice", Password: "s3cret"}, *smtp)
+		}
+
+		bobsEmail := emails["second@rotation.example"]
+		assertions.Nil(bobsEmail.SMTP)
+		assertions.Contains(bobsEmail.HTML, "<p>Bob</p>")
+		assertions.Equal("bob.replies@mailbox.example", bobsEmail.Headers["Reply-To"])
+		assertions.Contains(bobsEmail.Headers["Message-ID"], "@mailbox.example>")
+	})
+
+	t.Run("FollowUpsFromSameMailbox", func(t *testing.T) {
+		// reassigning doesn't move started enrollments
+		_, err := apiClient.UpdateSequenceMailboxes(ctx, sequenceID, api.SequenceMailboxes{MailboxIDs: []uint{bob.ID}})
+		checkNoError(t, err)
+
+		now = now.Add(25 * time.Hour)
+		scheduler.ReplyAddress = "replies@example.com"
+		defer func() { scheduler.ReplyAddress = "" }()
+		assertions.Equal(3, scheduler.RunDue(ctx))
+
+		emails := fromByRecipient()
+		assertions.Equal(`"Alice Smith" <alice@mailbox.example>`, emails["first@rotation.example"].From)
+		assertions.Equal(`"Bob" <bob@mailbox.example>`, emails["second@rotation.example"].From)
+		assertions.Equal(`"Alice Smith" <alice@mailbox.example>`, emails["third@rotation.example"].From)
+
+		// the mailbox's own reply-to is plus-tagged, not replaced
+		assertions.True(strings.HasPrefix(emails["second@rotation.example"].Headers["Reply-To"], "bob.replies+"))
+		assertions.True(strings.HasPrefix(emails["first@rotation.example"].Headers["Reply-To"], "replies+"))
+	})
+
+	t.Run("Sticky", func(t *testing.T) {
+		_, err := apiClient.UpdateSequenceMailboxes(ctx, stickySequenceID, api.SequenceMailboxes{Rotation: api.MailboxRotationSticky, MailboxIDs: []uint{alice.ID, bob.ID}})
+		checkNoError(t, err)
+
+		// the mailbox of the contact's other sequence
+		enrollment, err := apiClient.Enroll(ctx, stickySequenceID, contacts[1].ID)
+		checkNoError(t, err)
+		assertions.Equal(1, scheduler.RunDue(ctx))
+		assertions.Equal(`"Bob" <bob@mailbox.example>`, fromByRecipient()["second@rotation.example"].From)
+
+		enrollments, err := apiClient.ListEnrollments(ctx, stickySequenceID)
+		checkNoError(t, err)
+		if assertions.Len(enrollments, 1) {
+			assertions.Equal(enrollment.ID, enrollments[0].ID)
+			assertions.Equal(bob.ID, enrollments[0].MailboxID)
+		}
+	})
+
+	t.Run("DeleteInUse", func(t *testing.T) {
+		err := apiClient.DeleteMailbox(ctx, bob.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Mailbox is used by a sequence or active enrollment.")
+
+		// neither assigned nor sending to active enrollments anymore
+		_, err = apiClient.UpdateSequenceMailboxes(ctx, stickySequenceID, api.SequenceMailboxes{MailboxIDs: []uint{bob.ID}})
+		checkNoError(t, err)
+		checkNoError(t, apiClient.DeleteMailbox(ctx, alice.ID))
+		_, err = apiClient.GetMailbox(ctx, alice.ID)
+		checkFailsWithError(t, err, http.StatusNotFound, "Mailbox not found.")
+	})
+}
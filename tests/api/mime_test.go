@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"flag"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of testdata/ with the actual output")
+
+// checkGolden compares `actual` to `testdata/<name>`
+func checkGolden(t *testing.T, name string, actual []byte) {
+	path := "testdata/" + name
+	if *updateGolden {
+		checkNoError(t, os.WriteFile(path, actual, 0o644))
+	}
+	expected, err := os.ReadFile(path)
+	checkNoError(t, err)
+	assert.Equal(t, string(expected), string(actual), "differs from %s (go test -run %s -update rewrites it)", path, t.Name())
+}
+
+func TestBuildMessage(t *testing.T) {
+	date := time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC).Format(time.RFC1123Z)
+
+	t.Run("FirstStep", func(t *testing.T) {
+		checkGolden(t, "message_first_step.eml", service.BuildMessage(service.Email{
+			From:    "sales@example.com",
+			To:      "jane@example.org",
+			Subject: "Quick question",
+			HTML: `<html><head><style>p { margin: 0 }</style></head><body>
+<p>Hi Jane,</p>
+<p>We help   teams like yours ship <b>faster</b>:</p>
+<ul><li>Sequences</li><li>A/B tests</li></ul>
+<p>See <a href="https://example.com/pricing">our pricing</a> or <a href="https://example.com">https://example.com</a>.<br>Best, <img src="https://example.com/logo.png" alt="Example Inc."></p>
+</body></html>`,
+			Headers: map[string]string{
+				"Message-ID":                      "<first@example.com>",
+				"Date":                            date,
+				service.ListUnsubscribeHeader:     "<https://mail.example.com/u/1.abc>",
+				service.ListUnsubscribePostHeader: service.ListUnsubscribeOneClick,
+			},
+		}))
+	})
+
+	t.Run("FollowUp", func(t *testing.T) {
+		checkGolden(t, "message_follow_up.eml", service.BuildMessage(service.Email{
+			From:    service.FromHeader(&api.Mailbox{FromName: "Jürgen Müller", Address: "juergen@example.com"}),
+			To:      "jane@example.org",
+			Subject: "Grüße aus München – kurze Nachfrage zu unserem Angebot für Ihr Team",
+			HTML:    "<p>Hallo Jane,\nhaben Sie meine letzte Nachricht gesehen? Preis: 10 €</p>",
+			Headers: map[string]string{
+				"Message-ID":                  "<follow-up@example.com>",
+				"Date":                        date,
+				"Reply-To":                    "replies+1.abc@example.com",
+				service.InReplyToHeader:       "<first@example.com>",
+				service.ReferencesHeader:      "<first@example.com>",
+				service.ListUnsubscribeHeader: "<https://mail.example.com/u/1.abc>",
+			},
+		}))
+	})
+
+	t.Run("WithAttachments", func(t *testing.T) {
+		checkGolden(t, "message_attachments.eml", service.BuildMessage(service.Email{
+			From:    "sales@example.com",
+			To:      "jane@example.org",
+			Subject: "Our one pager",
+			HTML:    `<p>Hi Jane, the one pager is attached.</p><img src="cid:asset-2" alt="Example Inc.">`,
+			Headers: map[string]string{"Message-ID": "<attachments@example.com>", "Date": date},
+			Attachments: []service.Attachment{
+				{Name: "logo.png", ContentType: "image/png", ContentID: "asset-2", Content: testPNG},
+				{Name: "Übersicht.pdf", ContentType: "application/pdf", Content: testPDF},
+			},
+		}))
+	})
+
+	t.Run("ExplicitText", func(t *testing.T) {
+		message, err := mail.ReadMessage(bytes.NewReader(service.BuildMessage(service.Email{
+			From: "sales@example.com", To: "jane@example.org", Subject: "Hi\r\nBcc: everyone@example.org",
+			HTML: "<p>Hi</p>", Text: "Hi there",
+		})))
+		checkNoError(t, err)
+		assert.Equal(t, "Hi  Bcc: everyone@example.org", message.Header.Get("Subject"))
+		assert.Empty(t, message.Header.Get("Bcc"))
+		assert.NotEmpty(t, message.Header.Get("Date"))
+		assert.NotEmpty(t, message.Header.Get("Message-ID"))
+	})
+}
+
+// Will run sequentially
+func TestMessageThreading(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+	sequenceID := createSequence(t, api.Sequence{Name: "ThreadingSequence1"})
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+	for _, step := range []api.SequenceStep{
+		{Subject: "Intro", Content: "<p>Hi {{first_name}},</p><p>a short intro.</p>"},
+		{Subject: "Follow up", Content: "<p>Any thoughts?</p>", WaitDays: 1},
+		{Subject: "Last one", Content: "<p>Closing the loop.</p>", WaitDays: 1},
+	} {
+		step.SequenceID = sequenceID
+		_, err := apiClient.CreateStep(ctx, step)
+		checkNoError(t, err)
+	}
+
+	enrollment, err := apiClient.Enroll(ctx, sequenceID, createContact(t, "threading@example.com").ID)
+	checkNoError(t, err)
+
+	sender := &recordingSender{}
+	scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+	for _, days := range []int{0, 2, 4} {
+		at := time.Now().UTC().Add(time.Duration(days)*24*time.Hour + time.Hour)
+		scheduler.Now = func() time.Time { return at }
+		scheduler.RunDue(ctx)
+	}
+
+	if assertions.Len(sender.emails, 3) {
+		first := sender.emails[0]
+		assertions.Empty(first.Headers[service.InReplyToHeader])
+		assertions.True(strings.HasPrefix(first.Text, "Hi Jane,\n\na short intro.\n\nUnsubscribe (https://mail.example.com/u/"), first.Text)
+		_, err := time.Parse(time.RFC1123Z, first.Headers["Date"])
+		checkNoError(t, err)
+
+		for _, followUp := range sender.emails[1:] {
+			assertions.Equal(first.Headers["Message-ID"], followUp.Headers[service.InReplyToHeader])
+			assertions.Equal(first.Headers["Message-ID"], followUp.Headers[service.ReferencesHeader])
+		}
+
+		var found api.Enrollment
+		Db.First(&found, enrollment.ID)
+		assertions.Equal(first.Headers["Message-ID"], "<"+found.ThreadID+">")
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"github.com/sitetester/sequence-api/api/openapi"
+	"github.com/sitetester/sequence-api/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	documented := make(map[string]bool)
+	for _, operation := range openapi.Operations {
+		if operation.Public {
+			documented[operation.Method+" "+operation.Route] = true
+			continue
+		}
+		documented[operation.Method+" "+config.ApiVersion+operation.Route] = true
+	}
+
+	t.Run("AllRoutesDocumented", func(t *testing.T) {
+		registered := make(map[string]bool)
+		for _, route := range engine.Routes() {
+			key := route.Method + " " + route.Path
+			registered[key] = true
+			assertions.True(documented[key], "route %s isn't documented in openapi.Operations", key)
+		}
+
+		for key := range documented {
+			assertions.True(registered[key], "documented route %s isn't registered", key)
+		}
+	})
+
+	t.Run("Serve", func(t *testing.T) {
+		var document struct {
+			OpenAPI    string `json:"openapi"`
+			Paths      map[string]map[string]any
+			Components struct {
+				Schemas map[string]struct {
+					Required   []string
+					Properties map[string]map[string]any
+				}
+			}
+		}
+		checkNoError(t, apiClient.Do(ctx, http.MethodGet, "/openapi.json", nil, &document))
+		assertions.Equal("3.0.3", document.OpenAPI)
+		assertions.Contains(document.Paths, "/v1/sequences/{id}/steps:batch")
+		assertions.Contains(document.Paths["/v1/sequences/{id}"], "put")
+		assertions.Contains(document.Paths["/u/{token}"], "post") // public, outside of `/v1`
+
+		// constraints derived from `valid` tags
+		sequence := document.Components.Schemas["Sequence"]
+		assertions.Equal([]string{"Name"}, sequence.Required)
+		assertions.Equal(float64(3), sequence.Properties["Name"]["minLength"])
+		assertions.Equal(float64(30), sequence.Properties["Name"]["maxLength"])
+		assertions.Equal("^[a-zA-Z0-9]+$", sequence.Properties["Name"]["pattern"])
+		assertions.NotContains(sequence.Properties, "SequenceSteps") // json:"-"
+
+		// step fields depend on the step type, nothing is required by all of them
+		step := document.Components.Schemas["SequenceStep"]
+		assertions.Empty(step.Required)
+		assertions.Contains(step.Properties, "Type")
+
+		assertions.Contains(document.Components.Schemas, "ErrorResponse")
+		assertions.Contains(document.Components.Schemas, "BatchStepOperation") // nested
+		assertions.Contains(document.Components.Schemas["SequenceDocument"].Properties, "version")
+	})
+}
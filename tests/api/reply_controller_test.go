@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func replyMessage(headers string) []byte {
+	return []byte("From: Jane <Jane@example.com>\r\nSubject: Re: Hello\r\nMessage-ID: <reply-1@example.com>\r\n" + headers + "\r\nSounds good, let's talk.\r\n")
+}
+
+// Will run sequentially
+func TestReplies(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	sender := &recordingSender{}
+	var offset time.Duration
+	scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+	scheduler.ReplyAddress = "replies@example.com"
+	scheduler.Now = func() time.Time { return time.Now().UTC().Add(offset) }
+
+	sequenceID := createSequence(t, api.Sequence{Name: "ReplySequence1"})
+	for i, subject := range []string{"Hello", "Following up"} {
+		_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: subject, Content: "blah contents", Position: uint(i), WaitDays: 1})
+		checkNoError(t, err)
+	}
+
+	threaded := createContact(t, "threaded@example.com")
+	tagged := createContact(t, "tagged@example.com")
+	for _, contact := range []*api.Contact{threaded, tagged} {
+		_, err := apiClient.Enroll(ctx, sequenceID, contact.ID)
+		checkNoError(t, err)
+	}
+	offset += 24 * time.Hour
+	assertions.Equal(2, scheduler.RunDue(ctx))
+
+	emailTo := func(to string) service.Email {
+		for _, email := range sender.emails {
+			if email.To == to {
+				return email
+			}
+		}
+		t.Fatalf("no email sent to %s", to)
+		return service.Email{}
+	}
+
+	enrollmentStatus := func(contactID uint) string {
+		enrollments, err := apiClient.ListEnrollments(ctx, sequenceID)
+		checkNoError(t, err)
+		for _, enrollment := range enrollments {
+			if enrollment.ContactID == contactID {
+				return enrollment.Status
+			}
+		}
+		return ""
+	}
+
+	t.Run("RejectsInvalidMessage", func(t *testing.T) {
+		_, err := apiClient.ReportReply(ctx, []byte("not a message"))
+		checkFailsWithError(t, err, http.StatusBadRequest, "")
+	})
+
+	t.Run("IgnoresAutoReplies", func(t *testing.T) {
+		messageID := emailTo("threaded@example.com").Headers["Message-ID"]
+		result, err := apiClient.ReportReply(ctx, replyMessage("In-Reply-To: "+messageID+"\r\nAuto-Submitted: auto-replied\r\n"))
+		checkNoError(t, err)
+		assertions.False(result.Matched)
+		assertions.Contains(result.Ignored, "auto-reply")
+		assertions.Equal(api.EnrollmentActive, enrollmentStatus(threaded.ID))
+	})
+
+	t.Run("UnmatchedMessage", func(t *testing.T) {
+		result, err := apiClient.ReportReply(ctx, replyMessage("In-Reply-To: <unknown@example.com>\r\nTo: replies+1-0000@example.com\r\n"))
+		checkNoError(t, err)
+		assertions.False(result.Matched)
+	})
+
+	t.Run("MatchesByInReplyTo", func(t *testing.T) {
+		messageID := emailTo("threaded@example.com").Headers["Message-ID"]
+		result, err := apiClient.ReportReply(ctx, replyMessage("In-Reply-To: "+messageID+"\r\nReferences: <other@example.com> "+messageID+"\r\n"))
+		checkNoError(t, err)
+		if assertions.True(result.Matched) {
+			assertions.Equal(api.ReplyMatchedByMessageID, result.Reply.MatchedBy)
+			assertions.Equal("jane@example.com", result.Reply.FromEmail)
+			assertions.Equal(sequenceID, result.Reply.SequenceID)
+		}
+		assertions.Equal(api.EnrollmentReplied, enrollmentStatus(threaded.ID))
+	})
+
+	t.Run("MatchesByPlusAddressFromMaildir", func(t *testing.T) {
+		replyTo := emailTo("tagged@example.com").Headers["Reply-To"]
+		assertions.True(strings.HasPrefix(replyTo, "replies+"), replyTo)
+
+		dir := t.TempDir()
+		for _, sub := range []string{"new", "cur", "tmp"} {
+			checkNoError(t, os.Mkdir(filepath.Join(dir, sub), 0o755))
+		}
+		message := replyMessage(fmt.Sprintf("To: Sales <%s>\r\n", replyTo))
+		checkNoError(t, os.WriteFile(filepath.Join(dir, "new", "1700000000.1.host"), message, 0o644))
+
+		poller := service.MaildirPoller{Db: Db, Dir: dir}
+		matched, err := poller.PollOnce()
+		checkNoError(t, err)
+		assertions.Equal(1, matched)
+		assertions.FileExists(filepath.Join(dir, "cur", "1700000000.1.host:2,S"))
+
+		assertions.Equal(api.EnrollmentReplied, enrollmentStatus(tagged.ID))
+	})
+
+	t.Run("NoFurtherSteps", func(t *testing.T) {
+		offset += 7 * 24 * time.Hour
+		assertions.Zero(scheduler.RunDue(ctx))
+	})
+
+	t.Run("List", func(t *testing.T) {
+		replies, err := apiClient.ListReplies(ctx)
+		checkNoError(t, err)
+		if assertions.GreaterOrEqual(len(replies), 2) {
+			assertions.Equal(api.ReplyMatchedByPlusAddress, replies[0].MatchedBy)
+		}
+	})
+}
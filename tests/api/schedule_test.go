@@ -0,0 +1,249 @@
+package api
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	checkNoError(t, err)
+	return parsed
+}
+
+// Will run sequentially
+func TestSchedules(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	sequenceID := createSequence(t, api.Sequence{Name: "ScheduleSequence1"})
+	for i, subject := range []string{"Hello", "Following up", "Last one"} {
+		_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: subject, Content: "blah contents", Position: uint(i), WaitDays: uint(i)})
+		checkNoError(t, err)
+	}
+
+	Db.Where("name = ?", "Christmas").Delete(&api.HolidayCalendar{})
+	var calendar *api.HolidayCalendar
+	t.Run("CreateCalendar", func(t *testing.T) {
+		_, err := apiClient.CreateHolidayCalendar(ctx, api.HolidayCalendar{Name: "Christmas", Dates: []string{"25.12.2026"}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "not a YYYY-MM-DD date")
+
+		calendar, err = apiClient.CreateHolidayCalendar(ctx, api.HolidayCalendar{Name: "Christmas", Dates: []string{"2026-12-26", "2026-12-25", "2026-12-25"}})
+		checkNoError(t, err)
+		assertions.Equal([]string{"2026-12-25", "2026-12-26"}, calendar.Dates)
+
+		_, err = apiClient.CreateHolidayCalendar(ctx, api.HolidayCalendar{Name: "Christmas"})
+		checkFailsWithError(t, err, http.StatusConflict, "Name already taken.")
+	})
+
+	schedule := api.SendSchedule{
+		Days:              []string{"Mon", "tue", "wed", "thu", "fri"},
+		From:              "09:00",
+		Until:             "17:00",
+		TimeZone:          "America/New_York",
+		BusinessDaysOnly:  true,
+		HolidayCalendarID: calendar.ID,
+	}
+
+	t.Run("UpdateScheduleFailsForInvalidSchedule", func(t *testing.T) {
+		invalid := []struct {
+			schedule api.SendSchedule
+			msg      string
+		}{
+			{api.SendSchedule{Days: []string{"someday"}}, `Days: unknown day "someday"`},
+			{api.SendSchedule{From: "9am"}, "From: \"9am\" is not a HH:MM time"},
+			{api.SendSchedule{From: "17:00", Until: "09:00"}, "Until: must be after From"},
+			{api.SendSchedule{TimeZone: "Mars/Olympus"}, "TimeZone:"},
+			{api.SendSchedule{HolidayCalendarID: 1 << 30}, "HolidayCalendarID: calendar"},
+		}
+		for _, tc := range invalid {
+			_, err := apiClient.UpdateSequenceSchedule(ctx, sequenceID, tc.schedule)
+			checkFailsWithError(t, err, http.StatusBadRequest, tc.msg)
+		}
+	})
+
+	t.Run("UpdateSchedule", func(t *testing.T) {
+		sequence, err := apiClient.UpdateSequenceSchedule(ctx, sequenceID, schedule)
+		checkNoError(t, err)
+		assertions.Equal([]string{"mon", "tue", "wed", "thu", "fri"}, sequence.Schedule.Days)
+
+		// other updates keep the schedule
+		checkNoError(t, apiClient.UpdateSequence(ctx, sequenceID, api.Sequence{Name: "ScheduleSequence1", OpenTrackingEnabled: true}))
+		found, err := apiClient.GetSequence(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(calendar.ID, found.Sequence.Schedule.HolidayCalendarID)
+	})
+
+	t.Run("DeleteCalendarInUse", func(t *testing.T) {
+		err := apiClient.DeleteHolidayCalendar(ctx, calendar.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Calendar is used by a sequence schedule.")
+	})
+
+	t.Run("FailsForScheduleWithoutSendDay", func(t *testing.T) {
+		var everyDay []string
+		for day := time.Now().AddDate(0, 0, -2); day.Before(time.Now().AddDate(2, 0, 2)); day = day.AddDate(0, 0, 1) {
+			everyDay = append(everyDay, day.Format("2006-01-02"))
+		}
+
+		Db.Where("name = ?", "EveryDay").Delete(&api.HolidayCalendar{})
+		everyDayCalendar, err := apiClient.CreateHolidayCalendar(ctx, api.HolidayCalendar{Name: "EveryDay", Dates: everyDay})
+		checkNoError(t, err)
+		_, err = apiClient.UpdateSequenceSchedule(ctx, sequenceID, api.SendSchedule{Days: []string{"mon"}, HolidayCalendarID: everyDayCalendar.ID})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Days: no send day within the next")
+
+		// nor can the calendar of a schedule become one
+		_, err = apiClient.UpdateHolidayCalendar(ctx, calendar.ID, api.HolidayCalendar{Name: "Christmas", Dates: everyDay})
+		checkFailsWithError(t, err, http.StatusBadRequest, "no send day within the next")
+	})
+
+	_, err := apiClient.CreateContact(ctx, api.Contact{Email: "berlin@example.com", TimeZone: "Mars/Olympus"})
+	checkFailsWithError(t, err, http.StatusBadRequest, "TimeZone:")
+
+	berlin := createContact(t, "berlin@example.com")
+	Db.Model(berlin).Update("time_zone", "Europe/Berlin")
+	newYork := createContact(t, "newyork@example.com") // falls back to the schedule's time zone
+
+	// Thursday, 21:00 in Berlin & 15:00 in New York, the next day is a holiday
+	start := mustParseTime(t, "2026-12-24T20:00:00Z")
+
+	t.Run("PreviewInContactTimeZone", func(t *testing.T) {
+		previews, err := apiClient.PreviewSends(ctx, sequenceID, berlin.ID, start)
+		checkNoError(t, err)
+		if assertions.Len(previews, 3) {
+			// outside the window, holiday & weekend are skipped
+			assertions.Equal(mustParseTime(t, "2026-12-28T08:00:00Z"), previews[0].SendAt)
+			assertions.Equal("2026-12-28T09:00:00+01:00", previews[0].LocalAt)
+			assertions.Equal("Europe/Berlin", previews[0].TimeZone)
+			assertions.Equal(api.StepTypeEmail, previews[0].Type)
+			assertions.Equal("Hello", previews[0].Subject)
+			// 1 & 2 business days later
+			assertions.Equal(mustParseTime(t, "2026-12-29T08:00:00Z"), previews[1].SendAt)
+			assertions.Equal(mustParseTime(t, "2026-12-31T08:00:00Z"), previews[2].SendAt)
+		}
+	})
+
+	t.Run("PreviewInScheduleTimeZone", func(t *testing.T) {
+		previews, err := apiClient.PreviewSends(ctx, sequenceID, newYork.ID, start)
+		checkNoError(t, err)
+		if assertions.Len(previews, 3) {
+			assertions.Equal(start, previews[0].SendAt) // inside the window
+			assertions.Equal("America/New_York", previews[0].TimeZone)
+			assertions.Equal(mustParseTime(t, "2026-12-28T20:00:00Z"), previews[1].SendAt)
+			assertions.Equal(mustParseTime(t, "2026-12-30T20:00:00Z"), previews[2].SendAt)
+		}
+	})
+
+	t.Run("PreviewInScheduleTimeZoneForUnknownContactTimeZone", func(t *testing.T) {
+		// saved before time zones were validated
+		mars := createContact(t, "mars@example.com")
+		Db.Model(mars).Update("time_zone", "Mars/Olympus")
+
+		previews, err := apiClient.PreviewSends(ctx, sequenceID, mars.ID, start)
+		checkNoError(t, err)
+		if assertions.Len(previews, 3) {
+			assertions.Equal(start, previews[0].SendAt)
+			assertions.Equal("America/New_York", previews[0].TimeZone)
+		}
+	})
+
+	t.Run("PreviewFollowsStepTypes", func(t *testing.T) {
+		typesSequenceID := createSequence(t, api.Sequence{Name: "ScheduleSequence2"})
+		launch := mustParseTime(t, "2027-01-11T12:00:00Z")
+		for _, step := range []api.SequenceStep{
+			{Subject: "Hello", Content: "blah contents"},
+			{Type: api.StepTypeWaitUntil, Subject: "Wait for launch", WaitUntil: &launch},
+			{Type: api.StepTypeHTTPCall, Subject: "Notify CRM", URL: "https://crm.example.com/hook"},
+			{Type: api.StepTypeManualTask, Subject: "Call them", WaitDays: 1},
+			{Subject: "After the call", Content: "blah contents"},
+		} {
+			step.SequenceID = typesSequenceID
+			_, err := apiClient.CreateStep(ctx, step)
+			checkNoError(t, err)
+		}
+
+		previews, err := apiClient.PreviewSends(ctx, typesSequenceID, newYork.ID, start)
+		checkNoError(t, err)
+		// the step after the manual task is due once the task is done
+		if assertions.Len(previews, 4) {
+			assertions.Equal(start, previews[0].SendAt)
+			assertions.Equal(api.StepTypeWaitUntil, previews[1].Type)
+			assertions.Empty(previews[1].Subject)
+			assertions.Equal(launch, previews[1].SendAt)
+			assertions.Equal(api.StepTypeHTTPCall, previews[2].Type)
+			assertions.Equal(launch, previews[2].SendAt)
+			assertions.Equal(api.StepTypeManualTask, previews[3].Type)
+			assertions.Equal(launch.Add(24*time.Hour), previews[3].SendAt)
+		}
+	})
+
+	t.Run("PreviewFollowsEdges", func(t *testing.T) {
+		edgesSequenceID := createSequence(t, api.Sequence{Name: "ScheduleSequence3"})
+		steps := map[string]*api.SequenceStep{}
+		for _, subject := range []string{"Intro", "Enterprise plan", "Nurture", "Thanks for reading", "Bump"} {
+			step, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: edgesSequenceID, Subject: subject, Content: "blah contents", WaitDays: 1})
+			checkNoError(t, err)
+			steps[subject] = step
+		}
+		_, err := apiClient.UpdateSequenceEdges(ctx, edgesSequenceID, api.SequenceGraph{Edges: []api.StepEdge{
+			{FromStepID: steps["Intro"].ID, ToStepID: steps["Enterprise plan"].ID, Condition: api.EdgeAttribute, Attribute: "email", Value: "*@bigcorp.com"},
+			{FromStepID: steps["Intro"].ID, ToStepID: steps["Nurture"].ID, Condition: api.EdgeAlways, Priority: 1},
+			{FromStepID: steps["Nurture"].ID, ToStepID: steps["Thanks for reading"].ID, Condition: api.EdgeOpened},
+			{FromStepID: steps["Nurture"].ID, ToStepID: steps["Bump"].ID, Condition: api.EdgeNotOpened, WithinDays: 3, Priority: 1},
+		}})
+		checkNoError(t, err)
+
+		// the branch taken depends on whether the nurture email gets opened
+		previews, err := apiClient.PreviewSends(ctx, edgesSequenceID, newYork.ID, start)
+		checkNoError(t, err)
+		if assertions.Len(previews, 2) {
+			assertions.Equal(steps["Intro"].ID, previews[0].StepID)
+			assertions.Empty(previews[0].Branches)
+			assertions.Equal(steps["Nurture"].ID, previews[1].StepID)
+			assertions.Equal(start.Add(2*24*time.Hour), previews[1].SendAt)
+			assertions.Equal([]uint{steps["Thanks for reading"].ID, steps["Bump"].ID}, previews[1].Branches)
+		}
+
+		bigCorp := createContact(t, "schedule@bigcorp.com")
+		previews, err = apiClient.PreviewSends(ctx, edgesSequenceID, bigCorp.ID, start)
+		checkNoError(t, err)
+		if assertions.Len(previews, 2) {
+			assertions.Equal(steps["Enterprise plan"].ID, previews[1].StepID)
+			assertions.Empty(previews[1].Branches)
+		}
+	})
+
+	t.Run("PreviewFailsForUnknownContact", func(t *testing.T) {
+		_, err := apiClient.PreviewSends(ctx, sequenceID, 0, start)
+		checkFailsWithError(t, err, http.StatusNotFound, "Contact not found.")
+	})
+
+	t.Run("SchedulerWaitsForWindow", func(t *testing.T) {
+		sender := &recordingSender{}
+		scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+
+		enrollment, err := apiClient.Enroll(ctx, sequenceID, berlin.ID)
+		checkNoError(t, err)
+
+		// Sunday noon in Berlin
+		sunday := mustParseTime(t, "2027-01-03T11:00:00Z")
+		Db.Model(&api.Enrollment{}).Where("id = ?", enrollment.ID).Update("next_send_at", sunday)
+		scheduler.Now = func() time.Time { return sunday }
+		assertions.Zero(scheduler.RunDue(ctx))
+
+		enrollments, err := apiClient.ListEnrollments(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(mustParseTime(t, "2027-01-04T08:00:00Z"), enrollments[0].NextSendAt.UTC())
+
+		monday := mustParseTime(t, "2027-01-04T08:00:00Z")
+		scheduler.Now = func() time.Time { return monday }
+		assertions.Equal(1, scheduler.RunDue(ctx))
+
+		// the next steps are due within the time frame of the other tests' schedulers
+		Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+	})
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// createSegment removes a leftover of a previous run (with the same name) first
+func createSegment(t *testing.T, segment api.Segment) *api.Segment {
+	Db.Where("workspace = ? AND name = ?", api.DefaultWorkspace, segment.Name).Delete(&api.Segment{})
+	created, err := apiClient.CreateSegment(ctx, segment)
+	checkNoError(t, err)
+	return created
+}
+
+// Will run sequentially
+func TestSegments(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	sequenceID := createSequence(t, api.Sequence{Name: "SegmentSequence1"})
+	otherSequenceID := createSequence(t, api.Sequence{Name: "SegmentSequence2"})
+	defer Db.Where("sequence_id IN ?", []uint{sequenceID, otherSequenceID}).Delete(&api.Enrollment{})
+	_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Intro", Content: "blah contents"})
+	checkNoError(t, err)
+
+	t.Run("CreateFailsForInvalidSegment", func(t *testing.T) {
+		cases := []struct {
+			segment api.Segment
+			msg     string
+		}{
+			{api.Segment{}, "Name: non zero value required"},
+			{api.Segment{Name: "Bad", Rules: []api.SegmentRule{{Attribute: "company", Operator: api.SegmentOpEquals, Value: "acme"}}}, "Rules[0]: Attribute: must be one of status, tag, email"},
+			{api.Segment{Name: "Bad", Rules: []api.SegmentRule{{Attribute: "email", Operator: api.SegmentOpHas, Value: "x"}}}, "Rules[0]: Operator: has & not_has are the only operators of tag"},
+			{api.Segment{Name: "Bad", Rules: []api.SegmentRule{{Attribute: "email", Operator: api.SegmentOpMatches, Value: "[a"}}}, `Rules[0]: Value: "[a" is not a valid pattern`},
+		}
+		for _, c := range cases {
+			_, err := apiClient.CreateSegment(ctx, c.segment)
+			checkFailsWithError(t, err, http.StatusBadRequest, c.msg)
+		}
+	})
+
+	vips := createSegment(t, api.Segment{Name: "Segment VIPs", Rules: []api.SegmentRule{
+		{Attribute: api.SegmentAttributeTag, Operator: api.SegmentOpHas, Value: "Segment-VIP"},
+		{Attribute: "email", Operator: api.SegmentOpMatches, Value: "segment-*@example.com"},
+	}})
+	churned := createSegment(t, api.Segment{Name: "Segment churned", Rules: []api.SegmentRule{
+		{Attribute: api.SegmentAttributeTag, Operator: api.SegmentOpHas, Value: "segment-churned"},
+	}})
+	defer Db.Delete(&api.Segment{}, []uint{vips.ID, churned.ID})
+	defer Db.Model(&api.Sequence{}).Where("id = ?", sequenceID).Update("auto_enroll_segment_id", 0)
+	assertions.Equal("segment-vip", vips.Rules[0].Value)
+
+	t.Run("CreateFailsForTakenName", func(t *testing.T) {
+		_, err := apiClient.CreateSegment(ctx, api.Segment{Name: "Segment VIPs"})
+		checkFailsWithError(t, err, http.StatusConflict, "Name already taken.")
+	})
+
+	tag := func(contact *api.Contact, tags ...string) {
+		contact.Tags = tags
+		_, err := apiClient.UpdateContact(ctx, contact.ID, *contact)
+		checkNoError(t, err)
+	}
+	member := createContact(t, "segment-member@example.com")
+	tag(member, "segment-vip")
+	churnedMember := createContact(t, "segment-churned@example.com")
+	tag(churnedMember, "SEGMENT-VIP", "segment-churned")
+	busyMember := createContact(t, "segment-busy@example.com")
+	tag(busyMember, "segment-vip")
+	outsider := createContact(t, "outsider-segment@example.com")
+	tag(outsider, "segment-vip")
+	newcomer := createContact(t, "segment-newcomer@example.com")
+
+	members := func(id uint) []uint {
+		contacts, err := apiClient.ListSegmentContacts(ctx, id)
+		checkNoError(t, err)
+		var ids []uint
+		for _, contact := range contacts {
+			ids = append(ids, contact.ID)
+		}
+		return ids
+	}
+	enrolled := func(sequenceID uint, contactID uint) *api.Enrollment {
+		return (&service.EnrollmentService{Db: Db}).GetByContact(sequenceID, contactID)
+	}
+
+	t.Run("ListsMembers", func(t *testing.T) {
+		assertions.Equal([]uint{member.ID, churnedMember.ID, busyMember.ID}, members(vips.ID))
+		assertions.Equal([]uint{churnedMember.ID}, members(churned.ID))
+
+		contact, err := apiClient.GetContact(ctx, churnedMember.ID)
+		checkNoError(t, err)
+		assertions.Equal([]string{"segment-vip", "segment-churned"}, contact.Tags)
+	})
+
+	t.Run("UpdateAutoEnrollmentFailsForUnknownSegment", func(t *testing.T) {
+		_, err := apiClient.UpdateAutoEnrollment(ctx, sequenceID, api.AutoEnrollment{SegmentID: 999999})
+		checkFailsWithError(t, err, http.StatusBadRequest, "SegmentID: segment 999999 not found")
+
+		_, err = apiClient.UpdateAutoEnrollment(ctx, sequenceID, api.AutoEnrollment{SegmentID: vips.ID, ExcludeSegmentID: vips.ID})
+		checkFailsWithError(t, err, http.StatusBadRequest, "ExcludeSegmentID: can't be the enrolled segment")
+
+		_, err = apiClient.UpdateAutoEnrollment(ctx, sequenceID, api.AutoEnrollment{SegmentID: vips.ID, Reenrollment: "always"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Reenrollment: always does not validate")
+	})
+
+	t.Run("EnrollsMembersWithoutExclusions", func(t *testing.T) {
+		_, err := apiClient.Enroll(ctx, otherSequenceID, busyMember.ID)
+		checkNoError(t, err)
+
+		sequence, err := apiClient.UpdateAutoEnrollment(ctx, sequenceID, api.AutoEnrollment{
+			SegmentID:              vips.ID,
+			ExcludeSegmentID:       churned.ID,
+			ExcludeActiveElsewhere: true,
+		})
+		checkNoError(t, err)
+		assertions.Equal(api.ReenrollNever, sequence.AutoEnrollment.Reenrollment)
+
+		assertions.NotZero(enrolled(sequenceID, member.ID).ID)
+		assertions.Zero(enrolled(sequenceID, churnedMember.ID).ID)
+		assertions.Zero(enrolled(sequenceID, busyMember.ID).ID)
+		assertions.Zero(enrolled(sequenceID, outsider.ID).ID)
+	})
+
+	t.Run("EnrollsContactsEnteringTheSegment", func(t *testing.T) {
+		assertions.Zero(enrolled(sequenceID, newcomer.ID).ID)
+		tag(newcomer, "segment-vip")
+		assertions.Equal(api.EnrollmentActive, enrolled(sequenceID, newcomer.ID).Status)
+
+		tag(churnedMember, "segment-vip")
+		assertions.NotZero(enrolled(sequenceID, churnedMember.ID).ID)
+
+		Db.Where("email = ?", "segment-created@example.com").Delete(&api.Contact{})
+		created, err := apiClient.CreateContact(ctx, api.Contact{Email: "segment-created@example.com", Tags: []string{"segment-vip"}})
+		checkNoError(t, err)
+		defer Db.Delete(&api.Contact{}, created.ID)
+		assertions.NotZero(enrolled(sequenceID, created.ID).ID)
+	})
+
+	t.Run("ReenrollsPerPolicy", func(t *testing.T) {
+		enrollment := enrolled(sequenceID, member.ID)
+		Db.Model(enrollment).Update("status", api.EnrollmentCompleted)
+
+		_, err := apiClient.Enroll(ctx, sequenceID, member.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Contact already enrolled.")
+
+		_, err = apiClient.UpdateAutoEnrollment(ctx, sequenceID, api.AutoEnrollment{SegmentID: vips.ID, Reenrollment: api.ReenrollAfterCompletion, ReenrollAfterDays: 30})
+		checkNoError(t, err)
+		assertions.Equal(api.EnrollmentCompleted, enrolled(sequenceID, member.ID).Status)
+
+		// completed long enough ago
+		Db.Model(&api.Enrollment{}).Where("id = ?", enrollment.ID).UpdateColumn("updated_at", time.Now().UTC().AddDate(0, 0, -31))
+		assertions.Equal(1, (&service.AutoEnrollService{Db: Db}).SyncAll(time.Now().UTC()))
+		restarted := enrolled(sequenceID, member.ID)
+		assertions.Equal(enrollment.ID, restarted.ID)
+		assertions.Equal(api.EnrollmentActive, restarted.Status)
+		assertions.Equal(uint(0), restarted.NextStep)
+
+		// manually too
+		Db.Model(&api.Enrollment{}).Where("id = ?", enrollment.ID).Updates(map[string]any{"status": api.EnrollmentCompleted, "updated_at": time.Now().UTC().AddDate(0, 0, -31)})
+		reenrolled, err := apiClient.Enroll(ctx, sequenceID, member.ID)
+		checkNoError(t, err)
+		assertions.Equal(enrollment.ID, reenrolled.ID)
+		assertions.Equal(api.EnrollmentActive, reenrolled.Status)
+	})
+
+	t.Run("DeleteFailsForSegmentInUse", func(t *testing.T) {
+		err := apiClient.DeleteSegment(ctx, vips.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Segment is used by a sequence.")
+
+		err = apiClient.DeleteSegment(ctx, churned.ID)
+		checkNoError(t, err)
+		_, err = apiClient.GetSegment(ctx, churned.ID)
+		checkFailsWih404(t, err)
+	})
+}
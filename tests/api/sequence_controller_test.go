@@ -4,31 +4,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/sitetester/sequence-api/api"
-	"github.com/sitetester/sequence-api/config"
+	"github.com/sitetester/sequence-api/api/service"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"testing"
 )
 
-func checkByID(t *testing.T, url string, inputSequence api.Sequence) {
-	recorder := performRequest(t, http.MethodGet, url, nil)
-	checkStatusCode(t, http.StatusOK, recorder.Code)
+func checkByID(t *testing.T, id uint, inputSequence api.Sequence) {
+	sequenceWithSteps, err := apiClient.GetSequence(ctx, id)
+	checkNoError(t, err)
 
-	var sequenceWithSteps *api.SequenceWithSteps
-	json.NewDecoder(recorder.Body).Decode(&sequenceWithSteps)
 	assert.Equal(t, inputSequence.Name, sequenceWithSteps.Sequence.Name)
 	assert.Equal(t, inputSequence.OpenTrackingEnabled, sequenceWithSteps.Sequence.OpenTrackingEnabled)
 	assert.Equal(t, inputSequence.ClickTrackingEnabled, sequenceWithSteps.Sequence.ClickTrackingEnabled)
 }
 
-func checkBindJsonAndValidation(t *testing.T, method string, url string) {
+// checkBindJsonAndValidation `send` performs the request with given (raw) body
+func checkBindJsonAndValidation(t *testing.T, send func(body any) error) {
 	t.Run("FailsForJSONBinding", func(t *testing.T) {
 		inputSequence := map[string]interface{}{
 			"Name":                 "Sequence123",
 			"OpenTrackingEnabled":  "abc", // a string value
 			"ClickTrackingEnabled": true,
 		}
-		checkFailsWithError(t, method, url, inputSequence, http.StatusBadRequest, "json: cannot unmarshal")
+		checkFailsWithError(t, send(inputSequence), http.StatusBadRequest, "json: cannot unmarshal")
 	})
 
 	t.Run("FailsForNameMinLengthValidation", func(t *testing.T) {
@@ -37,7 +36,7 @@ func checkBindJsonAndValidation(t *testing.T, method string, url string) {
 			OpenTrackingEnabled:  false,
 			ClickTrackingEnabled: true,
 		}
-		checkFailsWithError(t, method, url, inputSequence, http.StatusBadRequest, "minstringlength(3)")
+		checkFailsWithError(t, send(inputSequence), http.StatusBadRequest, "minstringlength(3)")
 	})
 }
 
@@ -47,7 +46,6 @@ func TestSequence(t *testing.T) {
 
 	assertions := assert.New(t)
 
-	sequencesUrl := config.ApiVersion + "/sequences"
 	baseSequence := api.Sequence{
 		Name:                 "Sequence1",
 		OpenTrackingEnabled:  false,
@@ -56,36 +54,36 @@ func TestSequence(t *testing.T) {
 
 	var newSequenceID uint
 	t.Run("Create", func(t *testing.T) {
-		checkBindJsonAndValidation(t, http.MethodPost, sequencesUrl)
+		checkBindJsonAndValidation(t, func(body any) error {
+			return apiClient.Do(ctx, http.MethodPost, "/sequences", body, nil)
+		})
 
 		t.Run("Success", func(t *testing.T) {
 			deleteSequenceByName(baseSequence.Name)
 
-			recorder := performRequest(t, http.MethodPost, sequencesUrl, baseSequence)
-			checkStatusCode(t, http.StatusCreated, recorder.Code)
-
-			var postResult *api.Sequence
-			json.NewDecoder(recorder.Body).Decode(&postResult)
+			postResult, err := apiClient.CreateSequence(ctx, baseSequence)
+			checkNoError(t, err)
 			newSequenceID = postResult.ID
 
 			// now check the "by ID" endpoint
-			checkByID(t, buildUrl(sequencesUrl, newSequenceID), baseSequence)
+			checkByID(t, newSequenceID, baseSequence)
 		})
 
 		t.Run("FailsForDuplicateName", func(t *testing.T) {
-			checkFailsWithError(t, http.MethodPost, sequencesUrl, baseSequence, http.StatusConflict, "Name already assigned")
+			_, err := apiClient.CreateSequence(ctx, baseSequence)
+			checkFailsWithError(t, err, http.StatusConflict, "Name already assigned")
 		})
 	})
 
 	// CAUTION! This has dependency on ```postResult.ID``` (from `Create` step)
 	t.Run("Update", func(t *testing.T) {
-		updateUrl := buildUrl(sequencesUrl, newSequenceID)
-
 		t.Run("FailsForNonExistingSequenceID", func(t *testing.T) {
-			checkFailsWih404(t, http.MethodPut, buildUrl(sequencesUrl, 0))
+			checkFailsWih404(t, apiClient.UpdateSequence(ctx, 0, baseSequence))
 		})
 
-		checkBindJsonAndValidation(t, http.MethodPut, updateUrl)
+		checkBindJsonAndValidation(t, func(body any) error {
+			return apiClient.Do(ctx, http.MethodPut, fmt.Sprintf("/sequences/%d", newSequenceID), body, nil)
+		})
 
 		t.Run("FailsForDuplicateName(ForAnyOtherSequence)", func(t *testing.T) {
 			// let's first create 2 sequences
@@ -93,27 +91,20 @@ func TestSequence(t *testing.T) {
 			inputSequence1.Name = "Sequence11"
 			deleteSequenceByName(inputSequence1.Name)
 
-			recorder := performRequest(t, http.MethodPost, sequencesUrl, inputSequence1)
-			checkStatusCode(t, http.StatusCreated, recorder.Code)
-			var postResult1 *api.Sequence
-			json.NewDecoder(recorder.Body).Decode(&postResult1)
+			postResult1, err := apiClient.CreateSequence(ctx, inputSequence1)
+			checkNoError(t, err)
 
 			inputSequence2 := baseSequence
 			inputSequence2.Name = "Sequence22"
 			deleteSequenceByName(inputSequence2.Name)
-			recorder = performRequest(t, http.MethodPost, sequencesUrl, inputSequence2)
-			checkStatusCode(t, http.StatusCreated, recorder.Code)
-			var postResult2 *api.Sequence
-			json.NewDecoder(recorder.Body).Decode(&postResult2) // capture it's ID
+			postResult2, err := apiClient.CreateSequence(ctx, inputSequence2) // capture it's ID
+			checkNoError(t, err)
 
 			// Now try to change inputSequence2 name to inputSequence1
 			inputSequence2.Name = inputSequence1.Name
-			url := buildUrl(sequencesUrl, postResult2.ID)
-			recorder = performRequest(t, http.MethodPut, url, inputSequence2)
-			checkStatusCode(t, http.StatusConflict, recorder.Code)
-			resp := parseErrorResponse(recorder)
+			err = apiClient.UpdateSequence(ctx, postResult2.ID, inputSequence2)
 			msg := fmt.Sprintf("Name already assigned to sequence: %d", postResult1.ID)
-			assertions.Contains(resp.Error, msg)
+			checkFailsWithError(t, err, http.StatusConflict, msg)
 		})
 
 		t.Run("Success", func(t *testing.T) {
@@ -125,19 +116,189 @@ func TestSequence(t *testing.T) {
 
 			// delete the existing record (if any, when this test is run 2nd time)
 			Db.Where("name = ? AND id != ? ", updateInput.Name, newSequenceID).Delete(&api.Sequence{})
-			recorder := performRequest(t, http.MethodPut, updateUrl, updateInput)
-			checkStatusCode(t, http.StatusOK, recorder.Code)
+			checkNoError(t, apiClient.UpdateSequence(ctx, newSequenceID, updateInput))
 
 			// now check the "by ID" endpoint
-			checkByID(t, updateUrl, updateInput)
+			checkByID(t, newSequenceID, updateInput)
 		})
 	})
 
 	t.Run("ViewWithSteps", func(t *testing.T) {
 		t.Run("FailsForNonExistingSequenceID", func(t *testing.T) {
-			checkFailsWih404(t, http.MethodGet, buildUrl(sequencesUrl, 0))
+			_, err := apiClient.GetSequence(ctx, 0)
+			checkFailsWih404(t, err)
 		})
 
 		// `Success` case was already covered in `Create` & `Update` tests above
 	})
+
+	t.Run("List", func(t *testing.T) {
+		sequences, err := apiClient.ListSequences(ctx)
+		checkNoError(t, err)
+
+		var names []string
+		for _, sequence := range sequences {
+			names = append(names, sequence.Name)
+		}
+		assertions.Contains(names, "Sequence123")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		t.Run("FailsForNonExistingSequenceID", func(t *testing.T) {
+			checkFailsWih404(t, apiClient.DeleteSequence(ctx, 0))
+		})
+
+		t.Run("Success", func(t *testing.T) {
+			step := api.SequenceStep{Subject: "Step1", Content: "blah contents", SequenceID: newSequenceID}
+			stepResult, err := apiClient.CreateStep(ctx, step)
+			checkNoError(t, err)
+
+			checkNoError(t, apiClient.DeleteSequence(ctx, newSequenceID))
+
+			_, err = apiClient.GetSequence(ctx, newSequenceID)
+			checkFailsWih404(t, err)
+			// steps are deleted too
+			_, err = apiClient.GetStep(ctx, stepResult.ID)
+			checkFailsWih404(t, err)
+		})
+	})
+}
+
+// Will run sequentially
+func TestSequenceImportExport(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	document := api.SequenceDocument{
+		Version: api.SequenceDocumentVersion,
+		Sequence: api.SequenceDocumentSpec{
+			Name:                "ImportedSequence1",
+			OpenTrackingEnabled: true,
+			Steps: []api.SequenceDocumentStep{
+				{Subject: "Intro", Content: "Hello there", WaitDays: 0},
+				{Subject: "Follow up", Content: "Any news?", WaitDays: 3},
+			},
+		},
+	}
+	// clean up leftovers (including steps) of a previous run
+	createSequence(t, api.Sequence{Name: document.Sequence.Name})
+	deleteSequenceByName(document.Sequence.Name)
+
+	t.Run("FailsForUnsupportedVersion", func(t *testing.T) {
+		invalid := document
+		invalid.Version = 99
+		_, err := apiClient.ImportSequence(ctx, invalid, false)
+		checkFailsWithError(t, err, http.StatusBadRequest, "unsupported document version")
+	})
+
+	t.Run("FailsForDuplicateSubject", func(t *testing.T) {
+		invalid := document
+		invalid.Sequence.Steps = []api.SequenceDocumentStep{document.Sequence.Steps[0], document.Sequence.Steps[0]}
+		_, err := apiClient.ImportSequence(ctx, invalid, false)
+		checkFailsWithError(t, err, http.StatusBadRequest, "duplicate subject")
+	})
+
+	t.Run("DryRunCreate", func(t *testing.T) {
+		result, err := apiClient.ImportSequence(ctx, document, true)
+		checkNoError(t, err)
+		assertions.True(result.DryRun)
+		assertions.Equal(api.ImportActionCreate, result.Action)
+		assertions.Len(result.Changes, 3)
+
+		var count int64
+		Db.Model(&api.Sequence{}).Where("name = ?", document.Sequence.Name).Count(&count)
+		assertions.Zero(count)
+	})
+
+	var sequenceID uint
+	t.Run("Create", func(t *testing.T) {
+		result, err := apiClient.ImportSequence(ctx, document, false)
+		checkNoError(t, err)
+		assertions.Equal(api.ImportActionCreate, result.Action)
+		sequenceID = result.SequenceID
+		checkByID(t, sequenceID, api.Sequence{Name: document.Sequence.Name, OpenTrackingEnabled: true})
+	})
+
+	t.Run("ExportRoundTrip", func(t *testing.T) {
+		exported, err := apiClient.ExportSequence(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(document, *exported)
+
+		// importing it back is a no-op
+		result, err := apiClient.ImportSequence(ctx, *exported, false)
+		checkNoError(t, err)
+		assertions.Equal(api.ImportActionUnchanged, result.Action)
+		assertions.Empty(result.Changes)
+	})
+
+	t.Run("ExportYAML", func(t *testing.T) {
+		exported, err := apiClient.ExportSequenceYAML(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Contains(string(exported), "waitDays: 3")
+	})
+
+	t.Run("ExportJob", func(t *testing.T) {
+		job, err := apiClient.QueueExport(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(api.JobTypeSequenceExport, job.Type)
+
+		service.NewJobWorker(Db).RunDue(ctx)
+		job, err = apiClient.GetJob(ctx, job.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.JobSucceeded, job.Status)
+
+		var exported api.SequenceDocument
+		checkNoError(t, json.Unmarshal([]byte(job.Result), &exported))
+		assertions.Equal(document, exported)
+
+		_, err = apiClient.QueueExport(ctx, 0)
+		checkFailsWih404(t, err)
+	})
+
+	t.Run("UpdateFromYAML", func(t *testing.T) {
+		yamlDocument := []byte(`
+version: 1
+sequence:
+  name: ImportedSequence1
+  openTrackingEnabled: false
+  clickTrackingEnabled: true
+  steps:
+    - subject: Follow up
+      content: Any news?
+      waitDays: 2
+    - subject: Break up
+      content: Closing the loop
+      waitDays: 5
+`)
+
+		dryRun, err := apiClient.ImportSequenceYAML(ctx, yamlDocument, true)
+		checkNoError(t, err)
+		assertions.Equal(api.ImportActionUpdate, dryRun.Action)
+		assertions.ElementsMatch([]string{
+			"set OpenTrackingEnabled to false",
+			"set ClickTrackingEnabled to true",
+			`update step "Follow up"`,
+			`create step "Break up"`,
+			`delete step "Intro"`,
+		}, dryRun.Changes)
+
+		_, err = apiClient.ImportSequenceYAML(ctx, yamlDocument, false)
+		checkNoError(t, err)
+
+		sequenceWithSteps, err := apiClient.GetSequence(ctx, sequenceID)
+		checkNoError(t, err)
+		steps := *sequenceWithSteps.Steps
+		if assertions.Len(steps, 2) {
+			assertions.Equal("Follow up", steps[0].Subject)
+			assertions.Equal(uint(2), steps[0].WaitDays)
+			assertions.Equal("Break up", steps[1].Subject)
+			assertions.Equal(uint(2), steps[1].Position)
+		}
+	})
+
+	t.Run("ExportFailsForNonExistingSequenceID", func(t *testing.T) {
+		_, err := apiClient.ExportSequence(ctx, 0)
+		checkFailsWih404(t, err)
+	})
 }
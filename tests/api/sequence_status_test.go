@@ -0,0 +1,150 @@
+package api
+
+import (
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Will run sequentially
+func TestSequenceStatus(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	t.Run("CreateFailsForInvalidStatus", func(t *testing.T) {
+		_, err := apiClient.CreateSequence(ctx, api.Sequence{Name: "StatusSequence2", Status: api.SequencePaused})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Status: must be one of draft, active")
+	})
+
+	sequenceID := createSequence(t, api.Sequence{Name: "StatusSequence1", Status: api.SequenceDraft})
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+	for _, step := range []api.SequenceStep{
+		{Subject: "Intro", Content: "blah contents"},
+		{Subject: "Follow up", Content: "blah contents", WaitDays: 1},
+	} {
+		step.SequenceID = sequenceID
+		_, err := apiClient.CreateStep(ctx, step)
+		checkNoError(t, err)
+	}
+
+	sender := &recordingSender{}
+	scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+	runAt := func(at time.Time) int {
+		scheduler.Now = func() time.Time { return at }
+		return scheduler.RunDue(ctx)
+	}
+	reload := func(id uint) api.Enrollment {
+		var found api.Enrollment
+		Db.First(&found, id)
+		return found
+	}
+
+	now := time.Now().UTC().Add(time.Hour)
+	first, err := apiClient.Enroll(ctx, sequenceID, createContact(t, "status-first@example.com").ID)
+	checkNoError(t, err)
+	second, err := apiClient.Enroll(ctx, sequenceID, createContact(t, "status-second@example.com").ID)
+	checkNoError(t, err)
+
+	t.Run("ActivatesDraft", func(t *testing.T) {
+		assertions.Equal(0, runAt(now))
+
+		activated, err := apiClient.ActivateSequence(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(api.SequenceActive, activated.Status)
+		assertions.Equal(2, runAt(now))
+
+		_, err = apiClient.ActivateSequence(ctx, sequenceID)
+		checkFailsWithError(t, err, http.StatusConflict, "Sequence is not a draft.")
+	})
+
+	t.Run("PauseHoldsSends", func(t *testing.T) {
+		paused, err := apiClient.PauseSequence(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(api.SequencePaused, paused.Status)
+		assertions.NotNil(paused.PausedAt)
+		assertions.Equal(0, runAt(now.Add(48*time.Hour)))
+
+		_, err = apiClient.PauseSequence(ctx, sequenceID)
+		checkFailsWithError(t, err, http.StatusConflict, "Sequence is not active.")
+	})
+
+	t.Run("ResumeShiftsDueTimes", func(t *testing.T) {
+		// paused for two days
+		Db.Model(&api.Sequence{}).Where("id = ?", sequenceID).Update("paused_at", time.Now().UTC().Add(-48*time.Hour))
+		dueAt := *reload(first.ID).NextSendAt
+
+		resumed, err := apiClient.ResumeSequence(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(api.SequenceActive, resumed.Status)
+		assertions.Nil(resumed.PausedAt)
+		assertions.WithinDuration(dueAt.Add(48*time.Hour), *reload(first.ID).NextSendAt, time.Minute)
+
+		// the follow-ups which fell due meanwhile aren't sent at once
+		assertions.Equal(0, runAt(now.Add(25*time.Hour)))
+
+		_, err = apiClient.ResumeSequence(ctx, sequenceID)
+		checkFailsWithError(t, err, http.StatusConflict, "Sequence is not paused.")
+	})
+
+	t.Run("PausesEnrollment", func(t *testing.T) {
+		paused, err := apiClient.PauseEnrollment(ctx, sequenceID, first.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.EnrollmentPaused, paused.Status)
+		assertions.Equal(1, runAt(now.Add(73*time.Hour)))
+		assertions.Equal(api.EnrollmentCompleted, reload(second.ID).Status)
+
+		_, err = apiClient.PauseEnrollment(ctx, sequenceID, first.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Enrollment is not active.")
+	})
+
+	t.Run("ResumesEnrollment", func(t *testing.T) {
+		Db.Model(&api.Enrollment{}).Where("id = ?", first.ID).Update("paused_at", time.Now().UTC().Add(-24*time.Hour))
+		dueAt := *reload(first.ID).NextSendAt
+
+		resumed, err := apiClient.ResumeEnrollment(ctx, sequenceID, first.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.EnrollmentActive, resumed.Status)
+		assertions.WithinDuration(dueAt.Add(24*time.Hour), *resumed.NextSendAt, time.Minute)
+
+		_, err = apiClient.ResumeEnrollment(ctx, sequenceID, first.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Enrollment is not paused.")
+	})
+
+	t.Run("StopsEnrollment", func(t *testing.T) {
+		stopped, err := apiClient.StopEnrollment(ctx, sequenceID, first.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.EnrollmentStopped, stopped.Status)
+		assertions.Nil(stopped.NextSendAt)
+		assertions.Equal(0, runAt(now.Add(30*24*time.Hour)))
+
+		_, err = apiClient.StopEnrollment(ctx, sequenceID, first.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Enrollment already finished.")
+	})
+
+	t.Run("FailsForUnknownEnrollment", func(t *testing.T) {
+		_, err := apiClient.PauseEnrollment(ctx, sequenceID, 999999)
+		checkFailsWithError(t, err, http.StatusNotFound, "Enrollment not found.")
+
+		otherSequenceID := createSequence(t, api.Sequence{Name: "StatusSequence3"})
+		_, err = apiClient.StopEnrollment(ctx, otherSequenceID, first.ID)
+		checkFailsWithError(t, err, http.StatusNotFound, "Enrollment not found.")
+	})
+
+	t.Run("Archive", func(t *testing.T) {
+		archived, err := apiClient.ArchiveSequence(ctx, sequenceID)
+		checkNoError(t, err)
+		assertions.Equal(api.SequenceArchived, archived.Status)
+
+		_, err = apiClient.ArchiveSequence(ctx, sequenceID)
+		checkFailsWithError(t, err, http.StatusConflict, "Sequence already archived.")
+		_, err = apiClient.ResumeSequence(ctx, sequenceID)
+		checkFailsWithError(t, err, http.StatusConflict, "Sequence is not paused.")
+
+		_, err = apiClient.Enroll(ctx, sequenceID, createContact(t, "status-late@example.com").ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Sequence is archived.")
+	})
+}
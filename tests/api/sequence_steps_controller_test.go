@@ -1,34 +1,32 @@
 package api
 
 import (
-	"encoding/json"
+	"fmt"
 	"github.com/sitetester/sequence-api/api"
-	"github.com/sitetester/sequence-api/config"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"testing"
+	"time"
 )
 
-func checkStepByID(t *testing.T, url string, inputStep api.SequenceStep) {
+func checkStepByID(t *testing.T, id uint, inputStep api.SequenceStep) {
 	assertions := assert.New(t)
-	recorder := performRequest(t, http.MethodGet, url, nil)
-	checkStatusCode(t, http.StatusOK, recorder.Code)
-
-	var stepResultByID *api.SequenceStep
-	json.NewDecoder(recorder.Body).Decode(&stepResultByID)
+	stepResultByID, err := apiClient.GetStep(ctx, id)
+	checkNoError(t, err)
 
 	assertions.Equal(inputStep.SequenceID, stepResultByID.SequenceID)
 	assertions.Equal(inputStep.Subject, stepResultByID.Subject)
 	assertions.Equal(inputStep.Content, stepResultByID.Content)
 }
 
-func checkBindJonAndValidation(t *testing.T, method string, url string) {
+// checkBindJonAndValidation `send` performs the request with given (raw) body
+func checkBindJonAndValidation(t *testing.T, send func(body any) error) {
 	t.Run("FailsForBindJSON", func(t *testing.T) {
 		inputStep := map[string]interface{}{
 			"Subject": 123, // numeric input (must be in double quotes to consider as string)
 			"Content": "abc",
 		}
-		checkFailsWithError(t, method, url, inputStep, http.StatusBadRequest, "json: cannot unmarshal")
+		checkFailsWithError(t, send(inputStep), http.StatusBadRequest, "json: cannot unmarshal")
 	})
 
 	t.Run("FailsForEmptySubject", func(t *testing.T) {
@@ -36,7 +34,7 @@ func checkBindJonAndValidation(t *testing.T, method string, url string) {
 			Subject: "",
 			Content: "blah contents",
 		}
-		checkFailsWithError(t, method, url, inputStep, http.StatusBadRequest, "Subject: non zero value required")
+		checkFailsWithError(t, send(inputStep), http.StatusBadRequest, "Subject: non zero value required")
 	})
 
 	t.Run("FailsForContentMinLengthValidation", func(t *testing.T) {
@@ -44,7 +42,7 @@ func checkBindJonAndValidation(t *testing.T, method string, url string) {
 			Subject: "blah",
 			Content: "a",
 		}
-		checkFailsWithError(t, method, url, inputStep, http.StatusBadRequest, "minstringlength(3)")
+		checkFailsWithError(t, send(inputStep), http.StatusBadRequest, "minstringlength(3)")
 	})
 }
 
@@ -52,7 +50,6 @@ func checkBindJonAndValidation(t *testing.T, method string, url string) {
 func TestSequenceSteps(t *testing.T) {
 	setupTestEnv()
 
-	stepsUrl := config.ApiVersion + "/sequence-steps"
 	baseSequence := api.Sequence{
 		Name:                 "Sequence1",
 		OpenTrackingEnabled:  false,
@@ -67,80 +64,239 @@ func TestSequenceSteps(t *testing.T) {
 
 	// let's make sure we have a sequence available in test db (as tests might run in parallel)
 	t.Run("CreateSequence", func(t *testing.T) {
-		deleteSequenceByName(baseSequence.Name)
-
-		recorder := performRequest(t, http.MethodPost, config.ApiVersion+"/sequences", baseSequence)
-		checkStatusCode(t, http.StatusCreated, recorder.Code)
-
-		var sequenceResult *api.Sequence
-		json.NewDecoder(recorder.Body).Decode(&sequenceResult)
-		baseStep.SequenceID = sequenceResult.ID // assign newly generated ID
+		baseStep.SequenceID = createSequence(t, baseSequence) // assign newly generated ID
 	})
 
 	var newStepId uint
 
 	t.Run("Create", func(t *testing.T) {
-		checkBindJonAndValidation(t, http.MethodPost, stepsUrl)
+		checkBindJonAndValidation(t, func(body any) error {
+			return apiClient.Do(ctx, http.MethodPost, "/sequence-steps", body, nil)
+		})
 
 		t.Run("FailsForNonExistingSequenceID", func(t *testing.T) {
 			inputStep := baseStep
 			inputStep.SequenceID = 0
-			checkFailsWithError(t, http.MethodPost, stepsUrl, inputStep, http.StatusBadRequest, "Sequence not found.")
+			_, err := apiClient.CreateStep(ctx, inputStep)
+			checkFailsWithError(t, err, http.StatusBadRequest, "Sequence not found.")
 		})
 
 		t.Run("Success", func(t *testing.T) {
-			recorder := performRequest(t, http.MethodPost, stepsUrl, baseStep)
-			checkStatusCode(t, http.StatusCreated, recorder.Code)
-
-			var stepResult *api.SequenceStep
-			json.NewDecoder(recorder.Body).Decode(&stepResult) // capture its ID (will be used in `update` tests below)
+			stepResult, err := apiClient.CreateStep(ctx, baseStep)
+			checkNoError(t, err)
 
 			// now check the "by ID" endpoint
-			newStepId = stepResult.ID
-			checkStepByID(t, buildUrl(stepsUrl, newStepId), baseStep)
+			newStepId = stepResult.ID // capture its ID (will be used in `update` tests below)
+			checkStepByID(t, newStepId, baseStep)
 		})
 
 		t.Run("FailsWithDuplicateSubject", func(t *testing.T) {
-			checkFailsWithError(t, http.MethodPost, stepsUrl, baseStep, http.StatusConflict, "Subject already taken.")
+			_, err := apiClient.CreateStep(ctx, baseStep)
+			checkFailsWithError(t, err, http.StatusConflict, "Subject already taken.")
 		})
 	})
 
 	t.Run("Update", func(t *testing.T) {
-		updateStepUrl := buildUrl(stepsUrl, newStepId)
-
 		t.Run("FailsForNonExistingStepID", func(t *testing.T) {
-			checkFailsWih404(t, http.MethodPut, buildUrl(stepsUrl, 0))
+			checkFailsWih404(t, apiClient.UpdateStep(ctx, 0, baseStep))
 		})
 
-		checkBindJonAndValidation(t, http.MethodPut, updateStepUrl)
+		checkBindJonAndValidation(t, func(body any) error {
+			return apiClient.Do(ctx, http.MethodPut, fmt.Sprintf("/sequence-steps/%d", newStepId), body, nil)
+		})
 
 		t.Run("Success", func(t *testing.T) {
 			inputStep := baseStep
 			inputStep.Subject = "Test Subject 123"
 			inputStep.Content = "Test Contents 456"
 
-			recorder := performRequest(t, http.MethodPut, updateStepUrl, inputStep)
-			checkStatusCode(t, http.StatusOK, recorder.Code)
+			checkNoError(t, apiClient.UpdateStep(ctx, newStepId, inputStep))
+			checkStepByID(t, newStepId, inputStep)
+		})
+
+		t.Run("KeepsOmittedFields", func(t *testing.T) {
+			path := fmt.Sprintf("/sequence-steps/%d", newStepId)
+			waitDays := uint(3)
+			checkNoError(t, apiClient.Do(ctx, http.MethodPut, path, api.SequenceStepUpdate{WaitDays: &waitDays}, nil))
 
-			checkStepByID(t, updateStepUrl, inputStep)
+			// the body of clients predating delays & step types
+			var updated api.SequenceStep
+			body := map[string]string{"Subject": "Test Subject 789", "Content": "Test Contents 012"}
+			checkNoError(t, apiClient.Do(ctx, http.MethodPut, path, body, &updated))
+			assert.Equal(t, "Test Subject 789", updated.Subject)
+			assert.Equal(t, uint(3), updated.WaitDays)
+			assert.Equal(t, api.StepTypeEmail, updated.Type)
 		})
 	})
 
 	t.Run("Delete", func(t *testing.T) {
-		deleteStepUrl := buildUrl(stepsUrl, newStepId)
 		t.Run("FailsForNonExistingStepID", func(t *testing.T) {
 			// math.MaxUint64 = 18446744073709551615
 			id := -1 // (18446744073709551615)
-			checkFailsWih404(t, http.MethodDelete, buildUrl(stepsUrl, uint(id)))
+			checkFailsWih404(t, apiClient.DeleteStep(ctx, uint(id), false))
+		})
+
+		t.Run("FailsForActiveSequenceWithoutForce", func(t *testing.T) {
+			err := apiClient.DeleteStep(ctx, newStepId, false)
+			checkFailsWithError(t, err, http.StatusConflict, "Sequence is active, its steps are only deleted with force.")
 		})
 
 		t.Run("Success", func(t *testing.T) {
-			recorder := performRequest(t, http.MethodDelete, deleteStepUrl, nil)
-			checkStatusCode(t, http.StatusOK, recorder.Code)
+			checkNoError(t, apiClient.DeleteStep(ctx, newStepId, true))
 
 			// verify "by ID" returns 404
-			checkFailsWih404(t, http.MethodDelete, deleteStepUrl)
+			_, err := apiClient.GetStep(ctx, newStepId)
+			checkFailsWih404(t, err)
 		})
 	})
 
 }
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+// stepText the subject & content of a batch operation
+func stepText(subject string, content string) api.SequenceStepUpdate {
+	return api.SequenceStepUpdate{Subject: ptr(subject), Content: ptr(content)}
+}
+
+// Will run sequentially
+func TestSequenceStepsBatch(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+	// steps of drafts are deleted without force
+	sequenceID := createSequence(t, api.Sequence{Name: "BatchSequence1", Status: api.SequenceDraft})
+
+	var createdIDs []uint
+	t.Run("CreatesAll", func(t *testing.T) {
+		batchResponse, err := apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpCreate, SequenceStepUpdate: stepText("Step1", "content 1")},
+			{Op: api.BatchOpCreate, SequenceStepUpdate: stepText("Step2", "content 2")},
+			{Op: api.BatchOpCreate, SequenceStepUpdate: stepText("Step3", "content 3")},
+		}})
+		checkNoError(t, err)
+
+		assertions.Len(batchResponse.Results, 3)
+		for _, result := range batchResponse.Results {
+			assertions.Equal(http.StatusCreated, result.Status)
+			createdIDs = append(createdIDs, result.Step.ID)
+		}
+	})
+
+	t.Run("FailsForInBatchDuplicateSubject", func(t *testing.T) {
+		_, err := apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpCreate, SequenceStepUpdate: stepText("Step4", "content 4")},
+			{Op: api.BatchOpCreate, SequenceStepUpdate: stepText("Step4", "content 4")},
+		}})
+
+		apiErr := checkFailsWithError(t, err, http.StatusBadRequest, "no operations were applied")
+		assertions.Empty(apiErr.BatchResults[0].Error)
+		assertions.Equal(http.StatusConflict, apiErr.BatchResults[1].Status)
+		assertions.Contains(apiErr.BatchResults[1].Error, "Subject already used by operation: 0")
+	})
+
+	t.Run("IsAtomic", func(t *testing.T) {
+		_, err := apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpDelete, ID: createdIDs[0]},
+			{Op: api.BatchOpUpdate, ID: createdIDs[1], SequenceStepUpdate: stepText("Step1", "a")}, // fails for minstringlength(3)
+		}})
+
+		apiErr := checkFailsWithError(t, err, http.StatusBadRequest, "")
+		assertions.Contains(apiErr.BatchResults[1].Error, "minstringlength(3)")
+
+		// the delete wasn't applied either
+		checkStepByID(t, createdIDs[0], api.SequenceStep{
+			Subject: "Step1", Content: "content 1", SequenceID: sequenceID,
+		})
+	})
+
+	t.Run("FailsForExistingSubject", func(t *testing.T) {
+		_, err := apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpCreate, SequenceStepUpdate: stepText("Step2", "content 2")},
+		}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Batch rejected")
+	})
+
+	t.Run("FailsForStepOfOtherSequence", func(t *testing.T) {
+		_, err := apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpDelete, ID: 0},
+		}})
+		apiErr := checkFailsWithError(t, err, http.StatusBadRequest, "")
+		assertions.Equal(http.StatusNotFound, apiErr.BatchResults[0].Status)
+	})
+
+	t.Run("MixedSuccess", func(t *testing.T) {
+		// subject of deleted step is reused within the same batch
+		_, err := apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpDelete, ID: createdIDs[0]},
+			{Op: api.BatchOpUpdate, ID: createdIDs[1], SequenceStepUpdate: stepText("Step1", "updated content")},
+			{Op: api.BatchOpCreate, SequenceStepUpdate: stepText("Step2", "content 2")},
+		}})
+		checkNoError(t, err)
+
+		_, err = apiClient.GetStep(ctx, createdIDs[0])
+		checkFailsWih404(t, err)
+		checkStepByID(t, createdIDs[1], api.SequenceStep{
+			Subject: "Step1", Content: "updated content", SequenceID: sequenceID,
+		})
+	})
+
+	t.Run("SetsDelays", func(t *testing.T) {
+		position, waitDays := uint(5), uint(2)
+		batchResponse, err := apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpUpdate, ID: createdIDs[1], SequenceStepUpdate: api.SequenceStepUpdate{Subject: ptr("Step1"), Content: ptr("updated content"), WaitDays: &waitDays}},
+			{Op: api.BatchOpCreate, SequenceStepUpdate: api.SequenceStepUpdate{Subject: ptr("Step5"), Content: ptr("content 5"), Position: &position, WaitDays: &waitDays}},
+		}})
+		checkNoError(t, err)
+
+		updated, created := batchResponse.Results[0].Step, batchResponse.Results[1].Step
+		assertions.Equal(uint(2), updated.WaitDays)
+		assertions.Equal(uint(5), created.Position)
+		assertions.Equal(uint(2), created.WaitDays)
+
+		// omitted delays are kept
+		_, err = apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpUpdate, ID: created.ID, SequenceStepUpdate: stepText("Step5", "content 5")},
+		}})
+		checkNoError(t, err)
+		step, err := apiClient.GetStep(ctx, created.ID)
+		checkNoError(t, err)
+		assertions.Equal(uint(5), step.Position)
+	})
+
+	t.Run("SetsTypeFields", func(t *testing.T) {
+		waitUntil := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+		batchResponse, err := apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpCreate, SequenceStepUpdate: api.SequenceStepUpdate{Type: ptr(api.StepTypeWaitUntil), Subject: ptr("Hold"), WaitUntil: &waitUntil}},
+		}})
+		checkNoError(t, err)
+		held := batchResponse.Results[0].Step
+		assertions.Equal(api.StepTypeWaitUntil, held.Type)
+
+		// only the given fields are updated
+		position := uint(9)
+		_, err = apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpUpdate, ID: held.ID, SequenceStepUpdate: api.SequenceStepUpdate{Position: &position}},
+		}})
+		checkNoError(t, err)
+		step, err := apiClient.GetStep(ctx, held.ID)
+		checkNoError(t, err)
+		assertions.Equal("Hold", step.Subject)
+		assertions.Equal(uint(9), step.Position)
+		if assertions.NotNil(step.WaitUntil) {
+			assertions.True(waitUntil.Equal(*step.WaitUntil))
+		}
+	})
+
+	t.Run("FailsForNonExistingSequenceID", func(t *testing.T) {
+		_, err := apiClient.BatchSteps(ctx, 0, api.BatchStepsRequest{})
+		checkFailsWih404(t, err)
+	})
+
+	t.Run("FailsForUnknownAction", func(t *testing.T) {
+		err := apiClient.Do(ctx, http.MethodPost, fmt.Sprintf("/sequences/%d/steps:purge", sequenceID), nil, nil)
+		checkFailsWih404(t, err)
+	})
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Will run sequentially
+func TestTasks(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	sequenceID := createSequence(t, api.Sequence{Name: "TaskSequence1"})
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Task{})
+
+	// the CRM, failing its first call
+	var mu sync.Mutex
+	var calls []api.StepCall
+	crm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var call api.StepCall
+		_ = json.NewDecoder(r.Body).Decode(&call)
+		calls = append(calls, call)
+		if len(calls) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer crm.Close()
+
+	t.Run("CreateFailsForInvalidStep", func(t *testing.T) {
+		cases := []struct {
+			step api.SequenceStep
+			msg  string
+		}{
+			{api.SequenceStep{Type: "fax", Subject: "Fax"}, "Type: fax does not validate as in(email|manual_task|wait_until|http_call)"},
+			{api.SequenceStep{Subject: "Intro"}, "Content: non zero value required"},
+			{api.SequenceStep{Type: api.StepTypeManualTask, Subject: "Call", URL: crm.URL}, "URL: only allowed for http_call steps"},
+			{api.SequenceStep{Type: api.StepTypeWaitUntil, Subject: "Quarter start"}, "WaitUntil: non zero value required"},
+			{api.SequenceStep{Type: api.StepTypeHTTPCall, Subject: "Sync CRM", URL: "ftp://crm.example.com"}, `URL: "ftp://crm.example.com" is not an http(s) URL`},
+			{api.SequenceStep{Type: api.StepTypeHTTPCall, Subject: "Sync CRM", URL: crm.URL, Content: "{"}, "Content: must be JSON for http_call steps"},
+		}
+		for _, c := range cases {
+			c.step.SequenceID = sequenceID
+			_, err := apiClient.CreateStep(ctx, c.step)
+			checkFailsWithError(t, err, http.StatusBadRequest, c.msg)
+		}
+	})
+
+	now := time.Now().UTC().Add(time.Hour)
+	quarterStart := now.Add(5 * 24 * time.Hour)
+	for _, step := range []api.SequenceStep{
+		{Subject: "Intro", Content: "blah contents"},
+		{Type: api.StepTypeManualTask, Subject: "Call the lead", Content: "Ask about the budget", WaitDays: 1},
+		{Type: api.StepTypeWaitUntil, Subject: "Quarter start", WaitUntil: &quarterStart},
+		{Type: api.StepTypeHTTPCall, Subject: "Sync CRM", URL: crm.URL},
+		{Subject: "Follow up", Content: "blah contents"},
+	} {
+		step.SequenceID = sequenceID
+		created, err := apiClient.CreateStep(ctx, step)
+		checkNoError(t, err)
+		if step.Type == api.StepTypeHTTPCall {
+			assertions.Equal(http.MethodPost, created.Method)
+		}
+	}
+
+	sender := &recordingSender{}
+	scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+	runAt := func(at time.Time) int {
+		scheduler.Now = func() time.Time { return at }
+		return scheduler.RunDue(ctx)
+	}
+
+	caller := createContact(t, "task-caller@example.com")
+	skipped := createContact(t, "task-skipped@example.com")
+	enrollment, err := apiClient.Enroll(ctx, sequenceID, caller.ID)
+	checkNoError(t, err)
+	skippedEnrollment, err := apiClient.Enroll(ctx, sequenceID, skipped.ID)
+	checkNoError(t, err)
+	reload := func(id uint) api.Enrollment {
+		var found api.Enrollment
+		Db.First(&found, id)
+		return found
+	}
+
+	// open tasks of the enrollments, by enrollment ID
+	inbox := func() map[uint]api.Task {
+		tasks, err := apiClient.ListTasks(ctx, "")
+		checkNoError(t, err)
+		byEnrollmentID := map[uint]api.Task{}
+		for _, task := range tasks {
+			byEnrollmentID[task.EnrollmentID] = task
+		}
+		return byEnrollmentID
+	}
+
+	t.Run("OpensTasks", func(t *testing.T) {
+		assertions.Equal(2, runAt(now))
+		assertions.Equal(0, runAt(now.Add(24*time.Hour+time.Minute)))
+
+		tasks := inbox()
+		if assertions.Contains(tasks, enrollment.ID) {
+			assertions.Equal("Call the lead", tasks[enrollment.ID].Title)
+			assertions.Equal("Ask about the budget", tasks[enrollment.ID].Instructions)
+			assertions.Equal(caller.ID, tasks[enrollment.ID].ContactID)
+		}
+		assertions.Contains(tasks, skippedEnrollment.ID)
+
+		// the enrollment waits for the task
+		assertions.Nil(reload(enrollment.ID).NextSendAt)
+		assertions.Equal(0, runAt(now.Add(3*24*time.Hour)))
+	})
+
+	t.Run("ListFailsForInvalidStatus", func(t *testing.T) {
+		_, err := apiClient.ListTasks(ctx, "done")
+		checkFailsWithError(t, err, http.StatusBadRequest, "status: must be one of open, completed, skipped")
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		task := inbox()[skippedEnrollment.ID]
+		resolved, err := apiClient.SkipTask(ctx, task.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.TaskSkipped, resolved.Status)
+		assertions.NotNil(reload(skippedEnrollment.ID).NextSendAt)
+
+		_, err = apiClient.CompleteTask(ctx, task.ID)
+		checkFailsWithError(t, err, http.StatusConflict, "Task is not open.")
+		Db.Delete(&api.Enrollment{}, skippedEnrollment.ID)
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		task := inbox()[enrollment.ID]
+		resolved, err := apiClient.CompleteTask(ctx, task.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.TaskCompleted, resolved.Status)
+		assertions.NotContains(inbox(), enrollment.ID)
+
+		completed, err := apiClient.ListTasks(ctx, api.TaskCompleted)
+		checkNoError(t, err)
+		assertions.NotEmpty(completed)
+
+		_, err = apiClient.GetTask(ctx, 1<<30)
+		checkFailsWithError(t, err, http.StatusNotFound, "Task not found.")
+	})
+
+	t.Run("WaitsAndCalls", func(t *testing.T) {
+		// held until the quarter starts
+		assertions.Equal(0, runAt(now.Add(3*24*time.Hour)))
+		if found := reload(enrollment.ID); assertions.NotNil(found.NextSendAt) {
+			assertions.WithinDuration(quarterStart, *found.NextSendAt, time.Second)
+		}
+
+		later := quarterStart.Add(time.Minute)
+		assertions.Equal(0, runAt(later)) // the wait is over
+		assertions.Equal(0, runAt(later)) // the CRM fails
+		assertions.Contains(reload(enrollment.ID).LastError, "502")
+
+		later = later.Add(scheduler.RetryWait + time.Minute)
+		assertions.Equal(0, runAt(later))
+		mu.Lock()
+		if assertions.Len(calls, 2) {
+			assertions.Equal(enrollment.ID, calls[1].EnrollmentID)
+			assertions.Equal(caller.Email, calls[1].Contact.Email)
+		}
+		mu.Unlock()
+
+		assertions.Equal(1, runAt(later))
+		assertions.Equal("Follow up", sender.last().Subject)
+		assertions.Equal(api.EnrollmentCompleted, reload(enrollment.ID).Status)
+	})
+}
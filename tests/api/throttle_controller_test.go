@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Will run sequentially
+func TestThrottles(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	// throttles apply to every scheduler, none may be left for the other tests
+	clearThrottles := func() {
+		Db.Where("1 = 1").Delete(&api.RateBucket{})
+		Db.Where("1 = 1").Delete(&api.Throttle{})
+	}
+	clearThrottles()
+	defer clearThrottles()
+
+	t.Run("CreateFailsForInvalidThrottle", func(t *testing.T) {
+		invalid := []struct {
+			throttle api.Throttle
+			msg      string
+		}{
+			{api.Throttle{Scope: "planet", Period: api.ThrottlePeriodHour, Limit: 1}, "Scope: planet does not validate as in(mailbox|domain|global)"},
+			{api.Throttle{Scope: api.ThrottleScopeGlobal, Period: "week", Limit: 1}, "Period: week does not validate as in(hour|day)"},
+			{api.Throttle{Scope: api.ThrottleScopeGlobal, Period: api.ThrottlePeriodHour}, "Limit: non zero value required"},
+			{api.Throttle{Scope: api.ThrottleScopeGlobal, Key: "example.com", Period: api.ThrottlePeriodHour, Limit: 1}, "Key: must be empty for global throttles"},
+			{api.Throttle{Scope: api.ThrottleScopeMailbox, Key: "outreach", Period: api.ThrottlePeriodHour, Limit: 1}, `Key: "outreach" is not an email address`},
+		}
+		for _, tc := range invalid {
+			_, err := apiClient.CreateThrottle(ctx, tc.throttle)
+			checkFailsWithError(t, err, http.StatusBadRequest, tc.msg)
+		}
+	})
+
+	var mailboxThrottle, domainThrottle *api.Throttle
+	t.Run("Create", func(t *testing.T) {
+		var err error
+		mailboxThrottle, err = apiClient.CreateThrottle(ctx, api.Throttle{Scope: api.ThrottleScopeMailbox, Key: "Outreach@Example.com", Period: api.ThrottlePeriodHour, Limit: 2})
+		checkNoError(t, err)
+		assertions.Equal("outreach@example.com", mailboxThrottle.Key)
+
+		// a bucket per recipient domain
+		domainThrottle, err = apiClient.CreateThrottle(ctx, api.Throttle{Scope: api.ThrottleScopeDomain, Period: api.ThrottlePeriodDay, Limit: 1})
+		checkNoError(t, err)
+
+		throttles, err := apiClient.ListThrottles(ctx)
+		checkNoError(t, err)
+		assertions.Len(throttles, 2)
+	})
+
+	sequenceID := createSequence(t, api.Sequence{Name: "ThrottleSequence1"})
+	_, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Hello", Content: "blah contents"})
+	checkNoError(t, err)
+	// throttled enrollments would be sent by the schedulers of the other tests
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+
+	var enrollments []*api.Enrollment
+	for _, email := range []string{"first@throttled.example", "second@throttled.example", "third@other.example"} {
+		enrollment, err := apiClient.Enroll(ctx, sequenceID, createContact(t, email).ID)
+		checkNoError(t, err)
+		enrollments = append(enrollments, enrollment)
+	}
+
+	now := time.Now().UTC().Add(time.Hour)
+	sender := &recordingSender{}
+	scheduler := service.NewScheduler(Db, sender, "Outreach <outreach@example.com>", "https://mail.example.com")
+	scheduler.Now = func() time.Time { return now }
+
+	t.Run("ThrottlesPerDomain", func(t *testing.T) {
+		assertions.Equal(2, scheduler.RunDue(ctx))
+		assertions.Equal([]string{"first@throttled.example", "third@other.example"}, recipients(sender))
+
+		// the domain bucket is refilled in a day
+		var throttled api.Enrollment
+		Db.First(&throttled, enrollments[1].ID)
+		assertions.Equal(api.EnrollmentActive, throttled.Status)
+		assertions.WithinDuration(now.Add(24*time.Hour), *throttled.NextSendAt, time.Second)
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		usage, err := apiClient.GetThrottleUsage(ctx)
+		checkNoError(t, err)
+		if assertions.Len(usage, 3) {
+			assertions.Equal(mailboxThrottle.ID, usage[0].ThrottleID)
+			assertions.Equal(uint(2), usage[0].Used)
+			assertions.Zero(usage[0].Remaining)
+
+			assertions.Equal(domainThrottle.ID, usage[1].ThrottleID)
+			assertions.Equal("other.example", usage[1].Key)
+			assertions.Equal("throttled.example", usage[2].Key)
+			assertions.Equal(uint(1), usage[2].Used)
+		}
+	})
+
+	t.Run("ThrottlesPerMailbox", func(t *testing.T) {
+		enrollment, err := apiClient.Enroll(ctx, sequenceID, createContact(t, "fourth@fourth.example").ID)
+		checkNoError(t, err)
+
+		// the mailbox bucket is empty, one token is refilled every 30 minutes
+		assertions.Zero(scheduler.RunDue(ctx))
+		var throttled api.Enrollment
+		Db.First(&throttled, enrollment.ID)
+		assertions.WithinDuration(now.Add(30*time.Minute), *throttled.NextSendAt, time.Second)
+
+		now = now.Add(30 * time.Minute)
+		assertions.Equal(1, scheduler.RunDue(ctx))
+		assertions.Contains(recipients(sender), "fourth@fourth.example")
+	})
+
+	t.Run("FailedSendsGiveTheTokenBack", func(t *testing.T) {
+		enrollment, err := apiClient.Enroll(ctx, sequenceID, createContact(t, "fifth@fifth.example").ID)
+		checkNoError(t, err)
+
+		now = now.Add(30 * time.Minute)
+		failing := service.NewScheduler(Db, failingSender{}, "Outreach <outreach@example.com>", "https://mail.example.com")
+		failing.Now = func() time.Time { return now }
+		assertions.Zero(failing.RunDue(ctx))
+
+		usage, err := apiClient.GetThrottleUsage(ctx)
+		checkNoError(t, err)
+		assertions.Equal(uint(1), usage[0].Remaining)
+
+		// retried with the token it didn't use
+		var failed api.Enrollment
+		Db.First(&failed, enrollment.ID)
+		assertions.NotEmpty(failed.LastError)
+		now = *failed.NextSendAt
+		assertions.Equal(1, scheduler.RunDue(ctx))
+		assertions.Contains(recipients(sender), "fifth@fifth.example")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		checkNoError(t, apiClient.DeleteThrottle(ctx, domainThrottle.ID))
+
+		err := apiClient.DeleteThrottle(ctx, domainThrottle.ID)
+		checkFailsWithError(t, err, http.StatusNotFound, "Throttle not found.")
+
+		usage, err := apiClient.GetThrottleUsage(ctx)
+		checkNoError(t, err)
+		assertions.Len(usage, 1)
+	})
+}
+
+func recipients(sender *recordingSender) []string {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+
+	var to []string
+	for _, email := range sender.emails {
+		to = append(to, email.To)
+	}
+	return to
+}
+
+// failingSender can't reach the mail server
+type failingSender struct{}
+
+func (failingSender) Send(context.Context, service.Email) error {
+	return errors.New("connection refused")
+}
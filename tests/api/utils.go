@@ -1,11 +1,11 @@
 package api
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/client"
 	"github.com/sitetester/sequence-api/config"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
@@ -20,16 +20,28 @@ func checkStatusCode(t *testing.T, expected int, actual int) {
 	}
 }
 
-func parseErrorResponse(r *httptest.ResponseRecorder) *api.ErrorResponse {
-	var er api.ErrorResponse
-	json.NewDecoder(r.Body).Decode(&er)
-	return &er
+func checkNoError(t *testing.T, err error) {
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 }
 
 var Db *gorm.DB = nil
 var engine *gin.Engine = nil
+var apiClient *client.Client = nil
+
+// engineTransport lets the client talk to the router in-process (no network involved)
+type engineTransport struct {
+	handler http.Handler
+}
 
-// let's setup DB & router once
+func (et engineTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	et.handler.ServeHTTP(recorder, request)
+	return recorder.Result(), nil
+}
+
+// let's setup DB, router & client once
 func setupTestEnv() {
 	gin.SetMode(gin.TestMode) // switch to test mode (to avoid debug output)
 
@@ -40,54 +52,53 @@ func setupTestEnv() {
 	if engine == nil {
 		engine = config.SetupRouter(Db)
 	}
-}
 
-func performRequest(t *testing.T, method string, url string, data any) *httptest.ResponseRecorder {
-	body, err := json.Marshal(data)
-	if err != nil {
-		t.Fatalf("Couldn't marshal JSON: %v\n", err)
+	if apiClient == nil {
+		apiClient = newTestClient()
 	}
+}
 
-	// mock request
-	request, err := http.NewRequest(method, url, bytes.NewReader(body))
-	if err != nil {
-		t.Fatalf("Couldn't create request: %v\n", err)
-	}
-
-	// create a response recorder so can inspect the response
-	recorder := httptest.NewRecorder()
-
-	// perform the request
-	engine.ServeHTTP(recorder, request)
-	return recorder
+func newTestClient(options ...client.Option) *client.Client {
+	options = append([]client.Option{
+		client.WithHTTPClient(&http.Client{Transport: engineTransport{handler: engine}}),
+		client.WithRetries(0, 0),
+	}, options...)
+	return client.New("http://localhost", options...)
 }
 
-func checkFailsWithError(t *testing.T, method string, url string, data any, code int, msg string) {
-	assertions := assert.New(t)
-	recorder := performRequest(t, method, url, data)
-	checkStatusCode(t, code, recorder.Code)
+var ctx = context.Background()
+
+// checkFailsWithError `err` must be a `*client.Error` with given status code & containing `msg`
+func checkFailsWithError(t *testing.T, err error, code int, msg string) *client.Error {
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected API error, got %v", err)
+	}
+	checkStatusCode(t, code, apiErr.StatusCode)
 
 	if msg != "" {
-		response := parseErrorResponse(recorder)
-		assertions.Contains(response.Error, msg)
+		assert.Contains(t, apiErr.Message, msg)
 	}
+	return apiErr
 }
 
-func checkFailsWih404(t *testing.T, method string, url string) {
-	assertions := assert.New(t)
-
-	recorder := performRequest(t, method, url, nil)
-	checkStatusCode(t, http.StatusNotFound, recorder.Code)
-
-	response := parseErrorResponse(recorder)
-	assertions.Contains(response.Error, "not found")
+func checkFailsWih404(t *testing.T, err error) {
+	checkFailsWithError(t, err, http.StatusNotFound, "not found")
 }
 
 func deleteSequenceByName(name string) {
 	Db.Where("name = ?", name).Delete(&api.Sequence{}) // delete the existing record (if any)
 }
 
-// https://stackoverflow.com/questions/16474594/how-can-i-print-out-an-constant-uint64-in-go-using-fmt
-func buildUrl(base string, id uint) string {
-	return fmt.Sprintf("%s/%d", base, id)
+// createSequence removes leftovers of a previous run (including its steps) first
+func createSequence(t *testing.T, sequence api.Sequence) uint {
+	var previous api.Sequence
+	if Db.Where("name = ?", sequence.Name).Find(&previous).RowsAffected > 0 {
+		Db.Where("sequence_id = ?", previous.ID).Delete(&api.SequenceStep{})
+	}
+	deleteSequenceByName(sequence.Name)
+
+	created, err := apiClient.CreateSequence(ctx, sequence)
+	checkNoError(t, err)
+	return created.ID
 }
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"fmt"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/stretchr/testify/assert"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var trackedLinkPattern = regexp.MustCompile(`href="(https://mail\.example\.com/c/[^"]+)"`)
+
+// Will run sequentially
+func TestVariants(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	sequenceID := createSequence(t, api.Sequence{Name: "VariantSequence1", OpenTrackingEnabled: true, ClickTrackingEnabled: true})
+	defer Db.Where("sequence_id = ?", sequenceID).Delete(&api.Enrollment{})
+	step, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Hello", Content: "blah contents"})
+	checkNoError(t, err)
+
+	t.Run("CreateFailsForInvalidVariant", func(t *testing.T) {
+		_, err := apiClient.CreateVariant(ctx, step.ID, api.StepVariant{Subject: "Subject A", Content: "blah contents"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Name: non zero value required")
+
+		_, err = apiClient.CreateVariant(ctx, 0, api.StepVariant{Name: "A", Subject: "Subject A", Content: "blah contents"})
+		checkFailsWithError(t, err, http.StatusNotFound, "Step not found.")
+
+		task, err := apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Type: api.StepTypeManualTask, Subject: "Call them"})
+		checkNoError(t, err)
+		_, err = apiClient.CreateVariant(ctx, task.ID, api.StepVariant{Name: "A", Subject: "Subject A", Content: "blah contents"})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Step: variants are only allowed for email steps")
+		checkNoError(t, apiClient.DeleteStep(ctx, task.ID, true))
+	})
+
+	var variantA, variantB *api.StepVariant
+	t.Run("Create", func(t *testing.T) {
+		variantA, err = apiClient.CreateVariant(ctx, step.ID, api.StepVariant{Name: "A", Subject: "Subject A", Content: `<a href="https://example.com/pricing?a=1&amp;b=2">Pricing</a>`})
+		checkNoError(t, err)
+		assertions.Equal(uint(1), variantA.Weight)
+
+		variantB, err = apiClient.CreateVariant(ctx, step.ID, api.StepVariant{Name: "B", Subject: "Subject B", Content: "blah contents", Weight: 3})
+		checkNoError(t, err)
+
+		_, err = apiClient.CreateVariant(ctx, step.ID, api.StepVariant{Name: "B", Subject: "Subject C", Content: "blah contents"})
+		checkFailsWithError(t, err, http.StatusConflict, "Name already taken.")
+
+		variants, err := apiClient.ListVariants(ctx, step.ID)
+		checkNoError(t, err)
+		assertions.Len(variants, 2)
+	})
+
+	t.Run("StepKeepsItsTypeWithVariants", func(t *testing.T) {
+		changed := *step
+		changed.Type = api.StepTypeManualTask
+		changed.Content = ""
+		err := apiClient.UpdateStep(ctx, step.ID, changed)
+		checkFailsWithError(t, err, http.StatusConflict, "Step has A/B variants, only email steps have them: delete them first.")
+
+		manualTask := api.StepTypeManualTask
+		_, err = apiClient.BatchSteps(ctx, sequenceID, api.BatchStepsRequest{Operations: []api.BatchStepOperation{
+			{Op: api.BatchOpUpdate, ID: step.ID, SequenceStepUpdate: api.SequenceStepUpdate{Type: &manualTask}},
+		}})
+		apiErr := checkFailsWithError(t, err, http.StatusBadRequest, "Batch rejected")
+		if assertions.Len(apiErr.BatchResults, 1) {
+			assertions.Equal(http.StatusConflict, apiErr.BatchResults[0].Status)
+		}
+
+		found, err := apiClient.GetStep(ctx, step.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.StepTypeEmail, found.Type)
+	})
+
+	t.Run("UpdatePromotionFailsForInvalidPromotion", func(t *testing.T) {
+		_, err := apiClient.UpdateVariantPromotion(ctx, step.ID, api.VariantPromotion{Metric: "click_rate", SampleSize: 1})
+		checkFailsWithError(t, err, http.StatusBadRequest, "Metric: click_rate does not validate as in(open_rate|reply_rate)")
+
+		_, err = apiClient.UpdateVariantPromotion(ctx, step.ID, api.VariantPromotion{Metric: api.PromoteByOpenRate})
+		checkFailsWithError(t, err, http.StatusBadRequest, "SampleSize: required with Metric")
+
+		_, err = apiClient.UpdateVariantPromotion(ctx, step.ID, api.VariantPromotion{WinnerVariantID: 1 << 30})
+		checkFailsWithError(t, err, http.StatusBadRequest, fmt.Sprintf("WinnerVariantID: variant %d not found", 1<<30))
+	})
+
+	now := time.Now().UTC().Add(time.Hour)
+	sender := &recordingSender{}
+	scheduler := service.NewScheduler(Db, sender, "sales@example.com", "https://mail.example.com")
+	scheduler.Now = func() time.Time { return now }
+
+	// enrolls & sends to another contact, returns the email
+	contacts := 0
+	sendNext := func() service.Email {
+		contacts++
+		contact := createContact(t, fmt.Sprintf("variant%d@example.com", contacts))
+		_, err := apiClient.Enroll(ctx, sequenceID, contact.ID)
+		checkNoError(t, err)
+		assertions.Equal(1, scheduler.RunDue(ctx))
+		return sender.last()
+	}
+
+	sentBySubject := map[string][]service.Email{}
+	t.Run("WeightedVariants", func(t *testing.T) {
+		// until both variants were sent (B is more likely)
+		for contacts < 30 && (len(sentBySubject["Subject A"]) == 0 || len(sentBySubject["Subject B"]) == 0) {
+			email := sendNext()
+			sentBySubject[email.Subject] = append(sentBySubject[email.Subject], email)
+		}
+		assertions.NotEmpty(sentBySubject["Subject A"])
+		assertions.NotEmpty(sentBySubject["Subject B"])
+		assertions.Empty(sentBySubject["Hello"])
+
+		// the pick is stable per enrollment
+		var emailSend api.EmailSend
+		Db.Where("to_email = ?", sentBySubject["Subject A"][0].To).Last(&emailSend)
+		variant := (&service.VariantService{Db: Db}).Choose(step, emailSend.EnrollmentID)
+		assertions.Equal(variantA.ID, variant.ID)
+	})
+
+	var trackingID string
+	t.Run("TracksOpensAndClicks", func(t *testing.T) {
+		email := sentBySubject["Subject A"][0]
+		assertions.Contains(email.HTML, `<img src="https://mail.example.com/o/`)
+
+		var emailSend api.EmailSend
+		Db.Where("to_email = ?", email.To).Last(&emailSend)
+		trackingID = emailSend.TrackingID
+
+		match := trackedLinkPattern.FindStringSubmatch(email.HTML)
+		if !assertions.NotNil(match) {
+			return
+		}
+		link := html.UnescapeString(match[1])
+
+		response := publicRequest(http.MethodGet, strings.Replace(link, "url=", "url=x", 1), nil)
+		assertions.Equal(http.StatusNotFound, response.Code)
+
+		response = publicRequest(http.MethodGet, link, nil)
+		assertions.Equal(http.StatusFound, response.Code)
+		assertions.Equal("https://example.com/pricing?a=1&b=2", response.Header().Get("Location"))
+
+		// a click counts as open too
+		Db.First(&emailSend, emailSend.ID)
+		assertions.NotNil(emailSend.ClickedAt)
+		assertions.NotNil(emailSend.OpenedAt)
+
+		response = publicRequest(http.MethodGet, "/o/"+trackingID, nil)
+		assertions.Equal(http.StatusOK, response.Code)
+		assertions.Equal("image/gif", response.Header().Get("Content-Type"))
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		stats, err := apiClient.GetVariantStats(ctx, step.ID)
+		checkNoError(t, err)
+		if assertions.Len(stats, 2) {
+			assertions.Equal("A", stats[0].Name)
+			assertions.Equal(len(sentBySubject["Subject A"]), stats[0].Sent)
+			assertions.Equal(1, stats[0].Opened)
+			assertions.Equal(1, stats[0].Clicked)
+			assertions.InDelta(1/float64(stats[0].Sent), stats[0].OpenRate, 0.001)
+
+			assertions.Equal(len(sentBySubject["Subject B"]), stats[1].Sent)
+			assertions.Zero(stats[1].Opened)
+		}
+	})
+
+	t.Run("AutoPromotesWinner", func(t *testing.T) {
+		promoted, err := apiClient.UpdateVariantPromotion(ctx, step.ID, api.VariantPromotion{Metric: api.PromoteByOpenRate, SampleSize: 1})
+		checkNoError(t, err)
+		assertions.Zero(promoted.Promotion.WinnerVariantID)
+
+		// A has the better open rate, every later enrollment gets it
+		for i := 0; i < 3; i++ {
+			assertions.Equal("Subject A", sendNext().Subject)
+		}
+
+		stats, err := apiClient.GetVariantStats(ctx, step.ID)
+		checkNoError(t, err)
+		if assertions.Len(stats, 2) {
+			assertions.True(stats[0].Winner)
+			assertions.False(stats[1].Winner)
+		}
+	})
+
+	t.Run("DeleteWinner", func(t *testing.T) {
+		checkNoError(t, apiClient.DeleteVariant(ctx, step.ID, variantA.ID))
+
+		found, err := apiClient.GetStep(ctx, step.ID)
+		checkNoError(t, err)
+		assertions.Zero(found.Promotion.WinnerVariantID)
+
+		err = apiClient.DeleteVariant(ctx, step.ID, variantA.ID)
+		checkFailsWithError(t, err, http.StatusNotFound, "Variant not found.")
+
+		// the step's variants go along with it
+		checkNoError(t, apiClient.DeleteStep(ctx, step.ID, true))
+		assertions.Zero(Db.Where("id = ?", variantB.ID).Find(&api.StepVariant{}).RowsAffected)
+	})
+}
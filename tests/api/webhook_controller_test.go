@@ -0,0 +1,229 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/sitetester/sequence-api/client"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the requests it receives, responds with 500 while `fail` is set
+type webhookReceiver struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	fail     atomic.Bool
+}
+
+func (wr *webhookReceiver) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	body, _ := io.ReadAll(request.Body)
+
+	wr.mu.Lock()
+	wr.requests = append(wr.requests, request)
+	wr.bodies = append(wr.bodies, body)
+	wr.mu.Unlock()
+
+	if wr.fail.Load() {
+		writer.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (wr *webhookReceiver) count() int {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return len(wr.requests)
+}
+
+func (wr *webhookReceiver) last() (*http.Request, []byte) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return wr.requests[len(wr.requests)-1], wr.bodies[len(wr.bodies)-1]
+}
+
+// Will run sequentially
+func TestWebhooks(t *testing.T) {
+	setupTestEnv()
+
+	assertions := assert.New(t)
+
+	// subscriptions of a previous run would receive the events too
+	Db.Where("1 = 1").Delete(&api.WebhookDelivery{})
+	Db.Where("1 = 1").Delete(&api.WebhookSubscription{})
+	Db.Where("type = ?", api.JobTypeWebhookDelivery).Delete(&api.Job{})
+
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	// lets the worker travel in time
+	var offset time.Duration
+	newWorker := func() *service.JobWorker {
+		worker := service.NewJobWorker(Db)
+		worker.BaseBackoff = time.Minute
+		worker.Now = func() time.Time { return time.Now().UTC().Add(offset) }
+		return worker
+	}
+	worker := newWorker()
+	// deliver runs the due jobs, returns the number of requests received meanwhile
+	deliver := func() int {
+		received := receiver.count()
+		worker.RunDue(ctx)
+		return receiver.count() - received
+	}
+
+	sequenceID := createSequence(t, api.Sequence{Name: "WebhookSequence1"})
+
+	t.Run("CreateFailsForMissingURL", func(t *testing.T) {
+		_, err := apiClient.CreateWebhook(ctx, api.WebhookSubscription{EventTypes: []string{api.WebhookEventStepCreated}})
+		checkFailsWithError(t, err, http.StatusBadRequest, "URL: non zero value required")
+	})
+
+	t.Run("CreateFailsForUnknownEventType", func(t *testing.T) {
+		_, err := apiClient.CreateWebhook(ctx, api.WebhookSubscription{URL: server.URL, EventTypes: []string{"step.renamed"}})
+		checkFailsWithError(t, err, http.StatusBadRequest, `unknown event type "step.renamed"`)
+	})
+
+	var subscription *api.WebhookSubscription
+	t.Run("Create", func(t *testing.T) {
+		var err error
+		subscription, err = apiClient.CreateWebhook(ctx, api.WebhookSubscription{
+			URL:        server.URL,
+			EventTypes: []string{api.WebhookEventStepCreated, api.WebhookEventStepDeleted},
+		})
+		checkNoError(t, err)
+		assertions.Contains(subscription.Secret, "whsec_")
+
+		// the secret isn't returned afterwards
+		found, err := apiClient.GetWebhook(ctx, subscription.ID)
+		checkNoError(t, err)
+		assertions.Empty(found.Secret)
+		assertions.Equal(subscription.EventTypes, found.EventTypes)
+	})
+
+	t.Run("SubscriptionsAreScopedToWorkspace", func(t *testing.T) {
+		apiKeyService := service.ApiKeyService{Db: Db}
+		rawKey, _ := apiKeyService.CreateForWorkspace("OtherWorkspaceWebhookKey", "other")
+		otherClient := newTestClient(client.WithAPIKey(rawKey))
+
+		_, err := otherClient.GetWebhook(ctx, subscription.ID)
+		checkFailsWih404(t, err)
+		subscriptions, err := otherClient.ListWebhooks(ctx)
+		checkNoError(t, err)
+		assertions.Empty(subscriptions)
+
+		// events of the other workspace aren't delivered
+		otherStep, err := otherClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "OtherWorkspaceStep", Content: "blah contents"})
+		checkNoError(t, err)
+		assertions.Zero(deliver())
+		checkNoError(t, otherClient.DeleteStep(ctx, otherStep.ID, true))
+	})
+
+	var step *api.SequenceStep
+	t.Run("DeliversSignedEvent", func(t *testing.T) {
+		var err error
+		step, err = apiClient.CreateStep(ctx, api.SequenceStep{SequenceID: sequenceID, Subject: "Step1", Content: "blah contents"})
+		checkNoError(t, err)
+
+		// the job is claimed by one of the workers only
+		received := receiver.count()
+		var wg sync.WaitGroup
+		for _, concurrent := range []*service.JobWorker{worker, newWorker()} {
+			wg.Add(1)
+			go func(concurrent *service.JobWorker) {
+				defer wg.Done()
+				concurrent.RunDue(ctx)
+			}(concurrent)
+		}
+		wg.Wait()
+		assertions.Equal(1, receiver.count()-received)
+		request, body := receiver.last()
+		assertions.Equal(api.WebhookEventStepCreated, request.Header.Get(service.WebhookEventHeader))
+
+		timestamp := request.Header.Get(service.WebhookTimestampHeader)
+		assertions.Equal("sha256="+service.WebhookSignature(subscription.Secret, timestamp, body), request.Header.Get(service.WebhookSignatureHeader))
+
+		var event struct {
+			api.WebhookEvent
+			Data api.SequenceStep `json:"data"`
+		}
+		checkNoError(t, json.Unmarshal(body, &event))
+		assertions.Equal(api.WebhookEventStepCreated, event.Type)
+		assertions.Equal(step.ID, event.Data.ID)
+
+		deliveries, err := apiClient.ListWebhookDeliveries(ctx, subscription.ID, api.WebhookDeliverySucceeded)
+		checkNoError(t, err)
+		if assertions.Len(deliveries, 1) {
+			assertions.Equal(uint(1), deliveries[0].Attempts)
+			assertions.Equal(http.StatusOK, deliveries[0].LastStatusCode)
+		}
+	})
+
+	t.Run("SkipsUnsubscribedEventTypes", func(t *testing.T) {
+		checkNoError(t, apiClient.UpdateStep(ctx, step.ID, api.SequenceStep{Subject: "Step1", Content: "new contents"}))
+		assertions.Zero(deliver())
+	})
+
+	var failedDelivery api.WebhookDelivery
+	t.Run("RetriesWithBackoffUntilFailed", func(t *testing.T) {
+		receiver.fail.Store(true)
+		checkNoError(t, apiClient.DeleteStep(ctx, step.ID, true))
+
+		assertions.Equal(1, deliver())
+		deliveries, err := apiClient.ListWebhookDeliveries(ctx, subscription.ID, api.WebhookDeliveryPending)
+		checkNoError(t, err)
+		if assertions.Len(deliveries, 1) {
+			assertions.Equal(http.StatusInternalServerError, deliveries[0].LastStatusCode)
+			job, err := apiClient.GetJob(ctx, deliveries[0].JobID)
+			checkNoError(t, err)
+			assertions.WithinDuration(time.Now().Add(time.Minute), job.RunAt, time.Second)
+		}
+
+		// not due yet
+		assertions.Zero(deliver())
+
+		for attempt := 1; attempt < 8; attempt++ {
+			offset += time.Minute << (attempt - 1)
+			assertions.Equal(1, deliver())
+		}
+
+		deliveries, err = apiClient.ListWebhookDeliveries(ctx, subscription.ID, api.WebhookDeliveryFailed)
+		checkNoError(t, err)
+		if assertions.Len(deliveries, 1) {
+			failedDelivery = deliveries[0]
+			assertions.Equal(uint(8), failedDelivery.Attempts)
+			assertions.Contains(failedDelivery.LastError, "500")
+		}
+		offset += time.Hour
+		assertions.Zero(deliver())
+	})
+
+	t.Run("Redeliver", func(t *testing.T) {
+		receiver.fail.Store(false)
+
+		delivery, err := apiClient.RedeliverWebhook(ctx, subscription.ID, failedDelivery.ID)
+		checkNoError(t, err)
+		assertions.Equal(api.WebhookDeliveryPending, delivery.Status)
+
+		assertions.Equal(1, deliver())
+		_, body := receiver.last()
+		assertions.Contains(string(body), api.WebhookEventStepDeleted)
+
+		_, err = apiClient.RedeliverWebhook(ctx, subscription.ID, 0)
+		checkFailsWithError(t, err, http.StatusNotFound, "Delivery not found.")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		checkNoError(t, apiClient.DeleteWebhook(ctx, subscription.ID))
+
+		_, err := apiClient.GetWebhook(ctx, subscription.ID)
+		checkFailsWithError(t, err, http.StatusNotFound, "Webhook not found.")
+	})
+}
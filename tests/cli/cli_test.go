@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/cli"
+	"github.com/sitetester/sequence-api/config"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const dbPath = "../../db/sequences_cli_test.db"
+
+func run(t *testing.T, args ...string) string {
+	var stdout bytes.Buffer
+	if err := cli.Run(append([]string{"--db", dbPath}, args...), &stdout); err != nil {
+		t.Fatalf("%v failed: %v", args, err)
+	}
+	return stdout.String()
+}
+
+func runFails(t *testing.T, args ...string) error {
+	var stdout bytes.Buffer
+	err := cli.Run(append([]string{"--db", dbPath}, args...), &stdout)
+	if err == nil {
+		t.Fatalf("%v expected to fail", args)
+	}
+	return err
+}
+
+// Will run sequentially
+func TestCli(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assertions := assert.New(t)
+
+	run(t, "migrate")
+	db := config.SetupDb(dbPath)
+	var previous api.Sequence
+	if db.Where("name = ?", "CliSequence1").Find(&previous).RowsAffected > 0 {
+		db.Where("sequence_id = ?", previous.ID).Delete(&api.SequenceStep{})
+		db.Delete(&previous)
+	}
+
+	var sequence api.Sequence
+	t.Run("SequencesCreate", func(t *testing.T) {
+		var created []api.Sequence
+		json.Unmarshal([]byte(run(t, "--output", "json", "sequences", "create", "--name", "CliSequence1", "--open-tracking")), &created)
+		if assertions.Len(created, 1) {
+			sequence = created[0]
+		}
+		assertions.True(sequence.OpenTrackingEnabled)
+
+		err := runFails(t, "sequences", "create", "--name", "CliSequence1")
+		assertions.Contains(err.Error(), "Name already assigned")
+	})
+
+	sequenceID := fmt.Sprint(sequence.ID)
+	var stepID string
+	t.Run("Steps", func(t *testing.T) {
+		var created []api.SequenceStep
+		json.Unmarshal([]byte(run(t, "--output", "json", "steps", "add", "--sequence", sequenceID, "--subject", "Intro", "--content", "Hello there")), &created)
+		stepID = fmt.Sprint(created[0].ID)
+
+		// flags after the positional ID, only given flags are changed
+		output := run(t, "steps", "edit", stepID, "--wait-days", "2")
+		assertions.Contains(output, "Intro")
+
+		err := runFails(t, "steps", "edit", stepID, "--content", "a")
+		assertions.Contains(err.Error(), "minstringlength(3)")
+	})
+
+	t.Run("SequencesGetAndList", func(t *testing.T) {
+		output := run(t, "sequences", "get", sequenceID)
+		assertions.Contains(output, "CliSequence1")
+		assertions.Contains(output, "Intro")
+
+		assertions.Contains(run(t, "sequences", "list"), "CliSequence1")
+	})
+
+	t.Run("ExportAndImport", func(t *testing.T) {
+		output := run(t, "export", sequenceID, "--format", "yaml")
+		assertions.Contains(output, "waitDays: 2")
+
+		file := filepath.Join(t.TempDir(), "sequence.yaml")
+		os.WriteFile(file, []byte(strings.Replace(output, "Hello there", "Hello again", 1)), 0644)
+
+		assertions.Contains(run(t, "import", file, "--dry-run"), `(dry run) update sequence`)
+		assertions.Contains(run(t, "import", file), `update step "Intro"`)
+		assertions.Contains(run(t, "import", file), "unchanged")
+	})
+
+	t.Run("Remote", func(t *testing.T) {
+		server := httptest.NewServer(config.SetupRouter(db))
+		defer server.Close()
+
+		output := run(t, "apikey", "create", "--name", "cli test")
+		rawKey := strings.TrimPrefix(findLine(output, "Key: "), "Key: ")
+		assertions.NotEmpty(rawKey)
+
+		assertions.Contains(run(t, "--remote", server.URL, "--api-key", rawKey, "sequences", "get", sequenceID), "Intro")
+
+		err := runFails(t, "--remote", server.URL, "--api-key", "sk_invalid", "sequences", "list")
+		assertions.Contains(err.Error(), "Invalid API key.")
+
+		assertions.Contains(run(t, "--remote", server.URL, "--api-key", rawKey, "steps", "rm", "--force", stepID), "Deleted step")
+		assertions.Contains(run(t, "--remote", server.URL, "sequences", "delete", sequenceID), "Deleted sequence")
+
+		err = runFails(t, "--remote", server.URL, "sequences", "get", sequenceID)
+		assertions.Contains(err.Error(), "Sequence not found.")
+	})
+
+	t.Run("FailsForUnknownCommand", func(t *testing.T) {
+		assertions.Contains(runFails(t, "sequences", "purge").Error(), "unknown subcommand")
+		assertions.Contains(runFails(t, "--output", "xml", "sequences", "list").Error(), "unsupported output format")
+	})
+}
+
+func findLine(output string, prefix string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/client"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first `failures` requests with 503, then responds with `api.Sequence`
+func flakyServer(failures int32, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.Sequence{ID: 7, Name: "Sequence7"})
+	}))
+}
+
+func TestClient(t *testing.T) {
+	assertions := assert.New(t)
+	ctx := context.Background()
+
+	t.Run("RetriesIdempotentRequests", func(t *testing.T) {
+		var calls int32
+		server := flakyServer(2, &calls)
+		defer server.Close()
+
+		c := client.New(server.URL, client.WithRetries(3, time.Millisecond))
+		err := c.UpdateSequence(ctx, 7, api.Sequence{Name: "Sequence7"})
+		assertions.NoError(err)
+		assertions.Equal(int32(3), calls)
+	})
+
+	t.Run("GivesUpAfterMaxRetries", func(t *testing.T) {
+		var calls int32
+		server := flakyServer(10, &calls)
+		defer server.Close()
+
+		c := client.New(server.URL, client.WithRetries(2, time.Millisecond))
+		_, err := c.GetSequence(ctx, 7)
+		var apiErr *client.Error
+		assertions.True(errors.As(err, &apiErr))
+		assertions.Equal(http.StatusServiceUnavailable, apiErr.StatusCode)
+		assertions.Equal(int32(3), calls)
+	})
+
+	t.Run("DoesNotRetryPost", func(t *testing.T) {
+		var calls int32
+		server := flakyServer(1, &calls)
+		defer server.Close()
+
+		c := client.New(server.URL, client.WithRetries(3, time.Millisecond))
+		_, err := c.CreateSequence(ctx, api.Sequence{Name: "Sequence7"})
+		assertions.Error(err)
+		assertions.Equal(int32(1), calls)
+	})
+
+	t.Run("StopsOnCancelledContext", func(t *testing.T) {
+		var calls int32
+		server := flakyServer(10, &calls)
+		defer server.Close()
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		c := client.New(server.URL, client.WithRetries(3, time.Hour))
+		_, err := c.GetSequence(cancelled, 7)
+		assertions.ErrorIs(err, context.Canceled)
+	})
+
+	t.Run("MapsErrorResponse", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assertions.Equal("secret", r.Header.Get("X-Api-Key"))
+			assertions.Equal("request-1", r.Header.Get("X-Request-Id"))
+			assertions.Equal("/v1/sequences/7", r.URL.Path)
+
+			w.Header().Set("X-Request-Id", "request-1")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(api.ErrorResponse{Error: "Sequence not found."})
+		}))
+		defer server.Close()
+
+		c := client.New(server.URL, client.WithAPIKey("secret"))
+		_, err := c.GetSequence(client.WithRequestID(ctx, "request-1"), 7)
+
+		assertions.ErrorIs(err, client.ErrNotFound)
+		assertions.NotErrorIs(err, client.ErrConflict)
+
+		var apiErr *client.Error
+		if assertions.True(errors.As(err, &apiErr)) {
+			assertions.Equal("Sequence not found.", apiErr.Message)
+			assertions.Equal("request-1", apiErr.RequestID)
+			assertions.Equal("404 Not Found: Sequence not found.", apiErr.Error())
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package grpc
+
+import (
+	"context"
+	"github.com/sitetester/sequence-api/api"
+	"github.com/sitetester/sequence-api/api/grpcapi"
+	"github.com/sitetester/sequence-api/api/grpcapi/pb"
+	"github.com/sitetester/sequence-api/api/service"
+	"github.com/sitetester/sequence-api/config"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func checkNoError(t *testing.T, err error) {
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func checkFailsWithCode(t *testing.T, err error, code codes.Code, msg string) {
+	statusErr, ok := status.FromError(err)
+	if !ok || statusErr.Code() != code {
+		t.Fatalf("Expected %s, got %v", code, err)
+	}
+	assert.Contains(t, statusErr.Message(), msg)
+}
+
+// dial serves the API over an in-memory listener (no network involved)
+func dial(t *testing.T) *grpc.ClientConn {
+	db := config.SetupDb("../../db/sequences_grpc_test.db")
+	server := grpcapi.NewServer(db)
+	listener := bufconn.Listen(1024 * 1024)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	checkNoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	// clean up leftovers of a previous run
+	db.Where("1 = 1").Delete(&api.SequenceStep{})
+	db.Where("1 = 1").Delete(&api.Sequence{})
+	return conn
+}
+
+// Will run sequentially
+func TestGrpc(t *testing.T) {
+	assertions := assert.New(t)
+	conn := dial(t)
+	sequences := pb.NewSequenceServiceClient(conn)
+	steps := pb.NewSequenceStepsServiceClient(conn)
+	ctx := context.Background()
+
+	var sequenceID uint64
+	t.Run("CreateSequence", func(t *testing.T) {
+		t.Run("FailsForNameMinLengthValidation", func(t *testing.T) {
+			_, err := sequences.CreateSequence(ctx, &pb.Sequence{Name: "a"})
+			checkFailsWithCode(t, err, codes.InvalidArgument, "minstringlength(3)")
+		})
+
+		t.Run("Success", func(t *testing.T) {
+			var header metadata.MD
+			requestCtx := metadata.AppendToOutgoingContext(ctx, "x-request-id", "grpc-request-1")
+			created, err := sequences.CreateSequence(requestCtx, &pb.Sequence{Name: "GrpcSequence1", ClickTrackingEnabled: true}, grpc.Header(&header))
+			checkNoError(t, err)
+			assertions.NotZero(created.Id)
+			assertions.Equal([]string{"grpc-request-1"}, header.Get("x-request-id"))
+			sequenceID = created.Id
+		})
+
+		t.Run("FailsForDuplicateName", func(t *testing.T) {
+			_, err := sequences.CreateSequence(ctx, &pb.Sequence{Name: "GrpcSequence1"})
+			checkFailsWithCode(t, err, codes.AlreadyExists, "Name already assigned")
+		})
+	})
+
+	t.Run("UpdateSequence", func(t *testing.T) {
+		updated, err := sequences.UpdateSequence(ctx, &pb.UpdateSequenceRequest{
+			Id:       sequenceID,
+			Sequence: &pb.Sequence{Name: "GrpcSequence2", OpenTrackingEnabled: true},
+		})
+		checkNoError(t, err)
+		assertions.Equal("GrpcSequence2", updated.Name)
+		assertions.True(updated.OpenTrackingEnabled)
+	})
+
+	t.Run("Steps", func(t *testing.T) {
+		for _, subject := range []string{"Step1", "Step2", "Step3"} {
+			_, err := steps.CreateStep(ctx, &pb.SequenceStep{SequenceId: sequenceID, Subject: subject, Content: "blah contents"})
+			checkNoError(t, err)
+		}
+
+		_, err := steps.CreateStep(ctx, &pb.SequenceStep{SequenceId: sequenceID, Subject: "Step1", Content: "blah contents"})
+		checkFailsWithCode(t, err, codes.AlreadyExists, "Subject already taken.")
+
+		stream, err := steps.ListSteps(ctx, &pb.ListStepsRequest{SequenceId: sequenceID})
+		checkNoError(t, err)
+		var subjects []string
+		for {
+			step, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			checkNoError(t, err)
+			subjects = append(subjects, step.Subject)
+		}
+		assertions.Equal([]string{"Step1", "Step2", "Step3"}, subjects)
+
+		stream, err = steps.ListSteps(ctx, &pb.ListStepsRequest{SequenceId: 0})
+		checkNoError(t, err)
+		_, err = stream.Recv()
+		checkFailsWithCode(t, err, codes.NotFound, "Sequence not found.")
+	})
+
+	t.Run("GetSequence", func(t *testing.T) {
+		sequenceWithSteps, err := sequences.GetSequence(ctx, &pb.IDRequest{Id: sequenceID})
+		checkNoError(t, err)
+		assertions.Len(sequenceWithSteps.Steps, 3)
+
+		_, err = sequences.GetSequence(ctx, &pb.IDRequest{Id: 0})
+		checkFailsWithCode(t, err, codes.NotFound, "Sequence not found.")
+	})
+
+	t.Run("UpdateNonEmailStep", func(t *testing.T) {
+		waitUntil := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+		created, err := steps.CreateStep(ctx, &pb.SequenceStep{SequenceId: sequenceID, Subject: "Hold", Type: api.StepTypeWaitUntil, WaitUntil: timestamppb.New(waitUntil), Position: 7})
+		checkNoError(t, err)
+
+		// without mask, the populated fields are updated
+		updated, err := steps.UpdateStep(ctx, &pb.UpdateStepRequest{Id: created.Id, Step: &pb.SequenceStep{Subject: "Hold on"}})
+		checkNoError(t, err)
+		assertions.Equal("Hold on", updated.Subject)
+		assertions.Equal(api.StepTypeWaitUntil, updated.Type)
+		assertions.True(waitUntil.Equal(updated.WaitUntil.AsTime()))
+		assertions.Equal(uint32(7), updated.Position)
+
+		// zero values are set through the mask
+		updated, err = steps.UpdateStep(ctx, &pb.UpdateStepRequest{Id: created.Id, Step: &pb.SequenceStep{}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"position"}}})
+		checkNoError(t, err)
+		assertions.Zero(updated.Position)
+		assertions.Equal("Hold on", updated.Subject)
+
+		// changing the type clears the fields of the previous one
+		updated, err = steps.UpdateStep(ctx, &pb.UpdateStepRequest{Id: created.Id, Step: &pb.SequenceStep{Type: api.StepTypeHTTPCall, Url: "https://crm.example.com/hook"}})
+		checkNoError(t, err)
+		assertions.Nil(updated.WaitUntil)
+		assertions.Equal("POST", updated.Method)
+
+		_, err = steps.UpdateStep(ctx, &pb.UpdateStepRequest{Id: created.Id, Step: &pb.SequenceStep{}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"sequence_id"}}})
+		checkFailsWithCode(t, err, codes.InvalidArgument, "update_mask: sequence_id can't be updated")
+	})
+
+	t.Run("ListSequences", func(t *testing.T) {
+		response, err := sequences.ListSequences(ctx, &emptypb.Empty{})
+		checkNoError(t, err)
+		assertions.Len(response.Sequences, 1)
+	})
+
+	t.Run("DeleteStep", func(t *testing.T) {
+		created, err := steps.CreateStep(ctx, &pb.SequenceStep{SequenceId: sequenceID, Subject: "Step4", Content: "blah contents"})
+		checkNoError(t, err)
+
+		db := config.SetupDb("../../db/sequences_grpc_test.db")
+		db.Model(&api.Sequence{}).Where("id = ?", sequenceID).Update("status", api.SequenceActive)
+		sequenceWithSteps, err := sequences.GetSequence(ctx, &pb.IDRequest{Id: sequenceID})
+		checkNoError(t, err)
+		assertions.Equal(api.SequenceActive, sequenceWithSteps.Sequence.Status)
+
+		_, err = steps.DeleteStep(ctx, &pb.DeleteStepRequest{Id: created.Id})
+		checkFailsWithCode(t, err, codes.FailedPrecondition, "Sequence is active, its steps are only deleted with force.")
+
+		_, err = steps.DeleteStep(ctx, &pb.DeleteStepRequest{Id: created.Id, Force: true})
+		checkNoError(t, err)
+		_, err = steps.GetStep(ctx, &pb.IDRequest{Id: created.Id})
+		checkFailsWithCode(t, err, codes.NotFound, "Step not found.")
+	})
+
+	t.Run("DeleteSequence", func(t *testing.T) {
+		_, err := sequences.DeleteSequence(ctx, &pb.IDRequest{Id: sequenceID})
+		checkNoError(t, err)
+
+		_, err = sequences.DeleteSequence(ctx, &pb.IDRequest{Id: sequenceID})
+		checkFailsWithCode(t, err, codes.NotFound, "Sequence not found.")
+	})
+}
+
+func TestGrpcAuth(t *testing.T) {
+	conn := dial(t)
+	sequences := pb.NewSequenceServiceClient(conn)
+	steps := pb.NewSequenceStepsServiceClient(conn)
+
+	t.Run("RejectsInvalidApiKey", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "sk_invalid")
+		_, err := sequences.ListSequences(ctx, &emptypb.Empty{})
+		checkFailsWithCode(t, err, codes.Unauthenticated, "Invalid API key.")
+
+		stream, err := steps.ListSteps(ctx, &pb.ListStepsRequest{})
+		checkNoError(t, err)
+		_, err = stream.Recv()
+		checkFailsWithCode(t, err, codes.Unauthenticated, "Invalid API key.")
+	})
+
+	t.Run("AuditsApiKeyActor", func(t *testing.T) {
+		db := config.SetupDb("../../db/sequences_grpc_test.db")
+		rawKey, apiKey := (&service.ApiKeyService{Db: db}).Create("grpc")
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", rawKey)
+
+		created, err := sequences.CreateSequence(ctx, &pb.Sequence{Name: "GrpcAudited"})
+		checkNoError(t, err)
+
+		records := (&service.AuditService{Db: db}).List(service.AuditFilter{Entity: api.AuditEntitySequence, EntityID: uint(created.Id)})
+		if assert.NotEmpty(t, records) {
+			assert.Equal(t, "apikey:"+apiKey.Prefix, records[len(records)-1].Actor)
+		}
+	})
+}